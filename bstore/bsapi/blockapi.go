@@ -17,6 +17,9 @@ type SaveBlockParams struct {
     BlockType   int64           `msgpack:"blockType"    json:"blockType"`
     BlockId     int64           `msgpack:"blockId"      json:"blockId"`
     BlockSize   int64           `msgpack:"blockSize"    json:"blockSize"`
+    HashAlg     string          `msgpack:"hashAlg"      json:"hashAlg"`
+    HashInit    string          `msgpack:"hashInit"     json:"hashInit"`
+    HashSum     string          `msgpack:"hashSum"      json:"hashSum"`
 }
 
 type SaveBlockResult struct {
@@ -5,6 +5,10 @@
 
 package bsapi
 
+import (
+    "dstore/dscomm/dsdescr"
+)
+
 const GetStatusMethod string = "getStatus"
 
 type GetStatusParams struct {
@@ -23,3 +27,36 @@ func NewGetStatusResult() *GetStatusResult {
 func NewGetStatusParams() *GetStatusParams {
     return &GetStatusParams{}
 }
+
+const ScrubStatusMethod string = "scrubStatus"
+
+type ScrubStatusParams struct {
+}
+
+type ScrubStatusResult struct {
+    Status  *dsdescr.ScrubStatus    `json:"status"    msgpack:"status"`
+}
+
+func NewScrubStatusResult() *ScrubStatusResult {
+    return &ScrubStatusResult{}
+}
+func NewScrubStatusParams() *ScrubStatusParams {
+    return &ScrubStatusParams{}
+}
+
+const RunGCMethod string = "runGC"
+
+type RunGCParams struct {
+    DryRun  bool                    `json:"dryRun"    msgpack:"dryRun"`
+}
+
+type RunGCResult struct {
+    Report  *dsdescr.GCReport       `json:"report"    msgpack:"report"`
+}
+
+func NewRunGCResult() *RunGCResult {
+    return &RunGCResult{}
+}
+func NewRunGCParams() *RunGCParams {
+    return &RunGCParams{}
+}
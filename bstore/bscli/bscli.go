@@ -23,15 +23,55 @@ func main() {
     var err error
     util := NewUtil()
     err = util.Exec()
-    if err != nil {
+    if err != nil && !util.reported {
         fmt.Printf("Exec error: %s\n", err)
     }
+    os.Exit(exitCode(err))
+}
+
+// Exit codes tell the kind of the error of the call,
+// code 2 is left for wrong options
+const (
+    exitOK              int = 0
+    exitError           int = 1
+    exitNotFound        int = 3
+    exitExists          int = 4
+    exitUnauthorized    int = 5
+    exitForbidden       int = 6
+    exitQuotaExceeded   int = 7
+    exitCorrupt         int = 8
+)
+
+func exitCode(err error) int {
+    if err == nil {
+        return exitOK
+    }
+    switch {
+        case errors.Is(err, dsrpc.ErrNotFound):
+            return exitNotFound
+        case errors.Is(err, dsrpc.ErrExists):
+            return exitExists
+        case errors.Is(err, dsrpc.ErrUnauthorized):
+            return exitUnauthorized
+        case errors.Is(err, dsrpc.ErrForbidden):
+            return exitForbidden
+        case errors.Is(err, dsrpc.ErrQuotaExceeded):
+            return exitQuotaExceeded
+        case errors.Is(err, dsrpc.ErrCorrupt):
+            return exitCorrupt
+    }
+    return exitError
 }
 
 type Util struct {
     aLogin      string
     aPass       string
 
+    TLS         bool
+    CAPath      string
+    CertPath    string
+    KeyPath     string
+
     Port        string
     Address     string
     Message     string
@@ -50,6 +90,9 @@ type Util struct {
     BlockType   int64
 
     FilePath   string
+    DryRun     bool
+
+    reported    bool
 }
 
 func NewUtil() *Util {
@@ -63,6 +106,8 @@ func NewUtil() *Util {
 }
 
 const getStatusCmd      string = "getStatus"
+const scrubStatusCmd    string = "scrubStatus"
+const runGCCmd          string = "runGC"
 
 const saveBlockCmd      string = "saveBlock"
 const loadBlockCmd      string = "loadBlock"
@@ -88,12 +133,16 @@ func (util *Util) GetOpt() error {
     flag.StringVar(&util.Address, "address", util.Address, "service address")
     flag.StringVar(&util.aLogin, "aLogin", util.aLogin, "access login")
     flag.StringVar(&util.aPass, "aPass", util.aPass, "access password")
+    flag.BoolVar(&util.TLS, "tls", util.TLS, "use tls connection")
+    flag.StringVar(&util.CAPath, "ca", util.CAPath, "ca certificate file, system roots by default")
+    flag.StringVar(&util.CertPath, "cert", util.CertPath, "client certificate file for mutual tls")
+    flag.StringVar(&util.KeyPath, "key", util.KeyPath, "client key file for mutual tls")
 
     help := func() {
         fmt.Println("")
         fmt.Printf("Usage: %s [option] command [command option]\n", exeName)
         fmt.Printf("\n")
-        fmt.Printf("Command list: help, getStatus, \n")
+        fmt.Printf("Command list: help, getStatus, scrubStatus, runGC, \n")
         fmt.Printf("    saveBlock, loadBlock, listBlocks, deleteBlock \n")
         fmt.Printf("    addUser, checkUser, updateUser, listUsers, deleteUser \n")
 
@@ -121,7 +170,7 @@ func (util *Util) GetOpt() error {
         case helpCmd:
             help()
             return errors.New("unknown command")
-        case getStatusCmd:
+        case getStatusCmd, scrubStatusCmd:
             flagSet := flag.NewFlagSet(getStatusCmd, flag.ExitOnError)
             flagSet.Usage = func() {
                 fmt.Printf("\n")
@@ -133,6 +182,19 @@ func (util *Util) GetOpt() error {
             }
             flagSet.Parse(subArgs)
             util.SubCmd = subCmd
+        case runGCCmd:
+            flagSet := flag.NewFlagSet(runGCCmd, flag.ExitOnError)
+            flagSet.BoolVar(&util.DryRun, "dryRun", util.DryRun, "only report the garbage")
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
 
         case saveBlockCmd, loadBlockCmd, deleteBlockCmd:
             flagSet := flag.NewFlagSet(saveBlockCmd, flag.ExitOnError)
@@ -216,20 +278,24 @@ func (util *Util) GetOpt() error {
 type Response struct {
     Error       bool       `json:"error"`
     ErrorMsg    string     `json:"errorMsg,omitempty"`
+    ErrorCode   string     `json:"errorCode,omitempty"`
     Result      any        `json:"result,omitempty"`
 }
 
 func NewResponse(result any, err error) *Response {
     var errMsg string
+    var errCode string
     var errBool bool
     if err != nil {
         errMsg = err.Error()
+        errCode = dsrpc.ErrorCode(err).String()
         errBool = true
     }
     return &Response{
         Result:     result,
         Error:      errBool,
         ErrorMsg:   errMsg,
+        ErrorCode:  errCode,
     }
 }
 
@@ -240,6 +306,13 @@ func (util *Util) Exec() error {
         return err
     }
     util.URI = fmt.Sprintf("%s:%s", util.Address, util.Port)
+    if util.TLS {
+        tlsConfig, err := dsrpc.NewClientTLSConfig(util.CAPath, util.CertPath, util.KeyPath)
+        if err != nil {
+            return err
+        }
+        dsrpc.SetClientTLS(tlsConfig)
+    }
     auth := dsrpc.CreateAuth([]byte(util.aLogin), []byte(util.aPass))
 
     resp := NewResponse(nil, nil)
@@ -248,6 +321,10 @@ func (util *Util) Exec() error {
     switch util.SubCmd {
         case getStatusCmd:
             result, err = util.GetStatusCmd(auth)
+        case scrubStatusCmd:
+            result, err = util.ScrubStatusCmd(auth)
+        case runGCCmd:
+            result, err = util.RunGCCmd(auth)
 
         case saveBlockCmd:
             result, err = util.SaveBlockCmd(auth)
@@ -275,7 +352,8 @@ func (util *Util) Exec() error {
     resp = NewResponse(result, err)
     respJSON, _ := json.MarshalIndent(resp, "", "  ")
     fmt.Printf("%s\n", string(respJSON))
-    err = nil
+    // The error is printed with the response, the exit code tells its kind
+    util.reported = true
     return err
 }
 
@@ -290,6 +368,29 @@ func (util *Util) GetStatusCmd(auth *dsrpc.Auth) (*bsapi.GetStatusResult, error)
     return result, err
 }
 
+func (util *Util) ScrubStatusCmd(auth *dsrpc.Auth) (*bsapi.ScrubStatusResult, error) {
+    var err error
+    params := bsapi.NewScrubStatusParams()
+    result := bsapi.NewScrubStatusResult()
+    err = dsrpc.Exec(util.URI, bsapi.ScrubStatusMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) RunGCCmd(auth *dsrpc.Auth) (*bsapi.RunGCResult, error) {
+    var err error
+    params := bsapi.NewRunGCParams()
+    params.DryRun = util.DryRun
+    result := bsapi.NewRunGCResult()
+    err = dsrpc.Exec(util.URI, bsapi.RunGCMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
 func (util *Util) SaveBlockCmd(auth *dsrpc.Auth) (*bsapi.SaveBlockResult, error) {
     var err error
 
@@ -11,11 +11,14 @@ import (
     "dstore/dscomm/dserr"
 )
 
+// Calls of fstore to one bstore share the connection
+var pool = dsrpc.NewPool()
+
 func GetStatus(uri string, auth *dsrpc.Auth) error {
     var err error
     params := bsapi.NewGetStatusParams()
     result := bsapi.NewGetStatusResult()
-    err = dsrpc.Exec(uri, bsapi.GetStatusMethod, params, result, auth)
+    err = pool.Exec(uri, bsapi.GetStatusMethod, params, result, auth)
     if err != nil {
         return dserr.Err(err)
     }
@@ -31,13 +34,12 @@ func SaveBlock(uri string, auth *dsrpc.Auth, descr *dsdescr.Block, blockReader i
     params.BlockId      = descr.BlockId
 
     params.BlockSize    = descr.BlockSize
-    //params.DataSize     = descr.DataSize
-    //params.HashAlg      = descr.HashAlg
-    //params.HashInit     = descr.HashInit
-    //params.HashSum      = descr.HashSum
+    params.HashAlg      = descr.HashAlg
+    params.HashInit     = descr.HashInit
+    params.HashSum      = descr.HashSum
     result := bsapi.NewSaveBlockResult()
 
-    err = dsrpc.Put(uri, bsapi.SaveBlockMethod, blockReader, binSize, params, result, auth)
+    err = pool.Put(uri, bsapi.SaveBlockMethod, blockReader, binSize, params, result, auth)
     if err != nil {
         return dserr.Err(err)
     }
@@ -53,7 +55,7 @@ func LoadBlock(uri string, auth *dsrpc.Auth, fileId, batchId, blockType, blockId
     params.BlockId      = blockId
 
     result := bsapi.NewLoadBlockResult()
-    err = dsrpc.Get(uri, bsapi.LoadBlockMethod, blockWriter, params, result, auth)
+    err = pool.Get(uri, bsapi.LoadBlockMethod, blockWriter, params, result, auth)
     if err != nil {
         return dserr.Err(err)
     }
@@ -66,7 +68,7 @@ func ListBlocks(uri string, auth *dsrpc.Auth, fileId int64) ([]*dsdescr.Block, e
     params := bsapi.NewListBlocksParams()
     params.FileId = fileId
     result := bsapi.NewListBlocksResult()
-    err = dsrpc.Exec(uri, bsapi.ListBlocksMethod, params, result, auth)
+    err = pool.Exec(uri, bsapi.ListBlocksMethod, params, result, auth)
     if err != nil {
         return blockDescrs, dserr.Err(err)
     }
@@ -83,7 +85,7 @@ func DeleteBlock(uri string, auth *dsrpc.Auth, fileId, batchId, blockType, block
     params.BlockId      = blockId
 
     result := bsapi.NewDeleteBlockResult()
-    err = dsrpc.Exec(uri, bsapi.DeleteBlockMethod, params, result, auth)
+    err = pool.Exec(uri, bsapi.DeleteBlockMethod, params, result, auth)
     if err != nil {
         return dserr.Err(err)
     }
@@ -5,6 +5,7 @@
 package bsblock
 
 import (
+    "bytes"
     "fmt"
     "io"
     "time"
@@ -27,6 +28,10 @@ type Block struct {
     dataSize    int64
     createdAt   int64
     updatedAt   int64
+
+    hashAlg     string
+    hashInit    string
+    hashSum     string
 }
 
 func NewBlock(baseDir string, fileId, batchId, blockType, blockId, blockSize int64) (*Block, error) {
@@ -64,10 +69,23 @@ func OpenBlock(baseDir string, descr *dsdescr.Block) (*Block, error) {
 
     block.createdAt = descr.CreatedAt
     block.updatedAt = descr.UpdatedAt
+
+    block.hashAlg   = descr.HashAlg
+    block.hashInit  = descr.HashInit
+    block.hashSum   = descr.HashSum
     return &block, dserr.Err(err)
 }
 
 
+func (block *Block) SetHashInit(hashAlg, hashInit string) {
+    block.hashAlg   = hashAlg
+    block.hashInit  = hashInit
+}
+
+func (block *Block) HashSum() string {
+    return block.hashSum
+}
+
 func (block *Block) Write(reader io.Reader, dataSize int64) (int64, error) {
     var err error
     var wrSize int64
@@ -87,28 +105,43 @@ func (block *Block) Write(reader io.Reader, dataSize int64) (int64, error) {
         err = fmt.Errorf("block write error: %s", err)
         return wrSize, dserr.Err(err)
     }
+    // Hash covers whole crate content, old data included
+    hashAlg  := block.hashAlg
+    hashInit := block.hashInit
+    if hashAlg == "" || block.dataSize > 0 {
+        hashAlg  = dsdescr.HashSHA256
+        hashInit = newHashInit()
+    }
+    hasher, err := newHasher(hashAlg, hashInit)
+    if err != nil {
+        writer.Clean()
+        return wrSize, dserr.Err(err)
+    }
+    hWriter := io.MultiWriter(writer, hasher)
 
     var origin dsinter.Crate
     if block.dataSize > 0 {
-        var wrSize int64
-        reader, err := OpenCrate(block.baseDir, block.filePath, RDONLY)
-        defer reader.Close()
+        pReader, err := OpenCrate(block.baseDir, block.filePath, RDONLY)
+        defer pReader.Close()
         if err != nil {
+            writer.Clean()
             err = fmt.Errorf("block recopy error: %s", err)
             return wrSize, dserr.Err(err)
         }
-        wrSize, err = copyData(reader, writer, block.dataSize)
+        recopySize, err := copyData(pReader, hWriter, block.dataSize)
         if err != nil {
+            writer.Clean()
             err = fmt.Errorf("block recopy error: %s", err)
             return wrSize, dserr.Err(err)
         }
-        if wrSize != dataSize {
-            err = fmt.Errorf("block recopy only %d", wrSize)
+        if recopySize != block.dataSize {
+            writer.Clean()
+            err = fmt.Errorf("block recopy only %d", recopySize)
             return wrSize, dserr.Err(err)
         }
-        origin = reader
+        origin = pReader
     }
-    wrSize, err = copyData(reader, writer, dataSize)
+    wrSize, err = copyData(reader, hWriter, dataSize)
     if err != nil {
         writer.Clean()
         err = fmt.Errorf("block copy error: %s", err)
@@ -122,6 +155,9 @@ func (block *Block) Write(reader io.Reader, dataSize int64) (int64, error) {
     block.updatedAt = time.Now().Unix()
     block.filePath  = newPath
     block.dataSize += wrSize
+    block.hashAlg   = hashAlg
+    block.hashInit  = hashInit
+    block.hashSum   = hashSum(hasher)
     if origin != nil {
         origin.Clean()
     }
@@ -132,7 +168,7 @@ func (block *Block) Read(writer io.Writer, dataSize int64) (int64, error) {
     var err error
     var readSize int64
 
-    if dataSize < 1 {
+    if dataSize < 1 || block.dataSize < 1 {
         return readSize, dserr.Err(err)
     }
 
@@ -142,18 +178,63 @@ func (block *Block) Read(writer io.Writer, dataSize int64) (int64, error) {
         err = fmt.Errorf("block read error: %s", err)
         return readSize, dserr.Err(err)
     }
-
-    readSize, err = copyData(reader, writer, block.dataSize)
+    // Whole block is checked before output, bad data is never sent
+    buffer := bytes.NewBuffer(make([]byte, 0, block.dataSize))
+    bufSize, err := copyData(reader, buffer, block.dataSize)
     if err != nil {
         err = fmt.Errorf("block recopy error: %s", err)
         return readSize, dserr.Err(err)
     }
-    if readSize != block.dataSize {
-        err = fmt.Errorf("block recopy only %d", readSize)
+    if bufSize != block.dataSize {
+        err = fmt.Errorf("block recopy only %d", bufSize)
+        return readSize, dserr.Err(err)
+    }
+    err = block.verify(buffer.Bytes())
+    if err != nil {
+        return readSize, dserr.Err(err)
+    }
+    written, err := writer.Write(buffer.Bytes())
+    readSize = int64(written)
+    if err != nil {
+        err = fmt.Errorf("block write error: %s", err)
+        return readSize, dserr.Err(err)
     }
     return readSize, dserr.Err(err)
 }
 
+func (block *Block) HasCrate() bool {
+    size, err := crateSize(block.baseDir, block.filePath)
+    if err != nil {
+        return false
+    }
+    return size == block.dataSize
+}
+
+func (block *Block) Verify() error {
+    var err error
+    _, err = block.Read(io.Discard, block.dataSize)
+    return dserr.Err(err)
+}
+
+func (block *Block) verify(data []byte) error {
+    var err error
+    // Blocks written before hashing was introduced have no sum
+    if block.hashAlg == "" {
+        return dserr.Err(err)
+    }
+    hasher, err := newHasher(block.hashAlg, block.hashInit)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    hasher.Write(data)
+    if hashSum(hasher) != block.hashSum {
+        err = dserr.NewCorruptError("block %d,%d,%d,%d hash mismatch",
+                                block.fileId, block.batchId, block.blockType, block.blockId)
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
 func (block *Block) Descr() *dsdescr.Block {
     descr := dsdescr.NewBlock()
 
@@ -168,6 +249,10 @@ func (block *Block) Descr() *dsdescr.Block {
 
     descr.CreatedAt = block.createdAt
     descr.UpdatedAt = block.updatedAt
+
+    descr.HashAlg   = block.hashAlg
+    descr.HashInit  = block.hashInit
+    descr.HashSum   = block.hashSum
     return descr
 }
 
@@ -186,6 +271,9 @@ func (block *Block) Clean() error {
     }
     block.dataSize = 0
     block.filePath = newFilePath()
+    block.hashAlg  = ""
+    block.hashInit = ""
+    block.hashSum  = ""
 
     return dserr.Err(err)
 }
@@ -7,10 +7,14 @@ package bsblock
 import(
     "bytes"
     "math/rand"
+    "os"
+    "path/filepath"
     "testing"
 
     "github.com/stretchr/testify/require"
 
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
     "dstore/dscomm/dskvdb"
     "dstore/bstore/bssrv/bsreg"
 )
@@ -66,3 +70,41 @@ func TestBlock01(t *testing.T) {
     err = reg.DeleteBlock(block.fileId, block.batchId, block.blockType, block.blockId)
     require.NoError(t, err)
 }
+
+func TestBlock02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    var blockSize   int64 = 1024 * 64
+    block, err := NewBlock(dataDir, 1, 2, 1, 4, blockSize)
+    require.NoError(t, err)
+
+    buffer := make([]byte, blockSize)
+    rand.Read(buffer)
+    _, err = block.Write(bytes.NewReader(buffer), blockSize)
+    require.NoError(t, err)
+
+    descr := block.Descr()
+    require.Equal(t, dsdescr.HashSHA256, descr.HashAlg)
+    require.NotEqual(t, "", descr.HashInit)
+    require.NotEqual(t, "", descr.HashSum)
+
+    // Flip one byte inside the crate
+    fullPath := filepath.Join(dataDir, descr.FilePath)
+    data, err := os.ReadFile(fullPath)
+    require.NoError(t, err)
+    data[blockSize / 2] ^= 0xff
+    err = os.WriteFile(fullPath, data, 0644)
+    require.NoError(t, err)
+
+    block, err = OpenBlock(dataDir, descr)
+    require.NoError(t, err)
+
+    writer := bytes.NewBuffer(nil)
+    readSize, err := block.Read(writer, blockSize)
+    require.Error(t, err)
+    require.True(t, dserr.IsCorrupt(err))
+    require.Equal(t, int64(0), readSize)
+    require.Equal(t, 0, writer.Len())
+}
@@ -6,8 +6,11 @@ package bsblock
 
 import (
     "fmt"
+    "io/fs"
     "path/filepath"
     "os"
+    "regexp"
+    "strings"
 )
 
 type Crate struct {
@@ -21,6 +24,9 @@ const (
     WRONLY
 )
 
+// Count of dir levels in crate path
+const crateDepth int = 3
+
 
 func OpenCrate(dataDir, filePath string, direction int) (*Crate, error) {
     var err error
@@ -31,7 +37,7 @@ func OpenCrate(dataDir, filePath string, direction int) (*Crate, error) {
     switch direction {
         case RDONLY:
             fullPath := filepath.Join(crate.dataDir, crate.filePath)
-            crate.file, err = os.OpenFile(fullPath, os.O_CREATE|os.O_RDONLY, 0644)
+            crate.file, err = os.OpenFile(fullPath, os.O_RDONLY, 0644)
             if err != nil {
                 err = fmt.Errorf("file open error: %s", err)
                 return &crate, err
@@ -89,3 +95,64 @@ func (crate *Crate) Clean() error {
     os.Remove(fullPath)
     return err
 }
+
+func crateSize(dataDir, filePath string) (int64, error) {
+    var err error
+    var size int64
+    fullPath := filepath.Join(dataDir, filePath)
+    fileInfo, err := os.Stat(fullPath)
+    if err != nil {
+        return size, err
+    }
+    size = fileInfo.Size()
+    return size, err
+}
+
+// CrateFunc gets crate path relative to data dir
+type CrateFunc = func(filePath string, info fs.FileInfo) error
+
+var crateName = regexp.MustCompile(`^[0-9a-f]{64}\.block(--[0-9a-z-]+)?$`)
+
+// WalkCrates calls the callback for each crate file in the data dir
+func WalkCrates(dataDir string, crateCb CrateFunc) error {
+    var err error
+    walkCb := func(fullPath string, entry fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        filePath, err := filepath.Rel(dataDir, fullPath)
+        if err != nil {
+            return err
+        }
+        depth := len(strings.Split(filePath, string(filepath.Separator)))
+        if entry.IsDir() {
+            if filePath == "." {
+                return err
+            }
+            // Crate tree has hex named levels, other dirs belong to db and logs
+            if depth > crateDepth || !isHexName(entry.Name()) {
+                return filepath.SkipDir
+            }
+            return err
+        }
+        if depth != crateDepth + 1 || !crateName.MatchString(entry.Name()) {
+            return err
+        }
+        info, err := entry.Info()
+        if err != nil {
+            return err
+        }
+        return crateCb(filePath, info)
+    }
+    err = filepath.WalkDir(dataDir, walkCb)
+    return err
+}
+
+func isHexName(name string) bool {
+    for _, c := range name {
+        if !strings.ContainsRune("0123456789abcdef", c) {
+            return false
+        }
+    }
+    return len(name) > 0
+}
@@ -8,11 +8,14 @@ import (
     "crypto/sha256"
     "encoding/hex"
     "errors"
+    "fmt"
+    "hash"
     "io"
     "math/rand"
     "path/filepath"
     "time"
 
+    "dstore/dscomm/dsdescr"
     "dstore/dscomm/dserr"
 )
 
@@ -36,6 +39,34 @@ func newFilePath() (string) {
     return filePath
 }
 
+func newHashInit() string {
+    origin := make([]byte, 16)
+    rand.Read(origin)
+    return hex.EncodeToString(origin)
+}
+
+func newHasher(hashAlg, hashInit string) (hash.Hash, error) {
+    var err error
+    var hasher hash.Hash
+    switch hashAlg {
+        case dsdescr.HashSHA256:
+            hasher = sha256.New()
+        default:
+            err = fmt.Errorf("unknown hash algorithm %s", hashAlg)
+            return hasher, err
+    }
+    initBin, err := hex.DecodeString(hashInit)
+    if err != nil {
+        return hasher, err
+    }
+    hasher.Write(initBin)
+    return hasher, err
+}
+
+func hashSum(hasher hash.Hash) string {
+    return hex.EncodeToString(hasher.Sum(nil))
+}
+
 func copyData(reader io.Reader, writer io.Writer, size int64) (int64, error) {
     var err error
     var bufSize int64 = 1024 * 8
@@ -43,10 +74,7 @@ func copyData(reader io.Reader, writer io.Writer, size int64) (int64, error) {
     var remains int64 = size
     buffer := make([]byte, bufSize)
 
-    for {
-        if remains == 0 {
-            return total, dserr.Err(err)
-        }
+    for remains > 0 {
         if remains < bufSize {
             bufSize = remains
         }
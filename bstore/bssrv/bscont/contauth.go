@@ -5,13 +5,32 @@
 package bscont
 
 import (
-    "errors"
-
     "dstore/dscomm/dsrpc"
     "dstore/dscomm/dslog"
     "dstore/dscomm/dserr"
+    "dstore/bstore/bssrv/bstore"
 )
 
+// SetLegacyAuth allows salt and hash auth of old clients
+func (contr *Contr) SetLegacyAuth(legacyAuth bool) {
+    contr.legacyAuth = legacyAuth
+}
+
+// UserVerifier is used by the service for the auth challenge
+func (contr *Contr) UserVerifier(login []byte) (*dsrpc.Verifier, error) {
+    var err error
+    var verifier *dsrpc.Verifier
+    has, user, err := contr.store.GetUser(string(login))
+    if err != nil {
+        return verifier, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewAuthError("auth error")
+        return verifier, dserr.Err(err)
+    }
+    verifier = bstore.UserVerifier(user)
+    return verifier, dserr.Err(err)
+}
 
 func (contr *Contr) AuthMidware(debugMode bool) dsrpc.HandlerFunc {
     return func(context *dsrpc.Context) error {
@@ -23,13 +42,13 @@ func (contr *Contr) AuthMidware(debugMode bool) dsrpc.HandlerFunc {
 
         has, user, err := contr.store.GetUser(string(login))
         if err != nil {
-            resErr := errors.New("auth mismatch")
+            resErr := dserr.NewAuthError("auth mismatch")
             context.SendError(resErr)
             return dserr.Err(err)
         }
         if !has {
-            resErr := errors.New("auth error")
-            context.SendError(resErr)
+            err = dserr.NewAuthError("auth error")
+            context.SendError(err)
             return dserr.Err(err)
         }
 
@@ -38,14 +57,24 @@ func (contr *Contr) AuthMidware(debugMode bool) dsrpc.HandlerFunc {
             dslog.LogDebug("auth ", string(auth.JSON()))
         }
 
-        pass := []byte(user.Pass)
-        ok := dsrpc.CheckHash(login, pass, salt, hash)
+        verifier := bstore.UserVerifier(user)
+        var ok bool
+        switch {
+            case context.HasProof():
+                ok = context.CheckProof(verifier)
+            case contr.legacyAuth:
+                pass, isLegacy := dsrpc.LegacyPass(login, salt, hash)
+                ok = isLegacy && verifier.Check(pass)
+                if ok {
+                    dslog.LogWarningf("legacy auth for %s from %s", login, context.RemoteHost())
+                }
+        }
         if debugMode {
             dslog.LogDebugf("auth for %s is %v", login, ok)
         }
         if !ok {
-            resErr := errors.New("auth mismatch")
-            context.SendError(resErr)
+            err = dserr.NewAuthError("auth mismatch")
+            context.SendError(err)
             return dserr.Err(err)
         }
         return dserr.Err(err)
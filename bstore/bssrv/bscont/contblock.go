@@ -22,6 +22,11 @@ func (contr *Contr) SaveBlockHandler(context *dsrpc.Context) error {
 
     dataSize    := context.BinSize()
     blockReader := context.BinReader()
+    if dataSize < 0 {
+        err = errors.New("block data size must be known")
+        context.SendError(err)
+        return dserr.Err(err)
+    }
 
     fileId      := params.FileId
     batchId     := params.BatchId
@@ -30,7 +35,12 @@ func (contr *Contr) SaveBlockHandler(context *dsrpc.Context) error {
 
     blockSize   := params.BlockSize
 
-    err = contr.store.SaveBlock(fileId, batchId, blockType, blockId, blockSize, blockReader, dataSize)
+    hashAlg     := params.HashAlg
+    hashInit    := params.HashInit
+    hashSum     := params.HashSum
+
+    err = contr.store.SaveBlock(fileId, batchId, blockType, blockId, blockSize, hashAlg, hashInit, hashSum,
+                                                                                    blockReader, dataSize)
     if err != nil {
         context.SendError(err)
         return dserr.Err(err)
@@ -68,7 +78,7 @@ func (contr *Contr) LoadBlockHandler(context *dsrpc.Context) error {
         return err
     }
     if !has {
-        err = errors.New("block not exists")
+        err = dserr.NewNotFoundError("block not exists")
         err = dserr.Err(err)
         context.SendError(err)
         return err
@@ -11,6 +11,7 @@ import (
 
 type Contr struct {
     store  *bstore.Store
+    legacyAuth  bool
 }
 
 func NewContr(store *bstore.Store) (*Contr, error) {
@@ -0,0 +1,27 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package bscont
+
+import (
+    "dstore/dscomm/dsrpc"
+    "dstore/dscomm/dserr"
+)
+
+// ErrorCode maps errors of the store to the codes of responses
+func (contr *Contr) ErrorCode(err error) dsrpc.ErrCode {
+    switch {
+        case dserr.IsNotFound(err):
+            return dsrpc.CodeNotFound
+        case dserr.IsExists(err):
+            return dsrpc.CodeExists
+        case dserr.IsAuth(err):
+            return dsrpc.CodeUnauthorized
+        case dserr.IsAccess(err):
+            return dsrpc.CodeForbidden
+        case dserr.IsCorrupt(err):
+            return dsrpc.CodeCorrupt
+    }
+    return dsrpc.ErrorCode(err)
+}
@@ -41,3 +41,49 @@ func (contr *Contr) GetStatusHandler(context *dsrpc.Context) error {
     }
     return dserr.Err(err)
 }
+
+func (contr *Contr) ScrubStatusHandler(context *dsrpc.Context) error {
+    var err error
+    params := bsapi.NewScrubStatusParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    status, err := contr.store.ScrubStatus(authLogin)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := bsapi.NewScrubStatusResult()
+    result.Status = status
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) RunGCHandler(context *dsrpc.Context) error {
+    var err error
+    params := bsapi.NewRunGCParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    report, err := contr.store.RunGC(authLogin, params.DryRun)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := bsapi.NewRunGCResult()
+    result.Report = report
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
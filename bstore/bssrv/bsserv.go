@@ -14,6 +14,7 @@ import (
     "path/filepath"
     "strconv"
     "syscall"
+    "time"
     "io"
 
     "dstore/bstore/bsapi"
@@ -47,6 +48,7 @@ func main() {
 type Server struct {
     Params  *Config
     Backgr  bool
+    store   *bstore.Store
 }
 
 func (server *Server) Execute() error {
@@ -416,6 +418,10 @@ func (server *Server) SetSHandler() error {
 func (server *Server) StopAll() error {
     var err error
     dslog.LogInfo("stop processes")
+    if server.store != nil {
+        server.store.StopScrubber()
+        server.store.StopCollector()
+    }
     return err
 }
 
@@ -451,6 +457,11 @@ func (server *Server) RunService() error {
     }
     store.SetFilePerm(filePerm)
     store.SetDirPerm(dirPerm)
+    store.SetScrubRate(server.Params.ScrubRate * 1024)
+    store.SetScrubPause(time.Duration(server.Params.ScrubPause) * time.Second)
+    store.SetGCPause(time.Duration(server.Params.GCPause) * time.Second)
+    store.SetGCGrace(time.Duration(server.Params.GCGrace) * time.Second)
+    server.store = store
 
     err = store.SeedUsers()
     if err != nil {
@@ -460,12 +471,36 @@ func (server *Server) RunService() error {
     if err != nil {
         return err
     }
+    store.StartScrubber()
+    store.StartCollector()
 
     dslog.LogInfof("dataDir is %s", server.Params.DataDir)
     dslog.LogInfof("logDir is %s", server.Params.LogDir)
     dslog.LogInfof("runDir is %s", server.Params.RunDir)
 
     serv := dsrpc.NewService()
+    serv.SetVerifierFunc(contr.UserVerifier)
+    serv.SetErrorCoder(contr.ErrorCode)
+    contr.SetLegacyAuth(server.Params.LegacyAuth)
+    if server.Params.LegacyAuth {
+        dslog.LogWarning("legacy salt and hash auth is enabled, captured auth of old clients can be replayed")
+    }
+
+    serv.SetIdleTimeout(time.Duration(server.Params.IdleTimeout) * time.Second)
+    serv.SetTransferTimeout(time.Duration(server.Params.TransferTimeout) * time.Second)
+    serv.SetMaxConns(server.Params.MaxConns)
+    serv.SetMaxRPCSize(server.Params.MaxRPCSize)
+    serv.SetMaxBinSize(bsapi.SaveBlockMethod, server.Params.MaxBlockSize)
+
+    if server.Params.TLS {
+        tlsConfig, err := dsrpc.NewServerTLSConfig(server.Params.TLSCert, server.Params.TLSKey,
+                                                            server.Params.TLSClientCA)
+        if err != nil {
+            return err
+        }
+        serv.SetTLSConfig(tlsConfig)
+        dslog.LogInfof("tls enabled, cert is %s", server.Params.TLSCert)
+    }
 
     if debugMode || develMode {
         serv.PreMiddleware(dsrpc.LogRequest)
@@ -484,6 +519,8 @@ func (server *Server) RunService() error {
     serv.Handler(bsapi.DeleteUserMethod, contr.DeleteUserHandler)
 
     serv.Handler(bsapi.GetStatusMethod, contr.GetStatusHandler)
+    serv.Handler(bsapi.ScrubStatusMethod, contr.ScrubStatusHandler)
+    serv.Handler(bsapi.RunGCMethod, contr.RunGCHandler)
 
 
     if debugMode || develMode {
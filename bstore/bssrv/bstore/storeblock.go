@@ -13,7 +13,8 @@ import (
 )
 
 
-func (store *Store) SaveBlock(fileId, batchId, blockType, blockId, blockSize int64, blockReader io.Reader, dataSize int64) error {
+func (store *Store) SaveBlock(fileId, batchId, blockType, blockId, blockSize int64, hashAlg, hashInit, hashSum string,
+                                                            blockReader io.Reader, dataSize int64) error {
     var err error
     var has bool
 
@@ -44,6 +45,9 @@ func (store *Store) SaveBlock(fileId, batchId, blockType, blockId, blockSize int
     if err != nil {
         return dserr.Err(err)
     }
+    if len(hashAlg) > 0 {
+        block.SetHashInit(hashAlg, hashInit)
+    }
     descr := block.Descr()
     err = store.reg.PutBlock(descr)
     if err != nil  {
@@ -51,13 +55,15 @@ func (store *Store) SaveBlock(fileId, batchId, blockType, blockId, blockSize int
     }
 
     wrSize, err := block.Write(blockReader, dataSize)
-    if err != nil  {
-        return dserr.Err(err)
+    if err == nil && wrSize != dataSize {
+        err = fmt.Errorf("block %d,%d,%d,%d written only %d", fileId, batchId, blockType, blockId, wrSize)
     }
-    if err == io.EOF {
-        return dserr.Err(err)
+    if err == nil && len(hashSum) > 0 && block.HashSum() != hashSum {
+        block.Clean()
+        err = dserr.NewCorruptError("received block %d,%d,%d,%d hash mismatch", fileId, batchId, blockType, blockId)
     }
-    if wrSize != dataSize {
+    if err != nil  {
+        store.reg.DeleteBlock(fileId, batchId, blockType, blockId)
         return dserr.Err(err)
     }
 
@@ -78,7 +84,7 @@ func (store *Store) HasBlock(fileId, batchId, blockType, blockId int64) (bool, i
         return has, blockSize, dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("block %d,%d,%d,%d not exist", fileId, batchId, blockType, blockId)
+        err = dserr.NewNotFoundError("block %d,%d,%d,%d not exist", fileId, batchId, blockType, blockId)
         return has, blockSize, dserr.Err(err)
     }
     descr, err := store.reg.GetBlock(fileId, batchId, blockType, blockId)
@@ -96,7 +102,7 @@ func (store *Store) LoadBlock(fileId, batchId, blockType, blockId int64, blockWr
         return dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("block %d,%d,%d,%d not exist", fileId, batchId, blockType, blockId)
+        err = dserr.NewNotFoundError("block %d,%d,%d,%d not exist", fileId, batchId, blockType, blockId)
         return dserr.Err(err)
     }
     descr, err := store.reg.GetBlock(fileId, batchId, blockType, blockId)
@@ -149,5 +155,9 @@ func (store *Store) DeleteBlock(fileId, batchId, blockType, blockId int64) error
     if err != nil {
         return dserr.Err(err)
     }
+    err = store.reg.DeleteBlock(fileId, batchId, blockType, blockId)
+    if err != nil {
+        return dserr.Err(err)
+    }
     return dserr.Err(err)
 }
@@ -42,7 +42,7 @@ func TestBlock01(t *testing.T) {
     var blockId     int64 = 4
     var blockSize   int64 = 1024 * 1024 * 16
 
-    err = store.SaveBlock(fileId, batchId, blockType, blockId, blockSize, reader, dataSize)
+    err = store.SaveBlock(fileId, batchId, blockType, blockId, blockSize, "", "", "", reader, dataSize)
     require.NoError(t, err)
 
     writer1 := bytes.NewBuffer(nil)
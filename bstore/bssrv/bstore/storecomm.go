@@ -5,9 +5,12 @@
 package bstore
 
 import (
+    "context"
     "io/fs"
+    "sync"
     "time"
     "syscall"
+    "dstore/dscomm/dsdescr"
     "dstore/dscomm/dsinter"
 )
 
@@ -17,6 +20,22 @@ type Store struct {
     dirPerm     fs.FileMode
     filePerm    fs.FileMode
     startTime   int64
+
+    scrubRate   int64
+    scrubPause  time.Duration
+    scrubMtx    sync.Mutex
+    scrubStat   *dsdescr.ScrubStatus
+    scrubCtx    context.Context
+    scrubCancel context.CancelFunc
+    scrubWg     sync.WaitGroup
+
+    gcPause     time.Duration
+    gcGrace     time.Duration
+    gcMtx       sync.Mutex
+    gcRunMtx    sync.Mutex
+    gcCtx       context.Context
+    gcCancel    context.CancelFunc
+    gcWg        sync.WaitGroup
 }
 
 func NewStore(dataDir string, reg dsinter.BStoreReg) (*Store, error) {
@@ -27,6 +46,14 @@ func NewStore(dataDir string, reg dsinter.BStoreReg) (*Store, error) {
     store.dirPerm   = 0755
     store.filePerm  = 0644
     store.startTime = time.Now().Unix()
+
+    store.scrubPause = 3600 * time.Second
+    store.scrubStat  = dsdescr.NewScrubStatus()
+    store.scrubCtx, store.scrubCancel = context.WithCancel(context.Background())
+
+    store.gcPause = 3600 * 6 * time.Second
+    store.gcGrace = 3600 * 24 * time.Second
+    store.gcCtx, store.gcCancel = context.WithCancel(context.Background())
     return &store, err
 }
 
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package bstore
+
+import (
+    "io/fs"
+    "os"
+    "path/filepath"
+    "time"
+
+    "dstore/bstore/bssrv/bsblock"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+)
+
+const gcReportLimit int = 100
+
+// SetGCPause sets pause between collector passes, zero disables collector
+func (store *Store) SetGCPause(pause time.Duration) {
+    store.gcMtx.Lock()
+    defer store.gcMtx.Unlock()
+    store.gcPause = pause
+}
+
+// SetGCGrace sets age of unowned crates which are removed
+func (store *Store) SetGCGrace(grace time.Duration) {
+    store.gcMtx.Lock()
+    defer store.gcMtx.Unlock()
+    store.gcGrace = grace
+}
+
+func (store *Store) RunGC(login string, dryRun bool) (*dsdescr.GCReport, error) {
+    var err error
+    report := dsdescr.NewGCReport()
+    role, err := store.getUserRole(login)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    if role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", login)
+        return report, dserr.Err(err)
+    }
+    report, err = store.CollectGarbage(dryRun)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    return report, dserr.Err(err)
+}
+
+func (store *Store) StopCollector() {
+    store.gcCancel()
+    store.gcWg.Wait()
+}
+
+// StartCollector runs the garbage collection loop until StopCollector
+func (store *Store) StartCollector() {
+    store.gcWg.Add(1)
+    go store.collector()
+}
+
+func (store *Store) collector() {
+    defer store.gcWg.Done()
+
+    store.gcMtx.Lock()
+    pause := store.gcPause
+    store.gcMtx.Unlock()
+    if pause < 1 {
+        dslog.LogInfo("garbage collector disabled")
+        return
+    }
+    for {
+        select {
+            case <- store.gcCtx.Done():
+                dslog.LogInfo("gc loop canceled")
+                return
+            case <- time.After(pause):
+        }
+        report, err := store.CollectGarbage(false)
+        if err != nil {
+            dslog.LogErrorf("gc pass error: %v", err)
+            continue
+        }
+        dslog.LogInfof("gc pass: %d orphan crates, %d bytes", report.OrphanCrates, report.OrphanSize)
+    }
+}
+
+// CollectGarbage removes crates without owner block. Dry run only reports the garbage.
+func (store *Store) CollectGarbage(dryRun bool) (*dsdescr.GCReport, error) {
+    var err error
+    store.gcRunMtx.Lock()
+    defer store.gcRunMtx.Unlock()
+
+    report := dsdescr.NewGCReport()
+    report.DryRun = dryRun
+    report.StartedAt = time.Now().Unix()
+    defer func() {
+        report.FinishedAt = time.Now().Unix()
+    }()
+
+    store.gcMtx.Lock()
+    grace := store.gcGrace
+    store.gcMtx.Unlock()
+    deadline := time.Now().Add(-grace)
+
+    // Registry is read before the tree, crates written later are younger than deadline
+    used := make(map[string]bool)
+    blockCb := func(descr *dsdescr.Block) (bool, error) {
+        var err error
+        used[filepath.Clean(descr.FilePath)] = true
+        return false, err
+    }
+    err = store.reg.ProcBlocks(blockCb)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    crateCb := func(filePath string, info fs.FileInfo) error {
+        var err error
+        report.Crates++
+        if used[filePath] || info.ModTime().After(deadline) {
+            return err
+        }
+        report.OrphanCrates++
+        report.OrphanSize += info.Size()
+        if len(report.OrphanPaths) < gcReportLimit {
+            report.OrphanPaths = append(report.OrphanPaths, filePath)
+        }
+        if dryRun {
+            return err
+        }
+        err = os.Remove(filepath.Join(store.dataDir, filePath))
+        if err != nil {
+            return err
+        }
+        return err
+    }
+    err = bsblock.WalkCrates(store.dataDir, crateCb)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    return report, dserr.Err(err)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package bstore
+
+import (
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+    "dstore/dscomm/dsrpc"
+)
+
+// setUserPass replaces the password with salted verifier
+func setUserPass(user *dsdescr.User, pass string) {
+    verifier := dsrpc.NewVerifier([]byte(pass))
+    user.Pass       = ""
+    user.PassSalt   = verifier.Salt
+    user.PassIter   = verifier.Iter
+    user.PassKey    = verifier.StoredKey
+}
+
+func UserVerifier(user *dsdescr.User) *dsrpc.Verifier {
+    verifier := &dsrpc.Verifier{
+        Salt:       user.PassSalt,
+        Iter:       user.PassIter,
+        StoredKey:  user.PassKey,
+    }
+    return verifier
+}
+
+func checkUserPass(user *dsdescr.User, pass string) bool {
+    return UserVerifier(user).Check([]byte(pass))
+}
+
+// stripUser returns user descr copy without secrets
+func stripUser(user *dsdescr.User) *dsdescr.User {
+    stripped := *user
+    stripped.Pass       = ""
+    stripped.PassSalt   = nil
+    stripped.PassKey    = nil
+    return &stripped
+}
+
+// migrateUsers converts plain passwords of old records
+func (store *Store) migrateUsers() error {
+    var err error
+    users, err := store.reg.ListUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, user := range users {
+        if len(user.Pass) == 0 {
+            continue
+        }
+        setUserPass(user, user.Pass)
+        err = store.reg.PutUser(user)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        dslog.LogInfof("password of user %s is migrated", user.Login)
+    }
+    return dserr.Err(err)
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package bstore
+
+import (
+    "time"
+
+    "dstore/bstore/bssrv/bsblock"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+)
+
+const scrubBadLimit int = 100
+
+// SetScrubRate sets scrub read rate in bytes per second, zero disables scrubber
+func (store *Store) SetScrubRate(rate int64) {
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    store.scrubRate = rate
+    store.scrubStat.Rate = rate
+    store.scrubStat.Enabled = rate > 0
+}
+
+func (store *Store) SetScrubPause(pause time.Duration) {
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    store.scrubPause = pause
+}
+
+func (store *Store) ScrubStatus(login string) (*dsdescr.ScrubStatus, error) {
+    var err error
+    status := dsdescr.NewScrubStatus()
+    role, err := store.getUserRole(login)
+    if err != nil {
+        return status, dserr.Err(err)
+    }
+    if role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", login)
+        return status, dserr.Err(err)
+    }
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    *status = *store.scrubStat
+    if store.scrubStat.Current != nil {
+        current := *store.scrubStat.Current
+        current.BadBlocks = append([]*dsdescr.ScrubBlock{}, current.BadBlocks...)
+        status.Current = &current
+    }
+    return status, dserr.Err(err)
+}
+
+func (store *Store) StopScrubber() {
+    store.scrubCancel()
+    store.scrubWg.Wait()
+}
+
+// StartScrubber runs the scrub loop until StopScrubber
+func (store *Store) StartScrubber() {
+    store.scrubWg.Add(1)
+    go store.scrubber()
+}
+
+func (store *Store) scrubber() {
+    defer store.scrubWg.Done()
+
+    store.scrubMtx.Lock()
+    rate := store.scrubRate
+    pause := store.scrubPause
+    store.scrubMtx.Unlock()
+    if rate < 1 {
+        dslog.LogInfo("scrubber disabled")
+        return
+    }
+    for {
+        err := store.ScrubPass()
+        if err != nil {
+            dslog.LogErrorf("scrub pass error: %v", err)
+        }
+        select {
+            case <- store.scrubCtx.Done():
+                dslog.LogInfo("scrub loop canceled")
+                return
+            case <- time.After(pause):
+        }
+    }
+}
+
+// ScrubPass checks every stored block once. A bstore keeps single copy
+// of the block, the damage is only reported: the fstore owns recovery data.
+func (store *Store) ScrubPass() error {
+    var err error
+
+    pass := dsdescr.NewScrubPass()
+    pass.StartedAt = time.Now().Unix()
+    store.scrubMtx.Lock()
+    store.scrubStat.Current = pass
+    store.scrubMtx.Unlock()
+
+    defer func() {
+        store.scrubMtx.Lock()
+        pass.FinishedAt = time.Now().Unix()
+        store.scrubStat.Passes++
+        store.scrubStat.Last = pass
+        store.scrubStat.Current = nil
+        store.scrubMtx.Unlock()
+    }()
+
+    blockCb := func(descr *dsdescr.Block) (bool, error) {
+        var err error
+        var stop bool
+        select {
+            case <- store.scrubCtx.Done():
+                stop = true
+                return stop, err
+            default:
+        }
+        if descr.DataSize < 1 {
+            return stop, err
+        }
+        store.scrubBlock(pass, descr)
+        store.scrubThrottle(descr.DataSize)
+        return stop, err
+    }
+    err = store.reg.ProcBlocks(blockCb)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) scrubThrottle(size int64) {
+    store.scrubMtx.Lock()
+    rate := store.scrubRate
+    store.scrubMtx.Unlock()
+    if rate < 1 {
+        return
+    }
+    delay := time.Duration(size) * time.Second / time.Duration(rate)
+    select {
+        case <- store.scrubCtx.Done():
+        case <- time.After(delay):
+    }
+}
+
+func (store *Store) scrubBlock(pass *dsdescr.ScrubPass, descr *dsdescr.Block) {
+    state := checkBlock(store.dataDir, descr)
+    if state != dsdescr.ScrubHealthy {
+        // Block can be rewritten or deleted while checked
+        has, err := store.reg.HasBlock(descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId)
+        if err != nil || !has {
+            return
+        }
+        actual, err := store.reg.GetBlock(descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId)
+        if err != nil || actual.FilePath != descr.FilePath {
+            return
+        }
+        dslog.LogErrorf("%s block %d,%d,%d,%d", state, descr.FileId,
+                                descr.BatchId, descr.BlockType, descr.BlockId)
+    }
+
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    pass.Checked++
+    pass.CheckedSize += descr.DataSize
+    switch state {
+        case dsdescr.ScrubHealthy:
+            pass.Healthy++
+            return
+        case dsdescr.ScrubCorrupt:
+            pass.Corrupt++
+        default:
+            pass.Missing++
+    }
+    if len(pass.BadBlocks) < scrubBadLimit {
+        bad := &dsdescr.ScrubBlock{
+            FileId:     descr.FileId,
+            BatchId:    descr.BatchId,
+            BlockType:  descr.BlockType,
+            BlockId:    descr.BlockId,
+            State:      state,
+            CheckedAt:  time.Now().Unix(),
+        }
+        pass.BadBlocks = append(pass.BadBlocks, bad)
+    }
+}
+
+func checkBlock(dataDir string, descr *dsdescr.Block) string {
+    block, err := bsblock.OpenBlock(dataDir, descr)
+    if err != nil {
+        return dsdescr.ScrubMissing
+    }
+    if !block.HasCrate() {
+        return dsdescr.ScrubMissing
+    }
+    err = block.Verify()
+    if dserr.IsCorrupt(err) {
+        return dsdescr.ScrubCorrupt
+    }
+    if err != nil {
+        return dsdescr.ScrubMissing
+    }
+    return dsdescr.ScrubHealthy
+}
@@ -6,7 +6,6 @@ package bstore
 
 import (
     "errors"
-    "fmt"
     "time"
     "dstore/dscomm/dsdescr"
     "dstore/dscomm/dserr"
@@ -21,6 +20,10 @@ const defaultPass       string  = "user"
 
 func (store *Store) SeedUsers() error {
     var err error
+    err = store.migrateUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
     users, err := store.reg.ListUsers()
     if err != nil {
         return dserr.Err(err)
@@ -29,7 +32,7 @@ func (store *Store) SeedUsers() error {
         var user *dsdescr.User
         user = dsdescr.NewUser()
         user.Login  = defaultAUser
-        user.Pass   = defaultAPass
+        setUserPass(user, defaultAPass)
         user.State  = dsdescr.UStateEnabled
         user.Role   = dsdescr.URoleAdmin
         user.CreatedAt = time.Now().Unix()
@@ -41,7 +44,7 @@ func (store *Store) SeedUsers() error {
         }
         user = dsdescr.NewUser()
         user.Login  = defaultUser
-        user.Pass   = defaultPass
+        setUserPass(user, defaultPass)
         user.State  = dsdescr.UStateEnabled
         user.Role   = dsdescr.URoleUser
         user.CreatedAt = time.Now().Unix()
@@ -62,7 +65,7 @@ func (store *Store) AddUser(authLogin string, user *dsdescr.User) error {
 
     role, err := store.getUserRole(authLogin)
     if role != dsdescr.URoleAdmin {
-        err = fmt.Errorf("insufficient rights for %s", authLogin)
+        err = dserr.NewAccessError("insufficient rights for %s", authLogin)
         return dserr.Err(err)
     }
     ok, err = validateLogin(user.Login)
@@ -79,15 +82,18 @@ func (store *Store) AddUser(authLogin string, user *dsdescr.User) error {
         return dserr.Err(err)
     }
     if has {
-        err = fmt.Errorf("login %s exist", user.Login)
-
+        err = dserr.NewExistsError("login %s exist", user.Login)
+        return dserr.Err(err)
     }
-    user.State  = dsdescr.UStateEnabled
-    user.Role   = dsdescr.URoleUser
-    user.CreatedAt = time.Now().Unix()
-    user.UpdatedAt = user.CreatedAt
+    newUser := dsdescr.NewUser()
+    *newUser = *user
+    setUserPass(newUser, user.Pass)
+    newUser.State  = dsdescr.UStateEnabled
+    newUser.Role   = dsdescr.URoleUser
+    newUser.CreatedAt = time.Now().Unix()
+    newUser.UpdatedAt = newUser.CreatedAt
 
-    err = store.reg.PutUser(user)
+    err = store.reg.PutUser(newUser)
     if err != nil {
         return dserr.Err(err)
     }
@@ -120,7 +126,7 @@ func (store *Store) CheckUser(authLogin, login, passw string) (bool, error) {
     }
     userRole, err := store.getUserRole(authLogin)
     if authLogin != login && userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return ok, dserr.Err(err)
     }
     has, err := store.reg.HasUser(login)
@@ -128,15 +134,13 @@ func (store *Store) CheckUser(authLogin, login, passw string) (bool, error) {
         return ok, dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("user %s not exist", login)
+        err = dserr.NewNotFoundError("user %s not exist", login)
     }
     user, err := store.reg.GetUser(login)
     if err != nil {
         return ok, dserr.Err(err)
     }
-    if passw == user.Pass {
-        ok = true
-    }
+    ok = checkUserPass(user, passw)
     return ok, dserr.Err(err)
 }
 
@@ -153,7 +157,7 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     }
     // Rigth control
     if  authLogin != user.Login && userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return dserr.Err(err)
     }
 
@@ -164,7 +168,9 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     }
     newUser := dsdescr.NewUser()
     newUser.Login       = oldUser.Login
-    newUser.Pass        = oldUser.Pass
+    newUser.PassSalt    = oldUser.PassSalt
+    newUser.PassIter    = oldUser.PassIter
+    newUser.PassKey     = oldUser.PassKey
     newUser.Role        = oldUser.Role
     newUser.State       = oldUser.State
     newUser.CreatedAt   = oldUser.CreatedAt
@@ -172,7 +178,7 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
 
     // Update property if exists
     if len(user.Pass) > 0 {
-        newUser.Pass = user.Pass
+        setUserPass(newUser, user.Pass)
     }
     if len(user.Role) > 0 {
         newUser.Role = user.Role
@@ -182,11 +188,11 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     }
     // Rigth control
     if newUser.Role != oldUser.Role && userRole != dsdescr.URoleAdmin {
-        err = errors.New("insufficient rights for changing role")
+        err = dserr.NewAccessError("insufficient rights for changing role")
         return dserr.Err(err)
     }
     if newUser.State != oldUser.State && userRole != dsdescr.URoleAdmin {
-        err = errors.New("insufficient rights for changing state")
+        err = dserr.NewAccessError("insufficient rights for changing state")
         return dserr.Err(err)
     }
 
@@ -200,9 +206,11 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     if !ok {
         return dserr.Err(err)
     }
-    ok, err = validatePass(newUser.Pass)
-    if !ok {
-        return dserr.Err(err)
+    if len(user.Pass) > 0 || len(newUser.PassKey) == 0 {
+        ok, err = validatePass(user.Pass)
+        if !ok {
+            return dserr.Err(err)
+        }
     }
     // Delete old user descr
     err = store.reg.DeleteUser(user.Login)
@@ -222,13 +230,16 @@ func (store *Store) ListUsers(authLogin string) ([]*dsdescr.User, error) {
     users := make([]*dsdescr.User, 0)
     userRole, err := store.getUserRole(authLogin)
     if userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return users, dserr.Err(err)
     }
-    users, err = store.reg.ListUsers()
+    descrs, err := store.reg.ListUsers()
     if err != nil {
         return users, dserr.Err(err)
     }
+    for _, descr := range descrs {
+        users = append(users, stripUser(descr))
+    }
     return users, dserr.Err(err)
 }
 
@@ -237,7 +248,7 @@ func (store *Store) DeleteUser(authLogin string, login string) error {
 
     userRole, err := store.getUserRole(authLogin)
     if authLogin != login && userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return dserr.Err(err)
     }
 
@@ -253,7 +264,7 @@ func (store *Store) getUserRole(authLogin string) (string, error) {
     var userRole string
     has, err := store.reg.HasUser(authLogin)
     if !has {
-        err = fmt.Errorf("user %s not exists", authLogin)
+        err = dserr.NewNotFoundError("user %s not exists", authLogin)
         return userRole, dserr.Err(err)
     }
     user, err := store.reg.GetUser(authLogin)
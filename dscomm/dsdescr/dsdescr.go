@@ -19,6 +19,13 @@ type User struct {
     Pass        string      `json:"pass"        msgpack:"pass"`
     Role        string      `json:"role"        msgpack:"role"`
     State       string      `json:"state"       msgpack:"state"`
+    KeepVers    int64       `json:"keepVers"    msgpack:"keepVers"`
+    PassSalt    []byte      `json:"passSalt"    msgpack:"passSalt"`
+    PassIter    int64       `json:"passIter"    msgpack:"passIter"`
+    PassKey     []byte      `json:"passKey"     msgpack:"passKey"`
+    QuotaSize   int64       `json:"quotaSize"   msgpack:"quotaSize"`
+    QuotaFiles  int64       `json:"quotaFiles"  msgpack:"quotaFiles"`
+    Groups      []string    `json:"groups"      msgpack:"groups"`
     CreatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
     UpdatedAt   int64       `json:"createdAt"   msgpack:"createdAt"`
 }
@@ -42,13 +49,44 @@ func (descr *User) Pack() ([]byte, error) {
 }
 
 
+// Usage is running sum of user files, zero quota means no limit
+type Usage struct {
+    Login       string      `json:"login"       msgpack:"login"`
+    DataSize    int64       `json:"dataSize"    msgpack:"dataSize"`
+    FileCount   int64       `json:"fileCount"   msgpack:"fileCount"`
+    QuotaSize   int64       `json:"quotaSize"   msgpack:"quotaSize"`
+    QuotaFiles  int64       `json:"quotaFiles"  msgpack:"quotaFiles"`
+    UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
+}
+
+func NewUsage() *Usage {
+    var descr Usage
+    return &descr
+}
+
+func UnpackUsage(descrBin []byte) (*Usage, error) {
+    var err error
+    var descr Usage
+    err = encoder.Unmarshal(descrBin, &descr)
+    return &descr, err
+}
+
+func (descr *Usage) Pack() ([]byte, error) {
+    var err error
+    descrBin, err := encoder.Marshal(descr)
+    return descrBin, err
+}
+
+
 type File struct {
     FilePath    string      `json:"filePath"    msgpack:"filePath"`
     Login       string      `json:"login"       msgpack:"login"`
     FileId      int64       `json:"fileId"      msgpack:"fileId"`
+    FileVer     int64       `json:"fileVer"     msgpack:"fileVer"`
     BatchCount  int64       `json:"batchCount"  msgpack:"batchCount"`
     BatchSize   int64       `json:"batchSize"   msgpack:"batchSize"`
     BlockSize   int64       `json:"blockSize"   msgpack:"blockSize"`
+    RecoCount   int64       `json:"recoCount"   msgpack:"recoCount"`
     DataSize    int64       `json:"dataSize"    msgpack:"dataSize"`
     CreatedAt   int64       `json:"createdAt"   msgpack:"createdAt"`
     UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
@@ -73,11 +111,34 @@ func (descr *File) Pack() ([]byte, error) {
 }
 
 
+// MoveError is failure of one file of directory move
+type MoveError struct {
+    FilePath    string      `json:"filePath"    msgpack:"filePath"`
+    DestPath    string      `json:"destPath"    msgpack:"destPath"`
+    Error       string      `json:"error"       msgpack:"error"`
+}
+
+// DirEntry is a file or a pseudo-directory of directory listing,
+// the directory size and count are summed over all nested files
+type DirEntry struct {
+    Name        string      `json:"name"        msgpack:"name"`
+    IsDir       bool        `json:"isDir"       msgpack:"isDir"`
+    DataSize    int64       `json:"dataSize"    msgpack:"dataSize"`
+    FileCount   int64       `json:"fileCount"   msgpack:"fileCount"`
+    UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
+}
+
+func NewDirEntry() *DirEntry {
+    var descr DirEntry
+    return &descr
+}
+
 type Batch struct {
     BatchId     int64       `json:"batchId"     msgpack:"batchId"`
     FileId      int64       `json:"fileId"      msgpack:"fileId"`
     BatchSize   int64       `json:"batchSize"   msgpack:"batchSize"`
     BlockSize   int64       `json:"blockSize"   msgpack:"blockSize"`
+    RecoCount   int64       `json:"recoCount"   msgpack:"recoCount"`
     CreatedAt   int64       `json:"createdAt"   msgpack:"createdAt"`
     UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
 }
@@ -103,6 +164,8 @@ func (descr *Batch) Pack() ([]byte, error) {
 const BTData int64 = 1
 const BTReco int64 = 2
 
+const HashSHA256 string = "sha256"
+
 type Block struct {
     FileId      int64       `json:"fileId"      msgpack:"fileId"`
     BatchId     int64       `json:"batchId"     msgpack:"batchId"`
@@ -115,6 +178,7 @@ type Block struct {
     UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
     FilePath    string      `json:"filePath"    msgpack:"filePath"`
 
+    HashAlg     string      `json:"hashAlg"     msgpack:"hashAlg"`
     HashInit    string      `json:"hashInit"    msgpack:"hashInit"`
     HashSum     string      `json:"hashSum"     msgpack:"hashSum"`
 
@@ -154,6 +218,7 @@ type BStore struct {
     Login       string      `json:"login"       msgpack:"login"`
     Pass        string      `json:"pass"        msgpack:"pass"`
     State       string      `json:"state"       msgpack:"state"`
+    Secret      []byte      `json:"secret"      msgpack:"secret"`
     CreatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
     UpdatedAt   int64       `json:"createdAt"   msgpack:"createdAt"`
 }
@@ -175,3 +240,132 @@ func (descr *BStore) Pack() ([]byte, error) {
     descrBin, err := encoder.Marshal(descr)
     return descrBin, err
 }
+
+type APIKey struct {
+    KeyId       string      `json:"keyId"       msgpack:"keyId"`
+    Login       string      `json:"login"       msgpack:"login"`
+    Name        string      `json:"name"        msgpack:"name"`
+    Hash        []byte      `json:"hash"        msgpack:"hash"`
+    ReadOnly    bool        `json:"readOnly"    msgpack:"readOnly"`
+    PathPrefix  string      `json:"pathPrefix"  msgpack:"pathPrefix"`
+    ExpiresAt   int64       `json:"expiresAt"   msgpack:"expiresAt"`
+    CreatedAt   int64       `json:"createdAt"   msgpack:"createdAt"`
+    UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
+}
+
+func NewAPIKey() *APIKey {
+    var descr APIKey
+    return &descr
+}
+
+func UnpackAPIKey(descrBin []byte) (*APIKey, error) {
+    var err error
+    var descr APIKey
+    err = encoder.Unmarshal(descrBin, &descr)
+    return &descr, err
+}
+
+func (descr *APIKey) Pack() ([]byte, error) {
+    var err error
+    descrBin, err := encoder.Marshal(descr)
+    return descrBin, err
+}
+
+const GranteeUser       string  = "user"
+const GranteeGroup      string  = "group"
+
+const AccessRead        string  = "read"
+const AccessWrite       string  = "write"
+
+// Grant gives the grantee access to files of the owner under the path prefix
+type Grant struct {
+    Owner       string      `json:"owner"       msgpack:"owner"`
+    PathPrefix  string      `json:"pathPrefix"  msgpack:"pathPrefix"`
+    GranteeType string      `json:"granteeType" msgpack:"granteeType"`
+    Grantee     string      `json:"grantee"     msgpack:"grantee"`
+    Access      string      `json:"access"      msgpack:"access"`
+    CreatedAt   int64       `json:"createdAt"   msgpack:"createdAt"`
+    UpdatedAt   int64       `json:"updatedAt"   msgpack:"updatedAt"`
+}
+
+func NewGrant() *Grant {
+    var descr Grant
+    return &descr
+}
+
+func UnpackGrant(descrBin []byte) (*Grant, error) {
+    var err error
+    var descr Grant
+    err = encoder.Unmarshal(descrBin, &descr)
+    return &descr, err
+}
+
+func (descr *Grant) Pack() ([]byte, error) {
+    var err error
+    descrBin, err := encoder.Marshal(descr)
+    return descrBin, err
+}
+
+const ScrubHealthy      string  = "healthy"
+const ScrubCorrupt      string  = "corrupt"
+const ScrubMissing      string  = "missing"
+
+type ScrubBlock struct {
+    FileId      int64       `json:"fileId"      msgpack:"fileId"`
+    BatchId     int64       `json:"batchId"     msgpack:"batchId"`
+    BlockType   int64       `json:"blockType"   msgpack:"blockType"`
+    BlockId     int64       `json:"blockId"     msgpack:"blockId"`
+    State       string      `json:"state"       msgpack:"state"`
+    Repaired    bool        `json:"repaired"    msgpack:"repaired"`
+    CheckedAt   int64       `json:"checkedAt"   msgpack:"checkedAt"`
+}
+
+type ScrubPass struct {
+    StartedAt   int64           `json:"startedAt"   msgpack:"startedAt"`
+    FinishedAt  int64           `json:"finishedAt"  msgpack:"finishedAt"`
+    Checked     int64           `json:"checked"     msgpack:"checked"`
+    CheckedSize int64           `json:"checkedSize" msgpack:"checkedSize"`
+    Healthy     int64           `json:"healthy"     msgpack:"healthy"`
+    Corrupt     int64           `json:"corrupt"     msgpack:"corrupt"`
+    Missing     int64           `json:"missing"     msgpack:"missing"`
+    Repaired    int64           `json:"repaired"    msgpack:"repaired"`
+    BadBlocks   []*ScrubBlock   `json:"badBlocks"   msgpack:"badBlocks"`
+}
+
+func NewScrubPass() *ScrubPass {
+    var descr ScrubPass
+    descr.BadBlocks = make([]*ScrubBlock, 0)
+    return &descr
+}
+
+type ScrubStatus struct {
+    Enabled     bool        `json:"enabled"     msgpack:"enabled"`
+    Rate        int64       `json:"rate"        msgpack:"rate"`
+    Passes      int64       `json:"passes"      msgpack:"passes"`
+    Current     *ScrubPass  `json:"current"     msgpack:"current"`
+    Last        *ScrubPass  `json:"last"        msgpack:"last"`
+}
+
+func NewScrubStatus() *ScrubStatus {
+    var descr ScrubStatus
+    return &descr
+}
+
+type GCReport struct {
+    DryRun      bool        `json:"dryRun"      msgpack:"dryRun"`
+    StartedAt   int64       `json:"startedAt"   msgpack:"startedAt"`
+    FinishedAt  int64       `json:"finishedAt"  msgpack:"finishedAt"`
+    TmpFiles    int64       `json:"tmpFiles"    msgpack:"tmpFiles"`
+    TmpPaths    []string    `json:"tmpPaths"    msgpack:"tmpPaths"`
+    Crates      int64       `json:"crates"      msgpack:"crates"`
+    OrphanCrates int64      `json:"orphanCrates" msgpack:"orphanCrates"`
+    OrphanSize  int64       `json:"orphanSize"  msgpack:"orphanSize"`
+    OrphanPaths []string    `json:"orphanPaths" msgpack:"orphanPaths"`
+}
+
+func NewGCReport() *GCReport {
+    var descr GCReport
+    descr.TmpPaths      = make([]string, 0)
+    descr.OrphanPaths   = make([]string, 0)
+    return &descr
+}
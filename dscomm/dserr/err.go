@@ -1,6 +1,7 @@
 package dserr
 
 import (
+    "errors"
     "fmt"
     "runtime"
     "io"
@@ -27,13 +28,118 @@ func Err(err error) error {
             case develMode == true:
                 pc, filename, line, _ := runtime.Caller(1)
                 funcName := runtime.FuncForPC(pc).Name()
-                err = fmt.Errorf("\n%s:%d:%s:%s", filename, line, funcName, err.Error())
+                err = fmt.Errorf("\n%s:%d:%s:%w", filename, line, funcName, err)
             case debugMode == true:
                 pc, _, line, _ := runtime.Caller(1)
                 funcName := runtime.FuncForPC(pc).Name()
-                err = fmt.Errorf(" %s:%d:%s ", funcName, line, err.Error())
+                err = fmt.Errorf(" %s:%d:%w ", funcName, line, err)
             default:
         }
     }
     return err
 }
+
+type CorruptError struct {
+    message string
+}
+
+func NewCorruptError(format string, args ...interface{}) error {
+    return &CorruptError{ message: fmt.Sprintf(format, args...) }
+}
+
+func (corrupt *CorruptError) Error() string {
+    return "data corrupted: " + corrupt.message
+}
+
+func IsCorrupt(err error) bool {
+    var corrupt *CorruptError
+    return errors.As(err, &corrupt)
+}
+
+type QuotaError struct {
+    message string
+}
+
+func NewQuotaError(format string, args ...interface{}) error {
+    return &QuotaError{ message: fmt.Sprintf(format, args...) }
+}
+
+func (quota *QuotaError) Error() string {
+    return "quota exceeded: " + quota.message
+}
+
+func IsQuota(err error) bool {
+    var quota *QuotaError
+    return errors.As(err, &quota)
+}
+
+// Messages of the errors below are complete,
+// the kind of the error is told by the type
+
+type NotFoundError struct {
+    message string
+}
+
+func NewNotFoundError(format string, args ...interface{}) error {
+    return &NotFoundError{ message: fmt.Sprintf(format, args...) }
+}
+
+func (notFound *NotFoundError) Error() string {
+    return notFound.message
+}
+
+func IsNotFound(err error) bool {
+    var notFound *NotFoundError
+    return errors.As(err, &notFound)
+}
+
+type ExistsError struct {
+    message string
+}
+
+func NewExistsError(format string, args ...interface{}) error {
+    return &ExistsError{ message: fmt.Sprintf(format, args...) }
+}
+
+func (exists *ExistsError) Error() string {
+    return exists.message
+}
+
+func IsExists(err error) bool {
+    var exists *ExistsError
+    return errors.As(err, &exists)
+}
+
+type AuthError struct {
+    message string
+}
+
+func NewAuthError(format string, args ...interface{}) error {
+    return &AuthError{ message: fmt.Sprintf(format, args...) }
+}
+
+func (auth *AuthError) Error() string {
+    return auth.message
+}
+
+func IsAuth(err error) bool {
+    var auth *AuthError
+    return errors.As(err, &auth)
+}
+
+type AccessError struct {
+    message string
+}
+
+func NewAccessError(format string, args ...interface{}) error {
+    return &AccessError{ message: fmt.Sprintf(format, args...) }
+}
+
+func (access *AccessError) Error() string {
+    return access.message
+}
+
+func IsAccess(err error) bool {
+    var access *AccessError
+    return errors.As(err, &access)
+}
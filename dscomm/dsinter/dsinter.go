@@ -9,12 +9,32 @@ import (
 )
 
 type IterFunc = func(key []byte, val []byte) (bool, error)
+type BlockFunc = func(descr *dsdescr.Block) (bool, error)
+type FileFunc = func(descr *dsdescr.File) (bool, error)
+type PathFunc = func(filePath string) bool
 type DB interface {
     Put(key, val []byte) error
     Get(key []byte) ([]byte, error)
     Has(key []byte) (bool, error)
     Delete(key []byte) error
     Iter(prefix []byte, cb IterFunc) error
+    IterFrom(prefix, start []byte, cb IterFunc) error
+    NewBatch() Batch
+    WriteBatch(batch Batch) error
+    Snapshot() (Snapshot, error)
+}
+
+// Snapshot is read-only view of db at the moment of creation
+type Snapshot interface {
+    Iter(prefix []byte, cb IterFunc) error
+    IterFrom(prefix, start []byte, cb IterFunc) error
+    Release()
+}
+
+// Batch collects changes which are written to db atomically
+type Batch interface {
+    Put(key, val []byte)
+    Delete(key []byte)
 }
 
 type Alloc interface {
@@ -43,8 +63,22 @@ type FStoreReg interface {
     HasFile(login, filePath string) (bool, error)
     ListFiles(login string) ([]*dsdescr.File, error)
     PutFile(descr *dsdescr.File) error
+    MoveFile(login, filePath, destPath string) (*dsdescr.File, error)
+    ListDir(login, dirPath, token string, limit int, filter PathFunc) ([]*dsdescr.DirEntry, string, error)
+    Snapshot() (Snapshot, error)
+    ProcFilesFrom(snap Snapshot, login, startAfter string, fileCb FileFunc) error
+
+    PutVersion(descr *dsdescr.File) error
+    HasVersion(login, filePath string, fileVer int64) (bool, error)
+    GetVersion(login, filePath string, fileVer int64) (*dsdescr.File, error)
+    ListVersions(login, filePath string) ([]*dsdescr.File, error)
+    DeleteVersion(login, filePath string, fileVer int64) error
 
-    DeleteBatch(batchId, fileId int64) error
+    PutDrop(descr *dsdescr.File) error
+    DeleteDrop(fileId int64) error
+    ListDrops() ([]*dsdescr.File, error)
+
+    DeleteBatch(fileId, batchId int64) error
     GetBatch(batchId, fileId int64) (*dsdescr.Batch, error)
     HasBatch(batchId, fileId int64) (bool, error)
     ListBatchs(fileId int64) ([]*dsdescr.Batch, error)
@@ -55,13 +89,35 @@ type FStoreReg interface {
     HasBlock(fileId, batchId, blockType, blockId int64) (bool, error)
     ListBlocks(fileId int64) ([]*dsdescr.Block, error)
     DeleteBlock(fileId, batchId, blockType, blockId int64) error
-
+    ProcBlocks(blockCb BlockFunc) error
 
     DeleteBStore(address, port string) error
     GetBStore(address, port string) (*dsdescr.BStore, error)
     HasBStore(address, port string) (bool, error)
     ListBStores() ([]*dsdescr.BStore, error)
     PutBStore(descr *dsdescr.BStore) error
+
+    PutAPIKey(descr *dsdescr.APIKey) error
+    HasAPIKey(keyId string) (bool, error)
+    GetAPIKey(keyId string) (*dsdescr.APIKey, error)
+    ListAPIKeys(login string) ([]*dsdescr.APIKey, error)
+    DeleteAPIKey(keyId string) error
+
+    PutUsage(descr *dsdescr.Usage) error
+    HasUsage(login string) (bool, error)
+    GetUsage(login string) (*dsdescr.Usage, error)
+    DeleteUsage(login string) error
+    RecountUsage(login string) (*dsdescr.Usage, error)
+
+    PutGrant(descr *dsdescr.Grant) error
+    HasGrant(owner, granteeType, grantee, pathPrefix string) (bool, error)
+    GetGrant(owner, granteeType, grantee, pathPrefix string) (*dsdescr.Grant, error)
+    DeleteGrant(owner, granteeType, grantee, pathPrefix string) error
+    ListGrants(owner string) ([]*dsdescr.Grant, error)
+
+    RefCrate(filePath string) error
+    UnrefCrate(filePath string) (bool, error)
+    CrateRefs(filePath string) (int64, error)
 }
 
 type BStoreReg interface {
@@ -76,4 +132,5 @@ type BStoreReg interface {
     HasBlock(fileId, batchId, blockType, blockId int64) (bool, error)
     ListBlocks(fileId int64) ([]*dsdescr.Block, error)
     DeleteBlock(fileId, batchId, blockType, blockId int64) error
+    ProcBlocks(blockCb BlockFunc) error
 }
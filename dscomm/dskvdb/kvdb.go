@@ -5,8 +5,11 @@
 package dskvdb
 
 import (
+    "bytes"
+    "errors"
     "path/filepath"
     "github.com/syndtr/goleveldb/leveldb"
+    "github.com/syndtr/goleveldb/leveldb/iterator"
     "github.com/syndtr/goleveldb/leveldb/util"
 
     "dstore/dscomm/dsinter"
@@ -41,6 +44,21 @@ func (db *DB) Delete(key []byte) error {
     return db.ldb.Delete(key, nil)
 }
 
+func (db *DB) NewBatch() dsinter.Batch {
+    return &Batch{ lbatch: new(leveldb.Batch) }
+}
+
+// WriteBatch applies all changes of the batch or none of them
+func (db *DB) WriteBatch(batch dsinter.Batch) error {
+    var err error
+    dbBatch, ok := batch.(*Batch)
+    if !ok {
+        err = errors.New("foreign batch type")
+        return err
+    }
+    return db.ldb.Write(dbBatch.lbatch, nil)
+}
+
 func (db *DB) Close() error {
     return db.ldb.Close()
 }
@@ -59,3 +77,72 @@ func (db *DB) Iter(prefix []byte, cb dsinter.IterFunc) error {
     err = iter.Error()
     return err
 }
+
+// IterFrom iterates the keys with the prefix beginning from the start key
+func (db *DB) IterFrom(prefix, start []byte, cb dsinter.IterFunc) error {
+    iter := db.ldb.NewIterator(rangeFrom(prefix, start), nil)
+    return iterate(iter, cb)
+}
+
+// Snapshot fixes the current state of db for long iterations,
+// the snapshot must be released
+func (db *DB) Snapshot() (dsinter.Snapshot, error) {
+    var err error
+    var snap Snapshot
+    snap.lsnap, err = db.ldb.GetSnapshot()
+    return &snap, err
+}
+
+type Snapshot struct {
+    lsnap   *leveldb.Snapshot
+}
+
+func (snap *Snapshot) Iter(prefix []byte, cb dsinter.IterFunc) error {
+    iter := snap.lsnap.NewIterator(util.BytesPrefix(prefix), nil)
+    return iterate(iter, cb)
+}
+
+func (snap *Snapshot) IterFrom(prefix, start []byte, cb dsinter.IterFunc) error {
+    iter := snap.lsnap.NewIterator(rangeFrom(prefix, start), nil)
+    return iterate(iter, cb)
+}
+
+func (snap *Snapshot) Release() {
+    snap.lsnap.Release()
+}
+
+func rangeFrom(prefix, start []byte) *util.Range {
+    bRange := util.BytesPrefix(prefix)
+    if bytes.Compare(start, bRange.Start) > 0 {
+        bRange.Start = start
+    }
+    return bRange
+}
+
+func iterate(iter iterator.Iterator, cb dsinter.IterFunc) error {
+    var err error
+    defer iter.Release()
+    for iter.Next() {
+        stop, err := cb(iter.Key(), iter.Value())
+        if err != nil {
+            return err
+        }
+        if stop {
+            break
+        }
+    }
+    err = iter.Error()
+    return err
+}
+
+type Batch struct {
+    lbatch  *leveldb.Batch
+}
+
+func (batch *Batch) Put(key, val []byte) {
+    batch.lbatch.Put(key, val)
+}
+
+func (batch *Batch) Delete(key []byte) {
+    batch.lbatch.Delete(key)
+}
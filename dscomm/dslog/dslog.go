@@ -58,19 +58,19 @@ func SetOutput(writer io.Writer) error {
 }
 
 func LogDebug(message ...interface{}) {
-    logrus.Debug(message)
+    logrus.Debug(message...)
 }
 
 func LogError(message ...interface{}) {
-    logrus.Error(message)
+    logrus.Error(message...)
 }
 
 func LogWarning(message ...interface{}) {
-    logrus.Warning(message)
+    logrus.Warning(message...)
 }
 
 func LogInfo(message ...interface{}) {
-    logrus.Info(message)
+    logrus.Info(message...)
 }
 
 
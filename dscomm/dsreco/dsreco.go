@@ -0,0 +1,250 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsreco
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Reed-Solomon codec over GF(2^8) with systematic Cauchy matrix:
+// any dataCount shards from dataCount + recoCount restore the others.
+
+const gfPoly int = 0x11d
+
+var gfExp [512]byte
+var gfLog [256]byte
+
+func init() {
+    x := 1
+    for i := 0; i < 255; i++ {
+        gfExp[i] = byte(x)
+        gfLog[x] = byte(i)
+        x <<= 1
+        if x & 0x100 != 0 {
+            x ^= gfPoly
+        }
+    }
+    for i := 255; i < len(gfExp); i++ {
+        gfExp[i] = gfExp[i - 255]
+    }
+}
+
+func gfMul(a, b byte) byte {
+    if a == 0 || b == 0 {
+        return 0
+    }
+    return gfExp[int(gfLog[a]) + int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+    return gfExp[255 - int(gfLog[a])]
+}
+
+type Codec struct {
+    dataCount   int
+    recoCount   int
+    matrix      [][]byte
+}
+
+func NewCodec(dataCount, recoCount int) (*Codec, error) {
+    var err error
+    var codec Codec
+    if dataCount < 1 || recoCount < 0 || dataCount + recoCount > 256 {
+        err = fmt.Errorf("wrong shard counts %d,%d", dataCount, recoCount)
+        return &codec, err
+    }
+    codec.dataCount = dataCount
+    codec.recoCount = recoCount
+
+    // Identity rows for data shards, Cauchy rows for reco shards
+    codec.matrix = make([][]byte, dataCount + recoCount)
+    for i := 0; i < dataCount; i++ {
+        codec.matrix[i] = make([]byte, dataCount)
+        codec.matrix[i][i] = 1
+    }
+    for i := 0; i < recoCount; i++ {
+        row := make([]byte, dataCount)
+        for j := 0; j < dataCount; j++ {
+            row[j] = gfInv(byte(dataCount + i) ^ byte(j))
+        }
+        codec.matrix[dataCount + i] = row
+    }
+    return &codec, err
+}
+
+func (codec *Codec) DataCount() int {
+    return codec.dataCount
+}
+
+func (codec *Codec) RecoCount() int {
+    return codec.recoCount
+}
+
+// Encode fills reco shards from data shards, all shards have the same size
+func (codec *Codec) Encode(data [][]byte, reco [][]byte) error {
+    var err error
+    if len(data) != codec.dataCount || len(reco) != codec.recoCount {
+        err = errors.New("wrong shard count")
+        return err
+    }
+    size, err := shardSize(data)
+    if err != nil {
+        return err
+    }
+    for i := range reco {
+        if len(reco[i]) != size {
+            err = errors.New("wrong reco shard size")
+            return err
+        }
+        mulRows(codec.matrix[codec.dataCount + i], data, reco[i])
+    }
+    return err
+}
+
+// Reconstruct fills nil shards, data shards go first, then reco shards
+func (codec *Codec) Reconstruct(shards [][]byte) error {
+    var err error
+    if len(shards) != codec.dataCount + codec.recoCount {
+        err = errors.New("wrong shard count")
+        return err
+    }
+    size := -1
+    rows := make([]int, 0, codec.dataCount)
+    for i := range shards {
+        if shards[i] == nil {
+            continue
+        }
+        if size < 0 {
+            size = len(shards[i])
+        }
+        if len(shards[i]) != size {
+            err = errors.New("shards have different sizes")
+            return err
+        }
+        if len(rows) < codec.dataCount {
+            rows = append(rows, i)
+        }
+    }
+    if len(rows) < codec.dataCount {
+        err = fmt.Errorf("too few shards for reconstruction: %d of %d", len(rows), codec.dataCount)
+        return err
+    }
+
+    dataLost := false
+    for i := 0; i < codec.dataCount; i++ {
+        if shards[i] == nil {
+            dataLost = true
+        }
+    }
+    if dataLost {
+        sub := make([][]byte, codec.dataCount)
+        inputs := make([][]byte, codec.dataCount)
+        for i, row := range rows {
+            sub[i] = append([]byte(nil), codec.matrix[row]...)
+            inputs[i] = shards[row]
+        }
+        inv, err := invertMatrix(sub)
+        if err != nil {
+            return err
+        }
+        for i := 0; i < codec.dataCount; i++ {
+            if shards[i] != nil {
+                continue
+            }
+            shards[i] = make([]byte, size)
+            mulRows(inv[i], inputs, shards[i])
+        }
+    }
+    for i := codec.dataCount; i < len(shards); i++ {
+        if shards[i] != nil {
+            continue
+        }
+        shards[i] = make([]byte, size)
+        mulRows(codec.matrix[i], shards[:codec.dataCount], shards[i])
+    }
+    return err
+}
+
+func mulRows(row []byte, inputs [][]byte, output []byte) {
+    for i := range output {
+        output[i] = 0
+    }
+    for j, coef := range row {
+        if coef == 0 {
+            continue
+        }
+        input := inputs[j]
+        if coef == 1 {
+            for i := range output {
+                output[i] ^= input[i]
+            }
+            continue
+        }
+        logCoef := int(gfLog[coef])
+        for i := range output {
+            if input[i] != 0 {
+                output[i] ^= gfExp[logCoef + int(gfLog[input[i]])]
+            }
+        }
+    }
+}
+
+func invertMatrix(matrix [][]byte) ([][]byte, error) {
+    var err error
+    size := len(matrix)
+    inv := make([][]byte, size)
+    for i := range inv {
+        inv[i] = make([]byte, size)
+        inv[i][i] = 1
+    }
+    for col := 0; col < size; col++ {
+        pivot := -1
+        for row := col; row < size; row++ {
+            if matrix[row][col] != 0 {
+                pivot = row
+                break
+            }
+        }
+        if pivot < 0 {
+            err = errors.New("singular matrix")
+            return inv, err
+        }
+        matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+        inv[col], inv[pivot] = inv[pivot], inv[col]
+
+        scale := gfInv(matrix[col][col])
+        for j := 0; j < size; j++ {
+            matrix[col][j] = gfMul(matrix[col][j], scale)
+            inv[col][j] = gfMul(inv[col][j], scale)
+        }
+        for row := 0; row < size; row++ {
+            coef := matrix[row][col]
+            if row == col || coef == 0 {
+                continue
+            }
+            for j := 0; j < size; j++ {
+                matrix[row][j] ^= gfMul(coef, matrix[col][j])
+                inv[row][j] ^= gfMul(coef, inv[col][j])
+            }
+        }
+    }
+    return inv, err
+}
+
+func shardSize(shards [][]byte) (int, error) {
+    var err error
+    size := -1
+    for i := range shards {
+        if size < 0 {
+            size = len(shards[i])
+        }
+        if len(shards[i]) != size {
+            err = errors.New("shards have different sizes")
+            return size, err
+        }
+    }
+    return size, err
+}
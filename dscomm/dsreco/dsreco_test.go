@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsreco
+
+import (
+    "math/rand"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestCodec01(t *testing.T) {
+    var err error
+
+    dataCount := 5
+    recoCount := 3
+    shardSize := 1024
+
+    codec, err := NewCodec(dataCount, recoCount)
+    require.NoError(t, err)
+
+    data := make([][]byte, dataCount)
+    for i := range data {
+        data[i] = make([]byte, shardSize)
+        rand.Read(data[i])
+    }
+    reco := make([][]byte, recoCount)
+    for i := range reco {
+        reco[i] = make([]byte, shardSize)
+    }
+    err = codec.Encode(data, reco)
+    require.NoError(t, err)
+
+    // Drop every possible set of recoCount shards
+    total := dataCount + recoCount
+    for mask := 0; mask < 1 << total; mask++ {
+        lost := 0
+        for i := 0; i < total; i++ {
+            if mask & (1 << i) != 0 {
+                lost++
+            }
+        }
+        if lost != recoCount {
+            continue
+        }
+        shards := make([][]byte, total)
+        for i := 0; i < total; i++ {
+            if mask & (1 << i) != 0 {
+                continue
+            }
+            if i < dataCount {
+                shards[i] = append([]byte(nil), data[i]...)
+            } else {
+                shards[i] = append([]byte(nil), reco[i - dataCount]...)
+            }
+        }
+        err = codec.Reconstruct(shards)
+        require.NoError(t, err)
+        for i := 0; i < dataCount; i++ {
+            require.Equal(t, data[i], shards[i])
+        }
+        for i := 0; i < recoCount; i++ {
+            require.Equal(t, reco[i], shards[dataCount + i])
+        }
+    }
+}
+
+func TestCodec02(t *testing.T) {
+    var err error
+
+    codec, err := NewCodec(4, 2)
+    require.NoError(t, err)
+
+    shards := make([][]byte, 6)
+    shards[0] = make([]byte, 16)
+    shards[1] = make([]byte, 16)
+    shards[2] = make([]byte, 16)
+    err = codec.Reconstruct(shards)
+    require.Error(t, err)
+
+    _, err = NewCodec(0, 2)
+    require.Error(t, err)
+}
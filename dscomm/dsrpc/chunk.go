@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "errors"
+    "fmt"
+    "io"
+)
+
+// Binary data of unknown size is sent by chunks: int64 size
+// and the data of the chunk, the chunk of zero size ends the data.
+// The request header has ChunkedSize as the binary size.
+
+const ChunkedSize   int64 = -1
+const maxChunkSize  int64 = 1024 * 1024
+const sendChunkSize int64 = 1024 * 64
+
+type chunkReader struct {
+    reader      io.Reader
+    remains     int64
+    eof         bool
+    limit       int64
+    total       int64
+}
+
+func newChunkReader(reader io.Reader) *chunkReader {
+    return &chunkReader{
+        reader: reader,
+    }
+}
+
+// Read returns io.EOF after the last chunk, the stream broken
+// before the last chunk gives io.ErrUnexpectedEOF
+func (creader *chunkReader) Read(buffer []byte) (int, error) {
+    var err error
+    if creader.eof {
+        return 0, io.EOF
+    }
+    if creader.remains == 0 {
+        sizeBytes, err := ReadBytes(creader.reader, int64(sizeOfInt64))
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        if err != nil {
+            return 0, err
+        }
+        size := decoderI64(sizeBytes)
+        if size == 0 {
+            creader.eof = true
+            return 0, io.EOF
+        }
+        if size < 0 || size > maxChunkSize {
+            err = fmt.Errorf("wrong chunk size %d", size)
+            return 0, err
+        }
+        // Zero limit means the data without limit
+        if creader.limit > 0 && creader.total + size > creader.limit {
+            err = fmt.Errorf("binary data exceeds limit %d", creader.limit)
+            return 0, err
+        }
+        creader.total += size
+        creader.remains = size
+    }
+    if int64(len(buffer)) > creader.remains {
+        buffer = buffer[0:creader.remains]
+    }
+    read, err := creader.reader.Read(buffer)
+    creader.remains -= int64(read)
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
+        if read > 0 {
+            err = nil
+        }
+    }
+    return read, err
+}
+
+// writeChunks sends the data of the reader up to EOF by chunks
+// and the last chunk
+func writeChunks(reader io.Reader, writer io.Writer) (int64, error) {
+    var err error
+    var total int64
+    if reader == nil {
+        return total, errors.New("reader is nil")
+    }
+    if writer == nil {
+        return total, errors.New("writer is nil")
+    }
+    buffer := make([]byte, int64(sizeOfInt64) + sendChunkSize)
+    for {
+        read, readErr := reader.Read(buffer[sizeOfInt64:])
+        if read > 0 {
+            copy(buffer[0:sizeOfInt64], encoderI64(int64(read)))
+            _, err = writer.Write(buffer[0:sizeOfInt64 + read])
+            if err != nil {
+                err = fmt.Errorf("write error: %v", err)
+                return total, Err(err)
+            }
+            total += int64(read)
+        }
+        if readErr == io.EOF {
+            break
+        }
+        if readErr != nil {
+            err = fmt.Errorf("read error: %v", readErr)
+            return total, Err(err)
+        }
+    }
+    _, err = writer.Write(encoderI64(0))
+    if err != nil {
+        err = fmt.Errorf("write error: %v", err)
+        return total, Err(err)
+    }
+    return total, Err(err)
+}
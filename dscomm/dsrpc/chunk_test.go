@@ -0,0 +1,76 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "math/rand"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestChunks(t *testing.T) {
+    var err error
+    data := make([]byte, sendChunkSize * 3 + 17)
+    rand.Read(data)
+
+    stream := bytes.NewBuffer(nil)
+    written, err := writeChunks(bytes.NewReader(data), stream)
+    require.NoError(t, err)
+    require.Equal(t, int64(len(data)), written)
+
+    encoded := stream.Bytes()
+    received, err := io.ReadAll(newChunkReader(bytes.NewReader(encoded)))
+    require.NoError(t, err)
+    require.Equal(t, data, received)
+
+    // Stream without the last chunk is broken
+    _, err = io.ReadAll(newChunkReader(bytes.NewReader(encoded[:len(encoded) - sizeOfInt64])))
+    require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+    _, err = io.ReadAll(newChunkReader(bytes.NewReader(encoded[:100])))
+    require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+    // Empty data is the last chunk only
+    stream.Reset()
+    _, err = writeChunks(bytes.NewReader(nil), stream)
+    require.NoError(t, err)
+    require.Equal(t, sizeOfInt64, stream.Len())
+
+    _, err = io.ReadAll(newChunkReader(bytes.NewReader(encoderI64(maxChunkSize + 1))))
+    require.Error(t, err)
+}
+
+func TestNetChunked(t *testing.T) {
+    go testServ(false)
+    time.Sleep(10 * time.Millisecond)
+
+    data := make([]byte, 1024 * 1024 + 7)
+    rand.Read(data)
+    hash := sha256.Sum256(data)
+    auth := CreateAuth([]byte("qwert"), []byte("12345"))
+
+    params := NewSaveParams()
+    result := NewSaveResult()
+    err := Put("127.0.0.1:8081", sumMethod, bytes.NewReader(data), ChunkedSize, params, result, auth)
+    require.NoError(t, err)
+    require.Equal(t, hex.EncodeToString(hash[:]), result.Message)
+
+    pool := NewPool()
+    defer pool.Close()
+    result = NewSaveResult()
+    err = pool.Put("127.0.0.1:8081", sumMethod, bytes.NewReader(data), ChunkedSize, params, result, auth)
+    require.NoError(t, err)
+    require.Equal(t, hex.EncodeToString(hash[:]), result.Message)
+
+    result = NewSaveResult()
+    err = LocalPut(sumMethod, bytes.NewReader(data), ChunkedSize, params, result, auth, sumHandler)
+    require.NoError(t, err)
+    require.Equal(t, hex.EncodeToString(hash[:]), result.Message)
+}
@@ -5,8 +5,6 @@
 package dsrpc
 
 import (
-    "errors"
-    "fmt"
     "io"
     "net"
     "sync"
@@ -15,15 +13,12 @@ import (
 )
 
 
+// Put sends the data of the reader, ChunkedSize as the size
+// sends the data of unknown size up to EOF of the reader
 func Put(address string, method string, reader io.Reader, size int64, param, result any, auth *Auth) error {
     var err error
 
-    addr, err := net.ResolveTCPAddr("tcp", address)
-    if err != nil {
-        err = fmt.Errorf("unable to resolve adddress: %s", err)
-        return Err(err)
-    }
-    conn, err := net.DialTCP("tcp", nil, addr)
+    conn, err := dial(address)
     if err != nil {
         return Err(err)
     }
@@ -41,12 +36,17 @@ func Put(address string, method string, reader io.Reader, size int64, param, res
     //    return Err(err)
     //}
 
-    return ConnPut(conn, method, reader, size, param, result, auth)
+    tconn := newTimeConn(conn, getClientTimeout(), nil)
+    return ConnPut(tconn, method, reader, size, param, result, auth)
 }
 
 
 func ConnPut(conn net.Conn, method string, reader io.Reader, size int64, param, result any, auth *Auth) error {
     var err error
+    auth, err = authenticate(conn, method, auth)
+    if err != nil {
+        return Err(err)
+    }
     context := CreateContext(conn)
     context.reqRPC.Method = method
     context.reqRPC.Params = param
@@ -95,12 +95,7 @@ func ConnPut(conn net.Conn, method string, reader io.Reader, size int64, param,
 func Get(address string, method string, writer io.Writer, param, result any, auth *Auth) error {
     var err error
 
-    addr, err := net.ResolveTCPAddr("tcp", address)
-    if err != nil {
-        err = fmt.Errorf("unable to resolve adddress: %s", err)
-        return Err(err)
-    }
-    conn, err := net.DialTCP("tcp", nil, addr)
+    conn, err := dial(address)
     if err != nil {
         return Err(err)
     }
@@ -118,11 +113,16 @@ func Get(address string, method string, writer io.Writer, param, result any, aut
     //    return Err(err)
     //}
 
-    return ConnGet(conn, method, writer, param, result, auth)
+    tconn := newTimeConn(conn, getClientTimeout(), nil)
+    return ConnGet(tconn, method, writer, param, result, auth)
 }
 
 func ConnGet(conn net.Conn, method string, writer io.Writer, param, result any, auth *Auth) error {
     var err error
+    auth, err = authenticate(conn, method, auth)
+    if err != nil {
+        return Err(err)
+    }
 
     context := CreateContext(conn)
     context.reqRPC.Method = method
@@ -162,12 +162,7 @@ func ConnGet(conn net.Conn, method string, writer io.Writer, param, result any,
 func Exec(address, method string, param any, result any, auth *Auth) error {
     var err error
 
-    addr, err := net.ResolveTCPAddr("tcp", address)
-    if err != nil {
-        err = fmt.Errorf("unable to resolve adddress: %s", err)
-        return Err(err)
-    }
-    conn, err := net.DialTCP("tcp", nil, addr)
+    conn, err := dial(address)
     if err != nil {
         return Err(err)
     }
@@ -184,7 +179,8 @@ func Exec(address, method string, param any, result any, auth *Auth) error {
     //    return Err(err)
     //}
 
-    err = ConnExec(conn, method, param, result, auth)
+    tconn := newTimeConn(conn, getClientTimeout(), nil)
+    err = ConnExec(tconn, method, param, result, auth)
     if err != nil {
         return Err(err)
     }
@@ -194,6 +190,10 @@ func Exec(address, method string, param any, result any, auth *Auth) error {
 
 func ConnExec(conn net.Conn, method string, param any, result any, auth *Auth) error {
     var err error
+    auth, err = authenticate(conn, method, auth)
+    if err != nil {
+        return Err(err)
+    }
 
     context := CreateContext(conn)
     context.reqRPC.Method = method
@@ -257,6 +257,10 @@ func (context *Context) WriteRequest() error {
 
 func (context *Context) UploadBin() error {
     var err error
+    if context.reqHeader.binSize == ChunkedSize {
+        _, err = writeChunks(context.binReader, context.binWriter)
+        return Err(err)
+    }
     _, err = CopyBytes(context.binReader, context.binWriter, context.reqHeader.binSize)
     return Err(err)
 }
@@ -285,7 +289,7 @@ func (context *Context) UploadBinAsync(wg *sync.WaitGroup) {
         wg.Done()
     }
     defer exitFunc()
-    _, _ = CopyBytes(context.binReader, context.binWriter, context.reqHeader.binSize)
+    _ = context.UploadBin()
     return
 }
 
@@ -329,7 +333,11 @@ func (context *Context) BindResponse() error {
         return Err(err)
     }
     if len(context.resRPC.Error) > 0 {
-        err = errors.New(context.resRPC.Error)
+        code := context.resRPC.Code
+        if code == CodeNone {
+            code = CodeInternal
+        }
+        err = &CodeError{ Code: code, Message: context.resRPC.Error }
         return Err(err)
     }
     return Err(err)
@@ -5,6 +5,7 @@
 package dsrpc
 
 import (
+    gocontext "context"
     "io"
     "net"
     "time"
@@ -26,6 +27,17 @@ type Context struct {
 
     binReader   io.Reader
     binWriter   io.Writer
+    binChunks   *chunkReader
+    rpcLimit    int64
+    binLimit    int64
+    errorCoder  ErrorCoder
+
+    nonce       []byte
+    nonceIdent  []byte
+    nonceTime   time.Time
+
+    ctx         gocontext.Context
+    cancel      gocontext.CancelFunc
 }
 
 
@@ -45,15 +57,33 @@ func CreateContext(conn net.Conn) *Context {
     context.resPacket = NewPacket()
 
     context.reqHeader = NewHeader()
+    context.reqHeader.version = peerVersion(conn)
     context.reqRPC   = NewRequest()
 
     context.resHeader = NewHeader()
     context.resRPC = NewResponse()
     context.resRPC = NewResponse()
 
+    context.ctx, context.cancel = gocontext.WithCancel(gocontext.Background())
     return context
 }
 
+// Ctx is cancelled when the connection is broken, stalled
+// longer than the timeout or closed by the peer
+func (context *Context) Ctx() gocontext.Context {
+    if context.ctx == nil {
+        return gocontext.Background()
+    }
+    return context.ctx
+}
+
+// Cancel cancels the context of the call
+func (context *Context) Cancel() {
+    if context.cancel != nil {
+        context.cancel()
+    }
+}
+
 func (context *Context) Request() *Request  {
     return context.reqRPC
 }
@@ -151,6 +181,15 @@ func (context *Context) AuthHash() []byte {
     return context.reqRPC.Auth.Hash
 }
 
+func (context *Context) AuthToken() []byte {
+    return context.reqRPC.Auth.Token
+}
+
+// HasToken is true for the request with session token or API key
+func (context *Context) HasToken() bool {
+    return len(context.reqRPC.Auth.Token) > 0
+}
+
 func (context *Context) Auth() *Auth {
     return context.reqRPC.Auth
 }
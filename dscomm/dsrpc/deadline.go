@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "net"
+    "sync"
+    "time"
+)
+
+var clientTimeout time.Duration
+var clientTimeoutMtx sync.Mutex
+
+// SetClientTimeout limits dial and each read or write of Exec, Put and Get
+// calls, zero timeout disables the limit
+func SetClientTimeout(timeout time.Duration) {
+    clientTimeoutMtx.Lock()
+    defer clientTimeoutMtx.Unlock()
+    clientTimeout = timeout
+}
+
+func getClientTimeout() time.Duration {
+    clientTimeoutMtx.Lock()
+    defer clientTimeoutMtx.Unlock()
+    return clientTimeout
+}
+
+// timeConn moves the deadline forward before each read and write,
+// so the timeout limits a stall of the peer but not the transfer time.
+// The cancel function is called on the first error of the connection.
+type timeConn struct {
+    net.Conn
+    mtx         sync.Mutex
+    timeout     time.Duration
+    cancel      func()
+}
+
+func newTimeConn(conn net.Conn, timeout time.Duration, cancel func()) *timeConn {
+    return &timeConn{
+        Conn:       conn,
+        timeout:    timeout,
+        cancel:     cancel,
+    }
+}
+
+func (tconn *timeConn) setTimeout(timeout time.Duration) {
+    tconn.mtx.Lock()
+    defer tconn.mtx.Unlock()
+    tconn.timeout = timeout
+}
+
+func (tconn *timeConn) getTimeout() time.Duration {
+    tconn.mtx.Lock()
+    defer tconn.mtx.Unlock()
+    return tconn.timeout
+}
+
+func (tconn *timeConn) Read(data []byte) (int, error) {
+    timeout := tconn.getTimeout()
+    if timeout > 0 {
+        tconn.Conn.SetReadDeadline(time.Now().Add(timeout))
+    }
+    read, err := tconn.Conn.Read(data)
+    if err != nil && tconn.cancel != nil {
+        tconn.cancel()
+    }
+    return read, err
+}
+
+func (tconn *timeConn) Write(data []byte) (int, error) {
+    timeout := tconn.getTimeout()
+    if timeout > 0 {
+        tconn.Conn.SetWriteDeadline(time.Now().Add(timeout))
+    }
+    written, err := tconn.Conn.Write(data)
+    if err != nil && tconn.cancel != nil {
+        tconn.cancel()
+    }
+    return written, err
+}
+
+func (tconn *timeConn) peerVersion() int64 {
+    return peerVersion(tconn.Conn)
+}
+
+// watchPeer cancels the call when the peer closes the connection,
+// it is used only when the request data is completely read
+func (tconn *timeConn) watchPeer() {
+    tconn.Conn.SetReadDeadline(time.Time{})
+    buffer := make([]byte, 1)
+    tconn.Conn.Read(buffer)
+    if tconn.cancel != nil {
+        tconn.cancel()
+    }
+}
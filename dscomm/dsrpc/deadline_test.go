@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "io"
+    "net"
+    "os"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+const waitMethod string = "wait"
+
+func TestNetTimeouts(t *testing.T) {
+    var err error
+    canceled := make(chan bool, 1)
+    waitHandler := func(context *Context) error {
+        <- context.Ctx().Done()
+        canceled <- true
+        return context.SendResult(NewEmpty(), 0)
+    }
+    serv := NewService()
+    serv.Handler(waitMethod, waitHandler)
+    serv.Handler(sumMethod, sumHandler)
+    serv.SetIdleTimeout(200 * time.Millisecond)
+    serv.SetTransferTimeout(200 * time.Millisecond)
+    go serv.Listen("127.0.0.1:8084")
+    defer serv.Stop()
+    time.Sleep(10 * time.Millisecond)
+
+    // Connection without the request is dropped after the idle timeout
+    conn, err := net.Dial("tcp", "127.0.0.1:8084")
+    require.NoError(t, err)
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    _, err = io.ReadAll(conn)
+    require.NoError(t, err)
+    conn.Close()
+
+    // Stalled upload is dropped after the transfer timeout
+    conn, err = net.Dial("tcp", "127.0.0.1:8084")
+    require.NoError(t, err)
+    context := CreateContext(conn)
+    context.reqRPC.Method = sumMethod
+    context.reqRPC.Params = NewSaveParams()
+    context.reqHeader.binSize = 1024
+    err = context.CreateRequest()
+    require.NoError(t, err)
+    err = context.WriteRequest()
+    require.NoError(t, err)
+    _, err = conn.Write(make([]byte, 10))
+    require.NoError(t, err)
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    _, err = io.ReadAll(conn)
+    require.NoError(t, err)
+    conn.Close()
+
+    // Disconnect of the client cancels the context of the handler
+    conn, err = net.Dial("tcp", "127.0.0.1:8084")
+    require.NoError(t, err)
+    context = CreateContext(conn)
+    context.reqRPC.Method = waitMethod
+    context.reqRPC.Params = NewEmpty()
+    err = context.CreateRequest()
+    require.NoError(t, err)
+    err = context.WriteRequest()
+    require.NoError(t, err)
+    time.Sleep(50 * time.Millisecond)
+    conn.Close()
+    select {
+        case <- canceled:
+        case <- time.After(5 * time.Second):
+            t.Fatal("context of the handler is not canceled")
+    }
+}
+
+func TestTimeConn(t *testing.T) {
+    var err error
+    client, server := net.Pipe()
+    defer client.Close()
+    canceled := false
+    tconn := newTimeConn(server, 50 * time.Millisecond, func() { canceled = true })
+    defer tconn.Close()
+
+    start := time.Now()
+    _, err = tconn.Read(make([]byte, 1))
+    require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+    require.True(t, canceled)
+    require.Less(t, time.Since(start), 5 * time.Second)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "errors"
+    "fmt"
+)
+
+// ErrCode classifies the error of the response, zero code
+// comes from servers without codes and is taken as internal
+type ErrCode int64
+
+const (
+    CodeNone            ErrCode = 0
+    CodeInternal        ErrCode = 1
+    CodeNotFound        ErrCode = 2
+    CodeExists          ErrCode = 3
+    CodeUnauthorized    ErrCode = 4
+    CodeForbidden       ErrCode = 5
+    CodeQuotaExceeded   ErrCode = 6
+    CodeCorrupt         ErrCode = 7
+)
+
+var codeNames = map[ErrCode]string{
+    CodeNone:           "none",
+    CodeInternal:       "internal",
+    CodeNotFound:       "not found",
+    CodeExists:         "exists",
+    CodeUnauthorized:   "unauthorized",
+    CodeForbidden:      "forbidden",
+    CodeQuotaExceeded:  "quota exceeded",
+    CodeCorrupt:        "corrupt",
+}
+
+func (code ErrCode) String() string {
+    name, ok := codeNames[code]
+    if !ok {
+        return fmt.Sprintf("code %d", int64(code))
+    }
+    return name
+}
+
+// CodeError is the error with the code, the client returns it
+// for error responses. Errors with the same code match by errors.Is.
+type CodeError struct {
+    Code        ErrCode
+    Message     string
+}
+
+func NewCodeError(code ErrCode, format string, args ...any) error {
+    return &CodeError{ Code: code, Message: fmt.Sprintf(format, args...) }
+}
+
+func (codeErr *CodeError) Error() string {
+    return codeErr.Message
+}
+
+func (codeErr *CodeError) Is(target error) bool {
+    other, ok := target.(*CodeError)
+    return ok && other.Code == codeErr.Code
+}
+
+// Sentinels of the codes for errors.Is
+var (
+    ErrInternal         = &CodeError{ Code: CodeInternal, Message: "internal error" }
+    ErrNotFound         = &CodeError{ Code: CodeNotFound, Message: "not found" }
+    ErrExists           = &CodeError{ Code: CodeExists, Message: "already exists" }
+    ErrUnauthorized     = &CodeError{ Code: CodeUnauthorized, Message: "unauthorized" }
+    ErrForbidden        = &CodeError{ Code: CodeForbidden, Message: "forbidden" }
+    ErrQuotaExceeded    = &CodeError{ Code: CodeQuotaExceeded, Message: "quota exceeded" }
+    ErrCorrupt          = &CodeError{ Code: CodeCorrupt, Message: "data corrupted" }
+)
+
+// ErrorCode returns the code of the error, an error
+// without code is internal one
+func ErrorCode(err error) ErrCode {
+    if err == nil {
+        return CodeNone
+    }
+    var codeErr *CodeError
+    if errors.As(err, &codeErr) {
+        return codeErr.Code
+    }
+    return CodeInternal
+}
+
+// ErrorCoder maps errors of handlers to codes of the responses
+type ErrorCoder = func(err error) ErrCode
+
+// SetErrorCoder sets mapping of handler errors to the codes,
+// by default only CodeError has the code other than internal
+func (svc *Service) SetErrorCoder(coder ErrorCoder) {
+    svc.errorCoder = coder
+}
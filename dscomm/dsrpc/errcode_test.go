@@ -0,0 +1,54 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+var errMissing = errors.New("missing thing")
+
+func TestErrorCodes(t *testing.T) {
+    var err error
+    codeHandler := func(context *Context) error {
+        return context.SendError(NewCodeError(CodeExists, "thing %d exists", 1))
+    }
+    params := NewHelloParams()
+    result := NewHelloResult()
+    err = LocalExec(identMethod, params, result, nil, codeHandler)
+    require.ErrorIs(t, err, ErrExists)
+    require.False(t, errors.Is(err, ErrNotFound))
+    require.Equal(t, CodeExists, ErrorCode(err))
+
+    // Errors without code are internal
+    plainHandler := func(context *Context) error {
+        return context.SendError(errMissing)
+    }
+    err = LocalExec(identMethod, params, result, nil, plainHandler)
+    require.ErrorIs(t, err, ErrInternal)
+    require.Equal(t, "missing thing", err.(*CodeError).Message)
+
+    // Coder of the service maps errors of handlers
+    serv := NewService()
+    serv.Handler(identMethod, plainHandler)
+    serv.SetErrorCoder(func(err error) ErrCode {
+        if errors.Is(err, errMissing) {
+            return CodeNotFound
+        }
+        return ErrorCode(err)
+    })
+    go serv.Listen("127.0.0.1:8086")
+    defer serv.Stop()
+    time.Sleep(10 * time.Millisecond)
+
+    err = Exec("127.0.0.1:8086", identMethod, params, result, nil)
+    require.ErrorIs(t, err, ErrNotFound)
+    require.Equal(t, CodeNotFound, ErrorCode(err))
+    require.Equal(t, "not found", CodeNotFound.String())
+}
@@ -31,11 +31,11 @@ func Err(err error) error {
             case develMode == true:
                 pc, filename, line, _ := runtime.Caller(1)
                 funcName := runtime.FuncForPC(pc).Name()
-                err = fmt.Errorf(" %s:%d:%s:%s", filename, line, funcName, err.Error())
+                err = fmt.Errorf(" %s:%d:%s:%w", filename, line, funcName, err)
             case debugMode == true:
                 pc, _, line, _ := runtime.Caller(1)
                 funcName := runtime.FuncForPC(pc).Name()
-                err = fmt.Errorf(" %s:%d:%s ", funcName, line, err.Error())
+                err = fmt.Errorf(" %s:%d:%w ", funcName, line, err)
             default:
         }
     }
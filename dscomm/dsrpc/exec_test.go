@@ -6,10 +6,15 @@ package dsrpc
 
 import (
     "bytes"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
     "errors"
     "io"
     "math/rand"
+    "net"
+    "sync"
+    "sync/atomic"
     "testing"
     "time"
 
@@ -96,6 +101,243 @@ func TestNetLoad(t *testing.T) {
     require.NoError(t, err)
 }
 
+func TestNetToken(t *testing.T) {
+    go testServ(false)
+    time.Sleep(10 * time.Millisecond)
+
+    params := NewHelloParams()
+    params.Message = "hello server!"
+    result := NewHelloResult()
+    auth := CreateTokenAuth([]byte(testToken))
+    err := Exec("127.0.0.1:8081", identMethod, params, result, auth)
+    require.NoError(t, err)
+    // Ident set by middleware is kept after binding of params
+    require.Equal(t, "qwert", result.Message)
+
+    auth = CreateTokenAuth([]byte("wrong"))
+    err = Exec("127.0.0.1:8081", identMethod, params, result, auth)
+    require.Error(t, err)
+}
+
+func TestNetPool(t *testing.T) {
+    go testServ(false)
+    time.Sleep(10 * time.Millisecond)
+
+    pool := NewPool()
+    defer pool.Close()
+    auth := CreateAuth([]byte("qwert"), []byte("12345"))
+
+    var wg sync.WaitGroup
+    errs := make(chan error, 30)
+    for i := 0; i < 10; i++ {
+        wg.Add(3)
+        go func() {
+            defer wg.Done()
+            params := NewHelloParams()
+            result := NewHelloResult()
+            errs <- pool.Exec("127.0.0.1:8081", HelloMethod, params, result, auth)
+        }()
+        go func() {
+            defer wg.Done()
+            // Data is larger than the stream window
+            binBytes := make([]byte, 1024 * 1024 + 7)
+            rand.Read(binBytes)
+            hash := sha256.Sum256(binBytes)
+            params := NewSaveParams()
+            result := NewSaveResult()
+            err := pool.Put("127.0.0.1:8081", sumMethod, bytes.NewReader(binBytes), int64(len(binBytes)),
+                                                                params, result, auth)
+            if err == nil && result.Message != hex.EncodeToString(hash[:]) {
+                err = errors.New("wrong sum of data")
+            }
+            errs <- err
+        }()
+        go func() {
+            defer wg.Done()
+            params := NewLoadParams()
+            result := NewLoadResult()
+            writer := bytes.NewBuffer(make([]byte, 0))
+            err := pool.Get("127.0.0.1:8081", LoadMethod, writer, params, result, auth)
+            if err == nil && writer.Len() != 1024 {
+                err = errors.New("wrong size of data")
+            }
+            errs <- err
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        require.NoError(t, err)
+    }
+    require.Equal(t, 1, len(pool.sessions))
+    // Streams are dropped after close of both sides
+    for _, session := range pool.sessions {
+        require.Equal(t, ProtocolVersion, session.version)
+        dropped := func() bool {
+            return session.count() == 0
+        }
+        require.Eventually(t, dropped, time.Second, 10 * time.Millisecond)
+    }
+
+    // Wrong auth fails the call but not the connection
+    params := NewHelloParams()
+    result := NewHelloResult()
+    err := pool.Exec("127.0.0.1:8081", HelloMethod, params, result, CreateAuth([]byte("qwert"), []byte("wrong")))
+    require.Error(t, err)
+    err = pool.Exec("127.0.0.1:8081", HelloMethod, params, result, auth)
+    require.NoError(t, err)
+
+    // Broken connection is replaced by new one
+    for _, session := range pool.sessions {
+        session.Close()
+    }
+    err = pool.Exec("127.0.0.1:8081", HelloMethod, params, result, auth)
+    require.NoError(t, err)
+}
+
+func TestNetPoolLegacy(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:8083")
+    require.NoError(t, err)
+    defer listener.Close()
+
+    // Old server knows nothing about mux
+    var muxCalls int32
+    legacyHandler := func(context *Context) error {
+        if context.Method() == MuxMethod {
+            atomic.AddInt32(&muxCalls, 1)
+            return notFound(context)
+        }
+        return identHandler(context)
+    }
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            LocalService(conn, legacyHandler)
+            conn.Close()
+        }
+    }()
+    pool := NewPool()
+    defer pool.Close()
+    pool.legacyTTL = 100 * time.Millisecond
+    params := NewHelloParams()
+    result := NewHelloResult()
+    for i := 0; i < 2; i++ {
+        err = pool.Exec("127.0.0.1:8083", identMethod, params, result, CreateTokenAuth([]byte(testToken)))
+        require.NoError(t, err)
+    }
+    require.Contains(t, pool.legacy, "127.0.0.1:8083")
+    require.Equal(t, 0, len(pool.sessions))
+    require.Equal(t, int32(1), atomic.LoadInt32(&muxCalls))
+
+    // Mux is tried again after the legacy mark expires
+    time.Sleep(150 * time.Millisecond)
+    err = pool.Exec("127.0.0.1:8083", identMethod, params, result, CreateTokenAuth([]byte(testToken)))
+    require.NoError(t, err)
+    require.Equal(t, int32(2), atomic.LoadInt32(&muxCalls))
+}
+
+func TestNetPoolDial(t *testing.T) {
+    go testServ(false)
+    time.Sleep(10 * time.Millisecond)
+
+    // Server accepts the connection but never answers
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    require.NoError(t, err)
+    defer listener.Close()
+    stalled := listener.Addr().String()
+    conns := make(chan net.Conn, 10)
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            conns <- conn
+        }
+    }()
+
+    pool := NewPool()
+    defer pool.Close()
+    errs := make(chan error, 3)
+    for i := 0; i < 3; i++ {
+        go func() {
+            errs <- pool.Exec(stalled, HelloMethod, NewHelloParams(), NewHelloResult(), nil)
+        }()
+    }
+    var conn net.Conn
+    select {
+        case conn = <-conns:
+        case <-time.After(5 * time.Second):
+            t.Fatal("connection is not dialed")
+    }
+
+    // Stalled address does not stop calls to others
+    auth := CreateAuth([]byte("qwert"), []byte("12345"))
+    err = pool.Exec("127.0.0.1:8081", HelloMethod, NewHelloParams(), NewHelloResult(), auth)
+    require.NoError(t, err)
+
+    // Concurrent calls wait for the single connection
+    time.Sleep(50 * time.Millisecond)
+    conn.Close()
+    for i := 0; i < 3; i++ {
+        require.Error(t, <-errs)
+    }
+    require.Equal(t, 0, len(conns))
+}
+
+func TestNetPoolRetry(t *testing.T) {
+    var err error
+    go testServ(false)
+    time.Sleep(10 * time.Millisecond)
+
+    address := "127.0.0.1:8081"
+    auth := CreateAuth([]byte("qwert"), []byte("12345"))
+    pool := NewPool()
+    defer pool.Close()
+    err = pool.Exec(address, HelloMethod, NewHelloParams(), NewHelloResult(), auth)
+    require.NoError(t, err)
+
+    // Connection closed before the request is sent is dialed again
+    attempts := 0
+    direct := func() error {
+        return errors.New("unexpected one-shot call")
+    }
+    call := func(conn net.Conn) error {
+        attempts++
+        if attempts == 1 {
+            pool.sessions[address].Close()
+        }
+        return ConnExec(conn, HelloMethod, NewHelloParams(), NewHelloResult(), auth)
+    }
+    session := pool.sessions[address]
+    err = pool.call(address, direct, call)
+    require.NoError(t, err)
+    require.Equal(t, 2, attempts)
+    require.NotEqual(t, session, pool.sessions[address])
+
+    // Call with the sent request is not repeated
+    attempts = 0
+    call = func(conn net.Conn) error {
+        attempts++
+        _, err := conn.Write([]byte{ 0 })
+        if err != nil {
+            return err
+        }
+        pool.sessions[address].Close()
+        return ConnExec(conn, HelloMethod, NewHelloParams(), NewHelloResult(), auth)
+    }
+    err = pool.call(address, direct, call)
+    require.Error(t, err)
+    require.Equal(t, 1, attempts)
+
+    // Closed connection of the pool is replaced by the next call
+    err = pool.Exec(address, HelloMethod, NewHelloParams(), NewHelloResult(), auth)
+    require.NoError(t, err)
+}
+
 func BenchmarkNetPut(b *testing.B) {
     go testServ(true)
     time.Sleep(10 * time.Millisecond)
@@ -202,6 +444,9 @@ func testServ(quiet bool) error {
     serv.Handler(HelloMethod, helloHandler)
     serv.Handler(SaveMethod, saveHandler)
     serv.Handler(LoadMethod, loadHandler)
+    serv.Handler(identMethod, identHandler)
+    serv.Handler(sumMethod, sumHandler)
+    serv.SetVerifierFunc(testVerifier)
 
     serv.PreMiddleware(LogRequest)
     serv.PreMiddleware(auth)
@@ -216,19 +461,33 @@ func testServ(quiet bool) error {
     return err
 }
 
-func auth(context *Context) error {
+func testVerifier(ident []byte) (*Verifier, error) {
     var err error
-    reqIdent := context.AuthIdent()
-    reqSalt := context.AuthSalt()
-    reqHash := context.AuthHash()
-
-    ident := reqIdent
     pass := []byte("12345")
+    verifier := DeriveVerifier(pass, ident, DefaultIter)
+    return verifier, err
+}
+
+const testToken string = "token-of-qwert"
+
+func auth(context *Context) error {
+    var err error
+    if context.HasToken() {
+        if string(context.AuthToken()) != testToken {
+            err = errors.New("wrong token")
+            context.SendError(err)
+            return err
+        }
+        context.SetAuthIdent([]byte("qwert"))
+        return err
+    }
+    ident := context.AuthIdent()
 
     auth := context.Auth()
     logDebug("auth ", string(auth.JSON()))
 
-    ok := CheckHash(ident, pass, reqSalt, reqHash)
+    verifier, _ := testVerifier(ident)
+    ok := context.CheckProof(verifier)
     logDebug("auth ok:", ok)
     if !ok {
         err = errors.New("auth ident or pass missmatch")
@@ -263,6 +522,48 @@ func helloHandler(context *Context) error {
     return err
 }
 
+const identMethod string = "ident"
+
+func identHandler(context *Context) error {
+    var err error
+    params := NewHelloParams()
+    err = context.BindParams(params)
+    if err != nil {
+        return err
+    }
+    result := NewHelloResult()
+    result.Message = string(context.AuthIdent())
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+const sumMethod string = "sum"
+
+func sumHandler(context *Context) error {
+    var err error
+    params := NewSaveParams()
+    err = context.BindParams(params)
+    if err != nil {
+        return err
+    }
+    hasher := sha256.New()
+    err = context.ReadBin(hasher)
+    if err != nil {
+        context.SendError(err)
+        return err
+    }
+    result := NewSaveResult()
+    result.Message = hex.EncodeToString(hasher.Sum(nil))
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
 func saveHandler(context *Context) error {
     var err error
     params := NewSaveParams()
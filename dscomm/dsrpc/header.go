@@ -11,6 +11,8 @@ import (
     "encoding/binary"
     "encoding/json"
     "bytes"
+    "fmt"
+    "net"
 )
 
 const headerSize    int64   = 16 * 2
@@ -18,11 +20,19 @@ const sizeOfInt64   int     = 8
 const magicCodeA    int64   = 0xEE00ABBA
 const magicCodeB    int64   = 0xEE44ABBA
 
+// The protocol version is sent in the high half of the second magic code,
+// peers before versioning send and require zero version. Requests go with
+// zero version until the peer shows its own, the response has the version
+// of the request, so old clients get the header they know.
+const ProtocolVersion   int64   = 1
+const magicMaskB        int64   = 0xFFFFFFFF
+
 type Header struct {
-    magicCodeA  int64   `json:"magicCodeA"`
-    rpcSize     int64   `json:"rpcSize"`
-    binSize     int64   `json:"binSize"`
-    magicCodeB  int64   `json:"magicCodeB"`
+    magicCodeA  int64
+    rpcSize     int64
+    binSize     int64
+    magicCodeB  int64
+    version     int64
 }
 
 
@@ -33,8 +43,21 @@ func NewHeader() *Header {
     }
 }
 
+func (hdr *Header) Version() int64 {
+    return hdr.version
+}
+
 func (hdr *Header) JSON() []byte {
-    jBytes, _ := json.Marshal(hdr)
+    jHeader := struct {
+        RpcSize     int64   `json:"rpcSize"`
+        BinSize     int64   `json:"binSize"`
+        Version     int64   `json:"version"`
+    }{
+        RpcSize:    hdr.rpcSize,
+        BinSize:    hdr.binSize,
+        Version:    hdr.version,
+    }
+    jBytes, _ := json.Marshal(jHeader)
     return jBytes
 }
 
@@ -53,15 +76,21 @@ func (hdr *Header) Pack() ([]byte, error) {
     binSizeBytes := encoderI64(hdr.binSize)
     headerBuffer.Write(binSizeBytes)
 
-    magicCodeBBytes := encoderI64(hdr.magicCodeB)
+    magicCodeBBytes := encoderI64(hdr.version << 32 | hdr.magicCodeB & magicMaskB)
     headerBuffer.Write(magicCodeBBytes)
 
     return headerBuffer.Bytes(), Err(err)
 }
 
+// UnpackHeader checks the sizes before any allocation by them,
+// the binary size can be ChunkedSize for the data of unknown size
 func UnpackHeader(headerBytes []byte) (*Header, error) {
     var err error
     header := NewHeader()
+    if int64(len(headerBytes)) != headerSize {
+        err = fmt.Errorf("wrong header size %d", len(headerBytes))
+        return header, Err(err)
+    }
     headerReader := bytes.NewReader(headerBytes)
 
     magicCodeABytes := make([]byte, sizeOfInt64)
@@ -78,12 +107,25 @@ func UnpackHeader(headerBytes []byte) (*Header, error) {
 
     magicCodeBBytes := make([]byte, sizeOfInt64)
     headerReader.Read(magicCodeBBytes)
-    header.magicCodeB = decoderI64(magicCodeBBytes)
+    header.magicCodeB = decoderI64(magicCodeBBytes) & magicMaskB
+    header.version = int64(uint64(decoderI64(magicCodeBBytes)) >> 32)
 
     if header.magicCodeA != magicCodeA || header.magicCodeB != magicCodeB {
         err = errors.New("wrong protocol magic code")
         return header, Err(err)
     }
+    if header.version > ProtocolVersion {
+        err = fmt.Errorf("unsupported protocol version %d", header.version)
+        return header, Err(err)
+    }
+    if header.rpcSize < 0 {
+        err = fmt.Errorf("wrong rpc size %d", header.rpcSize)
+        return header, Err(err)
+    }
+    if header.binSize < ChunkedSize {
+        err = fmt.Errorf("wrong binary size %d", header.binSize)
+        return header, Err(err)
+    }
     return header, Err(err)
 }
 
@@ -96,3 +138,13 @@ func encoderI64(i int64) []byte {
 func decoderI64(b []byte) int64 {
     return int64(binary.BigEndian.Uint64(b))
 }
+
+// peerVersion returns the protocol version shown by the peer
+// of the connection, zero for unknown peer
+func peerVersion(conn net.Conn) int64 {
+    versioned, ok := conn.(interface{ peerVersion() int64 })
+    if !ok {
+        return 0
+    }
+    return versioned.peerVersion()
+}
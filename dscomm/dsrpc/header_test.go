@@ -0,0 +1,299 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "bytes"
+    "errors"
+    "net"
+    "os"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestHeader(t *testing.T) {
+    var err error
+    header := NewHeader()
+    require.Equal(t, int64(0), header.Version())
+    header.version = ProtocolVersion
+    header.rpcSize = 123
+    header.binSize = ChunkedSize
+    packed, err := header.Pack()
+    require.NoError(t, err)
+    require.Equal(t, headerSize, int64(len(packed)))
+
+    unpacked, err := UnpackHeader(packed)
+    require.NoError(t, err)
+    require.Equal(t, header, unpacked)
+
+    // Header of the peer before versioning
+    header.version = 0
+    packed, _ = header.Pack()
+    require.Equal(t, encoderI64(magicCodeB), packed[headerSize - int64(sizeOfInt64):])
+    unpacked, err = UnpackHeader(packed)
+    require.NoError(t, err)
+    require.Equal(t, int64(0), unpacked.Version())
+
+    header.version = ProtocolVersion + 1
+    packed, _ = header.Pack()
+    _, err = UnpackHeader(packed)
+    require.Error(t, err)
+
+    header.version = ProtocolVersion
+    header.rpcSize = -1
+    packed, _ = header.Pack()
+    _, err = UnpackHeader(packed)
+    require.Error(t, err)
+
+    header.rpcSize = 1
+    header.binSize = ChunkedSize - 1
+    packed, _ = header.Pack()
+    _, err = UnpackHeader(packed)
+    require.Error(t, err)
+
+    _, err = UnpackHeader(packed[1:])
+    require.Error(t, err)
+}
+
+// baselineUnpack parses the header as servers before versioning,
+// the second magic code has to be exact
+func baselineUnpack(headerBytes []byte) (int64, error) {
+    var err error
+    if decoderI64(headerBytes[0:8]) != magicCodeA || decoderI64(headerBytes[24:32]) != magicCodeB {
+        err = errors.New("wrong protocol magic code")
+        return 0, err
+    }
+    return decoderI64(headerBytes[8:16]), err
+}
+
+func TestBaselinePeer(t *testing.T) {
+    var err error
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    require.NoError(t, err)
+    defer listener.Close()
+    address := listener.Addr().String()
+
+    // Baseline server answers any method by not found error
+    headerErrs := make(chan error, 10)
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            headerBytes, err := ReadBytes(conn, headerSize)
+            if err != nil {
+                conn.Close()
+                continue
+            }
+            rpcSize, err := baselineUnpack(headerBytes)
+            headerErrs <- err
+            if err != nil {
+                conn.Close()
+                continue
+            }
+            ReadBytes(conn, rpcSize)
+            response := NewResponse()
+            response.Error = "method not found"
+            response.Result = NewEmpty()
+            payload, _ := response.Pack()
+            header := NewHeader()
+            header.rpcSize = int64(len(payload))
+            packed, _ := header.Pack()
+            conn.Write(packed)
+            conn.Write(payload)
+            conn.Close()
+        }
+    }()
+
+    params := NewHelloParams()
+    result := NewHelloResult()
+    err = Exec(address, HelloMethod, params, result, nil)
+    require.ErrorContains(t, err, "method not found")
+    require.NoError(t, <-headerErrs)
+
+    // Pool falls back to one-shot calls after the refused mux
+    pool := NewPool()
+    defer pool.Close()
+    err = pool.Exec(address, HelloMethod, params, result, nil)
+    require.ErrorContains(t, err, "method not found")
+    require.NoError(t, <-headerErrs)
+    require.NoError(t, <-headerErrs)
+    require.Contains(t, pool.legacy, address)
+}
+
+func TestNetLimits(t *testing.T) {
+    var err error
+    serv := NewService()
+    serv.Handler(sumMethod, sumHandler)
+    serv.SetMaxRPCSize(1024)
+    serv.SetMaxBinSize(sumMethod, 1024)
+    serv.SetMaxConns(1)
+    go serv.Listen("127.0.0.1:8085")
+    defer serv.Stop()
+    time.Sleep(10 * time.Millisecond)
+
+    // The slot is free after the server side of the closed connection is done
+    waitSlot := func() {
+        require.Eventually(t, func() bool {
+            return len(serv.slots) == 0
+        }, 5 * time.Second, 5 * time.Millisecond)
+    }
+
+    // Huge rpc size is refused without allocation
+    conn, err := net.Dial("tcp", "127.0.0.1:8085")
+    require.NoError(t, err)
+    header := NewHeader()
+    header.rpcSize = 1 << 60
+    packed, _ := header.Pack()
+    _, err = conn.Write(packed)
+    require.NoError(t, err)
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    _, err = ReadBytes(conn, headerSize)
+    require.Error(t, err)
+    conn.Close()
+    waitSlot()
+
+    params := NewSaveParams()
+    result := NewSaveResult()
+    err = Put("127.0.0.1:8085", sumMethod, bytes.NewReader(make([]byte, 1024)), 1024, params, result, nil)
+    require.NoError(t, err)
+    waitSlot()
+
+    err = Put("127.0.0.1:8085", sumMethod, bytes.NewReader(make([]byte, 1025)), 1025, params, result, nil)
+    require.Error(t, err)
+    waitSlot()
+
+    err = Put("127.0.0.1:8085", sumMethod, bytes.NewReader(make([]byte, 4096)), ChunkedSize, params, result, nil)
+    require.Error(t, err)
+    waitSlot()
+
+    // Connection over the limit is closed at once
+    conn, err = net.Dial("tcp", "127.0.0.1:8085")
+    require.NoError(t, err)
+    defer conn.Close()
+    time.Sleep(50 * time.Millisecond)
+    over, err := net.Dial("tcp", "127.0.0.1:8085")
+    require.NoError(t, err)
+    defer over.Close()
+    over.SetReadDeadline(time.Now().Add(5 * time.Second))
+    _, err = ReadBytes(over, 1)
+    require.Error(t, err)
+    require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+}
+
+func TestNetStreamLimits(t *testing.T) {
+    var err error
+    started := make(chan bool, 10)
+    release := make(chan bool)
+    blockHandler := func(context *Context) error {
+        started <- true
+        <-release
+        return context.SendResult(NewEmpty(), 0)
+    }
+    serv := NewService()
+    serv.Handler(waitMethod, blockHandler)
+    serv.Handler(sumMethod, sumHandler)
+    serv.SetMaxStreams(2)
+    serv.SetMaxConns(4)
+    go serv.Listen("127.0.0.1:8087")
+    defer serv.Stop()
+    var releaseOnce sync.Once
+    releaseFunc := func() {
+        releaseOnce.Do(func() { close(release) })
+    }
+    defer releaseFunc()
+    time.Sleep(10 * time.Millisecond)
+
+    pool := NewPool()
+    defer pool.Close()
+    errs := make(chan error, 2)
+    for i := 0; i < 2; i++ {
+        go func() {
+            errs <- pool.Exec("127.0.0.1:8087", waitMethod, NewEmpty(), NewEmpty(), nil)
+        }()
+    }
+    for i := 0; i < 2; i++ {
+        select {
+            case <-started:
+            case <-time.After(5 * time.Second):
+                t.Fatal("stream is not started")
+        }
+    }
+
+    // Stream over the limit of the connection is refused
+    params := NewSaveParams()
+    result := NewSaveResult()
+    err = pool.Put("127.0.0.1:8087", sumMethod, bytes.NewReader(make([]byte, 16)), 16, params, result, nil)
+    require.Error(t, err)
+
+    // Running streams are counted with connections
+    conn, err := net.Dial("tcp", "127.0.0.1:8087")
+    require.NoError(t, err)
+    time.Sleep(50 * time.Millisecond)
+    err = Put("127.0.0.1:8087", sumMethod, bytes.NewReader(make([]byte, 16)), 16, params, result, nil)
+    require.Error(t, err)
+    conn.Close()
+
+    releaseFunc()
+    for i := 0; i < 2; i++ {
+        require.NoError(t, <-errs)
+    }
+    slotsFree := func() bool {
+        return len(serv.slots) == 1
+    }
+    require.Eventually(t, slotsFree, time.Second, 10 * time.Millisecond)
+    err = pool.Put("127.0.0.1:8087", sumMethod, bytes.NewReader(make([]byte, 16)), 16, params, result, nil)
+    require.NoError(t, err)
+    err = Put("127.0.0.1:8087", sumMethod, bytes.NewReader(make([]byte, 16)), 16, params, result, nil)
+    require.NoError(t, err)
+}
+
+func FuzzUnpackHeader(f *testing.F) {
+    header := NewHeader()
+    header.rpcSize = 100
+    header.binSize = 1000
+    packed, _ := header.Pack()
+    f.Add(packed)
+    header.binSize = ChunkedSize
+    packed, _ = header.Pack()
+    f.Add(packed)
+    f.Add(make([]byte, headerSize))
+    f.Fuzz(func(t *testing.T, data []byte) {
+        header, err := UnpackHeader(data)
+        if err != nil {
+            return
+        }
+        if header.rpcSize < 0 || header.binSize < ChunkedSize || header.version > ProtocolVersion {
+            t.Fatalf("wrong header is accepted: %s", string(header.JSON()))
+        }
+        packed, err := header.Pack()
+        require.NoError(t, err)
+        require.Equal(t, data, packed)
+    })
+}
+
+func FuzzBindMethod(f *testing.F) {
+    request := NewRequest()
+    request.Method = sumMethod
+    request.Params = NewSaveParams()
+    payload, _ := request.Pack()
+    f.Add(payload)
+    f.Add([]byte{})
+    f.Add([]byte{ 0x81, 0xa6 })
+    f.Fuzz(func(t *testing.T, data []byte) {
+        context := CreateContext(nil)
+        context.reqPacket.rcpPayload = data
+        err := context.BindMethod()
+        if err != nil {
+            return
+        }
+        params := NewSaveParams()
+        context.BindParams(params)
+    })
+}
@@ -0,0 +1,549 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "os"
+    "sync"
+    "time"
+)
+
+// The mux connection carries many streams, each stream is the byte
+// pipe with the usual one-shot exchange: header, rpc payload and
+// binary data. The connection is switched to mux by MuxMethod call.
+//
+// Frame is the header of four int64: magic code, stream id, frame kind
+// and size. Data frame is followed by size bytes, ack frame returns
+// size bytes of the send window, close frame ends the stream.
+
+const MuxMethod string = "rpcMux"
+
+const magicCodeM    int64   = 0xEE88ABBA
+const frameSize     int64   = int64(sizeOfInt64) * 4
+const muxChunkSize  int64   = 32 * 1024
+const muxWindow     int64   = 256 * 1024
+const muxMaxRefused int64   = 1024
+
+const (
+    frameData   int64 = 1
+    frameAck    int64 = 2
+    frameClose  int64 = 3
+)
+
+var errMuxClosed = errors.New("mux connection closed")
+var errStreamClosed = errors.New("mux stream closed")
+
+type muxSession struct {
+    conn        net.Conn
+    wMtx        sync.Mutex
+    mtx         sync.Mutex
+    streams     map[int64]*muxStream
+    nextId      int64
+    refused     map[int64]bool
+    accept      func(*muxStream) bool
+    refuse      bool
+    maxStreams  int
+    err         error
+    done        chan struct{}
+    idleTimeout     time.Duration
+    writeTimeout    time.Duration
+    version         int64
+}
+
+func newMuxSession(conn net.Conn, accept func(*muxStream) bool) *muxSession {
+    session := &muxSession{}
+    session.conn = conn
+    session.streams = make(map[int64]*muxStream)
+    session.refused = make(map[int64]bool)
+    session.accept = accept
+    session.done = make(chan struct{})
+    return session
+}
+
+// openStream makes new stream on the client side
+func (session *muxSession) openStream() (*muxStream, error) {
+    var err error
+    session.mtx.Lock()
+    defer session.mtx.Unlock()
+    if session.err != nil {
+        return nil, Err(session.err)
+    }
+    session.nextId++
+    stream := newMuxStream(session, session.nextId)
+    session.streams[stream.id] = stream
+    return stream, Err(err)
+}
+
+// drain refuses new streams of the peer, running streams are not affected
+func (session *muxSession) drain() {
+    session.mtx.Lock()
+    defer session.mtx.Unlock()
+    session.refuse = true
+}
+
+func (session *muxSession) alive() bool {
+    session.mtx.Lock()
+    defer session.mtx.Unlock()
+    return session.err == nil
+}
+
+func (session *muxSession) count() int {
+    session.mtx.Lock()
+    defer session.mtx.Unlock()
+    return len(session.streams)
+}
+
+// Close breaks the connection and all its streams
+func (session *muxSession) Close() error {
+    return Err(session.fail(errMuxClosed))
+}
+
+func (session *muxSession) fail(cause error) error {
+    var err error
+    session.mtx.Lock()
+    if session.err != nil {
+        session.mtx.Unlock()
+        return err
+    }
+    session.err = cause
+    streams := session.streams
+    session.streams = make(map[int64]*muxStream)
+    close(session.done)
+    session.mtx.Unlock()
+
+    err = session.conn.Close()
+    for _, stream := range streams {
+        stream.mtx.Lock()
+        stream.cond.Broadcast()
+        stream.mtx.Unlock()
+    }
+    return Err(err)
+}
+
+func (session *muxSession) writeFrame(streamId, kind int64, data []byte) error {
+    var err error
+    frame := make([]byte, 0, frameSize + int64(len(data)))
+    frame = append(frame, encoderI64(magicCodeM)...)
+    frame = append(frame, encoderI64(streamId)...)
+    frame = append(frame, encoderI64(kind)...)
+    frame = append(frame, encoderI64(int64(len(data)))...)
+    frame = append(frame, data...)
+
+    session.wMtx.Lock()
+    defer session.wMtx.Unlock()
+    if !session.alive() {
+        return Err(errMuxClosed)
+    }
+    // Stalled peer breaks the connection
+    if session.writeTimeout > 0 {
+        session.conn.SetWriteDeadline(time.Now().Add(session.writeTimeout))
+    }
+    _, err = session.conn.Write(frame)
+    if err != nil {
+        session.fail(err)
+        return Err(err)
+    }
+    return Err(err)
+}
+
+func (session *muxSession) writeAck(streamId, size int64) error {
+    var err error
+    frame := make([]byte, 0, frameSize)
+    frame = append(frame, encoderI64(magicCodeM)...)
+    frame = append(frame, encoderI64(streamId)...)
+    frame = append(frame, encoderI64(frameAck)...)
+    frame = append(frame, encoderI64(size)...)
+
+    session.wMtx.Lock()
+    defer session.wMtx.Unlock()
+    if !session.alive() {
+        return Err(errMuxClosed)
+    }
+    if session.writeTimeout > 0 {
+        session.conn.SetWriteDeadline(time.Now().Add(session.writeTimeout))
+    }
+    _, err = session.conn.Write(frame)
+    if err != nil {
+        session.fail(err)
+        return Err(err)
+    }
+    return Err(err)
+}
+
+// loop reads frames of the connection until the error,
+// the connection without streams is closed after idle timeout
+func (session *muxSession) loop() error {
+    var err error
+    for {
+        if session.idleTimeout > 0 {
+            deadline := time.Time{}
+            if session.count() == 0 {
+                deadline = time.Now().Add(session.idleTimeout)
+            }
+            session.conn.SetReadDeadline(deadline)
+        }
+        err = session.readFrame()
+        if err != nil {
+            session.fail(err)
+            return Err(err)
+        }
+    }
+}
+
+func (session *muxSession) readFrame() error {
+    var err error
+    frame, err := ReadBytes(session.conn, frameSize)
+    if err != nil {
+        return Err(err)
+    }
+    magic := decoderI64(frame[0:8])
+    streamId := decoderI64(frame[8:16])
+    kind := decoderI64(frame[16:24])
+    size := decoderI64(frame[24:32])
+    if magic != magicCodeM {
+        err = errors.New("wrong mux magic code")
+        return Err(err)
+    }
+    switch kind {
+        case frameData:
+            if size < 1 || size > muxChunkSize {
+                err = fmt.Errorf("wrong mux frame size %d", size)
+                return Err(err)
+            }
+            data, err := ReadBytes(session.conn, size)
+            if err != nil {
+                return Err(err)
+            }
+            stream, err := session.getStream(streamId, true)
+            if stream == nil {
+                return Err(err)
+            }
+            err = stream.push(data)
+            if err != nil {
+                return Err(err)
+            }
+        case frameAck:
+            stream, _ := session.getStream(streamId, false)
+            if stream == nil {
+                return Err(err)
+            }
+            stream.addCredit(size)
+        case frameClose:
+            stream, _ := session.getStream(streamId, false)
+            if stream == nil {
+                session.forgetRefused(streamId)
+                return Err(err)
+            }
+            stream.remoteClose()
+        default:
+            err = fmt.Errorf("wrong mux frame kind %d", kind)
+            return Err(err)
+    }
+    return Err(err)
+}
+
+// getStream returns the stream of the frame, the first data frame of
+// the peer opens new stream on the accepting side. First frames of
+// the peer streams may come in any order of ids. The stream over
+// the limit or refused by accept is closed at once and its id is kept
+// until the close of the peer, so the rest of its frames are dropped.
+func (session *muxSession) getStream(streamId int64, create bool) (*muxStream, error) {
+    var err error
+    session.mtx.Lock()
+    stream, ok := session.streams[streamId]
+    if ok {
+        session.mtx.Unlock()
+        return stream, Err(err)
+    }
+    if !create || session.accept == nil || session.refused[streamId] {
+        session.mtx.Unlock()
+        return nil, Err(err)
+    }
+    over := session.maxStreams > 0 && len(session.streams) >= session.maxStreams
+    if session.refuse || over {
+        session.mtx.Unlock()
+        return nil, Err(session.refuseStream(streamId))
+    }
+    stream = newMuxStream(session, streamId)
+    // Accepted under the lock, so no stream starts after drain
+    if !session.accept(stream) {
+        session.mtx.Unlock()
+        return nil, Err(session.refuseStream(streamId))
+    }
+    session.streams[streamId] = stream
+    session.mtx.Unlock()
+    return stream, Err(err)
+}
+
+// refuseStream closes the stream of the peer and keeps its id,
+// the peer holding too many refused streams breaks the connection
+func (session *muxSession) refuseStream(streamId int64) error {
+    var err error
+    session.mtx.Lock()
+    if int64(len(session.refused)) >= muxMaxRefused {
+        session.mtx.Unlock()
+        err = errors.New("too many refused mux streams")
+        return Err(err)
+    }
+    session.refused[streamId] = true
+    session.mtx.Unlock()
+    session.writeFrame(streamId, frameClose, nil)
+    return Err(err)
+}
+
+func (session *muxSession) forgetRefused(streamId int64) {
+    session.mtx.Lock()
+    defer session.mtx.Unlock()
+    delete(session.refused, streamId)
+}
+
+func (session *muxSession) dropStream(streamId int64) {
+    session.mtx.Lock()
+    defer session.mtx.Unlock()
+    delete(session.streams, streamId)
+}
+
+// muxStream is the stream of the mux connection, it is used as net.Conn
+// by the client and the server code
+type muxStream struct {
+    session     *muxSession
+    id          int64
+    mtx         sync.Mutex
+    cond        *sync.Cond
+    buffer      bytes.Buffer
+    unacked     int64
+    credit      int64
+    closed      bool
+    rClosed     bool
+    sent        bool
+    rDeadline   time.Time
+    wDeadline   time.Time
+    rTimer      *time.Timer
+    wTimer      *time.Timer
+}
+
+func newMuxStream(session *muxSession, id int64) *muxStream {
+    stream := &muxStream{}
+    stream.session = session
+    stream.id = id
+    stream.credit = muxWindow
+    stream.cond = sync.NewCond(&stream.mtx)
+    return stream
+}
+
+func (stream *muxStream) push(data []byte) error {
+    var err error
+    stream.mtx.Lock()
+    defer stream.mtx.Unlock()
+    if stream.closed {
+        return err
+    }
+    if int64(stream.buffer.Len() + len(data)) + stream.unacked > muxWindow {
+        err = fmt.Errorf("mux stream %d window overflow", stream.id)
+        return Err(err)
+    }
+    stream.buffer.Write(data)
+    stream.cond.Broadcast()
+    return Err(err)
+}
+
+func (stream *muxStream) addCredit(size int64) {
+    stream.mtx.Lock()
+    defer stream.mtx.Unlock()
+    stream.credit += size
+    stream.cond.Broadcast()
+}
+
+func (stream *muxStream) remoteClose() {
+    stream.mtx.Lock()
+    stream.rClosed = true
+    closed := stream.closed
+    stream.cond.Broadcast()
+    stream.mtx.Unlock()
+    if closed {
+        stream.session.dropStream(stream.id)
+    }
+}
+
+// Read returns io.EOF after the peer closed the stream and
+// all received data is read
+func (stream *muxStream) Read(data []byte) (int, error) {
+    var err error
+    stream.mtx.Lock()
+    for stream.buffer.Len() == 0 && !stream.rClosed && !stream.closed && stream.session.alive() &&
+                                                                !expired(stream.rDeadline) {
+        stream.cond.Wait()
+    }
+    if stream.buffer.Len() == 0 {
+        switch {
+            case stream.closed:
+                err = errStreamClosed
+            case stream.rClosed:
+                err = io.EOF
+            case !stream.session.alive():
+                err = errMuxClosed
+            default:
+                err = os.ErrDeadlineExceeded
+        }
+        stream.mtx.Unlock()
+        return 0, err
+    }
+    read, _ := stream.buffer.Read(data)
+    stream.unacked += int64(read)
+    var ack int64
+    if stream.unacked >= muxWindow / 4 {
+        ack = stream.unacked
+        stream.unacked = 0
+    }
+    stream.mtx.Unlock()
+    if ack > 0 {
+        stream.session.writeAck(stream.id, ack)
+    }
+    return read, err
+}
+
+// Write sends the data by chunks inside of the window of the peer
+func (stream *muxStream) Write(data []byte) (int, error) {
+    var err error
+    var total int
+    for len(data) > 0 {
+        stream.mtx.Lock()
+        for stream.credit == 0 && !stream.rClosed && !stream.closed && stream.session.alive() &&
+                                                                !expired(stream.wDeadline) {
+            stream.cond.Wait()
+        }
+        switch {
+            case stream.closed:
+                err = errStreamClosed
+            case stream.rClosed:
+                err = io.ErrClosedPipe
+            case !stream.session.alive():
+                err = errMuxClosed
+            case stream.credit == 0:
+                err = os.ErrDeadlineExceeded
+        }
+        if err != nil {
+            stream.mtx.Unlock()
+            return total, Err(err)
+        }
+        chunk := int64(len(data))
+        if chunk > stream.credit {
+            chunk = stream.credit
+        }
+        if chunk > muxChunkSize {
+            chunk = muxChunkSize
+        }
+        stream.credit -= chunk
+        stream.mtx.Unlock()
+
+        err = stream.session.writeFrame(stream.id, frameData, data[0:chunk])
+        // Frame is not sent to the closed connection
+        if !errors.Is(err, errMuxClosed) {
+            stream.mtx.Lock()
+            stream.sent = true
+            stream.mtx.Unlock()
+        }
+        if err != nil {
+            return total, Err(err)
+        }
+        total += int(chunk)
+        data = data[chunk:]
+    }
+    return total, Err(err)
+}
+
+func (stream *muxStream) Close() error {
+    var err error
+    stream.mtx.Lock()
+    if stream.closed {
+        stream.mtx.Unlock()
+        return err
+    }
+    stream.closed = true
+    rClosed := stream.rClosed
+    stream.buffer.Reset()
+    stream.rTimer = stream.wakeAt(stream.rTimer, time.Time{})
+    stream.wTimer = stream.wakeAt(stream.wTimer, time.Time{})
+    stream.cond.Broadcast()
+    stream.mtx.Unlock()
+    if rClosed {
+        stream.session.dropStream(stream.id)
+    }
+    if stream.session.alive() {
+        err = stream.session.writeFrame(stream.id, frameClose, nil)
+    }
+    return Err(err)
+}
+
+// refused tells that the stream is closed by the peer or lost with
+// the connection before any data is sent, so the call can be repeated
+func (stream *muxStream) refused() bool {
+    stream.mtx.Lock()
+    defer stream.mtx.Unlock()
+    return !stream.sent && (stream.rClosed || !stream.session.alive())
+}
+
+func (stream *muxStream) peerVersion() int64 {
+    return stream.session.version
+}
+
+func (stream *muxStream) LocalAddr() net.Addr {
+    return stream.session.conn.LocalAddr()
+}
+
+func (stream *muxStream) RemoteAddr() net.Addr {
+    return stream.session.conn.RemoteAddr()
+}
+
+func (stream *muxStream) SetDeadline(t time.Time) error {
+    var err error
+    stream.SetReadDeadline(t)
+    stream.SetWriteDeadline(t)
+    return err
+}
+
+func (stream *muxStream) SetReadDeadline(t time.Time) error {
+    var err error
+    stream.mtx.Lock()
+    defer stream.mtx.Unlock()
+    stream.rDeadline = t
+    stream.rTimer = stream.wakeAt(stream.rTimer, t)
+    return err
+}
+
+func (stream *muxStream) SetWriteDeadline(t time.Time) error {
+    var err error
+    stream.mtx.Lock()
+    defer stream.mtx.Unlock()
+    stream.wDeadline = t
+    stream.wTimer = stream.wakeAt(stream.wTimer, t)
+    return err
+}
+
+// wakeAt makes the timer which wakes waiting reader and
+// writer at the deadline, it is called under the stream lock
+func (stream *muxStream) wakeAt(timer *time.Timer, t time.Time) *time.Timer {
+    if timer != nil {
+        timer.Stop()
+    }
+    if t.IsZero() {
+        return nil
+    }
+    wakeFunc := func() {
+        stream.mtx.Lock()
+        stream.cond.Broadcast()
+        stream.mtx.Unlock()
+    }
+    return time.AfterFunc(time.Until(t), wakeFunc)
+}
+
+func expired(deadline time.Time) bool {
+    return !deadline.IsZero() && !time.Now().Before(deadline)
+}
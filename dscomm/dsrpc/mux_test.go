@@ -0,0 +1,59 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "io"
+    "net"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestMuxStreamOrder(t *testing.T) {
+    var err error
+    clientConn, serverConn := net.Pipe()
+
+    // Server echoes the first byte of each stream
+    accept := func(stream *muxStream) bool {
+        go func() {
+            defer stream.Close()
+            buffer := make([]byte, 1)
+            _, err := io.ReadFull(stream, buffer)
+            if err != nil {
+                return
+            }
+            stream.Write(buffer)
+        }()
+        return true
+    }
+    server := newMuxSession(serverConn, accept)
+    go server.loop()
+    defer server.Close()
+    client := newMuxSession(clientConn, nil)
+    go client.loop()
+    defer client.Close()
+
+    // Second stream sends data before the first one
+    first, err := client.openStream()
+    require.NoError(t, err)
+    defer first.Close()
+    second, err := client.openStream()
+    require.NoError(t, err)
+    defer second.Close()
+    _, err = second.Write([]byte{ 2 })
+    require.NoError(t, err)
+    _, err = first.Write([]byte{ 1 })
+    require.NoError(t, err)
+
+    buffer := make([]byte, 1)
+    for i, stream := range []*muxStream{ first, second } {
+        stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+        _, err = io.ReadFull(stream, buffer)
+        require.NoError(t, err)
+        require.Equal(t, byte(i + 1), buffer[0])
+    }
+}
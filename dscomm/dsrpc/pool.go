@@ -0,0 +1,226 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "io"
+    "net"
+    "sync"
+    "time"
+)
+
+// Server without mux support is called by one-shot calls
+// for the time, then the mux is tried again
+const defaultLegacyTTL time.Duration = 5 * time.Minute
+
+// Pool keeps one mux connection per address, concurrent calls
+// go as separate streams of the connection. Server without mux
+// support is called by one-shot Exec, Put and Get.
+type Pool struct {
+    mtx         sync.Mutex
+    sessions    map[string]*muxSession
+    dials       map[string]*poolDial
+    legacy      map[string]time.Time
+    legacyTTL   time.Duration
+}
+
+// poolDial is the mux connection in progress,
+// concurrent calls to the address wait for it
+type poolDial struct {
+    done        chan struct{}
+    session     *muxSession
+    err         error
+}
+
+func NewPool() *Pool {
+    pool := &Pool{}
+    pool.sessions = make(map[string]*muxSession)
+    pool.dials = make(map[string]*poolDial)
+    pool.legacy = make(map[string]time.Time)
+    pool.legacyTTL = defaultLegacyTTL
+    return pool
+}
+
+func (pool *Pool) Exec(address, method string, param any, result any, auth *Auth) error {
+    direct := func() error {
+        return Exec(address, method, param, result, auth)
+    }
+    call := func(conn net.Conn) error {
+        return ConnExec(conn, method, param, result, auth)
+    }
+    return Err(pool.call(address, direct, call))
+}
+
+func (pool *Pool) Put(address string, method string, reader io.Reader, size int64, param, result any, auth *Auth) error {
+    direct := func() error {
+        return Put(address, method, reader, size, param, result, auth)
+    }
+    call := func(conn net.Conn) error {
+        return ConnPut(conn, method, reader, size, param, result, auth)
+    }
+    return Err(pool.call(address, direct, call))
+}
+
+func (pool *Pool) Get(address string, method string, writer io.Writer, param, result any, auth *Auth) error {
+    direct := func() error {
+        return Get(address, method, writer, param, result, auth)
+    }
+    call := func(conn net.Conn) error {
+        return ConnGet(conn, method, writer, param, result, auth)
+    }
+    return Err(pool.call(address, direct, call))
+}
+
+// call runs the call on the stream of the address. The connection
+// can be closed by the server at the start of the call, the call
+// refused before any request byte is sent is repeated once on the
+// new connection.
+func (pool *Pool) call(address string, direct func() error, call func(net.Conn) error) error {
+    var err error
+    for attempt := 0; attempt < 2; attempt++ {
+        var stream *muxStream
+        stream, err = pool.openStream(address)
+        if err != nil {
+            return Err(err)
+        }
+        if stream == nil {
+            return direct()
+        }
+        tconn := newTimeConn(stream, getClientTimeout(), nil)
+        err = call(tconn)
+        refused := err != nil && stream.refused()
+        stream.Close()
+        if !refused {
+            return Err(err)
+        }
+        logDebug("mux stream refused, retry call to", address, err)
+        pool.dropSession(address, stream.session)
+    }
+    return Err(err)
+}
+
+// dropSession forgets the connection of the address,
+// running streams of the connection are not affected
+func (pool *Pool) dropSession(address string, session *muxSession) {
+    pool.mtx.Lock()
+    defer pool.mtx.Unlock()
+    if pool.sessions[address] == session {
+        delete(pool.sessions, address)
+    }
+}
+
+// Close breaks all connections of the pool, running calls get the error
+func (pool *Pool) Close() error {
+    var err error
+    pool.mtx.Lock()
+    defer pool.mtx.Unlock()
+    for address, session := range pool.sessions {
+        session.Close()
+        delete(pool.sessions, address)
+    }
+    return Err(err)
+}
+
+// openStream returns nil stream for the server without mux support.
+// The connection is made outside of the pool lock, so slow address
+// does not stop calls to others.
+func (pool *Pool) openStream(address string) (*muxStream, error) {
+    var err error
+    var stream *muxStream
+    pool.mtx.Lock()
+    expire, isLegacy := pool.legacy[address]
+    if isLegacy && time.Now().Before(expire) {
+        pool.mtx.Unlock()
+        return stream, Err(err)
+    }
+    delete(pool.legacy, address)
+    session, ok := pool.sessions[address]
+    if ok {
+        stream, err = session.openStream()
+        if err == nil {
+            pool.mtx.Unlock()
+            return stream, Err(err)
+        }
+        err = nil
+    }
+    delete(pool.sessions, address)
+    dial, ok := pool.dials[address]
+    if ok {
+        pool.mtx.Unlock()
+        <-dial.done
+    } else {
+        dial = &poolDial{ done: make(chan struct{}) }
+        pool.dials[address] = dial
+        pool.mtx.Unlock()
+
+        dial.session, dial.err = openMux(address)
+
+        pool.mtx.Lock()
+        delete(pool.dials, address)
+        switch {
+            case dial.err != nil:
+            case dial.session == nil:
+                pool.legacy[address] = time.Now().Add(pool.legacyTTL)
+            default:
+                pool.sessions[address] = dial.session
+        }
+        pool.mtx.Unlock()
+        close(dial.done)
+    }
+    if dial.err != nil {
+        return stream, Err(dial.err)
+    }
+    if dial.session == nil {
+        return stream, Err(err)
+    }
+    stream, err = dial.session.openStream()
+    if err != nil {
+        return stream, Err(err)
+    }
+    return stream, Err(err)
+}
+
+// openMux returns nil session if the server refuses mux by error response
+func openMux(address string) (*muxSession, error) {
+    var err error
+    var session *muxSession
+    conn, err := dial(address)
+    if err != nil {
+        return session, Err(err)
+    }
+    timeout := getClientTimeout()
+    context := CreateContext(newTimeConn(conn, timeout, nil))
+    context.reqRPC.Method = MuxMethod
+    context.reqRPC.Params = NewEmpty()
+    context.resRPC.Result = NewEmpty()
+
+    err = context.CreateRequest()
+    if err != nil {
+        conn.Close()
+        return session, Err(err)
+    }
+    err = context.WriteRequest()
+    if err != nil {
+        conn.Close()
+        return session, Err(err)
+    }
+    err = context.ReadResponse()
+    if err != nil {
+        conn.Close()
+        return session, Err(err)
+    }
+    err = context.BindResponse()
+    if err != nil {
+        conn.Close()
+        logDebug("mux is not supported by", address, err)
+        return session, nil
+    }
+    conn.SetDeadline(time.Time{})
+    session = newMuxSession(conn, nil)
+    session.writeTimeout = timeout
+    session.version = context.resHeader.version
+    go session.loop()
+    return session, Err(err)
+}
@@ -17,6 +17,10 @@ type Request struct {
     Auth    *Auth       `json:"auth,omitempty"    msgpack:"auth"`
 }
 
+type paramsRequest struct {
+    Params  any         `msgpack:"params"`
+}
+
 func NewRequest() *Request {
     req := &Request{}
     req.Auth = &Auth{}
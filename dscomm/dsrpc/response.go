@@ -10,8 +10,10 @@ import (
 )
 
 
+// Old peers skip the code of the error
 type Response struct {
     Error   string      `json:"error"   msgpack:"error"`
+    Code    ErrCode     `json:"code,omitempty"  msgpack:"code,omitempty"`
     Result  any         `json:"result"  msgpack:"result"`
 }
 
@@ -6,6 +6,7 @@ package dsrpc
 
 import (
     "context"
+    "crypto/tls"
     "errors"
     "fmt"
     "io"
@@ -18,6 +19,18 @@ import (
 
 type HandlerFunc =  func(*Context) error
 
+const handshakeTimeout time.Duration = 30 * time.Second
+
+// Default limits of waiting for the request and of a stall during the call
+const defaultIdleTimeout     time.Duration = 5 * time.Minute
+const defaultTransferTimeout time.Duration = 2 * time.Minute
+
+// Default limit of the request without binary data
+const defaultMaxRPCSize int64 = 1024 * 1024
+
+// Default limit of running streams of one mux connection
+const defaultMaxStreams int = 64
+
 type Service struct {
     handlers    map[string]HandlerFunc
     ctx         context.Context
@@ -28,6 +41,16 @@ type Service struct {
     keepalive   bool
     kaTime      time.Duration
     kaMtx       sync.Mutex
+    tlsConfig   *tls.Config
+    verifierFunc VerifierFunc
+    idleTimeout     time.Duration
+    transferTimeout time.Duration
+    maxRPCSize      int64
+    maxBinSizes     map[string]int64
+    maxConns        int
+    maxStreams      int
+    slots           chan struct{}
+    errorCoder      ErrorCoder
 }
 
 func NewService() *Service {
@@ -40,6 +63,11 @@ func NewService() *Service {
     rdrpc.wg = &wg
     rdrpc.preMw = make([]HandlerFunc, 0)
     rdrpc.postMw = make([]HandlerFunc, 0)
+    rdrpc.idleTimeout = defaultIdleTimeout
+    rdrpc.transferTimeout = defaultTransferTimeout
+    rdrpc.maxRPCSize = defaultMaxRPCSize
+    rdrpc.maxBinSizes = make(map[string]int64)
+    rdrpc.maxStreams = defaultMaxStreams
 
     return rdrpc
 }
@@ -68,6 +96,67 @@ func (svc *Service) SetKeepAlivePeriod(interval time.Duration) {
     svc.kaTime = interval
 }
 
+// SetIdleTimeout limits waiting for the request on the connection,
+// zero timeout disables the limit
+func (svc *Service) SetIdleTimeout(timeout time.Duration) {
+    svc.idleTimeout = timeout
+}
+
+// SetTransferTimeout limits a stall of the client during the call,
+// zero timeout disables the limit
+func (svc *Service) SetTransferTimeout(timeout time.Duration) {
+    svc.transferTimeout = timeout
+}
+
+// SetMaxRPCSize limits the request without binary data,
+// zero size disables the limit
+func (svc *Service) SetMaxRPCSize(size int64) {
+    svc.maxRPCSize = size
+}
+
+// SetMaxBinSize limits binary data of the method requests,
+// the data of unknown size is broken when it exceeds the limit
+func (svc *Service) SetMaxBinSize(method string, size int64) {
+    svc.maxBinSizes[method] = size
+}
+
+// SetMaxConns limits count of served connections and mux streams,
+// the connection over the limit is closed at once, the stream is refused.
+// Zero count disables the limit.
+func (svc *Service) SetMaxConns(count int) {
+    svc.maxConns = count
+}
+
+// SetMaxStreams limits count of running streams of one mux connection,
+// the stream over the limit is refused. Zero count disables the limit.
+func (svc *Service) SetMaxStreams(count int) {
+    svc.maxStreams = count
+}
+
+// takeSlot counts the connection or the stream against maxConns
+func (svc *Service) takeSlot() bool {
+    if svc.slots == nil {
+        return true
+    }
+    select {
+        case svc.slots <- struct{}{}:
+            return true
+        default:
+            return false
+    }
+}
+
+func (svc *Service) freeSlot() {
+    if svc.slots != nil {
+        <-svc.slots
+    }
+}
+
+// SetTLSConfig enables TLS for accepted connections
+func (svc *Service) SetTLSConfig(config *tls.Config) {
+    svc.tlsConfig = config
+}
+
 func (svc *Service) Listen(address string) error {
     var err error
     logInfo("server listen:", address)
@@ -83,20 +172,40 @@ func (svc *Service) Listen(address string) error {
         return err
     }
 
+    // Stop breaks waiting accept
+    go func() {
+        <-svc.ctx.Done()
+        listener.Close()
+    }()
+
+    if svc.maxConns > 0 {
+        svc.slots = make(chan struct{}, svc.maxConns)
+    }
     for {
         conn, err := listener.AcceptTCP()
-        if err != nil {
-            logError("conn accept err:", err)
-        }
         select {
             case <-svc.ctx.Done():
-                return err
+                if conn != nil {
+                    conn.Close()
+                }
+                return nil
             default:
         }
+        if err != nil {
+            logError("conn accept err:", err)
+            continue
+        }
+        if !svc.takeSlot() {
+            logError("conn limit exceeded, drop:", conn.RemoteAddr().String())
+            conn.Close()
+            continue
+        }
         svc.wg.Add(1)
-        go svc.handleConn(conn, svc.wg)
+        go func() {
+            svc.handleConn(conn, svc.wg)
+            svc.freeSlot()
+        }()
     }
-    return err
 }
 
 func notFound(context *Context) error {
@@ -133,17 +242,37 @@ func (svc *Service) handleConn(conn *net.TCPConn, wg *sync.WaitGroup) {
             }
         }
     }
-    context := CreateContext(conn)
+    var sock net.Conn = conn
+    if svc.tlsConfig != nil {
+        tlsConn := tls.Server(conn, svc.tlsConfig)
+        // Silent client does not hold the handler forever
+        conn.SetDeadline(time.Now().Add(handshakeTimeout))
+        err = tlsConn.Handshake()
+        conn.SetDeadline(time.Time{})
+        if err != nil {
+            conn.Close()
+            wg.Done()
+            logError("tls handshake err:", err)
+            return
+        }
+        sock = tlsConn
+    }
+    tconn := newTimeConn(sock, svc.idleTimeout, nil)
+    context := CreateContext(tconn)
+    tconn.cancel = context.cancel
+    context.rpcLimit = svc.maxRPCSize
+    context.errorCoder = svc.errorCoder
 
     remoteAddr := conn.RemoteAddr().String()
     remoteHost, _, _ := net.SplitHostPort(remoteAddr)
     context.remoteHost = remoteHost
 
-    context.binReader = conn
+    context.binReader = tconn
     context.binWriter = io.Discard
 
     exitFunc := func() {
-            conn.Close()
+            sock.Close()
+            context.Cancel()
             wg.Done()
             if err != nil {
                 logError("conn handler err:", err)
@@ -164,32 +293,186 @@ func (svc *Service) handleConn(conn *net.TCPConn, wg *sync.WaitGroup) {
         err = Err(err)
         return
     }
+    tconn.setTimeout(svc.transferTimeout)
 
     err = context.BindMethod()
     if err != nil {
         err = Err(err)
         return
     }
-    for _, mw := range svc.preMw {
-        err = mw(context)
+    if context.reqRPC.Method == MuxMethod {
+        err = svc.serveMux(context, sock)
         if err != nil {
             err = Err(err)
             return
         }
+        return
     }
-    err = svc.Route(context)
+    err = svc.serveContext(context, tconn)
     if err != nil {
         err = Err(err)
         return
     }
+    return
+}
+
+// serveMux switches the connection to mux streams, each stream
+// is served as one-shot connection. Stop of the service waits
+// running streams and closes the connection.
+func (svc *Service) serveMux(context *Context, sock net.Conn) error {
+    var err error
+    // The client of mux knows the versions, so the reply
+    // shows the version of the server
+    context.resHeader.version = ProtocolVersion
+    err = context.SendResult(NewEmpty(), 0)
+    if err != nil {
+        return Err(err)
+    }
+    var streamWg sync.WaitGroup
+    // Running streams are counted as connections
+    accept := func(stream *muxStream) bool {
+        if !svc.takeSlot() {
+            logError("conn limit exceeded, refuse stream:", context.remoteHost)
+            return false
+        }
+        streamWg.Add(1)
+        svc.wg.Add(1)
+        go svc.handleStream(stream, context.remoteHost, &streamWg)
+        return true
+    }
+    session := newMuxSession(sock, accept)
+    session.maxStreams = svc.maxStreams
+    session.idleTimeout = svc.idleTimeout
+    session.writeTimeout = svc.transferTimeout
+
+    closeFunc := func() {
+        select {
+            case <-svc.ctx.Done():
+            case <-session.done:
+        }
+        session.drain()
+        streamWg.Wait()
+        session.Close()
+    }
+    go closeFunc()
+
+    loopErr := session.loop()
+    logDebug("mux connection closed:", loopErr)
+    return Err(err)
+}
+
+func (svc *Service) handleStream(stream *muxStream, remoteHost string, streamWg *sync.WaitGroup) {
+    var err error
+    tconn := newTimeConn(stream, svc.idleTimeout, nil)
+    context := CreateContext(tconn)
+    tconn.cancel = context.cancel
+    context.rpcLimit = svc.maxRPCSize
+    context.errorCoder = svc.errorCoder
+    context.remoteHost = remoteHost
+
+    context.binReader = tconn
+    context.binWriter = io.Discard
+
+    exitFunc := func() {
+            stream.Close()
+            context.Cancel()
+            svc.freeSlot()
+            streamWg.Done()
+            svc.wg.Done()
+            if err != nil {
+                logError("stream handler err:", err)
+            }
+    }
+    defer exitFunc()
+
+    recovFunc := func () {
+        panicMsg := recover()
+        if panicMsg != nil {
+            logError("handler panic message:", panicMsg)
+        }
+    }
+    defer recovFunc()
+
+    err = context.ReadRequest()
+    if err != nil {
+        err = Err(err)
+        return
+    }
+    tconn.setTimeout(svc.transferTimeout)
+
+    err = context.BindMethod()
+    if err != nil {
+        err = Err(err)
+        return
+    }
+    if context.reqRPC.Method == MuxMethod {
+        err = errors.New("mux inside of mux stream")
+        return
+    }
+    err = svc.serveContext(context, tconn)
+    if err != nil {
+        err = Err(err)
+        return
+    }
+    return
+}
+
+func (svc *Service) serveContext(context *Context, tconn *timeConn) error {
+    var err error
+    // The nonce is valid for the next request on the connection only
+    if context.reqRPC.Method == ChallengeMethod {
+        err = svc.challenge(context)
+        if err != nil {
+            return Err(err)
+        }
+        context, err = context.readChallenged(tconn)
+        if err != nil {
+            return Err(err)
+        }
+    }
+    err = svc.checkBinSize(context)
+    if err != nil {
+        context.SendError(err)
+        return Err(err)
+    }
+    // Nothing is read after the request without data,
+    // so the read gets only the close of the peer
+    if context.reqHeader.binSize == 0 {
+        go tconn.watchPeer()
+    }
+    for _, mw := range svc.preMw {
+        err = mw(context)
+        if err != nil {
+            return Err(err)
+        }
+    }
+    err = svc.Route(context)
+    if err != nil {
+        return Err(err)
+    }
     for _, mw := range svc.postMw {
         err = mw(context)
         if err != nil {
-            err = Err(err)
-            return
+            return Err(err)
         }
     }
-    return
+    return Err(err)
+}
+
+// checkBinSize refuses the request with binary data over the limit
+// of the method, the limit of the data of unknown size is checked by reading
+func (svc *Service) checkBinSize(context *Context) error {
+    var err error
+    limit := svc.maxBinSizes[context.reqRPC.Method]
+    if limit < 1 {
+        return Err(err)
+    }
+    if context.reqHeader.binSize > limit {
+        err = fmt.Errorf("binary size %d exceeds limit %d", context.reqHeader.binSize, limit)
+        return Err(err)
+    }
+    context.binLimit = limit
+    return Err(err)
 }
 
 func (svc *Service) Route(context *Context) error {
@@ -212,7 +495,12 @@ func (context *Context) ReadRequest() error {
         return Err(err)
     }
 
+    // Sizes are checked before the allocation
     rpcSize := context.reqHeader.rpcSize
+    if context.rpcLimit > 0 && rpcSize > context.rpcLimit {
+        err = fmt.Errorf("rpc size %d exceeds limit %d", rpcSize, context.rpcLimit)
+        return Err(err)
+    }
     context.reqPacket.rcpPayload, err = ReadBytes(context.sockReader, rpcSize)
     if err != nil {
         return Err(err)
@@ -224,16 +512,30 @@ func (context *Context) BinWriter() io.Writer {
     return context.sockWriter
 }
 
+// BinReader decodes chunks of the data of unknown size,
+// the reader returns io.EOF after the last chunk
 func (context *Context) BinReader() io.Reader {
+    if context.reqHeader.binSize == ChunkedSize {
+        if context.binChunks == nil {
+            context.binChunks = newChunkReader(context.sockReader)
+            context.binChunks.limit = context.binLimit
+        }
+        return context.binChunks
+    }
     return context.sockReader
 }
 
+// BinSize returns ChunkedSize for the data of unknown size
 func (context *Context) BinSize() int64 {
     return context.reqHeader.binSize
 }
 
 func (context *Context) ReadBin(writer io.Writer) error {
     var err error
+    if context.reqHeader.binSize == ChunkedSize {
+        _, err = io.Copy(writer, context.BinReader())
+        return Err(err)
+    }
     _, err = CopyBytes(context.sockReader, writer, context.reqHeader.binSize)
     return Err(err)
 }
@@ -241,17 +543,34 @@ func (context *Context) ReadBin(writer io.Writer) error {
 
 func (context *Context) BindMethod() error {
     var err error
-    err = encoder.Unmarshal(context.reqPacket.rcpPayload, context.reqRPC)
+    err = unmarshal(context.reqPacket.rcpPayload, context.reqRPC)
     return Err(err)
 }
 
+// BindParams binds only the params, the auth ident can be
+// replaced by middleware for token auth
 func (context *Context) BindParams(params any) error {
     var err error
-    context.reqRPC.Params = params
-    err = encoder.Unmarshal(context.reqPacket.rcpPayload, context.reqRPC)
+    request := &paramsRequest{}
+    request.Params = params
+    err = unmarshal(context.reqPacket.rcpPayload, request)
     if err != nil {
         return Err(err)
     }
+    context.reqRPC.Params = params
+    return Err(err)
+}
+
+// unmarshal turns panic of the decoder on malformed
+// payload into the error
+func unmarshal(payload []byte, value any) (err error) {
+    defer func() {
+        panicMsg := recover()
+        if panicMsg != nil {
+            err = fmt.Errorf("malformed rpc payload: %v", panicMsg)
+        }
+    }()
+    err = encoder.Unmarshal(payload, value)
     return Err(err)
 }
 
@@ -265,6 +584,9 @@ func (context *Context) SendResult(result any, binSize int64) error {
     }
     context.resHeader.rpcSize = int64(len(context.resPacket.rcpPayload))
     context.resHeader.binSize = binSize
+    if context.reqHeader.version > context.resHeader.version {
+        context.resHeader.version = context.reqHeader.version
+    }
 
     context.resPacket.header, err = context.resHeader.Pack()
     if err != nil {
@@ -286,6 +608,10 @@ func (context *Context) SendError(execErr error) error {
     var err error
 
     context.resRPC.Error = execErr.Error()
+    context.resRPC.Code = ErrorCode(execErr)
+    if context.errorCoder != nil {
+        context.resRPC.Code = context.errorCoder(execErr)
+    }
     context.resRPC.Result = NewEmpty()
 
     context.resPacket.rcpPayload, err = context.resRPC.Pack()
@@ -293,6 +619,9 @@ func (context *Context) SendError(execErr error) error {
         return Err(err)
     }
     context.resHeader.rpcSize = int64(len(context.resPacket.rcpPayload))
+    if context.reqHeader.version > context.resHeader.version {
+        context.resHeader.version = context.reqHeader.version
+    }
     context.resPacket.header, err = context.resHeader.Pack()
     if err != nil {
         return Err(err)
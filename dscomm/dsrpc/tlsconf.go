@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "net"
+    "os"
+    "sync"
+    "time"
+)
+
+var clientTLS *tls.Config
+var clientTLSMtx sync.Mutex
+
+// SetClientTLS enables TLS for Exec, Put and Get calls, nil config disables it
+func SetClientTLS(config *tls.Config) {
+    clientTLSMtx.Lock()
+    defer clientTLSMtx.Unlock()
+    clientTLS = config
+}
+
+// NewServerTLSConfig loads the server key pair. If CA file is given
+// the clients must present a certificate signed by the CA.
+func NewServerTLSConfig(certPath, keyPath, caPath string) (*tls.Config, error) {
+    var err error
+    config := &tls.Config{
+        MinVersion: tls.VersionTLS12,
+    }
+    cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+    if err != nil {
+        err = fmt.Errorf("unable to load key pair: %s", err)
+        return config, Err(err)
+    }
+    config.Certificates = []tls.Certificate{ cert }
+    if caPath == "" {
+        return config, Err(err)
+    }
+    pool, err := loadCertPool(caPath)
+    if err != nil {
+        return config, Err(err)
+    }
+    config.ClientCAs = pool
+    config.ClientAuth = tls.RequireAndVerifyClientCert
+    return config, Err(err)
+}
+
+// NewClientTLSConfig makes client config, empty CA path means the system roots.
+// The key pair is presented to servers which require client certificate.
+func NewClientTLSConfig(caPath, certPath, keyPath string) (*tls.Config, error) {
+    var err error
+    config := &tls.Config{
+        MinVersion: tls.VersionTLS12,
+    }
+    if caPath != "" {
+        config.RootCAs, err = loadCertPool(caPath)
+        if err != nil {
+            return config, Err(err)
+        }
+    }
+    if certPath != "" {
+        cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+        if err != nil {
+            err = fmt.Errorf("unable to load key pair: %s", err)
+            return config, Err(err)
+        }
+        config.Certificates = []tls.Certificate{ cert }
+    }
+    return config, Err(err)
+}
+
+func loadCertPool(caPath string) (*x509.CertPool, error) {
+    var err error
+    pool := x509.NewCertPool()
+    caPEM, err := os.ReadFile(caPath)
+    if err != nil {
+        err = fmt.Errorf("unable to read ca file: %s", err)
+        return pool, Err(err)
+    }
+    if !pool.AppendCertsFromPEM(caPEM) {
+        err = errors.New("no certificates in ca file")
+        return pool, Err(err)
+    }
+    return pool, Err(err)
+}
+
+func dial(address string) (net.Conn, error) {
+    var err error
+    var conn net.Conn
+
+    addr, err := net.ResolveTCPAddr("tcp", address)
+    if err != nil {
+        err = fmt.Errorf("unable to resolve adddress: %s", err)
+        return conn, Err(err)
+    }
+    timeout := getClientTimeout()
+    dialer := net.Dialer{ Timeout: timeout }
+    netConn, err := dialer.Dial("tcp", addr.String())
+    if err != nil {
+        return conn, Err(err)
+    }
+    tcpConn := netConn.(*net.TCPConn)
+    clientTLSMtx.Lock()
+    config := clientTLS
+    clientTLSMtx.Unlock()
+    if config == nil {
+        return tcpConn, Err(err)
+    }
+    config = config.Clone()
+    if config.ServerName == "" {
+        host, _, _ := net.SplitHostPort(address)
+        config.ServerName = host
+    }
+    tlsConn := tls.Client(tcpConn, config)
+    if timeout > 0 {
+        tlsConn.SetDeadline(time.Now().Add(timeout))
+    }
+    err = tlsConn.Handshake()
+    tlsConn.SetDeadline(time.Time{})
+    if err != nil {
+        tcpConn.Close()
+        err = fmt.Errorf("tls handshake error: %s", err)
+        return conn, Err(err)
+    }
+    return tlsConn, Err(err)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestNetTLS(t *testing.T) {
+    var err error
+    certDir := t.TempDir()
+
+    caCert, caKey := newTestCert(t, certDir, "ca", nil, nil)
+    newTestCert(t, certDir, "server", caCert, caKey)
+    newTestCert(t, certDir, "client", caCert, caKey)
+    caPath := filepath.Join(certDir, "ca.crt")
+
+    servConfig, err := NewServerTLSConfig(filepath.Join(certDir, "server.crt"),
+                                filepath.Join(certDir, "server.key"), caPath)
+    require.NoError(t, err)
+
+    serv := NewService()
+    serv.SetTLSConfig(servConfig)
+    serv.Handler(HelloMethod, helloHandler)
+    serv.SetVerifierFunc(testVerifier)
+    go serv.Listen("127.0.0.1:8082")
+    time.Sleep(10 * time.Millisecond)
+    defer SetClientTLS(nil)
+
+    params := NewHelloParams()
+    result := NewHelloResult()
+    auth := CreateAuth([]byte("qwert"), []byte("12345"))
+
+    // Plain client is rejected
+    SetClientTLS(nil)
+    err = Exec("127.0.0.1:8082", HelloMethod, params, result, auth)
+    require.Error(t, err)
+
+    // Client without certificate is rejected by mutual TLS
+    clientConfig, err := NewClientTLSConfig(caPath, "", "")
+    require.NoError(t, err)
+    SetClientTLS(clientConfig)
+    err = Exec("127.0.0.1:8082", HelloMethod, params, result, auth)
+    require.Error(t, err)
+
+    clientConfig, err = NewClientTLSConfig(caPath, filepath.Join(certDir, "client.crt"),
+                                filepath.Join(certDir, "client.key"))
+    require.NoError(t, err)
+    SetClientTLS(clientConfig)
+    err = Exec("127.0.0.1:8082", HelloMethod, params, result, auth)
+    require.NoError(t, err)
+    require.Equal(t, "hello, client!", result.Message)
+
+    // Server certificate must be signed by known CA
+    clientConfig, err = NewClientTLSConfig(filepath.Join(certDir, "client.crt"),
+                                filepath.Join(certDir, "client.crt"), filepath.Join(certDir, "client.key"))
+    require.NoError(t, err)
+    SetClientTLS(clientConfig)
+    err = Exec("127.0.0.1:8082", HelloMethod, params, result, auth)
+    require.Error(t, err)
+}
+
+func newTestCert(t *testing.T, certDir, name string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    require.NoError(t, err)
+
+    serial, err := rand.Int(rand.Reader, big.NewInt(1 << 62))
+    require.NoError(t, err)
+    template := &x509.Certificate{
+        SerialNumber:   serial,
+        Subject:        pkix.Name{ CommonName: name },
+        NotBefore:      time.Now().Add(-time.Hour),
+        NotAfter:       time.Now().Add(time.Hour),
+        KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+        ExtKeyUsage:    []x509.ExtKeyUsage{ x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth },
+        IPAddresses:    []net.IP{ net.ParseIP("127.0.0.1") },
+    }
+    parent, signKey := template, key
+    if caCert == nil {
+        template.IsCA = true
+        template.BasicConstraintsValid = true
+    } else {
+        parent, signKey = caCert, caKey
+    }
+    certDER, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signKey)
+    require.NoError(t, err)
+    cert, err := x509.ParseCertificate(certDER)
+    require.NoError(t, err)
+
+    keyDER, err := x509.MarshalECPrivateKey(key)
+    require.NoError(t, err)
+    certPEM := pem.EncodeToMemory(&pem.Block{ Type: "CERTIFICATE", Bytes: certDER })
+    keyPEM := pem.EncodeToMemory(&pem.Block{ Type: "EC PRIVATE KEY", Bytes: keyDER })
+    err = os.WriteFile(filepath.Join(certDir, name + ".crt"), certPEM, 0644)
+    require.NoError(t, err)
+    err = os.WriteFile(filepath.Join(certDir, name + ".key"), keyPEM, 0600)
+    require.NoError(t, err)
+    return cert, key
+}
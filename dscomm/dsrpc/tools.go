@@ -11,6 +11,9 @@ import (
 )
 
 func ReadBytes(reader io.Reader, size int64) ([]byte, error) {
+    if size < 0 {
+        return nil, fmt.Errorf("wrong read size %d", size)
+    }
     buffer := make([]byte, size)
     read, err := io.ReadFull(reader, buffer)
     return buffer[0:read], Err(err)
@@ -21,18 +24,15 @@ func CopyBytes(reader io.Reader, writer io.Writer, dataSize int64) (int64, error
     var bSize int64 = 1024 * 16
     var total int64 = 0
     var remains int64 = dataSize
+    if reader == nil {
+        return total, errors.New("reader is nil")
+    }
+    if writer == nil {
+        return total, errors.New("writer is nil")
+    }
     buffer := make([]byte, bSize)
 
-    for {
-        if reader == nil {
-            return total, errors.New("reader is nil")
-        }
-        if writer == nil {
-            return total, errors.New("writer is nil")
-        }
-        if remains == 0 {
-            return total, err
-        }
+    for remains > 0 {
         if remains < bSize {
             bSize = remains
         }
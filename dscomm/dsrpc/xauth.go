@@ -16,10 +16,17 @@ func init() {
     rand.Seed(time.Now().UnixNano())
 }
 
+// Auth carries the ident and the proof for the server nonce,
+// or the token issued by the server instead of them.
+// Salt and hash are sent by old clients only.
 type Auth struct {
     Ident   []byte      `msgpack:"ident"    json:"ident"`
     Salt    []byte      `msgpack:"salt"     json:"salt"`
     Hash    []byte      `msgpack:"hash"     json:"hash"`
+    Nonce   []byte      `msgpack:"nonce"    json:"nonce"`
+    Proof   []byte      `msgpack:"proof"    json:"proof"`
+    Token   []byte      `msgpack:"token"    json:"-"`
+    pass    []byte
 }
 
 func NewAuth() *Auth {
@@ -31,7 +38,25 @@ func (this *Auth) JSON() []byte {
     return jBytes
 }
 
+// CreateAuth keeps the password on the client side, the proof
+// is made for each call after the server challenge
 func CreateAuth(ident, pass []byte) *Auth {
+    auth := &Auth{}
+    auth.Ident = ident
+    auth.pass = pass
+    return auth
+}
+
+// CreateTokenAuth makes auth with session token or API key,
+// the call is made without the challenge
+func CreateTokenAuth(token []byte) *Auth {
+    auth := &Auth{}
+    auth.Token = token
+    return auth
+}
+
+// CreateLegacyAuth makes the auth of old clients
+func CreateLegacyAuth(ident, pass []byte) *Auth {
     salt := CreateSalt()
     hash := CreateHash(ident, pass, salt)
     auth := &Auth{}
@@ -48,6 +73,8 @@ func CreateSalt() []byte {
     return randBytes
 }
 
+// CreateHash is the legacy scheme, the result contains the password
+// as is and is kept only to check old clients
 func CreateHash(ident, pass, salt []byte) []byte {
     vec := make([]byte, 0, len(ident) + len(salt) + len(pass))
     vec = append(vec, ident...)
@@ -58,6 +85,27 @@ func CreateHash(ident, pass, salt []byte) []byte {
     return hash
 }
 
+// LegacyPass extracts the password from the legacy hash
+func LegacyPass(ident, reqSalt, reqHash []byte) ([]byte, bool) {
+    var pass []byte
+    suffix := sha256.New().Sum(nil)
+    prefixSize := len(ident) + len(reqSalt)
+    if len(reqSalt) == 0 || len(reqHash) < prefixSize + len(suffix) {
+        return pass, false
+    }
+    if !bytes.Equal(reqHash[0:len(ident)], ident) {
+        return pass, false
+    }
+    if !bytes.Equal(reqHash[len(ident):prefixSize], reqSalt) {
+        return pass, false
+    }
+    if !bytes.Equal(reqHash[len(reqHash) - len(suffix):], suffix) {
+        return pass, false
+    }
+    pass = reqHash[prefixSize:len(reqHash) - len(suffix)]
+    return pass, true
+}
+
 func CheckHash(ident, pass, reqSalt, reqHash []byte) bool {
     localHash := CreateHash(ident, pass, reqSalt)
     return bytes.Equal(reqHash, localHash)
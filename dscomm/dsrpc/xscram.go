@@ -0,0 +1,272 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "crypto/hmac"
+    crand "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/binary"
+    "errors"
+    "hash"
+    "net"
+    "time"
+)
+
+// The challenge follows SCRAM-SHA-256 idea: the server keeps only
+// stored key, the client proves knowledge of the password for
+// the server nonce which is valid for single call on the connection.
+
+const ChallengeMethod string = "authChallenge"
+
+const DefaultIter int64 = 10000
+const nonceSize int = 16
+const nonceTTL time.Duration = 30 * time.Second
+
+type ChallengeParams struct {
+    Ident   []byte      `msgpack:"ident"    json:"ident"`
+}
+
+type ChallengeResult struct {
+    Nonce   []byte      `msgpack:"nonce"    json:"nonce"`
+    Salt    []byte      `msgpack:"salt"     json:"salt"`
+    Iter    int64       `msgpack:"iter"     json:"iter"`
+}
+
+type Verifier struct {
+    Salt        []byte  `msgpack:"salt"       json:"salt"`
+    Iter        int64   `msgpack:"iter"       json:"iter"`
+    StoredKey   []byte  `msgpack:"storedKey"  json:"storedKey"`
+}
+
+// VerifierFunc returns the verifier of the ident for the challenge
+type VerifierFunc = func(ident []byte) (*Verifier, error)
+
+// NewVerifier makes verifier with random salt
+func NewVerifier(pass []byte) *Verifier {
+    salt := make([]byte, nonceSize)
+    crand.Read(salt)
+    return DeriveVerifier(pass, salt, DefaultIter)
+}
+
+func DeriveVerifier(pass, salt []byte, iter int64) *Verifier {
+    clientKey := makeClientKey(pass, salt, iter)
+    storedKey := sha256.Sum256(clientKey)
+    verifier := &Verifier{
+        Salt:       salt,
+        Iter:       iter,
+        StoredKey:  storedKey[:],
+    }
+    return verifier
+}
+
+// Check derives the key from the password and compares with stored key
+func (verifier *Verifier) Check(pass []byte) bool {
+    if verifier == nil || verifier.Iter < 1 || len(verifier.StoredKey) == 0 {
+        return false
+    }
+    local := DeriveVerifier(pass, verifier.Salt, verifier.Iter)
+    return subtle.ConstantTimeCompare(local.StoredKey, verifier.StoredKey) == 1
+}
+
+// SetVerifierFunc enables the challenge on the service
+func (svc *Service) SetVerifierFunc(verifierFunc VerifierFunc) {
+    svc.verifierFunc = verifierFunc
+}
+
+func (svc *Service) challenge(context *Context) error {
+    var err error
+    if svc.verifierFunc == nil {
+        return Err(notFound(context))
+    }
+    params := &ChallengeParams{}
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return Err(err)
+    }
+    result := &ChallengeResult{}
+    verifier, err := svc.verifierFunc(params.Ident)
+    if err != nil || verifier == nil {
+        // Unknown ident gets random salt and fails later
+        verifier = NewVerifier(nil)
+        err = nil
+    }
+    result.Salt = verifier.Salt
+    result.Iter = verifier.Iter
+    result.Nonce = make([]byte, nonceSize)
+    _, err = crand.Read(result.Nonce)
+    if err != nil {
+        context.SendError(err)
+        return Err(err)
+    }
+    context.nonce = result.Nonce
+    context.nonceIdent = params.Ident
+    context.nonceTime = time.Now()
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return Err(err)
+    }
+    return Err(err)
+}
+
+// HasProof is true for the request made after the challenge
+func (context *Context) HasProof() bool {
+    return len(context.reqRPC.Auth.Proof) > 0
+}
+
+// CheckProof checks the request proof against the verifier,
+// the nonce must be issued on the connection and not expired
+func (context *Context) CheckProof(verifier *Verifier) bool {
+    auth := context.reqRPC.Auth
+    if verifier == nil || len(context.nonce) == 0 {
+        return false
+    }
+    if time.Since(context.nonceTime) > nonceTTL {
+        return false
+    }
+    if !hmac.Equal(auth.Nonce, context.nonce) || !hmac.Equal(auth.Ident, context.nonceIdent) {
+        return false
+    }
+    if len(auth.Proof) != sha256.Size || len(verifier.StoredKey) != sha256.Size {
+        return false
+    }
+    authMsg := makeAuthMessage(auth.Ident, auth.Nonce, context.reqRPC.Method)
+    signature := makeHMAC(verifier.StoredKey, authMsg)
+    clientKey := xorBytes(auth.Proof, signature)
+    storedKey := sha256.Sum256(clientKey)
+    return subtle.ConstantTimeCompare(storedKey[:], verifier.StoredKey) == 1
+}
+
+// authenticate gets the server nonce and returns auth with the proof
+// for the method. Auth without password is returned as is.
+func authenticate(conn net.Conn, method string, auth *Auth) (*Auth, error) {
+    var err error
+    if auth == nil || auth.pass == nil {
+        return auth, Err(err)
+    }
+    context := CreateContext(conn)
+    context.reqRPC.Method = ChallengeMethod
+    context.reqRPC.Params = &ChallengeParams{ Ident: auth.Ident }
+    result := &ChallengeResult{}
+    context.resRPC.Result = result
+
+    err = context.CreateRequest()
+    if err != nil {
+        return auth, Err(err)
+    }
+    err = context.WriteRequest()
+    if err != nil {
+        return auth, Err(err)
+    }
+    err = context.ReadResponse()
+    if err != nil {
+        return auth, Err(err)
+    }
+    err = context.BindResponse()
+    if err != nil {
+        return auth, Err(err)
+    }
+    if len(result.Nonce) == 0 {
+        err = errors.New("empty server nonce")
+        return auth, Err(err)
+    }
+    clientKey := makeClientKey(auth.pass, result.Salt, result.Iter)
+    storedKey := sha256.Sum256(clientKey)
+    authMsg := makeAuthMessage(auth.Ident, result.Nonce, method)
+    signature := makeHMAC(storedKey[:], authMsg)
+
+    proofAuth := &Auth{}
+    proofAuth.Ident = auth.Ident
+    proofAuth.Nonce = result.Nonce
+    proofAuth.Proof = xorBytes(clientKey, signature)
+    return proofAuth, Err(err)
+}
+
+func (context *Context) readChallenged(conn net.Conn) (*Context, error) {
+    var err error
+    next := CreateContext(conn)
+    next.remoteHost = context.remoteHost
+    next.binReader = context.binReader
+    next.binWriter = context.binWriter
+    next.nonce = context.nonce
+    next.nonceIdent = context.nonceIdent
+    next.nonceTime = context.nonceTime
+    next.rpcLimit = context.rpcLimit
+    next.errorCoder = context.errorCoder
+    next.ctx = context.ctx
+    next.cancel = context.cancel
+    err = next.ReadRequest()
+    if err != nil {
+        return next, Err(err)
+    }
+    err = next.BindMethod()
+    if err != nil {
+        return next, Err(err)
+    }
+    if next.reqRPC.Method == ChallengeMethod {
+        err = errors.New("repeated challenge")
+        return next, Err(err)
+    }
+    return next, Err(err)
+}
+
+func makeClientKey(pass, salt []byte, iter int64) []byte {
+    saltedPass := pbkdf2(pass, salt, iter, sha256.Size, sha256.New)
+    return makeHMAC(saltedPass, []byte("Client Key"))
+}
+
+func makeAuthMessage(ident, nonce []byte, method string) []byte {
+    authMsg := make([]byte, 0, len(ident) + len(nonce) + len(method) + 2)
+    authMsg = append(authMsg, ident...)
+    authMsg = append(authMsg, 0)
+    authMsg = append(authMsg, nonce...)
+    authMsg = append(authMsg, 0)
+    authMsg = append(authMsg, method...)
+    return authMsg
+}
+
+func makeHMAC(key, data []byte) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write(data)
+    return mac.Sum(nil)
+}
+
+func xorBytes(a, b []byte) []byte {
+    res := make([]byte, len(a))
+    for i := range a {
+        res[i] = a[i] ^ b[i % len(b)]
+    }
+    return res
+}
+
+// pbkdf2 is RFC 8018 key derivation
+func pbkdf2(pass, salt []byte, iter int64, keyLen int, hashFunc func() hash.Hash) []byte {
+    prf := hmac.New(hashFunc, pass)
+    hashLen := prf.Size()
+    blockCount := (keyLen + hashLen - 1) / hashLen
+    key := make([]byte, 0, blockCount * hashLen)
+    buffer := make([]byte, 4)
+    for block := 1; block <= blockCount; block++ {
+        prf.Reset()
+        prf.Write(salt)
+        binary.BigEndian.PutUint32(buffer, uint32(block))
+        prf.Write(buffer)
+        u := prf.Sum(nil)
+        t := make([]byte, len(u))
+        copy(t, u)
+        for i := int64(1); i < iter; i++ {
+            prf.Reset()
+            prf.Write(u)
+            u = prf.Sum(u[:0])
+            for x := range t {
+                t[x] ^= u[x]
+            }
+        }
+        key = append(key, t...)
+    }
+    return key[0:keyLen]
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dsrpc
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "net"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestPBKDF2(t *testing.T) {
+    key := pbkdf2([]byte("password"), []byte("salt"), 1, 32, sha256.New)
+    require.Equal(t, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b", hex.EncodeToString(key))
+    key = pbkdf2([]byte("password"), []byte("salt"), 2, 32, sha256.New)
+    require.Equal(t, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43", hex.EncodeToString(key))
+}
+
+func TestNetChallenge(t *testing.T) {
+    var err error
+    go testServ(false)
+    time.Sleep(10 * time.Millisecond)
+
+    address := "127.0.0.1:8081"
+    params := NewHelloParams()
+    result := NewHelloResult()
+
+    err = Exec(address, HelloMethod, params, result, CreateAuth([]byte("qwert"), []byte("12345")))
+    require.NoError(t, err)
+
+    err = Exec(address, HelloMethod, params, result, CreateAuth([]byte("qwert"), []byte("54321")))
+    require.Error(t, err)
+
+    // Legacy auth is not accepted by the test server
+    err = Exec(address, HelloMethod, params, result, CreateLegacyAuth([]byte("qwert"), []byte("12345")))
+    require.Error(t, err)
+
+    // Captured proof cannot be replayed on other connection
+    conn, err := net.Dial("tcp", address)
+    require.NoError(t, err)
+    captured, err := authenticate(conn, HelloMethod, CreateAuth([]byte("qwert"), []byte("12345")))
+    conn.Close()
+    require.NoError(t, err)
+    require.NotEmpty(t, captured.Proof)
+    require.Empty(t, captured.pass)
+
+    conn, err = net.Dial("tcp", address)
+    require.NoError(t, err)
+    err = ConnExec(conn, HelloMethod, params, result, captured)
+    conn.Close()
+    require.Error(t, err)
+}
+
+func TestVerifier(t *testing.T) {
+    verifier := NewVerifier([]byte("12345"))
+    require.True(t, verifier.Check([]byte("12345")))
+    require.False(t, verifier.Check([]byte("54321")))
+
+    legacy := CreateLegacyAuth([]byte("qwert"), []byte("12345"))
+    pass, ok := LegacyPass(legacy.Ident, legacy.Salt, legacy.Hash)
+    require.True(t, ok)
+    require.True(t, verifier.Check(pass))
+    _, ok = LegacyPass(legacy.Ident, CreateSalt(), legacy.Hash)
+    require.False(t, ok)
+}
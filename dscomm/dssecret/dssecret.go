@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dssecret
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "errors"
+    "fmt"
+    "os"
+
+    "dstore/dscomm/dserr"
+)
+
+const KeySize int = 32
+
+// Box seals secrets which must stay recoverable, such as outbound passwords
+type Box struct {
+    aead    cipher.AEAD
+}
+
+func NewBox(key []byte) (*Box, error) {
+    var err error
+    var box Box
+    if len(key) != KeySize {
+        err = fmt.Errorf("secret key size %d, need %d", len(key), KeySize)
+        return &box, dserr.Err(err)
+    }
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return &box, dserr.Err(err)
+    }
+    box.aead, err = cipher.NewGCM(block)
+    if err != nil {
+        return &box, dserr.Err(err)
+    }
+    return &box, dserr.Err(err)
+}
+
+func NewKey() []byte {
+    key := make([]byte, KeySize)
+    rand.Read(key)
+    return key
+}
+
+// LoadKey reads the key file, missing file is created with new key
+func LoadKey(keyPath string) ([]byte, error) {
+    var err error
+    key, err := os.ReadFile(keyPath)
+    if err == nil {
+        if len(key) != KeySize {
+            err = fmt.Errorf("wrong secret key size in %s", keyPath)
+            return key, dserr.Err(err)
+        }
+        return key, dserr.Err(err)
+    }
+    if !errors.Is(err, os.ErrNotExist) {
+        return key, dserr.Err(err)
+    }
+    key = NewKey()
+    err = os.WriteFile(keyPath, key, 0600)
+    if err != nil {
+        return key, dserr.Err(err)
+    }
+    return key, dserr.Err(err)
+}
+
+// Seal returns nonce and encrypted data
+func (box *Box) Seal(data []byte) ([]byte, error) {
+    var err error
+    nonce := make([]byte, box.aead.NonceSize())
+    _, err = rand.Read(nonce)
+    if err != nil {
+        return nil, dserr.Err(err)
+    }
+    sealed := box.aead.Seal(nonce, nonce, data, nil)
+    return sealed, dserr.Err(err)
+}
+
+func (box *Box) Open(sealed []byte) ([]byte, error) {
+    var err error
+    nonceSize := box.aead.NonceSize()
+    if len(sealed) < nonceSize {
+        err = errors.New("sealed data too short")
+        return nil, dserr.Err(err)
+    }
+    data, err := box.aead.Open(nil, sealed[0:nonceSize], sealed[nonceSize:], nil)
+    if err != nil {
+        err = fmt.Errorf("cannot open secret: %v", err)
+        return nil, dserr.Err(err)
+    }
+    return data, dserr.Err(err)
+}
+
+// DeriveKey makes the subkey of the key for the purpose
+func DeriveKey(key []byte, purpose string) []byte {
+    return Sign(key, []byte(purpose))
+}
+
+// Sign returns HMAC-SHA256 of the data
+func Sign(key, data []byte) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write(data)
+    return mac.Sum(nil)
+}
+
+func CheckSign(key, data, sign []byte) bool {
+    return hmac.Equal(Sign(key, data), sign)
+}
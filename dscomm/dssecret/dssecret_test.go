@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package dssecret
+
+import (
+    "path/filepath"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+)
+
+func TestBox01(t *testing.T) {
+    var err error
+    keyPath := filepath.Join(t.TempDir(), "secret.key")
+
+    key, err := LoadKey(keyPath)
+    require.NoError(t, err)
+    key2, err := LoadKey(keyPath)
+    require.NoError(t, err)
+    require.Equal(t, key, key2)
+
+    box, err := NewBox(key)
+    require.NoError(t, err)
+
+    secret := []byte("qwerty")
+    sealed, err := box.Seal(secret)
+    require.NoError(t, err)
+    require.NotContains(t, string(sealed), string(secret))
+
+    opened, err := box.Open(sealed)
+    require.NoError(t, err)
+    require.Equal(t, secret, opened)
+
+    sealed[len(sealed) - 1] ^= 1
+    _, err = box.Open(sealed)
+    require.Error(t, err)
+
+    other, err := NewBox(NewKey())
+    require.NoError(t, err)
+    _, err = other.Open(sealed)
+    require.Error(t, err)
+
+    _, err = NewBox([]byte("short"))
+    require.Error(t, err)
+}
+
+func TestSign01(t *testing.T) {
+    key := NewKey()
+    subKey := DeriveKey(key, "session token")
+    require.Equal(t, KeySize, len(subKey))
+    require.NotEqual(t, subKey, DeriveKey(key, "other"))
+
+    data := []byte("qwerty")
+    sign := Sign(subKey, data)
+    require.True(t, CheckSign(subKey, data, sign))
+    require.False(t, CheckSign(key, data, sign))
+    require.False(t, CheckSign(subKey, []byte("qwertz"), sign))
+}
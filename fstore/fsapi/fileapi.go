@@ -13,6 +13,9 @@ const SaveFileMethod string = "saveFile"
 
 type SaveFileParams struct {
     FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    Append      bool                `msgpack:"append"    json:"append"`
+    Offset      int64               `msgpack:"offset"    json:"offset"`
+    Overwrite   bool                `msgpack:"overwrite" json:"overwrite"`
 }
 
 type SaveFileResult struct {
@@ -28,16 +31,39 @@ func NewSaveFileParams() *SaveFileParams {
 }
 
 
+const StatFileMethod string = "statFile"
+
+type StatFileParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+}
+
+type StatFileResult struct {
+    Exists  bool                    `msgpack:"exists"  json:"exists"`
+    File    *dsdescr.File           `msgpack:"file"    json:"file"`
+}
+
+func NewStatFileResult() *StatFileResult {
+    return &StatFileResult{}
+}
+
+func NewStatFileParams() *StatFileParams {
+    return &StatFileParams{}
+}
+
+
 const ListFilesMethod string = "listFiles"
 
 type ListFilesParams struct {
     Pattern     string              `msgpack:"pattern"  json:"pattern"`
     Regular     string              `msgpack:"pegular"  json:"regular"`
     GPattern    string              `msgpack:"gPattern"     json:"gPattern"`
+    StartAfter  string              `msgpack:"startAfter"   json:"startAfter"`
+    Limit       int                 `msgpack:"limit"        json:"limit"`
 }
 
 type ListFilesResult struct {
     Files   []*dsdescr.File         `msgpack:"files"    json:"files"`
+    Next    string                  `msgpack:"next"     json:"next"`
 }
 
 func NewListFilesResult() *ListFilesResult {
@@ -49,10 +75,61 @@ func NewListFilesParams() *ListFilesParams {
 }
 
 
+// Files of the stream are sent as newline-delimited json records
+// over the binary channel
+const ListFilesStreamMethod string = "listFilesStream"
+
+type ListFilesStreamParams struct {
+    Pattern     string              `msgpack:"pattern"      json:"pattern"`
+    Regular     string              `msgpack:"pegular"      json:"regular"`
+    GPattern    string              `msgpack:"gPattern"     json:"gPattern"`
+    StartAfter  string              `msgpack:"startAfter"   json:"startAfter"`
+    Limit       int                 `msgpack:"limit"        json:"limit"`
+}
+
+type ListFilesStreamResult struct {
+    Count   int64                   `msgpack:"count"    json:"count"`
+    Next    string                  `msgpack:"next"     json:"next"`
+}
+
+func NewListFilesStreamResult() *ListFilesStreamResult {
+    return &ListFilesStreamResult{}
+}
+
+func NewListFilesStreamParams() *ListFilesStreamParams {
+    return &ListFilesStreamParams{}
+}
+
+
+const ListDirMethod string = "listDir"
+
+type ListDirParams struct {
+    DirPath     string              `msgpack:"dirPath"   json:"dirPath"`
+    Token       string              `msgpack:"token"     json:"token"`
+    Limit       int                 `msgpack:"limit"     json:"limit"`
+}
+
+type ListDirResult struct {
+    Entries     []*dsdescr.DirEntry `msgpack:"entries"   json:"entries"`
+    Next        string              `msgpack:"next"      json:"next"`
+}
+
+func NewListDirResult() *ListDirResult {
+    return &ListDirResult{}
+}
+
+func NewListDirParams() *ListDirParams {
+    return &ListDirParams{}
+}
+
+
 const LoadFileMethod string = "loadFile"
 
 type LoadFileParams struct {
     FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    Offset      int64               `msgpack:"offset"    json:"offset"`
+    Length      int64               `msgpack:"length"    json:"length"`
+    Version     int64               `msgpack:"version"   json:"version"`
 }
 
 type LoadFileResult struct {
@@ -67,6 +144,102 @@ func NewLoadFileParams() *LoadFileParams {
 }
 
 
+const ListVersionsMethod string = "listVersions"
+
+type ListVersionsParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+}
+
+type ListVersionsResult struct {
+    Files   []*dsdescr.File         `msgpack:"files"    json:"files"`
+}
+
+func NewListVersionsResult() *ListVersionsResult {
+    return &ListVersionsResult{}
+}
+
+func NewListVersionsParams() *ListVersionsParams {
+    return &ListVersionsParams{}
+}
+
+
+const RestoreVersionMethod string = "restoreVersion"
+
+type RestoreVersionParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    Version     int64               `msgpack:"version"   json:"version"`
+}
+
+type RestoreVersionResult struct {
+    File   *dsdescr.File            `msgpack:"file"    json:"file"`
+}
+
+func NewRestoreVersionResult() *RestoreVersionResult {
+    return &RestoreVersionResult{}
+}
+
+func NewRestoreVersionParams() *RestoreVersionParams {
+    return &RestoreVersionParams{}
+}
+
+
+const ListTrashMethod string = "listTrash"
+
+type ListTrashParams struct {
+}
+
+type ListTrashResult struct {
+    Files   []*dsdescr.File         `msgpack:"files"    json:"files"`
+}
+
+func NewListTrashResult() *ListTrashResult {
+    return &ListTrashResult{}
+}
+
+func NewListTrashParams() *ListTrashParams {
+    return &ListTrashParams{}
+}
+
+
+const RestoreTrashMethod string = "restoreTrash"
+
+type RestoreTrashParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    DestPath    string              `msgpack:"destPath"  json:"destPath"`
+}
+
+type RestoreTrashResult struct {
+    File   *dsdescr.File            `msgpack:"file"    json:"file"`
+}
+
+func NewRestoreTrashResult() *RestoreTrashResult {
+    return &RestoreTrashResult{}
+}
+
+func NewRestoreTrashParams() *RestoreTrashParams {
+    return &RestoreTrashParams{}
+}
+
+
+const PurgeTrashMethod string = "purgeTrash"
+
+type PurgeTrashParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+}
+
+type PurgeTrashResult struct {
+    Files   []*dsdescr.File         `msgpack:"files"    json:"files"`
+}
+
+func NewPurgeTrashResult() *PurgeTrashResult {
+    return &PurgeTrashResult{}
+}
+
+func NewPurgeTrashParams() *PurgeTrashParams {
+    return &PurgeTrashParams{}
+}
+
+
 const DeleteFileMethod string = "deleteFile"
 type DeleteFileParams struct {
     FilePath    string              `msgpack:"filePath"  json:"filePath"`
@@ -91,11 +264,14 @@ type FileStatsParams struct {
     Pattern     string              `msgpack:"pattern"      json:"pattern"`
     Regular     string              `msgpack:"pegular"      json:"regular"`
     GPattern    string              `msgpack:"gPattern"     json:"gPattern"`
+    StartAfter  string              `msgpack:"startAfter"   json:"startAfter"`
+    Limit       int                 `msgpack:"limit"        json:"limit"`
 }
 
 type FileStatsResult struct {
     Count      int64                `msgpack:"count"    json:"count"`
     Usage      int64                `msgpack:"usage"    json:"usage"`
+    Next       string               `msgpack:"next"     json:"next"`
 }
 
 func NewFileStatsResult() *FileStatsResult {
@@ -114,10 +290,13 @@ type EraseFilesParams struct {
     Regular     string              `msgpack:"pegular"  json:"regular"`
     GPattern    string              `msgpack:"gPattern" json:"gPattern"`
     Erase       bool                `msgpack:"erase"    json:"erase"`
+    StartAfter  string              `msgpack:"startAfter"   json:"startAfter"`
+    Limit       int                 `msgpack:"limit"        json:"limit"`
 }
 
 type EraseFilesResult struct {
     Files   []*dsdescr.File         `msgpack:"files"    json:"files"`
+    Next    string                  `msgpack:"next"     json:"next"`
 }
 
 func NewEraseFilesResult() *EraseFilesResult {
@@ -128,4 +307,62 @@ func NewEraseFilesParams() *EraseFilesParams {
     return &EraseFilesParams{}
 }
 
+const MoveFileMethod string = "moveFile"
 
+type MoveFileParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    DestPath    string              `msgpack:"destPath"  json:"destPath"`
+}
+
+type MoveFileResult struct {
+    File   *dsdescr.File            `msgpack:"file"    json:"file"`
+}
+
+func NewMoveFileResult() *MoveFileResult {
+    return &MoveFileResult{}
+}
+
+func NewMoveFileParams() *MoveFileParams {
+    return &MoveFileParams{}
+}
+
+
+const MoveDirMethod string = "moveDir"
+
+type MoveDirParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    DestPath    string              `msgpack:"destPath"  json:"destPath"`
+}
+
+type MoveDirResult struct {
+    Files   []*dsdescr.File         `msgpack:"files"    json:"files"`
+    Failed  []*dsdescr.MoveError    `msgpack:"failed"   json:"failed"`
+}
+
+func NewMoveDirResult() *MoveDirResult {
+    return &MoveDirResult{}
+}
+
+func NewMoveDirParams() *MoveDirParams {
+    return &MoveDirParams{}
+}
+
+
+const CopyFileMethod string = "copyFile"
+
+type CopyFileParams struct {
+    FilePath    string              `msgpack:"filePath"  json:"filePath"`
+    DestPath    string              `msgpack:"destPath"  json:"destPath"`
+}
+
+type CopyFileResult struct {
+    File   *dsdescr.File            `msgpack:"file"    json:"file"`
+}
+
+func NewCopyFileResult() *CopyFileResult {
+    return &CopyFileResult{}
+}
+
+func NewCopyFileParams() *CopyFileParams {
+    return &CopyFileParams{}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsapi
+
+import (
+    "dstore/dscomm/dsdescr"
+)
+
+const GrantAccessMethod string = "grantAccess"
+
+type GrantAccessParams struct {
+    Owner       string      `json:"owner"       msgpack:"owner"`
+    PathPrefix  string      `json:"pathPrefix"  msgpack:"pathPrefix"`
+    GranteeType string      `json:"granteeType" msgpack:"granteeType"`
+    Grantee     string      `json:"grantee"     msgpack:"grantee"`
+    Access      string      `json:"access"      msgpack:"access"`
+}
+
+type GrantAccessResult struct {
+}
+
+func NewGrantAccessResult() *GrantAccessResult {
+    return &GrantAccessResult{}
+}
+func NewGrantAccessParams() *GrantAccessParams {
+    return &GrantAccessParams{}
+}
+
+const RevokeAccessMethod string = "revokeAccess"
+
+type RevokeAccessParams struct {
+    Owner       string      `json:"owner"       msgpack:"owner"`
+    PathPrefix  string      `json:"pathPrefix"  msgpack:"pathPrefix"`
+    GranteeType string      `json:"granteeType" msgpack:"granteeType"`
+    Grantee     string      `json:"grantee"     msgpack:"grantee"`
+}
+
+type RevokeAccessResult struct {
+}
+
+func NewRevokeAccessResult() *RevokeAccessResult {
+    return &RevokeAccessResult{}
+}
+func NewRevokeAccessParams() *RevokeAccessParams {
+    return &RevokeAccessParams{}
+}
+
+const ListGrantsMethod string = "listGrants"
+
+type ListGrantsParams struct {
+    Owner       string      `json:"owner"       msgpack:"owner"`
+}
+
+type ListGrantsResult struct {
+    Grants      []*dsdescr.Grant    `json:"grants"  msgpack:"grants"`
+}
+
+func NewListGrantsResult() *ListGrantsResult {
+    return &ListGrantsResult{}
+}
+func NewListGrantsParams() *ListGrantsParams {
+    return &ListGrantsParams{}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsapi
+
+import (
+    "dstore/dscomm/dsdescr"
+)
+
+const LoginMethod string = "login"
+
+type LoginParams struct {
+    TTL         int64       `json:"ttl"         msgpack:"ttl"`
+}
+
+type LoginResult struct {
+    Token       string      `json:"token"       msgpack:"token"`
+    ExpiresAt   int64       `json:"expiresAt"   msgpack:"expiresAt"`
+}
+
+func NewLoginResult() *LoginResult {
+    return &LoginResult{}
+}
+func NewLoginParams() *LoginParams {
+    return &LoginParams{}
+}
+
+const CreateKeyMethod string = "createKey"
+
+type CreateKeyParams struct {
+    Login       string      `json:"login"       msgpack:"login"`
+    Name        string      `json:"name"        msgpack:"name"`
+    ReadOnly    bool        `json:"readOnly"    msgpack:"readOnly"`
+    PathPrefix  string      `json:"pathPrefix"  msgpack:"pathPrefix"`
+    TTL         int64       `json:"ttl"         msgpack:"ttl"`
+}
+
+type CreateKeyResult struct {
+    Token       string              `json:"token"   msgpack:"token"`
+    Key         *dsdescr.APIKey     `json:"key"     msgpack:"key"`
+}
+
+func NewCreateKeyResult() *CreateKeyResult {
+    return &CreateKeyResult{}
+}
+func NewCreateKeyParams() *CreateKeyParams {
+    return &CreateKeyParams{}
+}
+
+const ListKeysMethod string = "listKeys"
+
+type ListKeysParams struct {
+    Login       string      `json:"login"       msgpack:"login"`
+}
+
+type ListKeysResult struct {
+    Keys        []*dsdescr.APIKey   `json:"keys"    msgpack:"keys"`
+}
+
+func NewListKeysResult() *ListKeysResult {
+    return &ListKeysResult{}
+}
+func NewListKeysParams() *ListKeysParams {
+    return &ListKeysParams{}
+}
+
+const RevokeKeyMethod string = "revokeKey"
+
+type RevokeKeyParams struct {
+    KeyId       string      `json:"keyId"       msgpack:"keyId"`
+}
+
+type RevokeKeyResult struct {
+}
+
+func NewRevokeKeyResult() *RevokeKeyResult {
+    return &RevokeKeyResult{}
+}
+func NewRevokeKeyParams() *RevokeKeyParams {
+    return &RevokeKeyParams{}
+}
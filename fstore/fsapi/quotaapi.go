@@ -0,0 +1,44 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsapi
+
+import (
+    "dstore/dscomm/dsdescr"
+)
+
+const SetQuotaMethod string = "setQuota"
+
+type SetQuotaParams struct {
+    Login       string      `json:"login"       msgpack:"login"`
+    QuotaSize   int64       `json:"quotaSize"   msgpack:"quotaSize"`
+    QuotaFiles  int64       `json:"quotaFiles"  msgpack:"quotaFiles"`
+}
+
+type SetQuotaResult struct {
+}
+
+func NewSetQuotaResult() *SetQuotaResult {
+    return &SetQuotaResult{}
+}
+func NewSetQuotaParams() *SetQuotaParams {
+    return &SetQuotaParams{}
+}
+
+const GetUsageMethod string = "getUsage"
+
+type GetUsageParams struct {
+    Login       string      `json:"login"       msgpack:"login"`
+}
+
+type GetUsageResult struct {
+    Usage       *dsdescr.Usage  `json:"usage"   msgpack:"usage"`
+}
+
+func NewGetUsageResult() *GetUsageResult {
+    return &GetUsageResult{}
+}
+func NewGetUsageParams() *GetUsageParams {
+    return &GetUsageParams{}
+}
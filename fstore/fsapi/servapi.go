@@ -5,6 +5,10 @@
 
 package fsapi
 
+import (
+    "dstore/dscomm/dsdescr"
+)
+
 const GetStatusMethod string = "getStatus"
 
 type GetStatusParams struct {
@@ -20,3 +24,36 @@ func NewGetStatusResult() *GetStatusResult {
 func NewGetStatusParams() *GetStatusParams {
     return &GetStatusParams{}
 }
+
+const ScrubStatusMethod string = "scrubStatus"
+
+type ScrubStatusParams struct {
+}
+
+type ScrubStatusResult struct {
+    Status  *dsdescr.ScrubStatus    `json:"status"    msgpack:"status"`
+}
+
+func NewScrubStatusResult() *ScrubStatusResult {
+    return &ScrubStatusResult{}
+}
+func NewScrubStatusParams() *ScrubStatusParams {
+    return &ScrubStatusParams{}
+}
+
+const RunGCMethod string = "runGC"
+
+type RunGCParams struct {
+    DryRun  bool                    `json:"dryRun"    msgpack:"dryRun"`
+}
+
+type RunGCResult struct {
+    Report  *dsdescr.GCReport       `json:"report"    msgpack:"report"`
+}
+
+func NewRunGCResult() *RunGCResult {
+    return &RunGCResult{}
+}
+func NewRunGCParams() *RunGCParams {
+    return &RunGCParams{}
+}
@@ -29,6 +29,8 @@ type UpdateUserParams struct {
     Login   string              `json:"login"`
     Pass    string              `json:"pass"`
     State   string              `json:"state"`
+    KeepVers    int64           `json:"keepVers"`
+    Groups      []string        `json:"groups"`
 }
 type UpdateUserResult struct {
 }
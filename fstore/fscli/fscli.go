@@ -7,11 +7,14 @@ package main
 import (
     "encoding/json"
     "fmt"
+    "io"
     "io/fs"
     "flag"
     "os"
     "path/filepath"
+    "strings"
     "errors"
+    "time"
 
     "dstore/fstore/fsapi"
     "dstore/dscomm/dsrpc"
@@ -23,14 +26,55 @@ func main() {
     var err error
     util := NewUtil()
     err = util.Exec()
-    if err != nil {
+    if err != nil && !util.reported {
         fmt.Printf("Exec error: %s\n", err)
     }
+    os.Exit(exitCode(err))
+}
+
+// Exit codes tell the kind of the error of the call,
+// code 2 is left for wrong options
+const (
+    exitOK              int = 0
+    exitError           int = 1
+    exitNotFound        int = 3
+    exitExists          int = 4
+    exitUnauthorized    int = 5
+    exitForbidden       int = 6
+    exitQuotaExceeded   int = 7
+    exitCorrupt         int = 8
+)
+
+func exitCode(err error) int {
+    if err == nil {
+        return exitOK
+    }
+    switch {
+        case errors.Is(err, dsrpc.ErrNotFound):
+            return exitNotFound
+        case errors.Is(err, dsrpc.ErrExists):
+            return exitExists
+        case errors.Is(err, dsrpc.ErrUnauthorized):
+            return exitUnauthorized
+        case errors.Is(err, dsrpc.ErrForbidden):
+            return exitForbidden
+        case errors.Is(err, dsrpc.ErrQuotaExceeded):
+            return exitQuotaExceeded
+        case errors.Is(err, dsrpc.ErrCorrupt):
+            return exitCorrupt
+    }
+    return exitError
 }
 
 type Util struct {
     aLogin      string
     aPass       string
+    aToken      string
+
+    TLS         bool
+    CAPath      string
+    CertPath    string
+    KeyPath     string
 
     Port        string
     Address     string
@@ -40,18 +84,46 @@ type Util struct {
 
     Login       string
     Pass        string
+    KeepVers    int64
+    Groups      string
 
     bPort       string
     bAddress    string
 
     LocalFilePath   string
     RemoteFilePath  string
+    DestFilePath    string
 
     Pattern     string
     GPattern    string
     Regular     string
 
     Erase       bool
+    Resume      bool
+    Overwrite   bool
+    Offset      int64
+    Length      int64
+    Version     int64
+    DryRun      bool
+    Limit       int
+    StartAfter  string
+    Stream      bool
+
+    KeyName     string
+    KeyId       string
+    ReadOnly    bool
+    PathPrefix  string
+    TTL         int64
+
+    QuotaSize   int64
+    QuotaFiles  int64
+
+    Owner       string
+    GranteeType string
+    Grantee     string
+    Access      string
+
+    reported    bool
 }
 
 func NewUtil() *Util {
@@ -61,13 +133,26 @@ func NewUtil() *Util {
     util.Message    = "hello"
     util.aLogin     = "admin"
     util.aPass      = "admin"
+    util.aToken     = os.Getenv("DSTORE_TOKEN")
     return &util
 }
 
 const getStatusCmd      string = "getStatus"
+const scrubStatusCmd    string = "scrubStatus"
+const runGCCmd          string = "runGC"
 const saveFileCmd       string = "saveFile"
 const loadFileCmd       string = "loadFile"
+const statFileCmd       string = "statFile"
+const listVersionsCmd   string = "listVersions"
+const restoreVersionCmd string = "restoreVersion"
+const listTrashCmd      string = "listTrash"
+const restoreTrashCmd   string = "restoreTrash"
+const purgeTrashCmd     string = "purgeTrash"
+const moveFileCmd       string = "moveFile"
+const moveDirCmd        string = "moveDir"
+const copyFileCmd       string = "copyFile"
 const listFilesCmd      string = "listFiles"
+const lsCmd             string = "ls"
 const fileStatsCmd      string = "fileStats"
 const deleteFileCmd     string = "deleteFile"
 const eraseFilesCmd     string = "eraseFiles"
@@ -83,6 +168,18 @@ const updateBStoreCmd   string = "updateBStore"
 const deleteBStoreCmd   string = "deleteBStore"
 const listBStoresCmd    string = "listBStores"
 
+const loginCmd          string = "login"
+const createKeyCmd      string = "createKey"
+const listKeysCmd       string = "listKeys"
+const revokeKeyCmd      string = "revokeKey"
+
+const setQuotaCmd       string = "setQuota"
+const getUsageCmd       string = "getUsage"
+
+const grantAccessCmd    string = "grantAccess"
+const revokeAccessCmd   string = "revokeAccess"
+const listGrantsCmd     string = "listGrants"
+
 const helpCmd           string = "help"
 
 
@@ -95,15 +192,23 @@ func (util *Util) GetOpt() error {
     flag.StringVar(&util.Address, "address", util.Address, "service address")
     flag.StringVar(&util.aLogin, "aLogin", util.aLogin, "access login")
     flag.StringVar(&util.aPass, "aPass", util.aPass, "access password")
+    flag.StringVar(&util.aToken, "aToken", util.aToken, "session token or api key instead of password, DSTORE_TOKEN by default")
+    flag.BoolVar(&util.TLS, "tls", util.TLS, "use tls connection")
+    flag.StringVar(&util.CAPath, "ca", util.CAPath, "ca certificate file, system roots by default")
+    flag.StringVar(&util.CertPath, "cert", util.CertPath, "client certificate file for mutual tls")
+    flag.StringVar(&util.KeyPath, "key", util.KeyPath, "client key file for mutual tls")
 
     help := func() {
         fmt.Println("")
         fmt.Printf("Usage: %s [option] command [command option]\n", exeName)
         fmt.Printf("\n")
-        fmt.Printf("Command list: help, getStatus, \n")
-        fmt.Printf("    saveFile, loadFile, listFiles, fileStats, deleteFile, eraseFiles \n")
+        fmt.Printf("Command list: help, getStatus, scrubStatus, runGC, \n")
+        fmt.Printf("    saveFile, loadFile, statFile, listFiles, ls, fileStats, deleteFile, eraseFiles \n")
+        fmt.Printf("    listVersions, restoreVersion, listTrash, restoreTrash, purgeTrash, moveFile, moveDir, copyFile \n")
         fmt.Printf("    addUser, checkUser, updateUser, listUsers, deleteUser \n")
         fmt.Printf("    addBStore, checkBStore, updateBStore, listBStores, deleteBStore \n")
+        fmt.Printf("    login, createKey, listKeys, revokeKey \n")
+        fmt.Printf("    setQuota, getUsage, grantAccess, revokeAccess, listGrants \n")
 
         fmt.Printf("\n")
         fmt.Printf("Global options:\n")
@@ -129,7 +234,7 @@ func (util *Util) GetOpt() error {
         case helpCmd:
             help()
             return errors.New("unknown command")
-        case getStatusCmd:
+        case getStatusCmd, scrubStatusCmd, listTrashCmd:
             flagSet := flag.NewFlagSet(getStatusCmd, flag.ExitOnError)
             flagSet.Usage = func() {
                 fmt.Printf("\n")
@@ -141,10 +246,36 @@ func (util *Util) GetOpt() error {
             }
             flagSet.Parse(subArgs)
             util.SubCmd = subCmd
+        case runGCCmd:
+            flagSet := flag.NewFlagSet(runGCCmd, flag.ExitOnError)
+            flagSet.BoolVar(&util.DryRun, "dryRun", util.DryRun, "only report the garbage")
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
         case saveFileCmd, loadFileCmd:
             flagSet := flag.NewFlagSet(saveFileCmd, flag.ExitOnError)
-            flagSet.StringVar(&util.LocalFilePath, "local", util.LocalFilePath, "local file name")
+            localUsage := "local file name"
+            if subCmd == saveFileCmd {
+                localUsage = "local file name, - for standard input"
+            }
+            flagSet.StringVar(&util.LocalFilePath, "local", util.LocalFilePath, localUsage)
             flagSet.StringVar(&util.RemoteFilePath, "remote", util.RemoteFilePath, "remote file path")
+            if subCmd == saveFileCmd {
+                flagSet.BoolVar(&util.Resume, "resume", util.Resume, "resume interrupted upload")
+                flagSet.BoolVar(&util.Overwrite, "overwrite", util.Overwrite, "replace existing file")
+            }
+            if subCmd == loadFileCmd {
+                flagSet.Int64Var(&util.Offset, "offset", util.Offset, "remote file offset")
+                flagSet.Int64Var(&util.Length, "length", util.Length, "data length, zero for up to end")
+                flagSet.Int64Var(&util.Version, "version", util.Version, "file version, zero for current")
+            }
             flagSet.Usage = func() {
                 fmt.Printf("\n")
                 fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
@@ -160,6 +291,11 @@ func (util *Util) GetOpt() error {
             flagSet.StringVar(&util.Pattern, "patt", util.Pattern, "shell-like pattern")
             flagSet.StringVar(&util.Regular, "regex", util.Regular, "regexp pattern")
             flagSet.StringVar(&util.GPattern, "glob", util.GPattern, "glob pattern")
+            flagSet.StringVar(&util.StartAfter, "after", util.StartAfter, "start after the path")
+            flagSet.IntVar(&util.Limit, "limit", util.Limit, "files per request")
+            if subCmd == listFilesCmd {
+                flagSet.BoolVar(&util.Stream, "stream", util.Stream, "print files as json lines")
+            }
 
             flagSet.Usage = func() {
                 fmt.Printf("\n")
@@ -171,10 +307,45 @@ func (util *Util) GetOpt() error {
             }
             flagSet.Parse(subArgs)
             util.SubCmd = subCmd
-        case deleteFileCmd:
+        case lsCmd:
+            util.RemoteFilePath = "/"
+            flagSet := flag.NewFlagSet(lsCmd, flag.ExitOnError)
+            flagSet.StringVar(&util.RemoteFilePath, "path", util.RemoteFilePath, "remote directory path")
+            flagSet.IntVar(&util.Limit, "limit", util.Limit, "entries per request")
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
+        case deleteFileCmd, statFileCmd, listVersionsCmd, restoreVersionCmd, restoreTrashCmd, purgeTrashCmd:
             flagSet := flag.NewFlagSet(saveFileCmd, flag.ExitOnError)
             flagSet.StringVar(&util.RemoteFilePath, "path", util.RemoteFilePath, "remote file path")
+            if subCmd == restoreVersionCmd {
+                flagSet.Int64Var(&util.Version, "version", util.Version, "file version")
+            }
+            if subCmd == restoreTrashCmd {
+                flagSet.StringVar(&util.DestFilePath, "dest", util.DestFilePath, "destination path, origin path by default")
+            }
 
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
+        case moveFileCmd, moveDirCmd, copyFileCmd:
+            flagSet := flag.NewFlagSet(moveFileCmd, flag.ExitOnError)
+            flagSet.StringVar(&util.RemoteFilePath, "path", util.RemoteFilePath, "remote file or directory path")
+            flagSet.StringVar(&util.DestFilePath, "dest", util.DestFilePath, "destination path")
             flagSet.Usage = func() {
                 fmt.Printf("\n")
                 fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
@@ -191,6 +362,8 @@ func (util *Util) GetOpt() error {
             flagSet.StringVar(&util.Regular, "regex", util.Regular, "regexp pattern")
             flagSet.StringVar(&util.GPattern, "glob", util.GPattern, "glob pattern")
             flagSet.BoolVar(&util.Erase, "erase", util.Erase, "erase")
+            flagSet.StringVar(&util.StartAfter, "after", util.StartAfter, "start after the path")
+            flagSet.IntVar(&util.Limit, "limit", util.Limit, "files per request")
 
             flagSet.Usage = func() {
                 fmt.Printf("\n")
@@ -206,6 +379,10 @@ func (util *Util) GetOpt() error {
             flagSet := flag.NewFlagSet(addUserCmd, flag.ExitOnError)
             flagSet.StringVar(&util.Login, "login", util.Login, "login")
             flagSet.StringVar(&util.Pass, "pass", util.Pass, "pass")
+            if subCmd == updateUserCmd {
+                flagSet.Int64Var(&util.KeepVers, "keepVers", util.KeepVers, "kept file versions, negative disables versions")
+                flagSet.StringVar(&util.Groups, "groups", util.Groups, "comma separated groups of user, \"-\" for none")
+            }
             flagSet.Usage = func() {
                 fmt.Printf("\n")
                 fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
@@ -287,6 +464,89 @@ func (util *Util) GetOpt() error {
             }
             flagSet.Parse(subArgs)
             util.SubCmd = subCmd
+        case loginCmd:
+            flagSet := flag.NewFlagSet(loginCmd, flag.ExitOnError)
+            flagSet.Int64Var(&util.TTL, "ttl", util.TTL, "token lifetime in seconds, server maximum by default")
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
+        case createKeyCmd, listKeysCmd:
+            flagSet := flag.NewFlagSet(createKeyCmd, flag.ExitOnError)
+            flagSet.StringVar(&util.Login, "login", util.Login, "key owner, access login by default")
+            if subCmd == createKeyCmd {
+                flagSet.StringVar(&util.KeyName, "name", util.KeyName, "key name")
+                flagSet.BoolVar(&util.ReadOnly, "readOnly", util.ReadOnly, "allow only read methods")
+                flagSet.StringVar(&util.PathPrefix, "prefix", util.PathPrefix, "allow only paths under the prefix")
+                flagSet.Int64Var(&util.TTL, "ttl", util.TTL, "key lifetime in seconds, zero for unlimited")
+            }
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
+        case setQuotaCmd, getUsageCmd:
+            flagSet := flag.NewFlagSet(setQuotaCmd, flag.ExitOnError)
+            flagSet.StringVar(&util.Login, "login", util.Login, "user login, access login by default")
+            if subCmd == setQuotaCmd {
+                flagSet.Int64Var(&util.QuotaSize, "size", util.QuotaSize, "max data size in bytes, zero for unlimited")
+                flagSet.Int64Var(&util.QuotaFiles, "files", util.QuotaFiles, "max file count, zero for unlimited")
+            }
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
+        case grantAccessCmd, revokeAccessCmd, listGrantsCmd:
+            flagSet := flag.NewFlagSet(grantAccessCmd, flag.ExitOnError)
+            flagSet.StringVar(&util.Owner, "owner", util.Owner, "owner of files, access login by default")
+            if subCmd != listGrantsCmd {
+                flagSet.StringVar(&util.PathPrefix, "prefix", util.PathPrefix, "shared path prefix, root by default")
+                flagSet.StringVar(&util.GranteeType, "type", util.GranteeType, "grantee type: user or group")
+                flagSet.StringVar(&util.Grantee, "grantee", util.Grantee, "grantee user or group name")
+            }
+            if subCmd == grantAccessCmd {
+                flagSet.StringVar(&util.Access, "access", util.Access, "access: read or write")
+            }
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
+        case revokeKeyCmd:
+            flagSet := flag.NewFlagSet(revokeKeyCmd, flag.ExitOnError)
+            flagSet.StringVar(&util.KeyId, "keyId", util.KeyId, "key id")
+            flagSet.Usage = func() {
+                fmt.Printf("\n")
+                fmt.Printf("Usage: %s [global options] %s [command options]\n", exeName, subCmd)
+                fmt.Printf("\n")
+                fmt.Printf("The command options:\n")
+                flagSet.PrintDefaults()
+                fmt.Printf("\n")
+            }
+            flagSet.Parse(subArgs)
+            util.SubCmd = subCmd
         default:
             help()
             return errors.New("unknown command")
@@ -297,20 +557,24 @@ func (util *Util) GetOpt() error {
 type Response struct {
     Error       bool       `json:"error"`
     ErrorMsg    string     `json:"errorMsg,omitempty"`
+    ErrorCode   string     `json:"errorCode,omitempty"`
     Result      any        `json:"result,omitempty"`
 }
 
 func NewResponse(result any, err error) *Response {
     var errMsg string
+    var errCode string
     var errBool bool
     if err != nil {
         errMsg = err.Error()
+        errCode = dsrpc.ErrorCode(err).String()
         errBool = true
     }
     return &Response{
         Result:     result,
         Error:      errBool,
         ErrorMsg:   errMsg,
+        ErrorCode:  errCode,
     }
 }
 
@@ -321,7 +585,17 @@ func (util *Util) Exec() error {
         return err
     }
     util.URI = fmt.Sprintf("%s:%s", util.Address, util.Port)
+    if util.TLS {
+        tlsConfig, err := dsrpc.NewClientTLSConfig(util.CAPath, util.CertPath, util.KeyPath)
+        if err != nil {
+            return err
+        }
+        dsrpc.SetClientTLS(tlsConfig)
+    }
     auth := dsrpc.CreateAuth([]byte(util.aLogin), []byte(util.aPass))
+    if len(util.aToken) > 0 {
+        auth = dsrpc.CreateTokenAuth([]byte(util.aToken))
+    }
 
     resp := NewResponse(nil, nil)
     var result interface{}
@@ -329,17 +603,45 @@ func (util *Util) Exec() error {
     switch util.SubCmd {
         case getStatusCmd:
             result, err = util.GetStatusCmd(auth)
+        case scrubStatusCmd:
+            result, err = util.ScrubStatusCmd(auth)
+        case runGCCmd:
+            result, err = util.RunGCCmd(auth)
 
         case saveFileCmd:
             result, err = util.SaveFileCmd(auth)
         case loadFileCmd:
             result, err = util.LoadFileCmd(auth)
+        case lsCmd:
+            // Listing is printed as text, not as json response
+            return util.LsCmd(auth)
         case listFilesCmd:
+            if util.Stream {
+                return util.ListFilesStreamCmd(auth)
+            }
             result, err = util.ListFilesCmd(auth)
         case fileStatsCmd:
             result, err = util.FileStatsCmd(auth)
         case deleteFileCmd:
             result, err = util.DeleteFileCmd(auth)
+        case statFileCmd:
+            result, err = util.StatFileCmd(auth)
+        case listVersionsCmd:
+            result, err = util.ListVersionsCmd(auth)
+        case restoreVersionCmd:
+            result, err = util.RestoreVersionCmd(auth)
+        case listTrashCmd:
+            result, err = util.ListTrashCmd(auth)
+        case restoreTrashCmd:
+            result, err = util.RestoreTrashCmd(auth)
+        case purgeTrashCmd:
+            result, err = util.PurgeTrashCmd(auth)
+        case moveFileCmd:
+            result, err = util.MoveFileCmd(auth)
+        case moveDirCmd:
+            result, err = util.MoveDirCmd(auth)
+        case copyFileCmd:
+            result, err = util.CopyFileCmd(auth)
         case eraseFilesCmd:
             result, err = util.EraseFilesCmd(auth)
 
@@ -362,13 +664,35 @@ func (util *Util) Exec() error {
             result, err = util.DeleteBStoreCmd(auth)
         case listBStoresCmd:
             result, err = util.ListBStoresCmd(auth)
+
+        case loginCmd:
+            result, err = util.LoginCmd(auth)
+        case createKeyCmd:
+            result, err = util.CreateKeyCmd(auth)
+        case listKeysCmd:
+            result, err = util.ListKeysCmd(auth)
+        case revokeKeyCmd:
+            result, err = util.RevokeKeyCmd(auth)
+
+        case setQuotaCmd:
+            result, err = util.SetQuotaCmd(auth)
+        case getUsageCmd:
+            result, err = util.GetUsageCmd(auth)
+
+        case grantAccessCmd:
+            result, err = util.GrantAccessCmd(auth)
+        case revokeAccessCmd:
+            result, err = util.RevokeAccessCmd(auth)
+        case listGrantsCmd:
+            result, err = util.ListGrantsCmd(auth)
         default:
             err = errors.New("unknown cli command")
     }
     resp = NewResponse(result, err)
     respJSON, _ := json.MarshalIndent(resp, "", "  ")
     fmt.Printf("%s\n", string(respJSON))
-    err = nil
+    // The error is printed with the response, the exit code tells its kind
+    util.reported = true
     return err
 }
 
@@ -383,11 +707,47 @@ func (util *Util) GetStatusCmd(auth *dsrpc.Auth) (*fsapi.GetStatusResult, error)
     return result, err
 }
 
+func (util *Util) ScrubStatusCmd(auth *dsrpc.Auth) (*fsapi.ScrubStatusResult, error) {
+    var err error
+    params := fsapi.NewScrubStatusParams()
+    result := fsapi.NewScrubStatusResult()
+    err = dsrpc.Exec(util.URI, fsapi.ScrubStatusMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) RunGCCmd(auth *dsrpc.Auth) (*fsapi.RunGCResult, error) {
+    var err error
+    params := fsapi.NewRunGCParams()
+    params.DryRun = util.DryRun
+    result := fsapi.NewRunGCResult()
+    err = dsrpc.Exec(util.URI, fsapi.RunGCMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
 func (util *Util) SaveFileCmd(auth *dsrpc.Auth) (*fsapi.SaveFileResult, error) {
     var err error
     params := fsapi.NewSaveFileParams()
     params.FilePath  = util.RemoteFilePath
     result := fsapi.NewSaveFileResult()
+    // Standard input is sent by chunks up to EOF
+    if util.LocalFilePath == stdinPath {
+        if util.Resume {
+            err = errors.New("resume cannot be used with standard input")
+            return result, err
+        }
+        params.Overwrite = util.Overwrite
+        err = dsrpc.Put(util.URI, fsapi.SaveFileMethod, os.Stdin, dsrpc.ChunkedSize, params, result, auth)
+        if err != nil {
+            return result, err
+        }
+        return result, err
+    }
     localFile, err := os.OpenFile(util.LocalFilePath, os.O_RDONLY, 0)
     defer localFile.Close()
     if err != nil {
@@ -398,6 +758,32 @@ func (util *Util) SaveFileCmd(auth *dsrpc.Auth) (*fsapi.SaveFileResult, error) {
         return result, err
     }
     fileSize := fileInfo.Size()
+    params.Overwrite = util.Overwrite
+
+    if util.Resume {
+        statParams := fsapi.NewStatFileParams()
+        statParams.FilePath = util.RemoteFilePath
+        statResult := fsapi.NewStatFileResult()
+        err = dsrpc.Exec(util.URI, fsapi.StatFileMethod, statParams, statResult, auth)
+        if err != nil {
+            return result, err
+        }
+        var offset int64
+        if statResult.Exists && statResult.File != nil {
+            offset = statResult.File.DataSize
+        }
+        if offset > fileSize {
+            err = fmt.Errorf("remote file size %d greater than local %d", offset, fileSize)
+            return result, err
+        }
+        _, err = localFile.Seek(offset, io.SeekStart)
+        if err != nil {
+            return result, err
+        }
+        params.Append = true
+        params.Offset = offset
+        fileSize -= offset
+    }
 
     err = dsrpc.Put(util.URI, fsapi.SaveFileMethod, localFile, fileSize, params, result, auth)
     if err != nil {
@@ -406,6 +792,8 @@ func (util *Util) SaveFileCmd(auth *dsrpc.Auth) (*fsapi.SaveFileResult, error) {
     return result, err
 }
 
+const stdinPath string = "-"
+
 const dirPerm   fs.FileMode = 0755
 const filePerm  fs.FileMode = 0644
 
@@ -413,12 +801,25 @@ func (util *Util) LoadFileCmd(auth *dsrpc.Auth) (*fsapi.LoadFileResult, error) {
     var err error
     params := fsapi.NewLoadFileParams()
     params.FilePath   = util.RemoteFilePath
+    params.Offset     = util.Offset
+    params.Length     = util.Length
+    params.Version    = util.Version
     result := fsapi.NewLoadFileResult()
-    localFile, err := os.OpenFile(util.LocalFilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, filePerm)
+    // Range is placed to the same offset of local file,
+    // an interrupted download can be continued from local file size
+    localFile, err := os.OpenFile(util.LocalFilePath, os.O_RDWR|os.O_CREATE, filePerm)
     defer localFile.Close()
     if err != nil {
         return result, err
     }
+    err = localFile.Truncate(util.Offset)
+    if err != nil {
+        return result, err
+    }
+    _, err = localFile.Seek(util.Offset, io.SeekStart)
+    if err != nil {
+        return result, err
+    }
     err = dsrpc.Get(util.URI, fsapi.LoadFileMethod, localFile, params, result, auth)
     if err != nil {
         return result, err
@@ -432,6 +833,8 @@ func (util *Util) ListFilesCmd(auth *dsrpc.Auth) (*fsapi.ListFilesResult, error)
     params.Pattern = util.Pattern
     params.Regular = util.Regular
     params.GPattern = util.GPattern
+    params.StartAfter = util.StartAfter
+    params.Limit = util.Limit
 
     result := fsapi.NewListFilesResult()
     err = dsrpc.Exec(util.URI, fsapi.ListFilesMethod, params, result, auth)
@@ -441,12 +844,80 @@ func (util *Util) ListFilesCmd(auth *dsrpc.Auth) (*fsapi.ListFilesResult, error)
     return result, err
 }
 
+// LsCmd prints the directory page by page
+func (util *Util) LsCmd(auth *dsrpc.Auth) error {
+    var err error
+    params := fsapi.NewListDirParams()
+    params.DirPath  = util.RemoteFilePath
+    params.Limit    = util.Limit
+    for {
+        result := fsapi.NewListDirResult()
+        err = dsrpc.Exec(util.URI, fsapi.ListDirMethod, params, result, auth)
+        if err != nil {
+            return err
+        }
+        for _, entry := range result.Entries {
+            updatedAt := time.Unix(entry.UpdatedAt, 0).Format("2006-01-02 15:04")
+            switch entry.IsDir {
+                case true:
+                    fmt.Printf("d  %s  %8s  %6d  %s/\n", updatedAt, humanSize(entry.DataSize),
+                                                                entry.FileCount, entry.Name)
+                default:
+                    fmt.Printf("-  %s  %8s  %6s  %s\n", updatedAt, humanSize(entry.DataSize),
+                                                                "", entry.Name)
+            }
+        }
+        if len(result.Next) == 0 {
+            break
+        }
+        params.Token = result.Next
+    }
+    return err
+}
+
+func humanSize(size int64) string {
+    const unit = 1024
+    if size < unit {
+        return fmt.Sprintf("%d", size)
+    }
+    div := int64(unit)
+    exp := 0
+    for n := size / unit; n >= unit; n /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f%c", float64(size) / float64(div), "KMGTPE"[exp])
+}
+
+// ListFilesStreamCmd prints json lines of files as they are received
+func (util *Util) ListFilesStreamCmd(auth *dsrpc.Auth) error {
+    var err error
+    params := fsapi.NewListFilesStreamParams()
+    params.Pattern  = util.Pattern
+    params.Regular  = util.Regular
+    params.GPattern = util.GPattern
+    params.StartAfter = util.StartAfter
+    params.Limit    = util.Limit
+
+    result := fsapi.NewListFilesStreamResult()
+    err = dsrpc.Get(util.URI, fsapi.ListFilesStreamMethod, os.Stdout, params, result, auth)
+    if err != nil {
+        return err
+    }
+    if len(result.Next) > 0 {
+        fmt.Fprintf(os.Stderr, "next: %s\n", result.Next)
+    }
+    return err
+}
+
 func (util *Util) FileStatsCmd(auth *dsrpc.Auth) (*fsapi.FileStatsResult, error) {
     var err error
     params := fsapi.NewFileStatsParams()
     params.Pattern  = util.Pattern
     params.Regular  = util.Regular
     params.GPattern = util.GPattern
+    params.StartAfter = util.StartAfter
+    params.Limit    = util.Limit
 
     result := fsapi.NewFileStatsResult()
     err = dsrpc.Exec(util.URI, fsapi.FileStatsMethod, params, result, auth)
@@ -469,6 +940,118 @@ func (util *Util) DeleteFileCmd(auth *dsrpc.Auth) (*fsapi.DeleteFileResult, erro
     return result, err
 }
 
+func (util *Util) StatFileCmd(auth *dsrpc.Auth) (*fsapi.StatFileResult, error) {
+    var err error
+    params := fsapi.NewStatFileParams()
+    params.FilePath   = util.RemoteFilePath
+    result := fsapi.NewStatFileResult()
+    err = dsrpc.Exec(util.URI, fsapi.StatFileMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) ListVersionsCmd(auth *dsrpc.Auth) (*fsapi.ListVersionsResult, error) {
+    var err error
+    params := fsapi.NewListVersionsParams()
+    params.FilePath   = util.RemoteFilePath
+    result := fsapi.NewListVersionsResult()
+    err = dsrpc.Exec(util.URI, fsapi.ListVersionsMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) RestoreVersionCmd(auth *dsrpc.Auth) (*fsapi.RestoreVersionResult, error) {
+    var err error
+    params := fsapi.NewRestoreVersionParams()
+    params.FilePath   = util.RemoteFilePath
+    params.Version    = util.Version
+    result := fsapi.NewRestoreVersionResult()
+    err = dsrpc.Exec(util.URI, fsapi.RestoreVersionMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) ListTrashCmd(auth *dsrpc.Auth) (*fsapi.ListTrashResult, error) {
+    var err error
+    params := fsapi.NewListTrashParams()
+    result := fsapi.NewListTrashResult()
+    err = dsrpc.Exec(util.URI, fsapi.ListTrashMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) RestoreTrashCmd(auth *dsrpc.Auth) (*fsapi.RestoreTrashResult, error) {
+    var err error
+    params := fsapi.NewRestoreTrashParams()
+    params.FilePath   = util.RemoteFilePath
+    params.DestPath   = util.DestFilePath
+    result := fsapi.NewRestoreTrashResult()
+    err = dsrpc.Exec(util.URI, fsapi.RestoreTrashMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) MoveFileCmd(auth *dsrpc.Auth) (*fsapi.MoveFileResult, error) {
+    var err error
+    params := fsapi.NewMoveFileParams()
+    params.FilePath   = util.RemoteFilePath
+    params.DestPath   = util.DestFilePath
+    result := fsapi.NewMoveFileResult()
+    err = dsrpc.Exec(util.URI, fsapi.MoveFileMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) MoveDirCmd(auth *dsrpc.Auth) (*fsapi.MoveDirResult, error) {
+    var err error
+    params := fsapi.NewMoveDirParams()
+    params.FilePath   = util.RemoteFilePath
+    params.DestPath   = util.DestFilePath
+    result := fsapi.NewMoveDirResult()
+    err = dsrpc.Exec(util.URI, fsapi.MoveDirMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) CopyFileCmd(auth *dsrpc.Auth) (*fsapi.CopyFileResult, error) {
+    var err error
+    params := fsapi.NewCopyFileParams()
+    params.FilePath   = util.RemoteFilePath
+    params.DestPath   = util.DestFilePath
+    result := fsapi.NewCopyFileResult()
+    err = dsrpc.Exec(util.URI, fsapi.CopyFileMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) PurgeTrashCmd(auth *dsrpc.Auth) (*fsapi.PurgeTrashResult, error) {
+    var err error
+    params := fsapi.NewPurgeTrashParams()
+    params.FilePath   = util.RemoteFilePath
+    result := fsapi.NewPurgeTrashResult()
+    err = dsrpc.Exec(util.URI, fsapi.PurgeTrashMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
 func (util *Util) EraseFilesCmd(auth *dsrpc.Auth) (*fsapi.EraseFilesResult, error) {
     var err error
     params := fsapi.NewEraseFilesParams()
@@ -476,6 +1059,8 @@ func (util *Util) EraseFilesCmd(auth *dsrpc.Auth) (*fsapi.EraseFilesResult, erro
     params.Regular = util.Regular
     params.GPattern = util.GPattern
     params.Erase    = util.Erase
+    params.StartAfter = util.StartAfter
+    params.Limit    = util.Limit
 
     result := fsapi.NewEraseFilesResult()
     err = dsrpc.Exec(util.URI, fsapi.EraseFilesMethod, params, result, auth)
@@ -517,6 +1102,14 @@ func (util *Util) UpdateUserCmd(auth *dsrpc.Auth) (*fsapi.UpdateUserResult, erro
     params := fsapi.NewUpdateUserParams()
     params.Login = util.Login
     params.Pass = util.Pass
+    params.KeepVers = util.KeepVers
+    switch util.Groups {
+        case "":
+        case "-":
+            params.Groups = make([]string, 0)
+        default:
+            params.Groups = strings.Split(util.Groups, ",")
+    }
     result := fsapi.NewUpdateUserResult()
     err = dsrpc.Exec(util.URI, fsapi.UpdateUserMethod, params, result, auth)
     if err != nil {
@@ -604,3 +1197,124 @@ func (util *Util) ListBStoresCmd(auth *dsrpc.Auth) (*fsapi.ListBStoresResult, er
     }
     return result, err
 }
+
+func (util *Util) LoginCmd(auth *dsrpc.Auth) (*fsapi.LoginResult, error) {
+    var err error
+    params := fsapi.NewLoginParams()
+    params.TTL = util.TTL
+    result := fsapi.NewLoginResult()
+    err = dsrpc.Exec(util.URI, fsapi.LoginMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) CreateKeyCmd(auth *dsrpc.Auth) (*fsapi.CreateKeyResult, error) {
+    var err error
+    params := fsapi.NewCreateKeyParams()
+    params.Login        = util.Login
+    params.Name         = util.KeyName
+    params.ReadOnly     = util.ReadOnly
+    params.PathPrefix   = util.PathPrefix
+    params.TTL          = util.TTL
+    result := fsapi.NewCreateKeyResult()
+    err = dsrpc.Exec(util.URI, fsapi.CreateKeyMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) ListKeysCmd(auth *dsrpc.Auth) (*fsapi.ListKeysResult, error) {
+    var err error
+    params := fsapi.NewListKeysParams()
+    params.Login = util.Login
+    result := fsapi.NewListKeysResult()
+    err = dsrpc.Exec(util.URI, fsapi.ListKeysMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) RevokeKeyCmd(auth *dsrpc.Auth) (*fsapi.RevokeKeyResult, error) {
+    var err error
+    params := fsapi.NewRevokeKeyParams()
+    params.KeyId = util.KeyId
+    result := fsapi.NewRevokeKeyResult()
+    err = dsrpc.Exec(util.URI, fsapi.RevokeKeyMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) SetQuotaCmd(auth *dsrpc.Auth) (*fsapi.SetQuotaResult, error) {
+    var err error
+    params := fsapi.NewSetQuotaParams()
+    params.Login        = util.Login
+    params.QuotaSize    = util.QuotaSize
+    params.QuotaFiles   = util.QuotaFiles
+    result := fsapi.NewSetQuotaResult()
+    err = dsrpc.Exec(util.URI, fsapi.SetQuotaMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) GetUsageCmd(auth *dsrpc.Auth) (*fsapi.GetUsageResult, error) {
+    var err error
+    params := fsapi.NewGetUsageParams()
+    params.Login = util.Login
+    result := fsapi.NewGetUsageResult()
+    err = dsrpc.Exec(util.URI, fsapi.GetUsageMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) GrantAccessCmd(auth *dsrpc.Auth) (*fsapi.GrantAccessResult, error) {
+    var err error
+    params := fsapi.NewGrantAccessParams()
+    params.Owner        = util.Owner
+    params.PathPrefix   = util.PathPrefix
+    params.GranteeType  = util.GranteeType
+    params.Grantee      = util.Grantee
+    params.Access       = util.Access
+    result := fsapi.NewGrantAccessResult()
+    err = dsrpc.Exec(util.URI, fsapi.GrantAccessMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) RevokeAccessCmd(auth *dsrpc.Auth) (*fsapi.RevokeAccessResult, error) {
+    var err error
+    params := fsapi.NewRevokeAccessParams()
+    params.Owner        = util.Owner
+    params.PathPrefix   = util.PathPrefix
+    params.GranteeType  = util.GranteeType
+    params.Grantee      = util.Grantee
+    result := fsapi.NewRevokeAccessResult()
+    err = dsrpc.Exec(util.URI, fsapi.RevokeAccessMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
+
+func (util *Util) ListGrantsCmd(auth *dsrpc.Auth) (*fsapi.ListGrantsResult, error) {
+    var err error
+    params := fsapi.NewListGrantsParams()
+    params.Owner = util.Owner
+    result := fsapi.NewListGrantsResult()
+    err = dsrpc.Exec(util.URI, fsapi.ListGrantsMethod, params, result, auth)
+    if err != nil {
+        return result, err
+    }
+    return result, err
+}
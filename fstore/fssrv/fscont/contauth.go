@@ -5,31 +5,53 @@
 package fscont
 
 import (
-    "errors"
-
     "dstore/dscomm/dsrpc"
     "dstore/dscomm/dslog"
     "dstore/dscomm/dserr"
+    "dstore/fstore/fssrv/fstore"
 )
 
+// SetLegacyAuth allows salt and hash auth of old clients
+func (contr *Contr) SetLegacyAuth(legacyAuth bool) {
+    contr.legacyAuth = legacyAuth
+}
+
+// UserVerifier is used by the service for the auth challenge
+func (contr *Contr) UserVerifier(login []byte) (*dsrpc.Verifier, error) {
+    var err error
+    var verifier *dsrpc.Verifier
+    has, user, err := contr.store.GetUser(string(login))
+    if err != nil {
+        return verifier, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewAuthError("auth error")
+        return verifier, dserr.Err(err)
+    }
+    verifier = fstore.UserVerifier(user)
+    return verifier, dserr.Err(err)
+}
 
 func (contr *Contr) AuthMidware(debugMode bool) dsrpc.HandlerFunc {
     return func(context *dsrpc.Context) error {
 
         var err error
+        if context.HasToken() {
+            return contr.tokenAuth(context, debugMode)
+        }
         login := context.AuthIdent()
         salt := context.AuthSalt()
         hash := context.AuthHash()
 
         has, user, err := contr.store.GetUser(string(login))
         if err != nil {
-            resErr := errors.New("auth mismatch")
+            resErr := dserr.NewAuthError("auth mismatch")
             context.SendError(resErr)
             return dserr.Err(err)
         }
         if !has {
-            resErr := errors.New("auth error")
-            context.SendError(resErr)
+            err = dserr.NewAuthError("auth error")
+            context.SendError(err)
             return dserr.Err(err)
         }
 
@@ -38,16 +60,48 @@ func (contr *Contr) AuthMidware(debugMode bool) dsrpc.HandlerFunc {
             dslog.LogDebug("auth ", string(auth.JSON()))
         }
 
-        pass := []byte(user.Pass)
-        ok := dsrpc.CheckHash(login, pass, salt, hash)
+        verifier := fstore.UserVerifier(user)
+        var ok bool
+        switch {
+            case context.HasProof():
+                ok = context.CheckProof(verifier)
+            case contr.legacyAuth:
+                pass, isLegacy := dsrpc.LegacyPass(login, salt, hash)
+                ok = isLegacy && verifier.Check(pass)
+                if ok {
+                    dslog.LogWarningf("legacy auth for %s from %s", login, context.RemoteHost())
+                }
+        }
         if debugMode {
             dslog.LogDebugf("auth for %s is %v", login, ok)
         }
         if !ok {
-            resErr := errors.New("auth mismatch")
-            context.SendError(resErr)
+            err = dserr.NewAuthError("auth mismatch")
+            context.SendError(err)
             return dserr.Err(err)
         }
         return dserr.Err(err)
     }
 }
+
+// tokenAuth checks session token or API key and sets the login
+// of the token as the auth ident of the call
+func (contr *Contr) tokenAuth(context *dsrpc.Context, debugMode bool) error {
+    var err error
+    login, apiKey, err := contr.store.CheckToken(string(context.AuthToken()))
+    if debugMode {
+        dslog.LogDebugf("token auth for %s is %v", login, err == nil)
+    }
+    if err != nil {
+        resErr := dserr.NewAuthError("auth mismatch")
+        context.SendError(resErr)
+        return dserr.Err(err)
+    }
+    err = contr.checkScope(context, apiKey)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    context.SetAuthIdent([]byte(login))
+    return dserr.Err(err)
+}
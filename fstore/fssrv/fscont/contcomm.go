@@ -11,6 +11,7 @@ import (
 
 type Contr struct {
     store  *fstore.Store
+    legacyAuth  bool
 }
 
 func NewContr(store *fstore.Store) (*Contr, error) {
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fscont
+
+import (
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dskvdb"
+    "dstore/dscomm/dsrpc"
+    "dstore/fstore/fsapi"
+    "dstore/fstore/fssrv/fsreg"
+    "dstore/fstore/fssrv/fstore"
+)
+
+func TestErrorCode(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    store, err := fstore.NewStore(dataDir, reg, nil)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    contr, err := NewContr(store)
+    require.NoError(t, err)
+
+    serv := dsrpc.NewService()
+    serv.SetVerifierFunc(contr.UserVerifier)
+    serv.PreMiddleware(contr.AuthMidware(false))
+    serv.Handler(fsapi.AddUserMethod, contr.AddUserHandler)
+    serv.SetErrorCoder(contr.ErrorCode)
+    go serv.Listen("127.0.0.1:8087")
+    defer serv.Stop()
+    time.Sleep(10 * time.Millisecond)
+
+    auth := dsrpc.CreateAuth([]byte("admin"), []byte("admin"))
+    params := fsapi.NewAddUserParams()
+    params.Login = "qwerty"
+    params.Pass = "123456"
+    result := fsapi.NewAddUserResult()
+    err = dsrpc.Exec("127.0.0.1:8087", fsapi.AddUserMethod, params, result, auth)
+    require.NoError(t, err)
+
+    // Duplicate login comes to the client with the code
+    params.Pass = "654321"
+    err = dsrpc.Exec("127.0.0.1:8087", fsapi.AddUserMethod, params, result, auth)
+    require.ErrorIs(t, err, dsrpc.ErrExists)
+}
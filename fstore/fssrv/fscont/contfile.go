@@ -7,6 +7,7 @@ package fscont
 import (
     "errors"
     "dstore/fstore/fsapi"
+    "dstore/dscomm/dsdescr"
     "dstore/dscomm/dsrpc"
     "dstore/dscomm/dserr"
 )
@@ -25,7 +26,17 @@ func (contr *Contr) SaveFileHandler(context *dsrpc.Context) error {
     login    := string(context.AuthIdent())
 
     filePath := params.FilePath
-    descr, err := contr.store.SaveFile(login, filePath, fileReader, fileSize)
+    var descr *dsdescr.File
+    switch {
+        case params.Append && params.Overwrite:
+            err = errors.New("append and overwrite cannot be used together")
+        case params.Append:
+            descr, err = contr.store.AppendFile(context.Ctx(), login, filePath, params.Offset, fileReader, fileSize)
+        case params.Overwrite:
+            descr, err = contr.store.ReplaceFile(context.Ctx(), login, filePath, fileReader, fileSize)
+        default:
+            descr, err = contr.store.SaveFile(context.Ctx(), login, filePath, fileReader, fileSize)
+    }
     if err != nil {
         context.SendError(err)
         return dserr.Err(err)
@@ -40,6 +51,30 @@ func (contr *Contr) SaveFileHandler(context *dsrpc.Context) error {
     return dserr.Err(err)
 }
 
+func (contr *Contr) StatFileHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewStatFileParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    exists, descr, err := contr.store.StatFile(login, params.FilePath)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewStatFileResult()
+    result.Exists = exists
+    result.File = descr
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
 func (contr *Contr) LoadFileHandler(context *dsrpc.Context) error {
     var err error
 
@@ -54,33 +89,142 @@ func (contr *Contr) LoadFileHandler(context *dsrpc.Context) error {
     fileWriter  := context.BinWriter()
     login := string(context.AuthIdent())
 
-    has, descr, err := contr.store.HasFile(login, filePath)
+    // Held file is not dropped by concurrent overwrite until the end of transfer
+    descr, err := contr.store.HoldFile(login, filePath, params.Version)
     if err != nil {
         err = dserr.Err(err)
         context.SendError(err)
         return err
     }
-    if !has {
-        err = errors.New("file not exists")
-        err = dserr.Err(err)
+    defer contr.store.ReleaseFile(descr)
+
+    fileSize, err := contr.store.RangeSize(descr, params.Offset, params.Length)
+    if err != nil {
         context.SendError(err)
-        return err
+        return dserr.Err(err)
     }
-    if descr == nil {
-        err = errors.New("file descr is nil")
-        err = dserr.Err(err)
+    result := fsapi.NewLoadFileResult()
+    result.File = descr
+    err = context.SendResult(result, fileSize)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = contr.store.ReadFile(context.Ctx(), descr, params.Offset, params.Length, fileWriter)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) ListVersionsHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewListVersionsParams()
+    err = context.BindParams(params)
+    if err != nil {
         context.SendError(err)
-        return err
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descrs, err := contr.store.ListVersions(login, params.FilePath)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewListVersionsResult()
+    result.Files = descrs
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
     }
+    return dserr.Err(err)
+}
 
-    fileSize := descr.DataSize
-    result := fsapi.NewLoadFileResult()
+func (contr *Contr) RestoreVersionHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewRestoreVersionParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descr, err := contr.store.RestoreVersion(login, params.FilePath, params.Version)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewRestoreVersionResult()
     result.File = descr
-    err = context.SendResult(result, fileSize)
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) ListTrashHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewListTrashParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descrs, err := contr.store.ListTrash(login)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewListTrashResult()
+    result.Files = descrs
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) RestoreTrashHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewRestoreTrashParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descr, err := contr.store.RestoreTrash(login, params.FilePath, params.DestPath)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewRestoreTrashResult()
+    result.File = descr
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) PurgeTrashHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewPurgeTrashParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descrs, err := contr.store.PurgeTrash(login, params.FilePath)
     if err != nil {
+        context.SendError(err)
         return dserr.Err(err)
     }
-    err = contr.store.LoadFile(login, filePath, fileWriter)
+    result := fsapi.NewPurgeTrashResult()
+    result.Files = descrs
+    err = context.SendResult(result, 0)
     if err != nil {
         return dserr.Err(err)
     }
@@ -126,15 +270,72 @@ func (contr *Contr) ListFilesHandler(context *dsrpc.Context) error {
     gPattern    := params.GPattern
 
     login   := string(context.AuthIdent())
-    reader  := context.BinReader()
 
-    files, err := contr.store.ListFiles(login, pattern, regular, gPattern, reader)
+    files, next, err := contr.store.ListFiles(context.Ctx(), login, pattern, regular, gPattern,
+                                            params.StartAfter, params.Limit)
     if err != nil {
         context.SendError(err)
         return dserr.Err(err)
     }
     result := fsapi.NewListFilesResult()
     result.Files = files
+    result.Next = next
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// ListFilesStreamHandler sends the result with the size of records
+// and then writes the records
+func (contr *Contr) ListFilesStreamHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewListFilesStreamParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login   := string(context.AuthIdent())
+    writer  := context.BinWriter()
+
+    sent := false
+    headCb := func(count, size int64, next string) error {
+        result := fsapi.NewListFilesStreamResult()
+        result.Count = count
+        result.Next = next
+        sent = true
+        return context.SendResult(result, size)
+    }
+    err = contr.store.StreamFiles(context.Ctx(), login, params.Pattern, params.Regular, params.GPattern,
+                                params.StartAfter, params.Limit, headCb, writer)
+    if err != nil {
+        if !sent {
+            context.SendError(err)
+        }
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) ListDirHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewListDirParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    entries, next, err := contr.store.ListDir(login, params.DirPath, params.Token, params.Limit)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewListDirResult()
+    result.Entries = entries
+    result.Next = next
     err = context.SendResult(result, 0)
     if err != nil {
         return dserr.Err(err)
@@ -156,9 +357,9 @@ func (contr *Contr) FileStatsHandler(context *dsrpc.Context) error {
 
 
     login   := string(context.AuthIdent())
-    reader  := context.BinReader()
 
-    count, usage, err := contr.store.FileStats(login, pattern, regular, gPattern, reader)
+    count, usage, next, err := contr.store.FileStats(context.Ctx(), login, pattern, regular, gPattern,
+                                            params.StartAfter, params.Limit)
     if err != nil {
         context.SendError(err)
         return dserr.Err(err)
@@ -166,6 +367,7 @@ func (contr *Contr) FileStatsHandler(context *dsrpc.Context) error {
     result := fsapi.NewFileStatsResult()
     result.Usage = usage
     result.Count = count
+    result.Next = next
     err = context.SendResult(result, 0)
     if err != nil {
         return dserr.Err(err)
@@ -187,15 +389,88 @@ func (contr *Contr) EraseFilesHandler(context *dsrpc.Context) error {
     erase       := params.Erase
 
     login   := string(context.AuthIdent())
-    reader  := context.BinReader()
 
-    files, err := contr.store.EraseFiles(login, pattern, regular, gPattern, erase, reader)
+    files, next, err := contr.store.EraseFiles(context.Ctx(), login, pattern, regular, gPattern,
+                                            params.StartAfter, params.Limit, erase)
     if err != nil {
         context.SendError(err)
         return dserr.Err(err)
     }
     result := fsapi.NewEraseFilesResult()
     result.Files = files
+    result.Next = next
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) MoveFileHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewMoveFileParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descr, err := contr.store.MoveFile(login, params.FilePath, params.DestPath)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewMoveFileResult()
+    result.File = descr
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) CopyFileHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewCopyFileParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descr, err := contr.store.CopyFile(login, params.FilePath, params.DestPath)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewCopyFileResult()
+    result.File = descr
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// MoveDirHandler returns moved and failed files, partial move is not
+// an error of the call
+func (contr *Contr) MoveDirHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewMoveDirParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    login := string(context.AuthIdent())
+    descrs, failed, err := contr.store.MoveDir(login, params.FilePath, params.DestPath)
+    if err != nil && len(failed) == 0 {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewMoveDirResult()
+    result.Files = descrs
+    result.Failed = failed
     err = context.SendResult(result, 0)
     if err != nil {
         return dserr.Err(err)
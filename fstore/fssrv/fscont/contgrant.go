@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fscont
+
+import (
+    "dstore/fstore/fsapi"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dsrpc"
+    "dstore/dscomm/dserr"
+)
+
+func (contr *Contr) GrantAccessHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewGrantAccessParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    descr := dsdescr.NewGrant()
+    descr.Owner         = params.Owner
+    descr.PathPrefix    = params.PathPrefix
+    descr.GranteeType   = params.GranteeType
+    descr.Grantee       = params.Grantee
+    descr.Access        = params.Access
+    authLogin := string(context.AuthIdent())
+    err = contr.store.GrantAccess(authLogin, descr)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewGrantAccessResult()
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) RevokeAccessHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewRevokeAccessParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    descr := dsdescr.NewGrant()
+    descr.Owner         = params.Owner
+    descr.PathPrefix    = params.PathPrefix
+    descr.GranteeType   = params.GranteeType
+    descr.Grantee       = params.Grantee
+    authLogin := string(context.AuthIdent())
+    err = contr.store.RevokeAccess(authLogin, descr)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewRevokeAccessResult()
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) ListGrantsHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewListGrantsParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    descrs, err := contr.store.ListGrants(authLogin, params.Owner)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewListGrantsResult()
+    result.Grants = descrs
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fscont
+
+import (
+    "time"
+
+    "dstore/fstore/fsapi"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dsrpc"
+    "dstore/dscomm/dserr"
+)
+
+func (contr *Contr) LoginHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewLoginParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    ttl := time.Duration(params.TTL) * time.Second
+    token, expiresAt, err := contr.store.CreateSession(authLogin, ttl)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewLoginResult()
+    result.Token = token
+    result.ExpiresAt = expiresAt
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) CreateKeyHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewCreateKeyParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    descr := dsdescr.NewAPIKey()
+    descr.Login         = params.Login
+    descr.Name          = params.Name
+    descr.ReadOnly      = params.ReadOnly
+    descr.PathPrefix    = params.PathPrefix
+    ttl := time.Duration(params.TTL) * time.Second
+    authLogin := string(context.AuthIdent())
+    token, descr, err := contr.store.CreateAPIKey(authLogin, descr, ttl)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewCreateKeyResult()
+    result.Token = token
+    result.Key = descr
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) ListKeysHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewListKeysParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    descrs, err := contr.store.ListAPIKeys(authLogin, params.Login)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewListKeysResult()
+    result.Keys = descrs
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) RevokeKeyHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewRevokeKeyParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    err = contr.store.RevokeAPIKey(authLogin, params.KeyId)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewRevokeKeyResult()
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
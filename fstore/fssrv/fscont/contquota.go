@@ -0,0 +1,56 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fscont
+
+import (
+    "dstore/fstore/fsapi"
+    "dstore/dscomm/dsrpc"
+    "dstore/dscomm/dserr"
+)
+
+func (contr *Contr) SetQuotaHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewSetQuotaParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    err = contr.store.SetQuota(authLogin, params.Login, params.QuotaSize, params.QuotaFiles)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewSetQuotaResult()
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) GetUsageHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewGetUsageParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    usage, err := contr.store.GetUsage(authLogin, params.Login)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewGetUsageResult()
+    result.Usage = usage
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
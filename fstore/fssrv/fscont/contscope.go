@@ -0,0 +1,113 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fscont
+
+import (
+    "errors"
+    "fmt"
+
+    "dstore/fstore/fsapi"
+    "dstore/fstore/fssrv/fstore"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dsrpc"
+    "dstore/dscomm/dserr"
+)
+
+// Methods allowed for read-only API key
+var readMethods = map[string]bool{
+    fsapi.StatFileMethod:        true,
+    fsapi.LoadFileMethod:        true,
+    fsapi.ListFilesMethod:       true,
+    fsapi.ListFilesStreamMethod: true,
+    fsapi.ListDirMethod:         true,
+    fsapi.FileStatsMethod:       true,
+    fsapi.ListVersionsMethod:    true,
+    fsapi.ListTrashMethod:       true,
+    fsapi.GetStatusMethod:       true,
+    fsapi.ScrubStatusMethod:     true,
+    fsapi.GetUsageMethod:        true,
+    fsapi.ListGrantsMethod:      true,
+}
+
+// Params of path methods which are checked against the key path prefix
+type scopeParams struct {
+    FilePath    string      `msgpack:"filePath"`
+    DestPath    string      `msgpack:"destPath"`
+    Pattern     string      `msgpack:"pattern"`
+    DirPath     string      `msgpack:"dirPath"`
+}
+
+// checkScope restricts the call made with the token, the API key
+// is nil for session token
+func (contr *Contr) checkScope(context *dsrpc.Context, apiKey *dsdescr.APIKey) error {
+    var err error
+    method := context.Method()
+    // New session and new keys are not issued for a token
+    if method == fsapi.LoginMethod {
+        err = dserr.NewAccessError("login requires password auth")
+        return dserr.Err(err)
+    }
+    if apiKey == nil {
+        return dserr.Err(err)
+    }
+    switch method {
+        case fsapi.CreateKeyMethod, fsapi.ListKeysMethod, fsapi.RevokeKeyMethod:
+            err = errors.New("api key cannot manage keys")
+            return dserr.Err(err)
+    }
+    if apiKey.ReadOnly && !readMethods[method] {
+        err = dserr.NewAccessError("method %s is not allowed for read-only key", method)
+        return dserr.Err(err)
+    }
+    if len(apiKey.PathPrefix) > 0 {
+        err = checkPathScope(context, apiKey.PathPrefix)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+func checkPathScope(context *dsrpc.Context, pathPrefix string) error {
+    var err error
+    method := context.Method()
+    params := &scopeParams{}
+    err = context.BindParams(params)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    var paths []string
+    switch method {
+        case fsapi.GetStatusMethod:
+            return dserr.Err(err)
+        case fsapi.SaveFileMethod, fsapi.StatFileMethod, fsapi.LoadFileMethod,
+                fsapi.ListVersionsMethod, fsapi.RestoreVersionMethod,
+                fsapi.DeleteFileMethod, fsapi.PurgeTrashMethod:
+            paths = append(paths, params.FilePath)
+        case fsapi.RestoreTrashMethod:
+            paths = append(paths, params.FilePath)
+            if len(params.DestPath) > 0 {
+                paths = append(paths, params.DestPath)
+            }
+        case fsapi.MoveFileMethod, fsapi.MoveDirMethod, fsapi.CopyFileMethod:
+            paths = append(paths, params.FilePath, params.DestPath)
+        case fsapi.ListFilesMethod, fsapi.ListFilesStreamMethod,
+                fsapi.FileStatsMethod, fsapi.EraseFilesMethod:
+            // Pattern under the prefix limits the result whatever other filters are
+            paths = append(paths, params.Pattern)
+        case fsapi.ListDirMethod:
+            paths = append(paths, params.DirPath)
+        default:
+            err = dserr.NewAccessError("method %s is not allowed for key with path prefix", method)
+            return dserr.Err(err)
+    }
+    for _, filePath := range paths {
+        if len(filePath) == 0 || !fstore.InPathPrefix(pathPrefix, filePath) {
+            err = fmt.Errorf("path %s is out of key prefix %s", filePath, pathPrefix)
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
@@ -31,3 +31,49 @@ func (contr *Contr) GetStatusHandler(context *dsrpc.Context) error {
     }
     return dserr.Err(err)
 }
+
+func (contr *Contr) ScrubStatusHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewScrubStatusParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    status, err := contr.store.ScrubStatus(authLogin)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewScrubStatusResult()
+    result.Status = status
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (contr *Contr) RunGCHandler(context *dsrpc.Context) error {
+    var err error
+    params := fsapi.NewRunGCParams()
+    err = context.BindParams(params)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    authLogin := string(context.AuthIdent())
+    report, err := contr.store.RunGC(authLogin, params.DryRun)
+    if err != nil {
+        context.SendError(err)
+        return dserr.Err(err)
+    }
+    result := fsapi.NewRunGCResult()
+    result.Report = report
+    err = context.SendResult(result, 0)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
@@ -75,6 +75,8 @@ func (contr *Contr) UpdateUserHandler(context *dsrpc.Context) error {
     descr.Pass    = params.Pass
     descr.State   = ""   // todo
     descr.Role    = ""   // todo
+    descr.KeepVers = params.KeepVers
+    descr.Groups  = params.Groups
     authLogin    := string(context.AuthIdent())
     err = contr.store.UpdateUser(authLogin, descr)
     if err != nil {
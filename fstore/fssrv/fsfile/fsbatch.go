@@ -5,11 +5,16 @@
 package fsfile
 
 import (
+    "bytes"
+    "context"
+    "fmt"
+    "hash"
     "io"
     "time"
     "dstore/dscomm/dsinter"
     "dstore/dscomm/dsdescr"
     "dstore/dscomm/dserr"
+    "dstore/dscomm/dsreco"
 )
 
 type Batch struct {
@@ -19,12 +24,15 @@ type Batch struct {
     fileId      int64
     batchSize   int64
     blockSize   int64
+    recoCount   int64
     createdAt   int64
     updatedAt   int64
     blocks      []*Block
+    recos       []*Block
+    keep        func(string)
 }
 
-func NewBatch(baseDir string, reg dsinter.FStoreReg, fileId, batchId, batchSize, blockSize int64) (*Batch, error) {
+func NewBatch(baseDir string, reg dsinter.FStoreReg, fileId, batchId, batchSize, blockSize, recoCount int64) (*Batch, error) {
     var err error
     var batch Batch
     batch.baseDir   = baseDir
@@ -34,12 +42,13 @@ func NewBatch(baseDir string, reg dsinter.FStoreReg, fileId, batchId, batchSize,
     batch.batchId   = batchId
     batch.batchSize = batchSize
     batch.blockSize = blockSize
+    batch.recoCount = recoCount
     batch.createdAt = time.Now().Unix()
     batch.updatedAt = batch.createdAt
 
     batch.blocks = make([]*Block, batch.batchSize)
     for i := int64(0); i < batchSize; i++ {
-        block, err := NewBlock(baseDir, batch.fileId, batch.batchId, dsdescr.BTData, i, blockSize)
+        block, err := NewBlock(baseDir, reg, batch.fileId, batch.batchId, dsdescr.BTData, i, blockSize)
         if err != nil {
             return &batch, dserr.Err(err)
         }
@@ -50,6 +59,19 @@ func NewBatch(baseDir string, reg dsinter.FStoreReg, fileId, batchId, batchSize,
         }
         batch.blocks[i] = block
     }
+    batch.recos = make([]*Block, batch.recoCount)
+    for i := int64(0); i < recoCount; i++ {
+        block, err := NewBlock(baseDir, reg, batch.fileId, batch.batchId, dsdescr.BTReco, i, blockSize)
+        if err != nil {
+            return &batch, dserr.Err(err)
+        }
+        blockDescr := block.Descr()
+        err = reg.PutBlock(blockDescr)
+        if err != nil {
+            return &batch, dserr.Err(err)
+        }
+        batch.recos[i] = block
+    }
     return &batch, dserr.Err(err)
 }
 
@@ -63,6 +85,7 @@ func OpenBatch(baseDir string, reg dsinter.FStoreReg, descr *dsdescr.Batch) (*Ba
     batch.batchId   = descr.BatchId
     batch.batchSize = descr.BatchSize
     batch.blockSize = descr.BlockSize
+    batch.recoCount = descr.RecoCount
     batch.createdAt = descr.CreatedAt
     batch.updatedAt = descr.UpdatedAt
 
@@ -72,29 +95,56 @@ func OpenBatch(baseDir string, reg dsinter.FStoreReg, descr *dsdescr.Batch) (*Ba
         if err != nil {
             return &batch, dserr.Err(err)
         }
-        block, err := OpenBlock(baseDir, blockDescr)
+        block, err := OpenBlock(baseDir, reg, blockDescr)
         if err != nil {
             return &batch, dserr.Err(err)
         }
         batch.blocks[i] = block
     }
+    batch.recos = make([]*Block, batch.recoCount)
+    for i := int64(0); i < batch.recoCount; i++ {
+        blockDescr, err := reg.GetBlock(batch.fileId, batch.batchId, dsdescr.BTReco, i)
+        if err != nil {
+            return &batch, dserr.Err(err)
+        }
+        block, err := OpenBlock(baseDir, reg, blockDescr)
+        if err != nil {
+            return &batch, dserr.Err(err)
+        }
+        batch.recos[i] = block
+    }
     return &batch, dserr.Err(err)
 }
 
-func (batch *Batch) Write(reader io.Reader, reqSize int64) (int64, bool, error) {
+func (batch *Batch) keepCrates(keep func(string)) {
+    batch.keep = keep
+    for _, block := range batch.blocks {
+        block.keep = keep
+    }
+    for _, block := range batch.recos {
+        block.keep = keep
+    }
+}
+
+func (batch *Batch) Write(ctx context.Context, reader io.Reader, reqSize int64) (int64, bool, error) {
     var err error
     var wrSize int64
     var eof bool
 
     for i := int64(0); i < batch.batchSize; i++ {
         if reqSize < 1 {
-            return wrSize, eof, dserr.Err(err)
+            break
+        }
+        err = ctx.Err()
+        if err != nil {
+            break
         }
-        blockWrSize, eof, err := batch.blocks[i].Write(reader, reqSize)
-        if err == io.EOF {
-            err = nil
-            eof = true
+        blockWrSize, blockEof, wrErr := batch.blocks[i].Write(reader, reqSize)
+        if wrErr == io.EOF {
+            wrErr = nil
+            blockEof = true
         }
+        eof = blockEof
         wrSize += blockWrSize
         blockDescr := batch.blocks[i].Descr()
         err = batch.reg.PutBlock(blockDescr)
@@ -102,23 +152,201 @@ func (batch *Batch) Write(reader io.Reader, reqSize int64) (int64, bool, error)
             return wrSize, eof, dserr.Err(err)
         }
         reqSize -= blockWrSize
+        if wrErr != nil {
+            err = wrErr
+            break
+        }
         if eof {
+            break
+        }
+    }
+    wrErr := err
+    if wrSize > 0 {
+        err = batch.encode()
+        if err != nil {
             return wrSize, eof, dserr.Err(err)
         }
     }
+    err = wrErr
     return wrSize, eof, dserr.Err(err)
 }
 
-func (batch *Batch) Read(writer io.Writer, dataSize int64) (int64, error) {
+// encode rewrites reco blocks from the current content of data blocks
+func (batch *Batch) encode() error {
+    var err error
+    if batch.recoCount < 1 {
+        return dserr.Err(err)
+    }
+    codec, err := dsreco.NewCodec(int(batch.batchSize), int(batch.recoCount))
+    if err != nil {
+        return dserr.Err(err)
+    }
+    var recoSize int64
+    for _, block := range batch.blocks {
+        if block.dataSize > recoSize {
+            recoSize = block.dataSize
+        }
+    }
+
+    readers := make([]*Crate, batch.batchSize)
+    defer func() {
+        for _, reader := range readers {
+            if reader != nil {
+                reader.Close()
+            }
+        }
+    }()
+    for i, block := range batch.blocks {
+        if block.dataSize < 1 {
+            continue
+        }
+        readers[i], err = OpenCrate(batch.baseDir, block.filePath, RDONLY)
+        if err != nil {
+            err = fmt.Errorf("batch encode error: %s", err)
+            return dserr.Err(err)
+        }
+    }
+
+    recoPaths := make([]string, batch.recoCount)
+    hashInits := make([]string, batch.recoCount)
+    hashers := make([]hash.Hash, batch.recoCount)
+    writers := make([]*Crate, batch.recoCount)
+    cleanWriters := func() {
+        for _, writer := range writers {
+            if writer != nil {
+                writer.Close()
+                writer.Clean()
+            }
+        }
+    }
+    for i, block := range batch.recos {
+        newPath := newFilePath()
+        recoPaths[i] = fmt.Sprintf("%s--%05d-%04d-r%02d", newPath, block.fileId, block.batchId, block.blockId)
+        writers[i], err = OpenCrate(batch.baseDir, recoPaths[i], WRONLY)
+        if err != nil {
+            cleanWriters()
+            err = fmt.Errorf("batch encode error: %s", err)
+            return dserr.Err(err)
+        }
+        hashInits[i] = newHashInit()
+        hashers[i], err = newHasher(dsdescr.HashSHA256, hashInits[i])
+        if err != nil {
+            cleanWriters()
+            return dserr.Err(err)
+        }
+    }
+
+    var chunkSize int64 = 1024 * 16
+    dataBufs := make([][]byte, batch.batchSize)
+    for i := range dataBufs {
+        dataBufs[i] = make([]byte, chunkSize)
+    }
+    recoBufs := make([][]byte, batch.recoCount)
+    for i := range recoBufs {
+        recoBufs[i] = make([]byte, chunkSize)
+    }
+    data := make([][]byte, batch.batchSize)
+    reco := make([][]byte, batch.recoCount)
+
+    for offset := int64(0); offset < recoSize; offset += chunkSize {
+        size := recoSize - offset
+        if size > chunkSize {
+            size = chunkSize
+        }
+        for i, block := range batch.blocks {
+            data[i] = dataBufs[i][0:size]
+            fill := block.dataSize - offset
+            if fill < 0 {
+                fill = 0
+            }
+            if fill > size {
+                fill = size
+            }
+            if fill > 0 {
+                _, err = io.ReadFull(readers[i], data[i][0:fill])
+                if err != nil {
+                    cleanWriters()
+                    err = fmt.Errorf("batch encode error: %s", err)
+                    return dserr.Err(err)
+                }
+            }
+            for j := fill; j < size; j++ {
+                data[i][j] = 0
+            }
+        }
+        for i := range reco {
+            reco[i] = recoBufs[i][0:size]
+        }
+        err = codec.Encode(data, reco)
+        if err != nil {
+            cleanWriters()
+            return dserr.Err(err)
+        }
+        for i := range reco {
+            _, err = writers[i].Write(reco[i])
+            if err != nil {
+                cleanWriters()
+                err = fmt.Errorf("batch encode error: %s", err)
+                return dserr.Err(err)
+            }
+            hashers[i].Write(reco[i])
+        }
+    }
+    for i, block := range batch.recos {
+        writers[i].Close()
+        block.replaceCrate(recoPaths[i], recoSize)
+        block.hashAlg  = dsdescr.HashSHA256
+        block.hashInit = hashInits[i]
+        block.hashSum  = hashSum(hashers[i])
+        err = batch.reg.PutBlock(block.Descr())
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (batch *Batch) Read(ctx context.Context, writer io.Writer, dataSize int64) (int64, error) {
+    return batch.ReadRange(ctx, writer, 0, dataSize)
+}
+
+// ReadRange writes length bytes of the batch data starting from offset,
+// reading begins from the block which holds the offset
+func (batch *Batch) ReadRange(ctx context.Context, writer io.Writer, offset, length int64) (int64, error) {
     var err error
     var readSize int64
-    if dataSize < 1 {
+    if length < 1 || batch.blockSize < 1 {
         return readSize, dserr.Err(err)
     }
-    for i := int64(0); i < batch.batchSize; i++ {
-        blockReadSize, err := batch.blocks[i].Read(writer, dataSize)
+    if offset < 0 {
+        err = fmt.Errorf("batch offset %d out of range", offset)
+        return readSize, dserr.Err(err)
+    }
+    first := offset / batch.blockSize
+    offset = offset % batch.blockSize
+    for i := first; i < batch.batchSize; i++ {
+        if length < 1 {
+            break
+        }
+        err = ctx.Err()
+        if err != nil {
+            return readSize, dserr.Err(err)
+        }
+        block := batch.blocks[i]
+        if offset >= block.dataSize {
+            break
+        }
+        blockLength := block.dataSize - offset
+        if blockLength > length {
+            blockLength = length
+        }
+        blockReadSize, err := block.ReadRange(writer, offset, blockLength)
+        if err != nil && blockReadSize == 0 && batch.recoCount > 0 {
+            blockReadSize, err = batch.rebuild(i, writer, offset, blockLength)
+        }
         readSize += blockReadSize
-        dataSize -= blockReadSize
+        length -= blockReadSize
+        offset = 0
         if err != nil {
             return readSize, dserr.Err(err)
         }
@@ -126,8 +354,129 @@ func (batch *Batch) Read(writer io.Writer, dataSize int64) (int64, error) {
     return readSize, dserr.Err(err)
 }
 
+// rebuild restores data block from other data and reco blocks
+func (batch *Batch) rebuild(index int64, writer io.Writer, offset, length int64) (int64, error) {
+    var err error
+    var readSize int64
+
+    data, err := batch.recover(index)
+    if err != nil {
+        return readSize, dserr.Err(err)
+    }
+    written, err := writer.Write(data[offset:offset + length])
+    readSize = int64(written)
+    if err != nil {
+        return readSize, dserr.Err(err)
+    }
+    return readSize, dserr.Err(err)
+}
+
+// Repair restores local crate of the block from other blocks of the batch
+func (batch *Batch) Repair(blockType, blockId int64) error {
+    var err error
+    if batch.recoCount < 1 {
+        err = fmt.Errorf("batch %d,%d has no reco blocks", batch.fileId, batch.batchId)
+        return dserr.Err(err)
+    }
+    if blockId < 0 {
+        err = fmt.Errorf("wrong block id %d", blockId)
+        return dserr.Err(err)
+    }
+    switch blockType {
+        case dsdescr.BTReco:
+            if blockId >= batch.recoCount {
+                err = fmt.Errorf("wrong reco block id %d", blockId)
+                return dserr.Err(err)
+            }
+            err = batch.encode()
+            if err != nil {
+                return dserr.Err(err)
+            }
+        default:
+            if blockId >= batch.batchSize {
+                err = fmt.Errorf("wrong data block id %d", blockId)
+                return dserr.Err(err)
+            }
+            data, err := batch.recover(blockId)
+            if err != nil {
+                return dserr.Err(err)
+            }
+            block := batch.blocks[blockId]
+            err = block.Restore(bytes.NewReader(data))
+            if err != nil {
+                return dserr.Err(err)
+            }
+            err = batch.reg.PutBlock(block.Descr())
+            if err != nil {
+                return dserr.Err(err)
+            }
+    }
+    return dserr.Err(err)
+}
+
+func (batch *Batch) recover(index int64) ([]byte, error) {
+    var err error
+    var data []byte
+
+    codec, err := dsreco.NewCodec(int(batch.batchSize), int(batch.recoCount))
+    if err != nil {
+        return data, dserr.Err(err)
+    }
+    var shardSize int64
+    for _, block := range batch.blocks {
+        if block.dataSize > shardSize {
+            shardSize = block.dataSize
+        }
+    }
+    shards := make([][]byte, batch.batchSize + batch.recoCount)
+    loadShard := func(block *Block) []byte {
+        shard := make([]byte, shardSize)
+        if block.dataSize == 0 {
+            return shard
+        }
+        buffer := bytes.NewBuffer(shard[0:0])
+        _, err := block.Read(buffer, block.dataSize)
+        if err != nil {
+            return nil
+        }
+        return shard
+    }
+    for i, block := range batch.blocks {
+        if int64(i) == index {
+            continue
+        }
+        shards[i] = loadShard(block)
+    }
+    for i, block := range batch.recos {
+        if block.dataSize != shardSize {
+            continue
+        }
+        shards[batch.batchSize + int64(i)] = loadShard(block)
+    }
+    err = codec.Reconstruct(shards)
+    if err != nil {
+        err = dserr.NewCorruptError("cannot rebuild block %d,%d,%d: %s", batch.fileId, batch.batchId, index, err)
+        return data, dserr.Err(err)
+    }
+    data = shards[index][0:batch.blocks[index].dataSize]
+    return data, dserr.Err(err)
+}
+
 func (batch *Batch) Clean() error {
     var err error
+    for i := batch.recoCount - 1; i >= 0; i-- {
+        if batch.recos[i] != nil {
+            err := batch.recos[i].Clean()
+            if err != nil {
+                return dserr.Err(err)
+            }
+            err = batch.reg.DeleteBlock(batch.fileId, batch.batchId, dsdescr.BTReco, i)
+            if err != nil {
+                return dserr.Err(err)
+            }
+            batch.recos[i] = nil
+        }
+    }
     for i := batch.batchSize - 1; i >= 0; i-- {
         if batch.blocks[i] != nil {
             err := batch.blocks[i].Clean()
@@ -150,6 +499,7 @@ func (batch *Batch) Descr() *dsdescr.Batch {
     descr.BatchId   = batch.batchId
     descr.BatchSize = batch.batchSize
     descr.BlockSize = batch.blockSize
+    descr.RecoCount = batch.recoCount
     descr.CreatedAt = batch.createdAt
     descr.UpdatedAt = batch.updatedAt
     return descr
@@ -6,12 +6,14 @@ package fsfile
 
 import(
     "bytes"
+    "context"
     "math/rand"
     "testing"
     "io"
 
     "github.com/stretchr/testify/require"
 
+    "dstore/dscomm/dsdescr"
     "dstore/dscomm/dskvdb"
     "dstore/fstore/fssrv/fsreg"
 )
@@ -29,11 +31,12 @@ func TestBatch01(t *testing.T) {
     require.NoError(t, err)
 
     var batchSize int64 = 5
+    var recoCount int64 = 2
     var blockSize int64 = 1024 * 1024
     var batchId int64 = 2
     var fileId  int64 = 3
 
-    batch, err := NewBatch(dataDir, reg, fileId, batchId, batchSize, blockSize)
+    batch, err := NewBatch(dataDir, reg, fileId, batchId, batchSize, blockSize, recoCount)
     require.NoError(t, err)
     require.NotEqual(t, batch, nil)
 
@@ -43,7 +46,7 @@ func TestBatch01(t *testing.T) {
     reader := bytes.NewReader(buffer)
 
     needSize := int64(batchSize * blockSize - 1)
-    wrSize, err := batch.Write(reader, needSize)
+    wrSize, _, err := batch.Write(context.Background(), reader, needSize)
     require.NoError(t, err)
     require.Equal(t, needSize, wrSize)
 
@@ -58,10 +61,76 @@ func TestBatch01(t *testing.T) {
     require.NoError(t, err)
     require.NotEqual(t, batch, nil)
 
-    readSize, err := batch.Read(io.Discard, needSize)
+    readSize, err := batch.Read(context.Background(), io.Discard, needSize)
     require.NoError(t, err)
     require.Equal(t, wrSize, readSize)
 
     err = batch.Clean()
     require.NoError(t, err)
 }
+
+func TestBatch02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    var batchSize int64 = 5
+    var recoCount int64 = 2
+    var blockSize int64 = 1024 * 64
+    var batchId int64 = 1
+    var fileId  int64 = 7
+
+    batch, err := NewBatch(dataDir, reg, fileId, batchId, batchSize, blockSize, recoCount)
+    require.NoError(t, err)
+
+    dataSize := batchSize * blockSize - blockSize / 3
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+    reader := bytes.NewReader(buffer)
+
+    wrSize, _, err := batch.Write(context.Background(), reader, dataSize)
+    require.NoError(t, err)
+    require.Equal(t, dataSize, wrSize)
+
+    err = reg.PutBatch(batch.Descr())
+    require.NoError(t, err)
+
+    // Lose two data blocks, include the short tail block
+    for _, blockId := range []int64{ 1, batchSize - 1 } {
+        blockDescr, err := reg.GetBlock(fileId, batchId, dsdescr.BTData, blockId)
+        require.NoError(t, err)
+        crate, err := OpenCrate(dataDir, blockDescr.FilePath, WRONLY)
+        require.NoError(t, err)
+        crate.Clean()
+        crate.Close()
+    }
+
+    descr, err := reg.GetBatch(fileId, batchId)
+    require.NoError(t, err)
+    batch, err = OpenBatch(dataDir, reg, descr)
+    require.NoError(t, err)
+
+    writer := bytes.NewBuffer(nil)
+    readSize, err := batch.Read(context.Background(), writer, dataSize)
+    require.NoError(t, err)
+    require.Equal(t, dataSize, readSize)
+    require.Equal(t, buffer, writer.Bytes())
+
+    // Third loss is beyond recovery
+    blockDescr, err := reg.GetBlock(fileId, batchId, dsdescr.BTData, 2)
+    require.NoError(t, err)
+    crate, err := OpenCrate(dataDir, blockDescr.FilePath, WRONLY)
+    require.NoError(t, err)
+    crate.Clean()
+    crate.Close()
+
+    _, err = batch.Read(context.Background(), io.Discard, dataSize)
+    require.Error(t, err)
+}
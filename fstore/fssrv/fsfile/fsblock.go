@@ -5,17 +5,20 @@
 package fsfile
 
 import (
+    "bytes"
     "fmt"
     "io"
     "time"
 
     "dstore/dscomm/dsdescr"
     "dstore/dscomm/dserr"
+    "dstore/dscomm/dsinter"
 )
 
 type Block struct {
     baseDir     string
     filePath    string
+    reg         dsinter.FStoreReg
 
     fileId      int64
     batchId     int64
@@ -26,12 +29,23 @@ type Block struct {
     dataSize    int64
     createdAt   int64
     updatedAt   int64
+
+    hashAlg     string
+    hashInit    string
+    hashSum     string
+
+    hasLocal    bool
+    hasRemote   bool
+    bstoreAddr  string
+    bstorePort  string
+    keep        func(string)
 }
 
-func NewBlock(baseDir string, fileId, batchId, blockType, blockId, blockSize int64) (*Block, error) {
+func NewBlock(baseDir string, reg dsinter.FStoreReg, fileId, batchId, blockType, blockId, blockSize int64) (*Block, error) {
     var err error
     var block Block
     block.baseDir   = baseDir
+    block.reg       = reg
 
     block.fileId    = fileId
     block.batchId   = batchId
@@ -47,10 +61,11 @@ func NewBlock(baseDir string, fileId, batchId, blockType, blockId, blockSize int
     return &block, dserr.Err(err)
 }
 
-func OpenBlock(baseDir string, descr *dsdescr.Block) (*Block, error) {
+func OpenBlock(baseDir string, reg dsinter.FStoreReg, descr *dsdescr.Block) (*Block, error) {
     var err error
     var block Block
     block.baseDir   = baseDir
+    block.reg       = reg
 
     block.fileId    = descr.FileId
     block.batchId   = descr.BatchId
@@ -63,6 +78,15 @@ func OpenBlock(baseDir string, descr *dsdescr.Block) (*Block, error) {
 
     block.createdAt = descr.CreatedAt
     block.updatedAt = descr.UpdatedAt
+
+    block.hashAlg   = descr.HashAlg
+    block.hashInit  = descr.HashInit
+    block.hashSum   = descr.HashSum
+
+    block.hasLocal   = descr.HasLocal
+    block.hasRemote  = descr.HasRemote
+    block.bstoreAddr = descr.BStoreAddr
+    block.bstorePort = descr.BStorePort
     return &block, dserr.Err(err)
 }
 
@@ -87,27 +111,37 @@ func (block *Block) Write(reader io.Reader, dataSize int64) (int64, bool, error)
         err = fmt.Errorf("block write error: %s", err)
         return wrSize, eof, dserr.Err(err)
     }
+    // Hash covers whole crate content, old data included
+    hashInit := newHashInit()
+    hasher, err := newHasher(dsdescr.HashSHA256, hashInit)
+    if err != nil {
+        writer.Clean()
+        return wrSize, eof, dserr.Err(err)
+    }
+    hWriter := io.MultiWriter(writer, hasher)
 
+    var origin *Crate
     if block.dataSize > 0 {
-        var wrSize int64
         pReader, err := OpenCrate(block.baseDir, block.filePath, RDONLY)
         defer pReader.Close()
         if err != nil {
+            writer.Clean()
             err = fmt.Errorf("block recopy error: %s", err)
             return wrSize, eof, dserr.Err(err)
         }
-        wrSize, eof, err = copyData(pReader, writer, block.dataSize)
-        block.updatedAt = time.Now().Unix()
-        block.filePath  = newPath
-        block.dataSize += wrSize
-        pReader.Clean()
+        recopySize, _, err := copyData(pReader, hWriter, block.dataSize)
+        if err == nil && recopySize != block.dataSize {
+            err = fmt.Errorf("block recopy only %d", recopySize)
+        }
         if err != nil {
+            writer.Clean()
             err = fmt.Errorf("block recopy error: %s", err)
             return wrSize, eof, dserr.Err(err)
         }
+        origin = pReader
     }
 
-    wrSize, eof, err = copyData(reader, writer, dataSize)
+    wrSize, eof, err = copyData(reader, hWriter, dataSize)
     if err == io.EOF {
         eof = true
         err = nil
@@ -115,18 +149,94 @@ func (block *Block) Write(reader io.Reader, dataSize int64) (int64, bool, error)
     block.updatedAt = time.Now().Unix()
     block.filePath  = newPath
     block.dataSize += wrSize
+    block.hasLocal  = true
+    block.hasRemote = false
+    block.hashAlg   = dsdescr.HashSHA256
+    block.hashInit  = hashInit
+    block.hashSum   = hashSum(hasher)
+    if origin != nil {
+        block.dropCrate(origin.filePath)
+    }
     if err != nil {
-        err = fmt.Errorf("block copy error: %s", err)
+        err = fmt.Errorf("block copy error: %w", err)
         return wrSize, eof, dserr.Err(err)
     }
     return wrSize, eof, dserr.Err(err)
 }
 
+func (block *Block) HasCrate() bool {
+    size, err := crateSize(block.baseDir, block.filePath)
+    if err != nil {
+        return false
+    }
+    return size == block.dataSize
+}
+
+func (block *Block) Restore(reader io.Reader) error {
+    var err error
+    newPath := newFilePath()
+    newPath = fmt.Sprintf("%s--%05d-%04d-%03d", newPath, block.fileId, block.batchId, block.blockId)
+
+    writer, err := OpenCrate(block.baseDir, newPath, WRONLY)
+    defer writer.Close()
+    if err != nil {
+        err = fmt.Errorf("block restore error: %s", err)
+        return dserr.Err(err)
+    }
+    hasher, err := newHasher(block.hashAlg, block.hashInit)
+    if err != nil && block.hashAlg != "" {
+        writer.Clean()
+        return dserr.Err(err)
+    }
+    var hWriter io.Writer = writer
+    if block.hashAlg != "" {
+        hWriter = io.MultiWriter(writer, hasher)
+    }
+    wrSize, _, err := copyData(reader, hWriter, block.dataSize)
+    if err == nil && wrSize != block.dataSize {
+        err = fmt.Errorf("block restore only %d", wrSize)
+    }
+    if err != nil {
+        writer.Clean()
+        err = fmt.Errorf("block restore error: %s", err)
+        return dserr.Err(err)
+    }
+    if block.hashAlg != "" && hashSum(hasher) != block.hashSum {
+        writer.Clean()
+        err = dserr.NewCorruptError("restored block %d,%d,%d,%d hash mismatch",
+                                block.fileId, block.batchId, block.blockType, block.blockId)
+        return dserr.Err(err)
+    }
+    hasRemote := block.hasRemote
+    block.replaceCrate(newPath, block.dataSize)
+    block.hasRemote = hasRemote
+    return dserr.Err(err)
+}
+
+func (block *Block) SetRemote(address, port string) {
+    block.hasRemote  = true
+    block.bstoreAddr = address
+    block.bstorePort = port
+}
+
 func (block *Block) Read(writer io.Writer, dataSize int64) (int64, error) {
+    return block.ReadRange(writer, 0, dataSize)
+}
+
+// ReadRange writes length bytes of the block data starting from offset.
+// Hashed block is read whole to be verified, only the range is written out.
+func (block *Block) ReadRange(writer io.Writer, offset, length int64) (int64, error) {
     var err error
     var readSize int64
 
-    if dataSize < 1 {
+    if offset < 0 || offset > block.dataSize {
+        err = fmt.Errorf("block offset %d out of range", offset)
+        return readSize, dserr.Err(err)
+    }
+    if length > block.dataSize - offset {
+        length = block.dataSize - offset
+    }
+    if length < 1 {
         return readSize, dserr.Err(err)
     }
 
@@ -136,18 +246,80 @@ func (block *Block) Read(writer io.Writer, dataSize int64) (int64, error) {
         err = fmt.Errorf("block read error: %s", err)
         return readSize, dserr.Err(err)
     }
-
-    readSize, _, err = copyData(reader, writer, block.dataSize)
+    if block.hashAlg == "" {
+        _, err = reader.Seek(offset, io.SeekStart)
+        if err != nil {
+            err = fmt.Errorf("block read error: %s", err)
+            return readSize, dserr.Err(err)
+        }
+        readSize, _, err = copyData(reader, writer, length)
+        if err == nil && readSize != length {
+            err = fmt.Errorf("block read only %d", readSize)
+        }
+        if err != nil {
+            err = fmt.Errorf("block read error: %s", err)
+            return readSize, dserr.Err(err)
+        }
+        return readSize, dserr.Err(err)
+    }
+    // Whole block is read before output, a broken crate writes nothing
+    buffer := bytes.NewBuffer(make([]byte, 0, block.dataSize))
+    bufSize, _, err := copyData(reader, buffer, block.dataSize)
     if err != nil {
         err = fmt.Errorf("block recopy error: %s", err)
         return readSize, dserr.Err(err)
     }
-    if readSize != block.dataSize {
-        err = fmt.Errorf("block recopy only %d", readSize)
+    if bufSize != block.dataSize {
+        err = fmt.Errorf("block recopy only %d", bufSize)
+        return readSize, dserr.Err(err)
+    }
+    err = block.verify(buffer.Bytes())
+    if err != nil {
+        return readSize, dserr.Err(err)
+    }
+    written, err := writer.Write(buffer.Bytes()[offset:offset + length])
+    readSize = int64(written)
+    if err != nil {
+        err = fmt.Errorf("block write error: %s", err)
+        return readSize, dserr.Err(err)
     }
     return readSize, dserr.Err(err)
 }
 
+func (block *Block) Verify() error {
+    var err error
+    _, err = block.Read(io.Discard, block.dataSize)
+    return dserr.Err(err)
+}
+
+func (block *Block) verify(data []byte) error {
+    var err error
+    // Blocks written before hashing was introduced have no sum
+    if block.hashAlg == "" {
+        return dserr.Err(err)
+    }
+    hasher, err := newHasher(block.hashAlg, block.hashInit)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    hasher.Write(data)
+    if hashSum(hasher) != block.hashSum {
+        err = dserr.NewCorruptError("block %d,%d,%d,%d hash mismatch",
+                                block.fileId, block.batchId, block.blockType, block.blockId)
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (block *Block) replaceCrate(filePath string, dataSize int64) {
+    block.dropCrate(block.filePath)
+    block.filePath  = filePath
+    block.dataSize  = dataSize
+    block.hasLocal  = true
+    block.hasRemote = false
+    block.updatedAt = time.Now().Unix()
+}
+
 func (block *Block) Descr() *dsdescr.Block {
     descr := dsdescr.NewBlock()
     descr.FileId    = block.fileId
@@ -161,24 +333,66 @@ func (block *Block) Descr() *dsdescr.Block {
 
     descr.CreatedAt = block.createdAt
     descr.UpdatedAt = block.updatedAt
+
+    descr.HashAlg   = block.hashAlg
+    descr.HashInit  = block.hashInit
+    descr.HashSum   = block.hashSum
+
+    descr.HasLocal   = block.hasLocal
+    descr.HasRemote  = block.hasRemote
+    descr.BStoreAddr = block.bstoreAddr
+    descr.BStorePort = block.bstorePort
     return descr
 }
 
 func (block *Block) Clean() error {
     var err error
-    crate, err := OpenCrate(block.baseDir, block.filePath, WRONLY)
-    defer crate.Close()
+    err = block.dropCrate(block.filePath)
     if err != nil {
         err = fmt.Errorf("block clean error: %s", err)
         return dserr.Err(err)
     }
+    block.dataSize = 0
+    block.filePath = newFilePath()
+    block.hashAlg  = ""
+    block.hashInit = ""
+    block.hashSum  = ""
+
+    return dserr.Err(err)
+}
+
+// dropCrate removes the crate, the crate shared with copy of the file
+// is kept until the last block releases it. The crate replaced while
+// readers of the file can read it is kept for later drop.
+func (block *Block) dropCrate(filePath string) error {
+    var err error
+    if block.keep != nil {
+        block.keep(filePath)
+        return dserr.Err(err)
+    }
+    return DropCrate(block.baseDir, block.reg, filePath)
+}
+
+// DropCrate removes the crate kept by the write of the file
+func DropCrate(baseDir string, reg dsinter.FStoreReg, filePath string) error {
+    var err error
+    if reg != nil {
+        last, err := reg.UnrefCrate(filePath)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        if !last {
+            return dserr.Err(err)
+        }
+    }
+    crate, err := OpenCrate(baseDir, filePath, WRONLY)
+    defer crate.Close()
+    if err != nil {
+        return dserr.Err(err)
+    }
     err = crate.Clean()
     if err != nil {
-        err = fmt.Errorf("block clean error: %s", err)
         return dserr.Err(err)
     }
-    block.dataSize = 0
-    block.filePath = newFilePath()
-
     return dserr.Err(err)
 }
@@ -7,10 +7,14 @@ package fsfile
 import(
     "bytes"
     "math/rand"
+    "os"
+    "path/filepath"
     "testing"
 
     "github.com/stretchr/testify/require"
 
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
     "dstore/dscomm/dskvdb"
     "dstore/fstore/fssrv/fsreg"
 )
@@ -33,7 +37,7 @@ func TestBlock01(t *testing.T) {
     var blockId     int64 = 4
     var blockSize   int64 = 1024 * 1024 * 16
 
-    block, err := NewBlock(dataDir, fileId, batchId, blockType, blockId, blockSize)
+    block, err := NewBlock(dataDir, reg, fileId, batchId, blockType, blockId, blockSize)
     require.NoError(t, err)
     require.NotEqual(t, block, nil)
 
@@ -43,7 +47,7 @@ func TestBlock01(t *testing.T) {
     reader := bytes.NewReader(buffer)
 
     needSize := blockSize - 1
-    wrSize, err := block.Write(reader, needSize)
+    wrSize, _, err := block.Write(reader, needSize)
     require.NoError(t, err)
     require.Equal(t, wrSize, needSize)
 
@@ -54,7 +58,7 @@ func TestBlock01(t *testing.T) {
     descr, err = reg.GetBlock(fileId, batchId, blockType, blockId)
     require.NoError(t, err)
 
-    block, err = OpenBlock(dataDir, descr)
+    block, err = OpenBlock(dataDir, reg, descr)
     require.NoError(t, err)
     require.NotEqual(t, block, nil)
 
@@ -68,3 +72,41 @@ func TestBlock01(t *testing.T) {
     err = block.Clean()
     require.NoError(t, err)
 }
+
+func TestBlock02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    var blockSize   int64 = 1024 * 64
+    block, err := NewBlock(dataDir, nil, 1, 2, 1, 4, blockSize)
+    require.NoError(t, err)
+
+    buffer := make([]byte, blockSize)
+    rand.Read(buffer)
+    _, _, err = block.Write(bytes.NewReader(buffer), blockSize)
+    require.NoError(t, err)
+
+    descr := block.Descr()
+    require.Equal(t, dsdescr.HashSHA256, descr.HashAlg)
+    require.NotEqual(t, "", descr.HashInit)
+    require.NotEqual(t, "", descr.HashSum)
+
+    // Flip one byte inside the crate
+    fullPath := filepath.Join(dataDir, descr.FilePath)
+    data, err := os.ReadFile(fullPath)
+    require.NoError(t, err)
+    data[blockSize / 2] ^= 0xff
+    err = os.WriteFile(fullPath, data, 0644)
+    require.NoError(t, err)
+
+    block, err = OpenBlock(dataDir, nil, descr)
+    require.NoError(t, err)
+
+    writer := bytes.NewBuffer(nil)
+    readSize, err := block.Read(writer, blockSize)
+    require.Error(t, err)
+    require.True(t, dserr.IsCorrupt(err))
+    require.Equal(t, int64(0), readSize)
+    require.Equal(t, 0, writer.Len())
+}
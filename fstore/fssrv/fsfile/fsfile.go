@@ -1,6 +1,8 @@
 package fsfile
 
 import (
+    "context"
+    "fmt"
     "io"
     "time"
     "dstore/dscomm/dsdescr"
@@ -18,15 +20,17 @@ type File struct {
     fileVer         int64
     batchSize       int64
     blockSize       int64
+    recoCount       int64
 
     dataSize        int64
     createdAt       int64
     updatedAt       int64
     batchCount      int64
     batchs          []*Batch
+    keep            func(string)
 }
 
-func NewFile(baseDir string, reg dsinter.FStoreReg, login, filePath string, fileId, batchSize, blockSize int64) (*File, error) {
+func NewFile(baseDir string, reg dsinter.FStoreReg, login, filePath string, fileId, batchSize, blockSize, recoCount int64) (*File, error) {
     var file File
     var err error
     file.reg        = reg
@@ -38,6 +42,7 @@ func NewFile(baseDir string, reg dsinter.FStoreReg, login, filePath string, file
     file.fileId     = fileId
     file.batchSize  = batchSize
     file.blockSize  = blockSize
+    file.recoCount  = recoCount
     file.dataSize   = 0
     file.createdAt  = time.Now().Unix()
     file.updatedAt  = file.createdAt
@@ -56,14 +61,16 @@ func OpenFile(baseDir string, reg dsinter.FStoreReg, descr *dsdescr.File) (*File
     file.filePath   = descr.FilePath
 
     file.fileId     = descr.FileId
+    file.fileVer    = descr.FileVer
     file.batchSize  = descr.BatchSize
     file.blockSize  = descr.BlockSize
+    file.recoCount  = descr.RecoCount
     file.dataSize   = descr.DataSize
     file.createdAt  = descr.CreatedAt
     file.updatedAt  = descr.UpdatedAt
     file.batchCount = descr.BatchCount
 
-    file.batchs = make([]*Batch, file.batchCount + 1)
+    file.batchs = make([]*Batch, file.batchCount)
     for i := int64(0); i < file.batchCount; i++ {
         batchDescr, err := file.reg.GetBatch(file.fileId, i)
         if err != nil {
@@ -78,30 +85,50 @@ func OpenFile(baseDir string, reg dsinter.FStoreReg, descr *dsdescr.File) (*File
     return &file, dserr.Err(err)
 }
 
-func (file *File) Write(reader io.Reader, dataSize int64) (int64, bool, error) {
+// KeepCrates passes crates replaced by the write to the keep function
+// instead of drop, readers of the file can read them until DropCrate
+func (file *File) KeepCrates(keep func(string)) {
+    file.keep = keep
+    for _, batch := range file.batchs {
+        batch.keepCrates(keep)
+    }
+}
+
+// Write stops between batches when the context is done,
+// a batch is written by the batch Write
+func (file *File) Write(ctx context.Context, reader io.Reader, dataSize int64) (int64, bool, error) {
     var err error
     var written int64
     var eof bool
+    // Last batch can be partially filled by an interrupted write
     for i := range file.batchs {
-        if dataSize < 1 {
+        if dataSize < 1 || eof {
             return written, eof, dserr.Err(err)
         }
-        batchWritten, eof, err := file.batchs[i].Write(reader, dataSize)
+        err = ctx.Err()
+        if err != nil {
+            return written, eof, dserr.Err(err)
+        }
+        batchWritten, batchEof, err := file.batchs[i].Write(ctx, reader, dataSize)
+        if err == io.EOF {
+            err = nil
+            batchEof = true
+        }
+        eof = batchEof
         written += batchWritten
-
+        file.dataSize += batchWritten
+        dataSize -= batchWritten
         if batchWritten > 0 {
+            file.updatedAt = time.Now().Unix()
             batchDescr := file.batchs[i].Descr()
-
-            err = file.reg.PutBatch(batchDescr)
-            if err != nil {
-                return written, eof, dserr.Err(err)
+            putErr := file.reg.PutBatch(batchDescr)
+            if putErr != nil {
+                return written, eof, dserr.Err(putErr)
             }
         }
-
         if err != nil {
             return written, eof, dserr.Err(err)
         }
-        dataSize -= batchWritten
     }
 
     for {
@@ -111,47 +138,73 @@ func (file *File) Write(reader io.Reader, dataSize int64) (int64, bool, error) {
         if eof {
             return written, eof, dserr.Err(err)
         }
+        err = ctx.Err()
+        if err != nil {
+            return written, eof, dserr.Err(err)
+        }
         batchNumber := file.batchCount
 
-        batch, err := NewBatch(file.baseDir, file.reg, file.fileId, batchNumber, file.batchSize, file.blockSize)
+        batch, err := NewBatch(file.baseDir, file.reg, file.fileId, batchNumber, file.batchSize, file.blockSize, file.recoCount)
         if err != nil {
             return written, eof, dserr.Err(err)
         }
+        batch.keepCrates(file.keep)
         batchDescr := batch.Descr()
         err = file.reg.PutBatch(batchDescr)
         if err != nil {
             return written, eof, dserr.Err(err)
         }
+        file.batchs = append(file.batchs, batch)
+        file.batchCount++
 
-        batchWritten, eof, err := batch.Write(reader, dataSize)
+        batchWritten, batchEof, err := batch.Write(ctx, reader, dataSize)
         if err == io.EOF {
             err = nil
-            eof = true
+            batchEof = true
         }
+        eof = batchEof
         written += batchWritten
         file.dataSize += batchWritten
+        file.updatedAt = time.Now().Unix()
         batchDescr = batch.Descr()
-        err = file.reg.PutBatch(batchDescr)
+        putErr := file.reg.PutBatch(batchDescr)
+        if putErr != nil {
+            return written, eof, dserr.Err(putErr)
+        }
         if err != nil {
             return written, eof, dserr.Err(err)
         }
         dataSize -= batchWritten
-        file.batchCount++
-        if eof {
-            return written, eof, dserr.Err(err)
-        }
     }
-    return written, eof, dserr.Err(err)
 }
 
-func (file *File) Read(writer io.Writer) (int64, error) {
+func (file *File) Read(ctx context.Context, writer io.Writer) (int64, error) {
+    return file.ReadRange(ctx, writer, 0, file.dataSize)
+}
+
+// ReadRange writes length bytes of the file starting from offset,
+// reading begins from the batch which holds the offset
+func (file *File) ReadRange(ctx context.Context, writer io.Writer, offset, length int64) (int64, error) {
     var err error
     var readSize int64
-    dataSize := file.dataSize
-    for i := int64(0); i < file.batchCount; i++ {
-        batchRead, err := file.batchs[i].Read(writer, dataSize)
+    length, err = RangeSize(file.dataSize, offset, length)
+    if err != nil {
+        return readSize, dserr.Err(err)
+    }
+    if length < 1 {
+        return readSize, dserr.Err(err)
+    }
+    batchBytes := file.batchSize * file.blockSize
+    first := offset / batchBytes
+    offset = offset % batchBytes
+    for i := first; i < file.batchCount; i++ {
+        if length < 1 {
+            break
+        }
+        batchRead, err := file.batchs[i].ReadRange(ctx, writer, offset, length)
         readSize += batchRead
-        dataSize -= batchRead
+        length -= batchRead
+        offset = 0
         if err == io.EOF {
             err = nil
             return readSize, dserr.Err(err)
@@ -160,9 +213,29 @@ func (file *File) Read(writer io.Writer) (int64, error) {
             return readSize, dserr.Err(err)
         }
     }
+    if length > 0 {
+        err = fmt.Errorf("file read only %d", readSize)
+        return readSize, dserr.Err(err)
+    }
     return readSize, dserr.Err(err)
 }
 
+// RangeSize returns size of the data range, zero length means up to end of data
+func RangeSize(dataSize, offset, length int64) (int64, error) {
+    var err error
+    if offset < 0 || offset > dataSize {
+        err = fmt.Errorf("offset %d out of data size %d", offset, dataSize)
+        return length, dserr.Err(err)
+    }
+    if length < 0 {
+        err = fmt.Errorf("wrong length %d", length)
+        return length, dserr.Err(err)
+    }
+    if length == 0 || length > dataSize - offset {
+        length = dataSize - offset
+    }
+    return length, dserr.Err(err)
+}
 
 func (file *File) Clean() error {
     var err error
@@ -172,7 +245,7 @@ func (file *File) Clean() error {
             if err != nil {
                 return dserr.Err(err)
             }
-            err = file.reg.DeleteBatch(i, file.fileId)
+            err = file.reg.DeleteBatch(file.fileId, i)
             if err != nil {
                 return dserr.Err(err)
             }
@@ -196,14 +269,20 @@ func (file *File) SetFilePath(filePath string) {
     file.filePath = filePath
 }
 
+func (file *File) SetFileVer(fileVer int64) {
+    file.fileVer = fileVer
+}
+
 
 func (file *File) Descr() *dsdescr.File {
     descr := dsdescr.NewFile()
     descr.Login         = file.login
     descr.FilePath      = file.filePath
     descr.FileId        = file.fileId
+    descr.FileVer       = file.fileVer
     descr.BatchSize     = file.batchSize
     descr.BlockSize     = file.blockSize
+    descr.RecoCount     = file.recoCount
     descr.DataSize      = file.dataSize
     descr.BatchCount    = file.batchCount
     descr.CreatedAt     = file.createdAt
@@ -6,10 +6,12 @@ package fsfile
 
 import(
     "bytes"
+    "context"
     "math/rand"
     "testing"
     "github.com/stretchr/testify/require"
 
+    "dstore/dscomm/dsdescr"
     "dstore/dscomm/dskvdb"
     "dstore/fstore/fssrv/fsreg"
 )
@@ -32,8 +34,9 @@ func TestFile01(t *testing.T) {
     var batchSize   int64 = 5
     var blockSize   int64 = 1000 * 1000
     var batchCount  int64 = 10
+    var recoCount   int64 = 2
 
-    file, err := NewFile(dataDir, reg, login, filePath,  fileId, batchSize, blockSize)
+    file, err := NewFile(dataDir, reg, login, filePath,  fileId, batchSize, blockSize, recoCount)
     require.NoError(t, err)
     require.NotEqual(t, file, nil)
 
@@ -47,15 +50,13 @@ func TestFile01(t *testing.T) {
     reader := bytes.NewReader(origin)
 
     needSize := int64(dataSize)
-    wrSize, err := file.Write(reader, needSize)
+    wrSize, _, err := file.Write(context.Background(), reader, needSize)
     require.NoError(t, err)
     require.Equal(t, needSize, wrSize)
 
     _, err = reg.GetFile(login, filePath)
     require.NoError(t, err)
 
-    return
-
     descr = file.Descr()
 
     file, err = OpenFile(dataDir, reg, descr)
@@ -64,11 +65,150 @@ func TestFile01(t *testing.T) {
 
     writer := bytes.NewBuffer(nil)
 
-    readSize, err := file.Read(writer)
+    readSize, err := file.Read(context.Background(), writer)
     require.NoError(t, err)
     require.Equal(t, wrSize, readSize)
-    //require.Equal(t, origin[0:wrSize], writer.Bytes())
+    require.Equal(t, origin[0:wrSize], writer.Bytes())
+
+    err = file.Clean()
+    require.NoError(t, err)
+}
+
+func TestFile02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.leveldb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    filePath    := "/append.bin"
+    login       := "admin"
+    var fileId      int64 = 4
+    var batchSize   int64 = 3
+    var blockSize   int64 = 1024 * 64
+    var recoCount   int64 = 2
+
+    file, err := NewFile(dataDir, reg, login, filePath,  fileId, batchSize, blockSize, recoCount)
+    require.NoError(t, err)
+
+    dataSize := 5 * blockSize + 1000
+    origin := make([]byte, dataSize)
+    rand.Read(origin)
+
+    // Write the data by parts, each part reopens the file
+    parts := []int64{ blockSize / 2, blockSize * 2, 10, blockSize * 3 }
+    var offset int64
+    for _, part := range parts {
+        if offset + part > dataSize {
+            part = dataSize - offset
+        }
+        reader := bytes.NewReader(origin[offset:offset + part])
+        wrSize, _, err := file.Write(context.Background(), reader, part)
+        require.NoError(t, err)
+        require.Equal(t, part, wrSize)
+        offset += wrSize
+        require.Equal(t, offset, file.DataSize())
+
+        descr := file.Descr()
+        err = reg.PutFile(descr)
+        require.NoError(t, err)
+        file, err = OpenFile(dataDir, reg, descr)
+        require.NoError(t, err)
+    }
+    require.Equal(t, dataSize, offset)
+
+    writer := bytes.NewBuffer(nil)
+    readSize, err := file.Read(context.Background(), writer)
+    require.NoError(t, err)
+    require.Equal(t, dataSize, readSize)
+    require.Equal(t, origin, writer.Bytes())
 
     err = file.Clean()
     require.NoError(t, err)
+    batchDescrs, err := reg.ListBatchs(fileId)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(batchDescrs))
+}
+
+func TestFile03(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.leveldb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    filePath    := "/range.bin"
+    login       := "admin"
+    var fileId      int64 = 5
+    var batchSize   int64 = 3
+    var blockSize   int64 = 1024 * 64
+    var recoCount   int64 = 2
+
+    file, err := NewFile(dataDir, reg, login, filePath,  fileId, batchSize, blockSize, recoCount)
+    require.NoError(t, err)
+
+    dataSize := 10 * blockSize + 123
+    origin := make([]byte, dataSize)
+    rand.Read(origin)
+    _, _, err = file.Write(context.Background(), bytes.NewReader(origin), dataSize)
+    require.NoError(t, err)
+
+    batchBytes := batchSize * blockSize
+    ranges := [][2]int64{
+        { 0, 100 },
+        { blockSize - 10, 20 },
+        { batchBytes - 5, 10 },
+        { batchBytes + 3, blockSize * 4 },
+        { dataSize - 7, 0 },
+        { 1000, dataSize },
+        { dataSize, 0 },
+    }
+    check := func() {
+        for _, rng := range ranges {
+            offset, length := rng[0], rng[1]
+            want := origin[offset:]
+            if length > 0 && length < int64(len(want)) {
+                want = want[0:length]
+            }
+            writer := bytes.NewBuffer(make([]byte, 0))
+            readSize, err := file.ReadRange(context.Background(), writer, offset, length)
+            require.NoError(t, err)
+            require.Equal(t, int64(len(want)), readSize)
+            require.Equal(t, want, writer.Bytes())
+        }
+    }
+    check()
+
+    // Lost block is rebuilt for the range
+    descr, err := reg.GetBlock(fileId, 1, dsdescr.BTData, 0)
+    require.NoError(t, err)
+    block, err := OpenBlock(dataDir, reg, descr)
+    require.NoError(t, err)
+    err = block.Clean()
+    require.NoError(t, err)
+    file, err = OpenFile(dataDir, reg, file.Descr())
+    require.NoError(t, err)
+    check()
+
+    _, err = file.ReadRange(context.Background(), bytes.NewBuffer(nil), dataSize + 1, 0)
+    require.Error(t, err)
+    _, err = file.ReadRange(context.Background(), bytes.NewBuffer(nil), -1, 0)
+    require.Error(t, err)
+
+    // Canceled read stops before the data
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    readSize, err := file.Read(ctx, bytes.NewBuffer(nil))
+    require.ErrorIs(t, err, context.Canceled)
+    require.Equal(t, int64(0), readSize)
 }
@@ -8,11 +8,14 @@ import (
     "crypto/sha256"
     "encoding/hex"
     "errors"
+    "fmt"
+    "hash"
     "io"
     "math/rand"
     "path/filepath"
     "time"
 
+    "dstore/dscomm/dsdescr"
     "dstore/dscomm/dserr"
 )
 
@@ -35,6 +38,34 @@ func newFilePath() (string) {
     return filePath
 }
 
+func newHashInit() string {
+    origin := make([]byte, 16)
+    rand.Read(origin)
+    return hex.EncodeToString(origin)
+}
+
+func newHasher(hashAlg, hashInit string) (hash.Hash, error) {
+    var err error
+    var hasher hash.Hash
+    switch hashAlg {
+        case dsdescr.HashSHA256:
+            hasher = sha256.New()
+        default:
+            err = fmt.Errorf("unknown hash algorithm %s", hashAlg)
+            return hasher, err
+    }
+    initBin, err := hex.DecodeString(hashInit)
+    if err != nil {
+        return hasher, err
+    }
+    hasher.Write(initBin)
+    return hasher, err
+}
+
+func hashSum(hasher hash.Hash) string {
+    return hex.EncodeToString(hasher.Sum(nil))
+}
+
 func copyData(reader io.Reader, writer io.Writer, size int64) (int64, bool, error) {
     var err error
     var bufSize int64 = 1024 * 16
@@ -43,10 +74,7 @@ func copyData(reader io.Reader, writer io.Writer, size int64) (int64, bool, erro
     var eof     bool  = false
     buffer := make([]byte, bufSize)
 
-    for {
-        if remains == 0 {
-            return total, eof,dserr.Err(err)
-        }
+    for remains > 0 {
         if remains < bufSize {
             bufSize = remains
         }
@@ -70,5 +98,5 @@ func copyData(reader io.Reader, writer io.Writer, size int64) (int64, bool, erro
         total += int64(written)
         remains -= int64(written)
     }
-    return total, eof, dserr. Err(err)
+    return total, eof, dserr.Err(err)
 }
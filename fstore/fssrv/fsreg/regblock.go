@@ -4,6 +4,7 @@ import (
     "strings"
     "strconv"
     "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dsinter"
 )
 
 func (reg *Reg) PutBlock(descr *dsdescr.Block) error {
@@ -100,3 +101,23 @@ func (reg *Reg) ListBlocks(fileId int64) ([]*dsdescr.Block, error) {
     }
     return descrs, err
 }
+
+func (reg *Reg) ProcBlocks(blockCb dsinter.BlockFunc) error {
+    var err error
+    iterCb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var interr bool
+        descr, err := dsdescr.UnpackBlock(val)
+        if err != nil {
+            return interr, err
+        }
+        interr, err = blockCb(descr)
+        return interr, err
+    }
+    blockBaseBin := []byte(reg.blockBase + reg.sep)
+    err = reg.db.Iter(blockBaseBin, iterCb)
+    if err != nil {
+        return err
+    }
+    return err
+}
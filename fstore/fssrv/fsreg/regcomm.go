@@ -2,6 +2,7 @@
 package fsreg
 
 import (
+    "sync"
     "dstore/dscomm/dsinter"
 )
 
@@ -13,7 +14,15 @@ type Reg struct {
     blockBase   string
     batchBase   string
     fileBase    string
+    verBase     string
     bstoreBase  string
+    keyBase     string
+    usageBase   string
+    grantBase   string
+    crateBase   string
+    dropBase    string
+    fileMtx     sync.Mutex
+    crateMtx    sync.Mutex
 }
 
 func NewReg(db dsinter.DB) (*Reg, error) {
@@ -26,6 +35,12 @@ func NewReg(db dsinter.DB) (*Reg, error) {
     reg.blockBase   = "block"
     reg.batchBase   = "batch"
     reg.fileBase    = "file"
+    reg.verBase     = "ver"
     reg.bstoreBase  = "bstore"
+    reg.keyBase     = "apikey"
+    reg.usageBase   = "usage"
+    reg.grantBase   = "grant"
+    reg.crateBase   = "crateref"
+    reg.dropBase    = "drop"
     return &reg, err
 }
@@ -0,0 +1,94 @@
+package fsreg
+
+import (
+    "strconv"
+    "strings"
+)
+
+// Crate refs count blocks of copied files which share the crate.
+// Crate without record is owned by single block.
+
+func (reg *Reg) RefCrate(filePath string) error {
+    var err error
+    reg.crateMtx.Lock()
+    defer reg.crateMtx.Unlock()
+
+    refs, err := reg.getCrateRefs(filePath)
+    if err != nil {
+        return err
+    }
+    err = reg.putCrateRefs(filePath, refs + 1)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+// UnrefCrate releases the crate and reports that the last ref is released
+func (reg *Reg) UnrefCrate(filePath string) (bool, error) {
+    var err error
+    var last bool
+    reg.crateMtx.Lock()
+    defer reg.crateMtx.Unlock()
+
+    refs, err := reg.getCrateRefs(filePath)
+    if err != nil {
+        return last, err
+    }
+    refs--
+    switch {
+        case refs < 1:
+            last = true
+        case refs == 1:
+            err = reg.db.Delete(reg.crateKey(filePath))
+        default:
+            err = reg.putCrateRefs(filePath, refs)
+    }
+    if err != nil {
+        return last, err
+    }
+    return last, err
+}
+
+func (reg *Reg) CrateRefs(filePath string) (int64, error) {
+    var err error
+    reg.crateMtx.Lock()
+    defer reg.crateMtx.Unlock()
+
+    refs, err := reg.getCrateRefs(filePath)
+    return refs, err
+}
+
+func (reg *Reg) getCrateRefs(filePath string) (int64, error) {
+    var err error
+    var refs int64 = 1
+    keyBin := reg.crateKey(filePath)
+    has, err := reg.db.Has(keyBin)
+    if err != nil {
+        return refs, err
+    }
+    if !has {
+        return refs, err
+    }
+    valBin, err := reg.db.Get(keyBin)
+    if err != nil {
+        return refs, err
+    }
+    refs, err = strconv.ParseInt(string(valBin), 10, 64)
+    if err != nil {
+        return refs, err
+    }
+    return refs, err
+}
+
+func (reg *Reg) putCrateRefs(filePath string, refs int64) error {
+    var err error
+    valBin := []byte(strconv.FormatInt(refs, 10))
+    err = reg.db.Put(reg.crateKey(filePath), valBin)
+    return err
+}
+
+func (reg *Reg) crateKey(filePath string) []byte {
+    keyArr := []string{ reg.crateBase, filePath }
+    return []byte(strings.Join(keyArr, reg.sep))
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dskvdb"
+)
+
+func TestCrateRef01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    filePath := "/a1/b2/c3.blk"
+
+    refs, err := reg.CrateRefs(filePath)
+    require.NoError(t, err)
+    require.Equal(t, int64(1), refs)
+
+    err = reg.RefCrate(filePath)
+    require.NoError(t, err)
+    err = reg.RefCrate(filePath)
+    require.NoError(t, err)
+
+    refs, err = reg.CrateRefs(filePath)
+    require.NoError(t, err)
+    require.Equal(t, int64(3), refs)
+
+    for i := 0; i < 2; i++ {
+        last, err := reg.UnrefCrate(filePath)
+        require.NoError(t, err)
+        require.Equal(t, false, last)
+    }
+    has, err := db.Has(reg.crateKey(filePath))
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    last, err := reg.UnrefCrate(filePath)
+    require.NoError(t, err)
+    require.Equal(t, true, last)
+}
@@ -0,0 +1,81 @@
+package fsreg
+
+import (
+    "strings"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dsinter"
+)
+
+const dirSep string = "/"
+
+// ListDir returns files and pseudo-directories of one level of the directory.
+// Nested files are collapsed into the directory entry with summed size and count.
+// Entries go in key order, next token is empty after the last entry.
+// The token is the name of last entry, directory names end with slash.
+func (reg *Reg) ListDir(login, dirPath, token string, limit int, filter dsinter.PathFunc) ([]*dsdescr.DirEntry, string, error) {
+    var err error
+    var next string
+    entries := make([]*dsdescr.DirEntry, 0)
+
+    dirPath = strings.TrimSuffix(dirPath, dirSep) + dirSep
+    keyArr := []string{ reg.fileBase, login, dirPath }
+    prefix := strings.Join(keyArr, reg.sep)
+
+    // Slash is followed by "0", so the directory is skipped as a whole
+    start := prefix
+    switch {
+        case strings.HasSuffix(token, dirSep):
+            start = prefix + strings.TrimSuffix(token, dirSep) + "0"
+        case len(token) > 0:
+            start = prefix + token + "\x00"
+    }
+
+    var entry *dsdescr.DirEntry
+    cb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var stop bool
+        name := strings.TrimPrefix(string(key), prefix)
+        if filter != nil && !filter(dirPath + name) {
+            return stop, err
+        }
+        isDir := false
+        index := strings.Index(name, dirSep)
+        if index >= 0 {
+            name = name[:index]
+            isDir = true
+        }
+        descr, err := dsdescr.UnpackFile(val)
+        if err != nil {
+            return stop, err
+        }
+        if entry == nil || entry.Name != name || entry.IsDir != isDir {
+            if limit > 0 && len(entries) == limit {
+                next = entryToken(entry)
+                stop = true
+                return stop, err
+            }
+            entry = dsdescr.NewDirEntry()
+            entry.Name  = name
+            entry.IsDir = isDir
+            entries = append(entries, entry)
+        }
+        entry.DataSize += descr.DataSize
+        entry.FileCount++
+        if descr.UpdatedAt > entry.UpdatedAt {
+            entry.UpdatedAt = descr.UpdatedAt
+        }
+        return stop, err
+    }
+    err = reg.db.IterFrom([]byte(prefix), []byte(start), cb)
+    if err != nil {
+        return entries, next, err
+    }
+    return entries, next, err
+}
+
+func entryToken(entry *dsdescr.DirEntry) string {
+    if entry.IsDir {
+        return entry.Name + dirSep
+    }
+    return entry.Name
+}
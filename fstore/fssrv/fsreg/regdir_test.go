@@ -0,0 +1,83 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "strings"
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+)
+
+func TestDir01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    filePaths := []string{ "/a", "/a-x", "/a/b", "/a/c/d", "/b", "/c/e", "/c/f" }
+    for i, filePath := range filePaths {
+        descr := dsdescr.NewFile()
+        descr.Login     = "user"
+        descr.FilePath  = filePath
+        descr.FileId    = int64(i + 1)
+        descr.DataSize  = 10
+        descr.UpdatedAt = int64(i)
+        err = reg.PutFile(descr)
+        require.NoError(t, err)
+    }
+
+    entries, next, err := reg.ListDir("user", "/", "", 0, nil)
+    require.NoError(t, err)
+    require.Equal(t, "", next)
+    require.Equal(t, 5, len(entries))
+
+    names := make([]string, 0)
+    for _, entry := range entries {
+        names = append(names, entryToken(entry))
+    }
+    require.Equal(t, []string{ "a", "a-x", "a/", "b", "c/" }, names)
+    require.Equal(t, int64(20), entries[2].DataSize)
+    require.Equal(t, int64(2), entries[2].FileCount)
+    require.Equal(t, int64(3), entries[2].UpdatedAt)
+
+    // Paging returns the same entries
+    paged := make([]string, 0)
+    var token string
+    for {
+        entries, token, err = reg.ListDir("user", "/", token, 2, nil)
+        require.NoError(t, err)
+        for _, entry := range entries {
+            paged = append(paged, entryToken(entry))
+        }
+        if len(token) == 0 {
+            break
+        }
+    }
+    require.Equal(t, names, paged)
+
+    entries, _, err = reg.ListDir("user", "/a", "", 0, nil)
+    require.NoError(t, err)
+    require.Equal(t, 2, len(entries))
+    require.Equal(t, "b", entries[0].Name)
+    require.Equal(t, "c", entries[1].Name)
+    require.Equal(t, true, entries[1].IsDir)
+
+    filter := func(filePath string) bool {
+        return strings.HasPrefix(filePath, "/c/")
+    }
+    entries, _, err = reg.ListDir("user", "/", "", 0, filter)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(entries))
+    require.Equal(t, int64(2), entries[0].FileCount)
+}
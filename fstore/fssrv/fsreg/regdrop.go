@@ -0,0 +1,54 @@
+package fsreg
+
+import (
+    "fmt"
+    "strings"
+    "dstore/dscomm/dsdescr"
+)
+
+// Drop records keep descrs of replaced files until the data is dropped,
+// the drops pending at the stop of the server are replayed at start
+
+func (reg *Reg) dropKey(fileId int64) []byte {
+    keyArr := []string{ reg.dropBase, fmt.Sprintf("%020d", fileId) }
+    return []byte(strings.Join(keyArr, reg.sep))
+}
+
+func (reg *Reg) PutDrop(descr *dsdescr.File) error {
+    var err error
+    keyBin := reg.dropKey(descr.FileId)
+    valBin, _ := descr.Pack()
+    err = reg.db.Put(keyBin, valBin)
+    return err
+}
+
+func (reg *Reg) DeleteDrop(fileId int64) error {
+    var err error
+    keyBin := reg.dropKey(fileId)
+    err = reg.db.Delete(keyBin)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+func (reg *Reg) ListDrops() ([]*dsdescr.File, error) {
+    var err error
+    descrs := make([]*dsdescr.File, 0)
+    cb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var interr bool
+        descr, err := dsdescr.UnpackFile(val)
+        if err != nil {
+            return interr, err
+        }
+        descrs = append(descrs, descr)
+        return interr, err
+    }
+    dropBaseBin := []byte(reg.dropBase + reg.sep)
+    err = reg.db.Iter(dropBaseBin, cb)
+    if err != nil {
+        return descrs, err
+    }
+    return descrs, err
+}
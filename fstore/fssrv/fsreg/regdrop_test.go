@@ -0,0 +1,48 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+)
+
+func TestDrop01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    for _, fileId := range []int64{ 12, 3, 1 } {
+        descr := dsdescr.NewFile()
+        descr.Login     = "admin"
+        descr.FilePath  = "/qwerty"
+        descr.FileId    = fileId
+        err = reg.PutDrop(descr)
+        require.NoError(t, err)
+    }
+
+    descrs, err := reg.ListDrops()
+    require.NoError(t, err)
+    require.Equal(t, 3, len(descrs))
+    require.Equal(t, int64(1), descrs[0].FileId)
+    require.Equal(t, int64(12), descrs[2].FileId)
+
+    err = reg.DeleteDrop(3)
+    require.NoError(t, err)
+
+    descrs, err = reg.ListDrops()
+    require.NoError(t, err)
+    require.Equal(t, 2, len(descrs))
+}
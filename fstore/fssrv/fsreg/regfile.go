@@ -2,18 +2,97 @@ package fsreg
 
 import (
     "strings"
+    "time"
     "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dsinter"
 )
 
+// PutFile writes the file descr and updates the usage of the login
 func (reg *Reg) PutFile(descr *dsdescr.File) error {
     var err error
+    reg.fileMtx.Lock()
+    defer reg.fileMtx.Unlock()
+
+    var sizeDelta int64 = descr.DataSize
+    var countDelta int64 = 1
+    has, err := reg.HasFile(descr.Login, descr.FilePath)
+    if err != nil {
+        return err
+    }
+    if has {
+        oldDescr, err := reg.GetFile(descr.Login, descr.FilePath)
+        if err != nil {
+            return err
+        }
+        sizeDelta -= oldDescr.DataSize
+        countDelta = 0
+    }
     keyArr := []string{ reg.fileBase, descr.Login, descr.FilePath }
     keyBin := []byte(strings.Join(keyArr, reg.sep))
     valBin, _ := descr.Pack()
     err = reg.db.Put(keyBin, valBin)
+    if err != nil {
+        return err
+    }
+    err = reg.addUsage(descr.Login, sizeDelta, countDelta)
     return err
 }
 
+// MoveFile rewrites the file key and the version keys of the file
+// in one batch, blocks are keyed by file id and stay in place
+func (reg *Reg) MoveFile(login, filePath, destPath string) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+    reg.fileMtx.Lock()
+    defer reg.fileMtx.Unlock()
+
+    has, err := reg.HasFile(login, filePath)
+    if err != nil {
+        return descr, err
+    }
+    if !has {
+        err = dserr.NewNotFoundError("file %s not exist", filePath)
+        return descr, err
+    }
+    has, err = reg.HasFile(login, destPath)
+    if err != nil {
+        return descr, err
+    }
+    if has {
+        err = dserr.NewExistsError("file %s already exist", destPath)
+        return descr, err
+    }
+    descr, err = reg.GetFile(login, filePath)
+    if err != nil {
+        return descr, err
+    }
+    vers, err := reg.ListVersions(login, filePath)
+    if err != nil {
+        return descr, err
+    }
+    batch := reg.db.NewBatch()
+    for _, ver := range vers {
+        batch.Delete(reg.versionKey(login, ver.FilePath, ver.FileVer))
+        ver.FilePath = destPath
+        valBin, _ := ver.Pack()
+        batch.Put(reg.versionKey(login, ver.FilePath, ver.FileVer), valBin)
+    }
+    keyArr := []string{ reg.fileBase, login, filePath }
+    batch.Delete([]byte(strings.Join(keyArr, reg.sep)))
+
+    descr.FilePath  = destPath
+    descr.UpdatedAt = time.Now().Unix()
+    keyArr = []string{ reg.fileBase, login, destPath }
+    valBin, _ := descr.Pack()
+    batch.Put([]byte(strings.Join(keyArr, reg.sep)), valBin)
+    err = reg.db.WriteBatch(batch)
+    if err != nil {
+        return descr, err
+    }
+    return descr, err
+}
+
 func (reg *Reg) HasFile(login, filePath string) (bool, error) {
     var err error
     keyArr := []string{ reg.fileBase, login, filePath }
@@ -43,12 +122,27 @@ func (reg *Reg) GetFile(login, filePath string) (*dsdescr.File, error) {
 
 func (reg *Reg) DeleteFile(login, filePath string) error {
     var err error
+    reg.fileMtx.Lock()
+    defer reg.fileMtx.Unlock()
+
+    has, err := reg.HasFile(login, filePath)
+    if err != nil {
+        return err
+    }
+    if !has {
+        return err
+    }
+    oldDescr, err := reg.GetFile(login, filePath)
+    if err != nil {
+        return err
+    }
     keyArr := []string{ reg.fileBase, login, filePath }
     keyBin := []byte(strings.Join(keyArr, reg.sep))
     err = reg.db.Delete(keyBin)
     if err != nil {
         return err
     }
+    err = reg.addUsage(login, -oldDescr.DataSize, -1)
     return err
 }
 
@@ -104,3 +198,35 @@ func (reg *Reg) ProcFiles(login string, fileCb FileFunc) ([]*dsdescr.File, error
     }
     return descrs, err
 }
+
+// Snapshot fixes the registry state for long listings
+func (reg *Reg) Snapshot() (dsinter.Snapshot, error) {
+    return reg.db.Snapshot()
+}
+
+// ProcFilesFrom calls the callback for files of the login placed after
+// the start path in key order, empty start path means the first file
+func (reg *Reg) ProcFilesFrom(snap dsinter.Snapshot, login, startAfter string, fileCb FileFunc) error {
+    var err error
+    iterCb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var interr bool
+        descr, err := dsdescr.UnpackFile(val)
+        if err != nil {
+            return interr, err
+        }
+        interr, err = fileCb(descr)
+        return interr, err
+    }
+    keyArr := []string{ reg.fileBase, login }
+    prefix := strings.Join(keyArr, reg.sep) + reg.sep
+    start := prefix
+    if len(startAfter) > 0 {
+        start = prefix + startAfter + "\x00"
+    }
+    err = snap.IterFrom([]byte(prefix), []byte(start), iterCb)
+    if err != nil {
+        return err
+    }
+    return err
+}
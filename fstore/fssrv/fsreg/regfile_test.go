@@ -57,3 +57,61 @@ func TestFile01(t *testing.T) {
     require.NoError(t, err)
     require.Equal(t, has, false)
 }
+
+func TestFileMove01(t *testing.T) {
+    var err error
+    var has bool
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    descr := dsdescr.NewFile()
+    descr.Login     = "qwerty"
+    descr.FilePath  = "/a/b.txt"
+    descr.FileId    = 3
+    descr.FileVer   = 1
+    descr.DataSize  = 100
+    err = reg.PutVersion(descr)
+    require.NoError(t, err)
+    descr.FileVer   = 2
+    err = reg.PutFile(descr)
+    require.NoError(t, err)
+
+    other := dsdescr.NewFile()
+    other.Login     = "qwerty"
+    other.FilePath  = "/c.txt"
+    err = reg.PutFile(other)
+    require.NoError(t, err)
+
+    _, err = reg.MoveFile("qwerty", "/a/b.txt", "/c.txt")
+    require.Error(t, err)
+    _, err = reg.MoveFile("qwerty", "/x.txt", "/y.txt")
+    require.Error(t, err)
+
+    moved, err := reg.MoveFile("qwerty", "/a/b.txt", "/d/b.txt")
+    require.NoError(t, err)
+    require.Equal(t, "/d/b.txt", moved.FilePath)
+    require.Equal(t, descr.FileId, moved.FileId)
+
+    has, err = reg.HasFile("qwerty", "/a/b.txt")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    vers, err := reg.ListVersions("qwerty", "/d/b.txt")
+    require.NoError(t, err)
+    require.Equal(t, 1, len(vers))
+    vers, err = reg.ListVersions("qwerty", "/a/b.txt")
+    require.NoError(t, err)
+    require.Equal(t, 0, len(vers))
+
+    usage, err := reg.GetUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, int64(100), usage.DataSize)
+    require.Equal(t, int64(2), usage.FileCount)
+}
@@ -0,0 +1,80 @@
+package fsreg
+
+import (
+    "strings"
+    "dstore/dscomm/dsdescr"
+)
+
+func (reg *Reg) PutGrant(descr *dsdescr.Grant) error {
+    var err error
+    keyArr := []string{ reg.grantBase, descr.Owner, descr.GranteeType, descr.Grantee, descr.PathPrefix }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    valBin, _ := descr.Pack()
+    err = reg.db.Put(keyBin, valBin)
+    return err
+}
+
+func (reg *Reg) HasGrant(owner, granteeType, grantee, pathPrefix string) (bool, error) {
+    var err error
+    keyArr := []string{ reg.grantBase, owner, granteeType, grantee, pathPrefix }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    has, err := reg.db.Has(keyBin)
+    if err != nil {
+        return has, err
+    }
+    return has, err
+}
+
+func (reg *Reg) GetGrant(owner, granteeType, grantee, pathPrefix string) (*dsdescr.Grant, error) {
+    var err error
+    var descr *dsdescr.Grant
+    keyArr := []string{ reg.grantBase, owner, granteeType, grantee, pathPrefix }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    valBin, err := reg.db.Get(keyBin)
+    if err != nil {
+        return descr, err
+    }
+    descr, err = dsdescr.UnpackGrant(valBin)
+    if err != nil {
+        return descr, err
+    }
+    return descr, err
+}
+
+func (reg *Reg) DeleteGrant(owner, granteeType, grantee, pathPrefix string) error {
+    var err error
+    keyArr := []string{ reg.grantBase, owner, granteeType, grantee, pathPrefix }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    err = reg.db.Delete(keyBin)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+// ListGrants returns grants of the owner, empty owner means all grants
+func (reg *Reg) ListGrants(owner string) ([]*dsdescr.Grant, error) {
+    var err error
+    descrs := make([]*dsdescr.Grant, 0)
+    cb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var interr bool
+        descr, err := dsdescr.UnpackGrant(val)
+        if err != nil {
+            return interr, err
+        }
+        if len(owner) == 0 || descr.Owner == owner {
+            descrs = append(descrs, descr)
+        }
+        return interr, err
+    }
+    grantBaseBin := []byte(reg.grantBase + reg.sep)
+    if len(owner) > 0 {
+        grantBaseBin = []byte(reg.grantBase + reg.sep + owner + reg.sep)
+    }
+    err = reg.db.Iter(grantBaseBin, cb)
+    if err != nil {
+        return descrs, err
+    }
+    return descrs, err
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+)
+
+func TestGrant01(t *testing.T) {
+    var err error
+    var has bool
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    descr0 := dsdescr.NewGrant()
+    descr0.Owner        = "qwerty"
+    descr0.PathPrefix   = "/builds"
+    descr0.GranteeType  = dsdescr.GranteeUser
+    descr0.Grantee      = "admin"
+    descr0.Access       = dsdescr.AccessRead
+    descr0.CreatedAt    = 1657645101
+    descr0.UpdatedAt    = 1657645102
+
+    err = reg.PutGrant(descr0)
+    require.NoError(t, err)
+
+    descr2 := dsdescr.NewGrant()
+    descr2.Owner        = "qwerty2"
+    descr2.PathPrefix   = "/"
+    descr2.GranteeType  = dsdescr.GranteeGroup
+    descr2.Grantee      = "devel"
+    err = reg.PutGrant(descr2)
+    require.NoError(t, err)
+
+    has, err = reg.HasGrant(descr0.Owner, descr0.GranteeType, descr0.Grantee, descr0.PathPrefix)
+    require.NoError(t, err)
+    require.Equal(t, has, true)
+
+    descr1, err := reg.GetGrant(descr0.Owner, descr0.GranteeType, descr0.Grantee, descr0.PathPrefix)
+    require.NoError(t, err)
+    require.Equal(t, descr0, descr1)
+
+    descrs, err := reg.ListGrants(descr0.Owner)
+    require.NoError(t, err)
+    require.Equal(t, len(descrs), 1)
+
+    descrs, err = reg.ListGrants("")
+    require.NoError(t, err)
+    require.Equal(t, len(descrs), 2)
+
+    err = reg.DeleteGrant(descr0.Owner, descr0.GranteeType, descr0.Grantee, descr0.PathPrefix)
+    require.NoError(t, err)
+
+    has, err = reg.HasGrant(descr0.Owner, descr0.GranteeType, descr0.Grantee, descr0.PathPrefix)
+    require.NoError(t, err)
+    require.Equal(t, has, false)
+}
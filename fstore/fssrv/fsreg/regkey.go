@@ -0,0 +1,77 @@
+package fsreg
+
+import (
+    "strings"
+    "dstore/dscomm/dsdescr"
+)
+
+func (reg *Reg) PutAPIKey(descr *dsdescr.APIKey) error {
+    var err error
+    keyArr := []string{ reg.keyBase, descr.KeyId }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    valBin, _ := descr.Pack()
+    err = reg.db.Put(keyBin, valBin)
+    return err
+}
+
+func (reg *Reg) HasAPIKey(keyId string) (bool, error) {
+    var err error
+    keyArr := []string{ reg.keyBase, keyId }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    has, err := reg.db.Has(keyBin)
+    if err != nil {
+        return has, err
+    }
+    return has, err
+}
+
+func (reg *Reg) GetAPIKey(keyId string) (*dsdescr.APIKey, error) {
+    var err error
+    var descr *dsdescr.APIKey
+    keyArr := []string{ reg.keyBase, keyId }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    valBin, err := reg.db.Get(keyBin)
+    if err != nil {
+        return descr, err
+    }
+    descr, err = dsdescr.UnpackAPIKey(valBin)
+    if err != nil {
+        return descr, err
+    }
+    return descr, err
+}
+
+func (reg *Reg) DeleteAPIKey(keyId string) error {
+    var err error
+    keyArr := []string{ reg.keyBase, keyId }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    err = reg.db.Delete(keyBin)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+// ListAPIKeys returns keys of the login, empty login means all keys
+func (reg *Reg) ListAPIKeys(login string) ([]*dsdescr.APIKey, error) {
+    var err error
+    descrs := make([]*dsdescr.APIKey, 0)
+    cb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var interr bool
+        descr, err := dsdescr.UnpackAPIKey(val)
+        if err != nil {
+            return interr, err
+        }
+        if len(login) == 0 || descr.Login == login {
+            descrs = append(descrs, descr)
+        }
+        return interr, err
+    }
+    keyKeyBaseBin := []byte(reg.keyBase + reg.sep)
+    err = reg.db.Iter(keyKeyBaseBin, cb)
+    if err != nil {
+        return descrs, err
+    }
+    return descrs, err
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+)
+
+func TestAPIKey01(t *testing.T) {
+    var err error
+    var has bool
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    descr0 := dsdescr.NewAPIKey()
+    descr0.KeyId        = "0a1b2c3d4e5f6071"
+    descr0.Login        = "qwerty"
+    descr0.Name         = "ci"
+    descr0.Hash         = []byte("0123456789")
+    descr0.ReadOnly     = true
+    descr0.PathPrefix   = "/ci"
+    descr0.CreatedAt    = 1657645101
+    descr0.UpdatedAt    = 1657645102
+
+    err = reg.PutAPIKey(descr0)
+    require.NoError(t, err)
+
+    descr2 := dsdescr.NewAPIKey()
+    descr2.KeyId        = "1a1b2c3d4e5f6071"
+    descr2.Login        = "admin"
+    err = reg.PutAPIKey(descr2)
+    require.NoError(t, err)
+
+    has, err = reg.HasAPIKey(descr0.KeyId)
+    require.NoError(t, err)
+    require.Equal(t, has, true)
+
+    descr1, err := reg.GetAPIKey(descr0.KeyId)
+    require.NoError(t, err)
+    require.Equal(t, descr0, descr1)
+
+    descrs, err := reg.ListAPIKeys(descr0.Login)
+    require.NoError(t, err)
+    require.Equal(t, len(descrs), 1)
+
+    descrs, err = reg.ListAPIKeys("")
+    require.NoError(t, err)
+    require.Equal(t, len(descrs), 2)
+
+    err = reg.DeleteAPIKey(descr0.KeyId)
+    require.NoError(t, err)
+
+    has, err = reg.HasAPIKey(descr0.KeyId)
+    require.NoError(t, err)
+    require.Equal(t, has, false)
+}
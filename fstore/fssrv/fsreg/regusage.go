@@ -0,0 +1,105 @@
+package fsreg
+
+import (
+    "strings"
+    "time"
+    "dstore/dscomm/dsdescr"
+)
+
+func (reg *Reg) PutUsage(descr *dsdescr.Usage) error {
+    var err error
+    keyArr := []string{ reg.usageBase, descr.Login }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    valBin, _ := descr.Pack()
+    err = reg.db.Put(keyBin, valBin)
+    return err
+}
+
+func (reg *Reg) HasUsage(login string) (bool, error) {
+    var err error
+    keyArr := []string{ reg.usageBase, login }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    has, err := reg.db.Has(keyBin)
+    if err != nil {
+        return has, err
+    }
+    return has, err
+}
+
+// GetUsage returns zero usage for the login without record
+func (reg *Reg) GetUsage(login string) (*dsdescr.Usage, error) {
+    var err error
+    descr := dsdescr.NewUsage()
+    descr.Login = login
+    keyArr := []string{ reg.usageBase, login }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    has, err := reg.db.Has(keyBin)
+    if err != nil {
+        return descr, err
+    }
+    if !has {
+        return descr, err
+    }
+    valBin, err := reg.db.Get(keyBin)
+    if err != nil {
+        return descr, err
+    }
+    descr, err = dsdescr.UnpackUsage(valBin)
+    if err != nil {
+        return descr, err
+    }
+    return descr, err
+}
+
+func (reg *Reg) DeleteUsage(login string) error {
+    var err error
+    keyArr := []string{ reg.usageBase, login }
+    keyBin := []byte(strings.Join(keyArr, reg.sep))
+    err = reg.db.Delete(keyBin)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+// RecountUsage rebuilds the usage of the login from file descrs,
+// trashed and uploading files are counted, old versions are not
+func (reg *Reg) RecountUsage(login string) (*dsdescr.Usage, error) {
+    var err error
+    reg.fileMtx.Lock()
+    defer reg.fileMtx.Unlock()
+
+    descr := dsdescr.NewUsage()
+    descr.Login = login
+    files, err := reg.ListFiles(login)
+    if err != nil {
+        return descr, err
+    }
+    for _, file := range files {
+        descr.DataSize += file.DataSize
+        descr.FileCount++
+    }
+    descr.UpdatedAt = time.Now().Unix()
+    err = reg.PutUsage(descr)
+    if err != nil {
+        return descr, err
+    }
+    return descr, err
+}
+
+// addUsage is called under usage mutex
+func (reg *Reg) addUsage(login string, sizeDelta, countDelta int64) error {
+    var err error
+    if sizeDelta == 0 && countDelta == 0 {
+        return err
+    }
+    descr, err := reg.GetUsage(login)
+    if err != nil {
+        return err
+    }
+    descr.DataSize  += sizeDelta
+    descr.FileCount += countDelta
+    descr.UpdatedAt = time.Now().Unix()
+    err = reg.PutUsage(descr)
+    return err
+}
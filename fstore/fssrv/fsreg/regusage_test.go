@@ -0,0 +1,76 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+)
+
+func TestUsage01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    has, err := reg.HasUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    usage, err := reg.GetUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, int64(0), usage.DataSize)
+
+    file := dsdescr.NewFile()
+    file.Login      = "qwerty"
+    file.FilePath   = "/a.txt"
+    file.DataSize   = 100
+    err = reg.PutFile(file)
+    require.NoError(t, err)
+
+    file.DataSize   = 150
+    err = reg.PutFile(file)
+    require.NoError(t, err)
+
+    file.FilePath   = "/b.txt"
+    file.DataSize   = 50
+    err = reg.PutFile(file)
+    require.NoError(t, err)
+
+    usage, err = reg.GetUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, int64(200), usage.DataSize)
+    require.Equal(t, int64(2), usage.FileCount)
+
+    err = reg.DeleteFile("qwerty", "/a.txt")
+    require.NoError(t, err)
+    err = reg.DeleteFile("qwerty", "/a.txt")
+    require.NoError(t, err)
+
+    usage, err = reg.GetUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, int64(50), usage.DataSize)
+    require.Equal(t, int64(1), usage.FileCount)
+
+    err = reg.DeleteUsage("qwerty")
+    require.NoError(t, err)
+    usage, err = reg.RecountUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, int64(50), usage.DataSize)
+    require.Equal(t, int64(1), usage.FileCount)
+
+    has, err = reg.HasUsage("qwerty")
+    require.NoError(t, err)
+    require.Equal(t, true, has)
+}
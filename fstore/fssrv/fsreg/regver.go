@@ -0,0 +1,89 @@
+package fsreg
+
+import (
+    "fmt"
+    "strings"
+    "dstore/dscomm/dsdescr"
+)
+
+func (reg *Reg) versionKey(login, filePath string, fileVer int64) []byte {
+    keyArr := []string{ reg.verBase, login, filePath, fmt.Sprintf("%016d", fileVer) }
+    return []byte(strings.Join(keyArr, reg.sep))
+}
+
+func (reg *Reg) PutVersion(descr *dsdescr.File) error {
+    var err error
+    keyBin := reg.versionKey(descr.Login, descr.FilePath, descr.FileVer)
+    valBin, _ := descr.Pack()
+    err = reg.db.Put(keyBin, valBin)
+    return err
+}
+
+func (reg *Reg) HasVersion(login, filePath string, fileVer int64) (bool, error) {
+    var err error
+    keyBin := reg.versionKey(login, filePath, fileVer)
+    has, err := reg.db.Has(keyBin)
+    if err != nil {
+        return has, err
+    }
+    return has, err
+}
+
+func (reg *Reg) GetVersion(login, filePath string, fileVer int64) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+    keyBin := reg.versionKey(login, filePath, fileVer)
+    valBin, err := reg.db.Get(keyBin)
+    if err != nil {
+        return descr, err
+    }
+    descr, err = dsdescr.UnpackFile(valBin)
+    if err != nil {
+        return descr, err
+    }
+    return descr, err
+}
+
+func (reg *Reg) DeleteVersion(login, filePath string, fileVer int64) error {
+    var err error
+    keyBin := reg.versionKey(login, filePath, fileVer)
+    err = reg.db.Delete(keyBin)
+    if err != nil {
+        return err
+    }
+    return err
+}
+
+// ListVersions returns versions of the file in ascending order,
+// empty file path means all versions of the user
+func (reg *Reg) ListVersions(login, filePath string) ([]*dsdescr.File, error) {
+    var err error
+    descrs := make([]*dsdescr.File, 0)
+
+    cb := func(key []byte, val []byte) (bool, error) {
+        var err error
+        var interr bool
+        descr, err := dsdescr.UnpackFile(val)
+        if err != nil {
+            return interr, err
+        }
+        // Prefix also matches paths with separator inside
+        if len(filePath) > 0 && descr.FilePath != filePath {
+            return interr, err
+        }
+        descrs = append(descrs, descr)
+        return interr, err
+    }
+
+    keyArr := []string{ reg.verBase, login }
+    if len(filePath) > 0 {
+        keyArr = append(keyArr, filePath)
+    }
+    keyStr := strings.Join(keyArr, reg.sep)
+    verBaseBin := []byte(keyStr + reg.sep)
+    err = reg.db.Iter(verBaseBin, cb)
+    if err != nil {
+        return descrs, err
+    }
+    return descrs, err
+}
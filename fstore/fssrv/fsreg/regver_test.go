@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fsreg
+
+import(
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+)
+
+func TestVersion01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "tmp.db")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := NewReg(db)
+    require.NoError(t, err)
+
+    paths := []string{ "/qwerty", "/qwerty:x", "/qwerty2" }
+    for _, path := range paths {
+        for _, ver := range []int64{ 12, 3, 1 } {
+            descr := dsdescr.NewFile()
+            descr.Login     = "admin"
+            descr.FilePath  = path
+            descr.FileId    = ver + 100
+            descr.FileVer   = ver
+            err = reg.PutVersion(descr)
+            require.NoError(t, err)
+        }
+    }
+
+    has, err := reg.HasVersion("admin", "/qwerty", 3)
+    require.NoError(t, err)
+    require.True(t, has)
+
+    descr, err := reg.GetVersion("admin", "/qwerty", 3)
+    require.NoError(t, err)
+    require.Equal(t, int64(103), descr.FileId)
+
+    descrs, err := reg.ListVersions("admin", "/qwerty")
+    require.NoError(t, err)
+    require.Equal(t, 3, len(descrs))
+    require.Equal(t, int64(1), descrs[0].FileVer)
+    require.Equal(t, int64(3), descrs[1].FileVer)
+    require.Equal(t, int64(12), descrs[2].FileVer)
+
+    descrs, err = reg.ListVersions("admin", "")
+    require.NoError(t, err)
+    require.Equal(t, 9, len(descrs))
+
+    err = reg.DeleteVersion("admin", "/qwerty", 3)
+    require.NoError(t, err)
+    has, err = reg.HasVersion("admin", "/qwerty", 3)
+    require.NoError(t, err)
+    require.False(t, has)
+}
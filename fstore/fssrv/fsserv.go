@@ -28,6 +28,7 @@ import (
     "dstore/dscomm/dserr"
     "dstore/dscomm/dsalloc"
     "dstore/dscomm/dsinter"
+    "dstore/dscomm/dssecret"
 )
 
 const successExit   int = 0
@@ -52,6 +53,7 @@ type Server struct {
     Backgr  bool
     fileIdAlloc dsinter.Alloc
     serv    *dsrpc.Service
+    store   *fstore.Store
 }
 
 func (server *Server) Execute() error {
@@ -469,6 +471,23 @@ func (server *Server) RunService() error {
 
     store.SetFilePerm(filePerm)
     store.SetDirPerm(dirPerm)
+    store.SetScrubRate(server.Params.ScrubRate * 1024)
+    store.SetScrubPause(time.Duration(server.Params.ScrubPause) * time.Second)
+    store.SetKeepVersions(server.Params.KeepVersions)
+    store.SetTrashPause(time.Duration(server.Params.TrashPause) * time.Second)
+    store.SetGCPause(time.Duration(server.Params.GCPause) * time.Second)
+    store.SetGCGrace(time.Duration(server.Params.GCGrace) * time.Second)
+    store.SetSessionTTL(time.Duration(server.Params.SessionTTL) * time.Second)
+    server.store = store
+
+    secretKey, err := dssecret.LoadKey(server.Params.SecretFile)
+    if err != nil {
+        return err
+    }
+    err = store.SetSecretKey(secretKey)
+    if err != nil {
+        return err
+    }
 
     err = store.SeedUsers()
     if err != nil {
@@ -478,17 +497,61 @@ func (server *Server) RunService() error {
     if err != nil {
         return err
     }
+    err = store.ReplayDrops()
+    if err != nil {
+        return err
+    }
 
     contr, err := fscont.NewContr(store)
     if err != nil {
         return err
     }
+    store.StartScrubber()
+    store.StartTrashCleaner()
+    store.StartCollector()
 
     dslog.LogInfof("dataDir is %s", server.Params.DataDir)
     dslog.LogInfof("logDir is %s", server.Params.LogDir)
     dslog.LogInfof("runDir is %s", server.Params.RunDir)
 
     server.serv = dsrpc.NewService()
+    server.serv.SetVerifierFunc(contr.UserVerifier)
+    server.serv.SetErrorCoder(contr.ErrorCode)
+    contr.SetLegacyAuth(server.Params.LegacyAuth)
+    if server.Params.LegacyAuth {
+        dslog.LogWarning("legacy salt and hash auth is enabled, captured auth of old clients can be replayed")
+    }
+
+    idleTimeout := time.Duration(server.Params.IdleTimeout) * time.Second
+    transferTimeout := time.Duration(server.Params.TransferTimeout) * time.Second
+    server.serv.SetIdleTimeout(idleTimeout)
+    server.serv.SetTransferTimeout(transferTimeout)
+    dsrpc.SetClientTimeout(transferTimeout)
+    server.serv.SetMaxConns(server.Params.MaxConns)
+    server.serv.SetMaxRPCSize(server.Params.MaxRPCSize)
+
+    if server.Params.TLS {
+        tlsConfig, err := dsrpc.NewServerTLSConfig(server.Params.TLSCert, server.Params.TLSKey,
+                                                            server.Params.TLSClientCA)
+        if err != nil {
+            return err
+        }
+        server.serv.SetTLSConfig(tlsConfig)
+        dslog.LogInfof("tls enabled, cert is %s", server.Params.TLSCert)
+    }
+    if server.Params.BStoreTLS {
+        var certPath, keyPath string
+        if server.Params.TLS {
+            certPath = server.Params.TLSCert
+            keyPath = server.Params.TLSKey
+        }
+        tlsConfig, err := dsrpc.NewClientTLSConfig(server.Params.BStoreCA, certPath, keyPath)
+        if err != nil {
+            return err
+        }
+        dsrpc.SetClientTLS(tlsConfig)
+        dslog.LogInfo("tls enabled for bstore connections")
+    }
 
     if debugMode || develMode {
         server.serv.PreMiddleware(dsrpc.LogRequest)
@@ -496,9 +559,20 @@ func (server *Server) RunService() error {
     server.serv.PreMiddleware(contr.AuthMidware(debugMode))
 
     server.serv.Handler(fsapi.SaveFileMethod, contr.SaveFileHandler)
+    server.serv.Handler(fsapi.StatFileMethod, contr.StatFileHandler)
+    server.serv.Handler(fsapi.ListVersionsMethod, contr.ListVersionsHandler)
+    server.serv.Handler(fsapi.RestoreVersionMethod, contr.RestoreVersionHandler)
+    server.serv.Handler(fsapi.ListTrashMethod, contr.ListTrashHandler)
+    server.serv.Handler(fsapi.RestoreTrashMethod, contr.RestoreTrashHandler)
+    server.serv.Handler(fsapi.PurgeTrashMethod, contr.PurgeTrashHandler)
+    server.serv.Handler(fsapi.MoveFileMethod, contr.MoveFileHandler)
+    server.serv.Handler(fsapi.MoveDirMethod, contr.MoveDirHandler)
+    server.serv.Handler(fsapi.CopyFileMethod, contr.CopyFileHandler)
     server.serv.Handler(fsapi.LoadFileMethod, contr.LoadFileHandler)
     server.serv.Handler(fsapi.FileStatsMethod, contr.FileStatsHandler)
     server.serv.Handler(fsapi.ListFilesMethod, contr.ListFilesHandler)
+    server.serv.Handler(fsapi.ListFilesStreamMethod, contr.ListFilesStreamHandler)
+    server.serv.Handler(fsapi.ListDirMethod, contr.ListDirHandler)
     server.serv.Handler(fsapi.DeleteFileMethod, contr.DeleteFileHandler)
     server.serv.Handler(fsapi.EraseFilesMethod, contr.EraseFilesHandler)
 
@@ -508,6 +582,18 @@ func (server *Server) RunService() error {
     server.serv.Handler(fsapi.ListUsersMethod, contr.ListUsersHandler)
     server.serv.Handler(fsapi.DeleteUserMethod, contr.DeleteUserHandler)
 
+    server.serv.Handler(fsapi.LoginMethod, contr.LoginHandler)
+    server.serv.Handler(fsapi.CreateKeyMethod, contr.CreateKeyHandler)
+    server.serv.Handler(fsapi.ListKeysMethod, contr.ListKeysHandler)
+    server.serv.Handler(fsapi.RevokeKeyMethod, contr.RevokeKeyHandler)
+
+    server.serv.Handler(fsapi.SetQuotaMethod, contr.SetQuotaHandler)
+    server.serv.Handler(fsapi.GetUsageMethod, contr.GetUsageHandler)
+
+    server.serv.Handler(fsapi.GrantAccessMethod, contr.GrantAccessHandler)
+    server.serv.Handler(fsapi.RevokeAccessMethod, contr.RevokeAccessHandler)
+    server.serv.Handler(fsapi.ListGrantsMethod, contr.ListGrantsHandler)
+
     server.serv.Handler(fsapi.AddBStoreMethod, contr.AddBStoreHandler)
     server.serv.Handler(fsapi.CheckBStoreMethod, contr.CheckBStoreHandler)
     server.serv.Handler(fsapi.UpdateBStoreMethod, contr.UpdateBStoreHandler)
@@ -515,6 +601,8 @@ func (server *Server) RunService() error {
     server.serv.Handler(fsapi.DeleteBStoreMethod, contr.DeleteBStoreHandler)
 
     server.serv.Handler(fsapi.GetStatusMethod, contr.GetStatusHandler)
+    server.serv.Handler(fsapi.ScrubStatusMethod, contr.ScrubStatusHandler)
+    server.serv.Handler(fsapi.RunGCMethod, contr.RunGCHandler)
 
     //if debugMode || develMode {
     //    server.serv.PostMiddleware(dsrpc.LogResponse)
@@ -545,6 +633,11 @@ func (server *Server) RunService() error {
 func (server *Server) StopAll() error {
     var err error
     dslog.LogInfo("stop processes")
+    if server.store != nil {
+        server.store.StopScrubber()
+        server.store.StopTrashCleaner()
+        server.store.StopCollector()
+    }
     if server.fileIdAlloc != nil {
         server.fileIdAlloc.Stop()
     }
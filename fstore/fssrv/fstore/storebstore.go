@@ -6,7 +6,6 @@ package fstore
 
 import (
     "errors"
-    "fmt"
     "regexp"
     "time"
     "dstore/dscomm/dsdescr"
@@ -15,6 +14,10 @@ import (
 
 func (store *Store) SeedBStores() error {
     var err error
+    err = store.migrateBStores()
+    if err != nil {
+        return dserr.Err(err)
+    }
 
     bStores, err := store.reg.ListBStores()
     if err != nil {
@@ -32,6 +35,10 @@ func (store *Store) SeedBStores() error {
     descr.CreatedAt = time.Now().Unix()
     descr.UpdatedAt = descr.CreatedAt
 
+    err = store.sealBStorePass(descr)
+    if err != nil {
+        return dserr.Err(err)
+    }
     for _, port := range ports {
         descr.Port = port
         err = store.reg.PutBStore(descr)
@@ -48,7 +55,7 @@ func (store *Store) AddBStore(login string, bstore *dsdescr.BStore) error {
 
     role, err := store.getUserRole(login)
     if role != dsdescr.URoleAdmin {
-        err = fmt.Errorf("insufficient rights for %s", login)
+        err = dserr.NewAccessError("insufficient rights for %s", login)
         return dserr.Err(err)
     }
 
@@ -67,14 +74,23 @@ func (store *Store) AddBStore(login string, bstore *dsdescr.BStore) error {
         return dserr.Err(err)
     }
     if has {
-        err = fmt.Errorf("address:port %s:%s exist", bstore.Address, bstore.Port)
+        err = dserr.NewExistsError("address:port %s:%s exist", bstore.Address, bstore.Port)
         return dserr.Err(err)
     }
-    bstore.State  = dsdescr.BSStateEnabled
-    bstore.CreatedAt = time.Now().Unix()
-    bstore.UpdatedAt = bstore.CreatedAt
-
-    err = store.reg.PutBStore(bstore)
+    ok, err = validateBSPass(bstore.Pass)
+    if !ok {
+        return dserr.Err(err)
+    }
+    newBStore := dsdescr.NewBStore()
+    *newBStore = *bstore
+    newBStore.State  = dsdescr.BSStateEnabled
+    newBStore.CreatedAt = time.Now().Unix()
+    newBStore.UpdatedAt = newBStore.CreatedAt
+    err = store.sealBStorePass(newBStore)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.reg.PutBStore(newBStore)
     if err != nil {
         return dserr.Err(err)
     }
@@ -104,7 +120,7 @@ func (store *Store) CheckBStore(authLogin, address, port, login, pass string) (b
 
     userRole, err := store.getUserRole(authLogin)
     if userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return ok, dserr.Err(err)
     }
 
@@ -113,7 +129,7 @@ func (store *Store) CheckBStore(authLogin, address, port, login, pass string) (b
         return ok, dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("bstore %s not exist", login)
+        err = dserr.NewNotFoundError("bstore %s not exist", login)
     }
     descr, err := store.reg.GetBStore(address, port)
     if err != nil {
@@ -123,7 +139,11 @@ func (store *Store) CheckBStore(authLogin, address, port, login, pass string) (b
         ok1 = true
     }
 
-    if pass == descr.Pass {
+    descrPass, err := store.openBStorePass(descr)
+    if err != nil {
+        return ok, dserr.Err(err)
+    }
+    if pass == descrPass {
         ok2 = true
     }
     ok = ok1 && ok2
@@ -140,7 +160,7 @@ func (store *Store) UpdateBStore(login string, bstore *dsdescr.BStore) error {
     // Set defaults
     // Rigth control
     if userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", login)
+        err = dserr.NewAccessError("user %s have insufficient rights", login)
         return dserr.Err(err)
     }
 
@@ -153,7 +173,7 @@ func (store *Store) UpdateBStore(login string, bstore *dsdescr.BStore) error {
     newBStore.Address     = oldBStore.Address
     newBStore.Port        = oldBStore.Port
     newBStore.Login       = oldBStore.Login
-    newBStore.Pass        = oldBStore.Pass
+    newBStore.Secret      = oldBStore.Secret
     newBStore.State       = oldBStore.State
     newBStore.CreatedAt   = oldBStore.CreatedAt
     newBStore.UpdatedAt   = time.Now().Unix()
@@ -193,8 +213,14 @@ func (store *Store) UpdateBStore(login string, bstore *dsdescr.BStore) error {
     if !ok {
         return dserr.Err(err)
     }
-    ok, err = validateBSPass(newBStore.Pass)
-    if !ok {
+    if len(bstore.Pass) > 0 || len(newBStore.Secret) == 0 {
+        ok, err = validateBSPass(newBStore.Pass)
+        if !ok {
+            return dserr.Err(err)
+        }
+    }
+    err = store.sealBStorePass(newBStore)
+    if err != nil {
         return dserr.Err(err)
     }
     // Delete old bstore descr
@@ -216,7 +242,7 @@ func (store *Store) ListBStores(authLogin, regular string) ([]*dsdescr.BStore, e
     resDescrs := make([]*dsdescr.BStore, 0)
     userRole, err := store.getUserRole(authLogin)
     if userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return resDescrs, dserr.Err(err)
     }
 
@@ -225,7 +251,9 @@ func (store *Store) ListBStores(authLogin, regular string) ([]*dsdescr.BStore, e
         return resDescrs, dserr.Err(err)
     }
     if len(regular) == 0 {
-        resDescrs = descrs
+        for _, descr := range descrs {
+            resDescrs = append(resDescrs, stripBStore(descr))
+        }
         return resDescrs, dserr.Err(err)
     }
     re, err := regexp.CompilePOSIX(regular)
@@ -235,7 +263,7 @@ func (store *Store) ListBStores(authLogin, regular string) ([]*dsdescr.BStore, e
     for _, descr := range descrs {
         ok := re.Match([]byte(descr.Address))
         if ok {
-            resDescrs = append(resDescrs, descr)
+            resDescrs = append(resDescrs, stripBStore(descr))
         }
     }
     return resDescrs, dserr.Err(err)
@@ -246,7 +274,7 @@ func (store *Store) DeleteBStore(login string, address, port string) error {
 
     userRole, err := store.getUserRole(login)
     if userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", login)
+        err = dserr.NewAccessError("user %s have insufficient rights", login)
         return dserr.Err(err)
     }
 
@@ -53,11 +53,14 @@ func TestBStore01(t *testing.T) {
     descrs, err := store.ListBStores(adminLogin, "")
     require.NoError(t, err)
     require.Equal(t, len(descrs), 1)
+    require.Empty(t, descrs[0].Secret)
 
     has, descr1, err := store.GetBStore(descr0.Address, descr0.Port)
     require.NoError(t, err)
     require.Equal(t, has, true)
-    require.Equal(t, descr0, descr1)
+    require.Equal(t, descr0.Login, descr1.Login)
+    require.Equal(t, "", descr1.Pass)
+    require.NotEmpty(t, descr1.Secret)
 
     var ok bool
     ok, err = store.CheckBStore(adminLogin, descr0.Address, descr0.Port, descr0.Login, descr0.Pass)
@@ -5,9 +5,14 @@
 package fstore
 
 import (
+    "context"
     "io/fs"
+    "sync"
     "time"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
     "dstore/dscomm/dsinter"
+    "dstore/dscomm/dssecret"
 )
 
 type Store struct {
@@ -18,6 +23,42 @@ type Store struct {
     startTime   int64
 
     fileAlloc   dsinter.Alloc
+
+    refMtx      sync.Mutex
+    fileRefs    map[int64]int64
+    dropped     map[int64]*dsdescr.File
+    writers     map[int64]bool
+    crates      map[int64][]string
+    keepVers    int64
+
+    quotaMtx    sync.Mutex
+    reserved    map[string]int64
+
+    secretBox   *dssecret.Box
+    tokenKey    []byte
+    sessionTTL  time.Duration
+
+    scrubRate   int64
+    scrubPause  time.Duration
+    scrubMtx    sync.Mutex
+    scrubStat   *dsdescr.ScrubStatus
+    scrubCtx    context.Context
+    scrubCancel context.CancelFunc
+    scrubWg     sync.WaitGroup
+
+    trashPause  time.Duration
+    trashMtx    sync.Mutex
+    trashCtx    context.Context
+    trashCancel context.CancelFunc
+    trashWg     sync.WaitGroup
+
+    gcPause     time.Duration
+    gcGrace     time.Duration
+    gcMtx       sync.Mutex
+    gcRunMtx    sync.Mutex
+    gcCtx       context.Context
+    gcCancel    context.CancelFunc
+    gcWg        sync.WaitGroup
 }
 
 func NewStore(dataDir string, reg dsinter.FStoreReg, fileAlloc dsinter.Alloc) (*Store, error) {
@@ -29,9 +70,48 @@ func NewStore(dataDir string, reg dsinter.FStoreReg, fileAlloc dsinter.Alloc) (*
     store.dirPerm   = 0755
     store.filePerm  = 0644
     store.startTime = time.Now().Unix()
+
+    store.fileRefs  = make(map[int64]int64)
+    store.dropped   = make(map[int64]*dsdescr.File)
+    store.writers   = make(map[int64]bool)
+    store.crates    = make(map[int64][]string)
+    store.keepVers  = 5
+    store.reserved  = make(map[string]int64)
+
+    // Ephemeral key, server sets the persistent one before use of bstores
+    store.secretBox, err = dssecret.NewBox(dssecret.NewKey())
+    if err != nil {
+        return &store, dserr.Err(err)
+    }
+    store.tokenKey   = dssecret.NewKey()
+    store.sessionTTL = 3600 * time.Second
+
+    store.scrubPause = 3600 * time.Second
+    store.scrubStat  = dsdescr.NewScrubStatus()
+    store.scrubCtx, store.scrubCancel = context.WithCancel(context.Background())
+
+    store.trashPause = 3600 * time.Second
+    store.trashCtx, store.trashCancel = context.WithCancel(context.Background())
+
+    store.gcPause = 3600 * 6 * time.Second
+    store.gcGrace = 3600 * 24 * time.Second
+    store.gcCtx, store.gcCancel = context.WithCancel(context.Background())
     return &store, err
 }
 
+// SetSecretKey sets the key for sealing of bstore passwords
+// and for signing of session tokens
+func (store *Store) SetSecretKey(key []byte) error {
+    var err error
+    secretBox, err := dssecret.NewBox(key)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    store.secretBox = secretBox
+    store.tokenKey = dssecret.DeriveKey(key, "session token")
+    return dserr.Err(err)
+}
+
 func (store *Store) SetDirPerm(dirPerm fs.FileMode) {
     store.dirPerm = dirPerm
 }
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "path/filepath"
+    "time"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+    "dstore/fstore/fssrv/fsfile"
+)
+
+// CopyFile makes new file which shares local crates with the source.
+// Crate is copied only when one of files modifies or deletes the block,
+// bstore replicas are made for each file separately.
+func (store *Store) CopyFile(login, filePath, destPath string) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+
+    destOwner, destPath, err := store.resolvePath(login, destPath, true)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if isServicePath(destPath) {
+        err = fmt.Errorf("path %s is in service directory", destPath)
+        return descr, dserr.Err(err)
+    }
+    has, err := store.reg.HasFile(destOwner, destPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if has {
+        err = dserr.NewExistsError("file %s already exist", destPath)
+        return descr, dserr.Err(err)
+    }
+    srcDescr, err := store.HoldFile(login, filePath, 0)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    defer store.ReleaseFile(srcDescr)
+
+    err = store.reserveQuota(destOwner, srcDescr.DataSize, true)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    defer store.releaseQuota(destOwner, srcDescr.DataSize)
+
+    // Shared crates must be local
+    err = store.restoreBlocks(srcDescr.FileId)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    fileId, err := store.fileAlloc.NewId()
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    randBin := make([]byte, 16)
+    rand.Read(randBin)
+    randStr := hex.EncodeToString(randBin)
+    tmpFilePath := filepath.Join("/.tmp/", randStr, destPath)
+
+    descr = dsdescr.NewFile()
+    *descr = *srcDescr
+    descr.FilePath  = tmpFilePath
+    descr.Login     = destOwner
+    descr.FileId    = fileId
+    descr.FileVer   = 1
+    descr.CreatedAt = time.Now().Unix()
+    descr.UpdatedAt = descr.CreatedAt
+
+    // Held tmp file is not expired by collector during copy
+    store.refMtx.Lock()
+    store.fileRefs[fileId]++
+    store.refMtx.Unlock()
+    defer store.ReleaseFile(descr)
+    err = store.reg.PutFile(descr)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    err = store.copyBlocks(srcDescr.FileId, fileId)
+    if err != nil {
+        dropErr := store.dropFile(descr)
+        if dropErr != nil {
+            dslog.LogErrorf("cannot drop incomplete copy %s: %v", tmpFilePath, dropErr)
+        }
+        return descr, dserr.Err(err)
+    }
+    store.refMtx.Lock()
+    descr, err = store.reg.MoveFile(destOwner, tmpFilePath, destPath)
+    store.refMtx.Unlock()
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    err = store.replicateFile(fileId)
+    if err != nil {
+        dslog.LogDebugf("replication error %s,%s: %v", destOwner, destPath, err)
+        err = nil
+    }
+    descr, err = store.reg.GetFile(destOwner, destPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    return descr, dserr.Err(err)
+}
+
+// copyBlocks puts batch and block descrs of the source file with new file id,
+// every crate of the source gets one more ref
+func (store *Store) copyBlocks(srcFileId, fileId int64) error {
+    var err error
+    batchDescrs, err := store.reg.ListBatchs(srcFileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, batchDescr := range batchDescrs {
+        batchDescr.FileId = fileId
+        err = store.reg.PutBatch(batchDescr)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    blockDescrs, err := store.reg.ListBlocks(srcFileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, blockDescr := range blockDescrs {
+        if blockDescr.DataSize > 0 {
+            err = store.reg.RefCrate(blockDescr.FilePath)
+            if err != nil {
+                return dserr.Err(err)
+            }
+            // Source block can be rewritten before the ref is taken
+            if !store.hasCrate(blockDescr) {
+                store.reg.UnrefCrate(blockDescr.FilePath)
+                err = fmt.Errorf("block %d,%d,%d,%d changed during copy", blockDescr.FileId,
+                                blockDescr.BatchId, blockDescr.BlockType, blockDescr.BlockId)
+                return dserr.Err(err)
+            }
+        }
+        blockDescr.FileId     = fileId
+        blockDescr.HasRemote  = false
+        blockDescr.BStoreAddr = ""
+        blockDescr.BStorePort = ""
+        err = store.reg.PutBlock(blockDescr)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) hasCrate(descr *dsdescr.Block) bool {
+    block, err := fsfile.OpenBlock(store.dataDir, store.reg, descr)
+    if err != nil {
+        return false
+    }
+    return block.HasCrate()
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "bytes"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestCopy01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024 * 256
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    srcDescr, err := store.SaveFile(context.Background(), "user", "/src.bin", bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+
+    descr, err := store.CopyFile("user", "/src.bin", "/copy.bin")
+    require.NoError(t, err)
+    require.Equal(t, "/copy.bin", descr.FilePath)
+    require.NotEqual(t, srcDescr.FileId, descr.FileId)
+
+    _, err = store.CopyFile("user", "/src.bin", "/copy.bin")
+    require.Error(t, err)
+    _, err = store.CopyFile("user", "/src.bin", "/.tmp/copy.bin")
+    require.Error(t, err)
+
+    // Crates are shared, not copied
+    srcBlocks, err := reg.ListBlocks(srcDescr.FileId)
+    require.NoError(t, err)
+    copyBlocks, err := reg.ListBlocks(descr.FileId)
+    require.NoError(t, err)
+    require.Equal(t, len(srcBlocks), len(copyBlocks))
+    crates := make(map[string]bool)
+    for _, block := range srcBlocks {
+        if block.DataSize > 0 {
+            crates[block.FilePath] = true
+        }
+    }
+    for _, block := range copyBlocks {
+        if block.DataSize > 0 {
+            require.True(t, crates[block.FilePath])
+        }
+    }
+
+    usage, err := store.GetUsage("user", "")
+    require.NoError(t, err)
+    require.Equal(t, 2 * dataSize, usage.DataSize)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "user", "/copy.bin", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    // Modified copy does not change the source
+    tail := make([]byte, 1024)
+    rand.Read(tail)
+    _, err = store.AppendFile(context.Background(), "user", "/copy.bin", dataSize, bytes.NewReader(tail), int64(len(tail)))
+    require.NoError(t, err)
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "user", "/src.bin", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    // Deleted source does not remove shared crates
+    _, err = store.DeleteFile("user", "/src.bin")
+    require.NoError(t, err)
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "user", "/copy.bin", writer)
+    require.NoError(t, err)
+    require.Equal(t, append(buffer, tail...), writer.Bytes())
+
+    // Last owner removes the crates
+    _, err = store.DeleteFile("user", "/copy.bin")
+    require.NoError(t, err)
+    for filePath := range crates {
+        _, err = os.Stat(filepath.Join(dataDir, filePath))
+        require.True(t, os.IsNotExist(err))
+        refs, err := reg.CrateRefs(filePath)
+        require.NoError(t, err)
+        require.Equal(t, int64(1), refs)
+    }
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+)
+
+const listDirLimit int = 1000
+
+// ListDir returns one page of the directory entries of own or shared
+// directory, empty next token means the last page
+func (store *Store) ListDir(login, dirPath, token string, limit int) ([]*dsdescr.DirEntry, string, error) {
+    var err error
+    var next string
+    entries := make([]*dsdescr.DirEntry, 0)
+
+    owner, dirPath, prefixes, err := store.resolvePattern(login, dirPath, false)
+    if err != nil {
+        return entries, next, dserr.Err(err)
+    }
+    dirPath = cleanPath(dirPath)
+    if limit < 1 || limit > listDirLimit {
+        limit = listDirLimit
+    }
+    var filter func(filePath string) bool
+    if prefixes != nil {
+        filter = func(filePath string) bool {
+            return inPrefixes(prefixes, filePath)
+        }
+    }
+    entries, next, err = store.reg.ListDir(owner, dirPath, token, limit, filter)
+    if err != nil {
+        return entries, next, dserr.Err(err)
+    }
+    return entries, next, dserr.Err(err)
+}
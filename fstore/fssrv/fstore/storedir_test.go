@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "bytes"
+    "math/rand"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestDir01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    user := dsdescr.NewUser()
+    user.Login  = "devel"
+    user.Pass   = "devel"
+    err = store.AddUser("admin", user)
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    for _, filePath := range []string{ "/top.bin", "/builds/a.tgz", "/builds/old/b.tgz", "/private/key.pem" } {
+        _, err = store.SaveFile(context.Background(), "user", filePath, bytes.NewReader(buffer), dataSize)
+        require.NoError(t, err)
+    }
+
+    entries, next, err := store.ListDir("user", "/", "", 0)
+    require.NoError(t, err)
+    require.Equal(t, "", next)
+    require.Equal(t, 3, len(entries))
+    require.Equal(t, "builds", entries[0].Name)
+    require.Equal(t, true, entries[0].IsDir)
+    require.Equal(t, int64(2), entries[0].FileCount)
+    require.Equal(t, 2 * dataSize, entries[0].DataSize)
+
+    entries, next, err = store.ListDir("user", "builds/", "", 1)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(entries))
+    require.Equal(t, "a.tgz", next)
+    entries, next, err = store.ListDir("user", "builds/", next, 1)
+    require.NoError(t, err)
+    require.Equal(t, "old", entries[0].Name)
+    require.Equal(t, "", next)
+
+    // Shared listing shows only granted files
+    _, _, err = store.ListDir("devel", "user:/", "", 0)
+    require.Error(t, err)
+
+    grant := dsdescr.NewGrant()
+    grant.PathPrefix    = "/builds/old"
+    grant.Grantee       = "devel"
+    err = store.GrantAccess("user", grant)
+    require.NoError(t, err)
+
+    entries, _, err = store.ListDir("devel", "user:/", "", 0)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(entries))
+    require.Equal(t, "builds", entries[0].Name)
+    require.Equal(t, int64(1), entries[0].FileCount)
+}
@@ -5,10 +5,14 @@
 package fstore
 
 import (
+    "context"
+    "encoding/json"
     "fmt"
     "io"
+    "math"
     "path/filepath"
     "regexp"
+    "strings"
     "math/rand"
     "encoding/hex"
 
@@ -17,41 +21,83 @@ import (
     "dstore/fstore/fssrv/fsfile"
     "dstore/dscomm/dserr"
     "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dsinter"
     "dstore/dscomm/dslog"
 )
 
-func (store *Store) SaveFile(login string, filePath string, fileReader io.Reader, fileSize int64) (*dsdescr.File, error) {
+// SaveFile saves new file, negative size means the stream
+// of unknown size which is read up to EOF
+func (store *Store) SaveFile(ctx context.Context, login string, filePath string, fileReader io.Reader, fileSize int64) (*dsdescr.File, error) {
+    return store.saveFile(ctx, login, filePath, fileReader, fileSize, false)
+}
+
+// ReplaceFile saves new version of the file, the old one is replaced only
+// after the new one is completely received
+func (store *Store) ReplaceFile(ctx context.Context, login string, filePath string, fileReader io.Reader, fileSize int64) (*dsdescr.File, error) {
+    return store.saveFile(ctx, login, filePath, fileReader, fileSize, true)
+}
+
+func (store *Store) saveFile(ctx context.Context, login string, filePath string, fileReader io.Reader, fileSize int64, overwrite bool) (*dsdescr.File, error) {
     var err error
     var has bool
     var descr *dsdescr.File
 
-    filePath = cleanPath(filePath)
+    login, filePath, err = store.resolvePath(login, filePath, true)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
     has, err = store.reg.HasFile(login, filePath)
     if err != nil {
         return descr, dserr.Err(err)
     }
-    if has {
+    if has && !overwrite {
         descr, err = store.reg.GetFile(login, filePath)
         if err != nil {
             return descr, dserr.Err(err)
         }
-        err = fmt.Errorf("file %s already exist", filePath)
+        err = dserr.NewExistsError("file %s already exist", filePath)
+        return descr, dserr.Err(err)
+    }
+    // Reserve quota, overwritten file returns its size.
+    // Stream of unknown size reserves the quota while it is read.
+    unknownSize := fileSize < 0
+    sizeDelta := fileSize
+    if has && !unknownSize {
+        oldDescr, err := store.reg.GetFile(login, filePath)
+        if err != nil {
+            return descr, dserr.Err(err)
+        }
+        sizeDelta -= oldDescr.DataSize
+    }
+    if unknownSize {
+        sizeDelta = 0
+    }
+    err = store.reserveQuota(login, sizeDelta, !has)
+    if err != nil {
         return descr, dserr.Err(err)
     }
+    defer store.releaseQuota(login, sizeDelta)
+    qreader := newQuotaReader(store, fileReader, login, fileSize, sizeDelta)
+    defer qreader.release()
+    fileReader = qreader
 
     var batchSize   int64 = 5
     var blockSize   int64 = 1024 * 1024 * 8
+    var recoCount   int64 = 2
 
-    if fileSize < blockSize * batchSize {
+    if !unknownSize && fileSize < blockSize * batchSize {
         blockSize = fileSize / batchSize
         rs := int64(1024 * 16)
         bs := blockSize / rs
         blockSize = (bs + 1) * rs
     }
 
-    if fileSize < blockSize * batchSize {
+    if !unknownSize && fileSize < blockSize * batchSize {
         batchSize = fileSize / blockSize + 1
     }
+    if unknownSize {
+        fileSize = math.MaxInt64
+    }
 
     // Get file id
     fileId, err := store.fileAlloc.NewId()
@@ -66,17 +112,23 @@ func (store *Store) SaveFile(login string, filePath string, fileReader io.Reader
     tmpFilePath := filepath.Join("/.tmp/", randStr, filePath)
 
     // Create file object
-    file, err := fsfile.NewFile(store.dataDir, store.reg, login, tmpFilePath, fileId, batchSize, blockSize)
+    file, err := fsfile.NewFile(store.dataDir, store.reg, login, tmpFilePath, fileId, batchSize, blockSize, recoCount)
     if err != nil {
         return descr, dserr.Err(err)
     }
+    file.SetFileVer(1)
+    // Held tmp file is not expired by collector during upload
+    store.refMtx.Lock()
+    store.fileRefs[fileId]++
+    store.refMtx.Unlock()
+    defer store.ReleaseFile(file.Descr())
     // Save file descr with tmp name
     descr = file.Descr()
     err = store.reg.PutFile(descr)
     if err != nil {
         return descr, dserr.Err(err)
     }
-    _, eof, err := file.Write(fileReader, fileSize)
+    written, eof, err := file.Write(ctx, fileReader, fileSize)
     if err == io.EOF {
         err = nil
         eof = true
@@ -87,29 +139,149 @@ func (store *Store) SaveFile(login string, filePath string, fileReader io.Reader
     if eof {
         dslog.LogDebugf("eof for %s,%s", login, filePath)
     }
-    // Save descr with new name
+    if dserr.IsQuota(err) || (overwrite || unknownSize) && err != nil ||
+                                overwrite && !unknownSize && written != fileSize {
+        // Incomplete version never replaces the old one, the file cut off
+        // by quota and broken stream of unknown size are not kept
+        if err == nil {
+            err = fmt.Errorf("file %s received only %d of %d", filePath, written, fileSize)
+        }
+        dropErr := store.dropFile(file.Descr())
+        if dropErr != nil {
+            dslog.LogErrorf("cannot drop incomplete file %s: %v", tmpFilePath, dropErr)
+        }
+        return descr, dserr.Err(err)
+    }
+    // Save descr with new name and delete old descr with tmp name
     file.SetFilePath(filePath)
     descr = file.Descr()
-
-    err = store.reg.PutFile(descr)
+    switch overwrite {
+        case true:
+            err = store.replaceFile(descr, tmpFilePath)
+            if err != nil {
+                return descr, dserr.Err(err)
+            }
+        default:
+            err = store.reg.PutFile(descr)
+            if err != nil {
+                return descr, dserr.Err(err)
+            }
+            err = store.reg.DeleteFile(login, tmpFilePath)
+            if err != nil {
+                return descr, dserr.Err(err)
+            }
+    }
+    // Check descr
+    has, err = store.reg.HasFile(login, filePath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if !has {
+        err = fmt.Errorf("file %s not saved", filePath)
+        return descr, dserr.Err(err)
+    }
+    // Push blocks to bstores, local copy stays the primary one
+    err = store.replicateFile(descr.FileId)
+    if err != nil {
+        dslog.LogDebugf("replication error %s,%s: %v", login, filePath, err)
+        err = nil
+    }
+    // Return saved descr
+    descr, err = store.reg.GetFile(login, filePath)
     if err != nil {
         return descr, dserr.Err(err)
     }
-    // Delete old descr with tmp name
-    err = store.reg.DeleteFile(login, tmpFilePath)
+    return descr, dserr.Err(err)
+}
+
+// AppendFile writes the data to the end of existing file, the offset must be
+// equal to current file size. Missing file is saved as new one.
+// The append of the file being written is refused.
+func (store *Store) AppendFile(ctx context.Context, login string, filePath string, offset int64, fileReader io.Reader, fileSize int64) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+
+    login, filePath, err = store.resolvePath(login, filePath, true)
     if err != nil {
         return descr, dserr.Err(err)
     }
-    // Check descr
-    has, err = store.reg.HasFile(login, filePath)
+    has, err := store.reg.HasFile(login, filePath)
     if err != nil {
         return descr, dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("file %s not saved", filePath)
+        if offset != 0 {
+            err = dserr.NewNotFoundError("file %s not exist", filePath)
+            return descr, dserr.Err(err)
+        }
+        return store.SaveFile(ctx, login, filePath, fileReader, fileSize)
+    }
+    descr, err = store.holdWriter(login, filePath)
+    if err != nil {
         return descr, dserr.Err(err)
     }
-    // Return saved descr
+    defer store.releaseWriter(descr)
+    if descr.DataSize != offset {
+        err = fmt.Errorf("file %s size %d mismatch offset %d", filePath, descr.DataSize, offset)
+        return descr, dserr.Err(err)
+    }
+    sizeDelta := fileSize
+    if fileSize < 0 {
+        sizeDelta = 0
+    }
+    err = store.reserveQuota(login, sizeDelta, false)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    defer store.releaseQuota(login, sizeDelta)
+    qreader := newQuotaReader(store, fileReader, login, fileSize, sizeDelta)
+    defer qreader.release()
+    fileReader = qreader
+    if fileSize < 0 {
+        fileSize = math.MaxInt64
+    }
+
+    err = store.restoreBlocks(descr.FileId)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    file, err := fsfile.OpenFile(store.dataDir, store.reg, descr)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    // Readers of the file read replaced crates until release
+    fileId := descr.FileId
+    keep := func(crate string) {
+        store.keepCrate(fileId, crate)
+    }
+    file.KeepCrates(keep)
+    _, eof, err := file.Write(ctx, fileReader, fileSize)
+    if err == io.EOF {
+        err = nil
+        eof = true
+    }
+    if err != nil   {
+        dslog.LogDebugf("write error %s,%s: %v", login, filePath, err)
+    }
+    if eof {
+        dslog.LogDebugf("eof for %s,%s", login, filePath)
+    }
+    // Received part is kept even when the transfer was broken
+    // or was cut off by quota
+    writeErr := err
+    descr = file.Descr()
+    err = store.reg.PutFile(descr)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if dserr.IsQuota(writeErr) {
+        return descr, dserr.Err(writeErr)
+    }
+    err = store.replicateFile(descr.FileId)
+    if err != nil {
+        dslog.LogDebugf("replication error %s,%s: %v", login, filePath, err)
+        err = nil
+    }
     descr, err = store.reg.GetFile(login, filePath)
     if err != nil {
         return descr, dserr.Err(err)
@@ -117,17 +289,42 @@ func (store *Store) SaveFile(login string, filePath string, fileReader io.Reader
     return descr, dserr.Err(err)
 }
 
+func (store *Store) StatFile(login string, filePath string) (bool, *dsdescr.File, error) {
+    var err error
+    var has bool
+    var descr *dsdescr.File
+    login, filePath, err = store.resolvePath(login, filePath, false)
+    if err != nil {
+        return has, descr, dserr.Err(err)
+    }
+    has, err = store.reg.HasFile(login, filePath)
+    if err != nil {
+        return has, descr, dserr.Err(err)
+    }
+    if !has {
+        return has, descr, dserr.Err(err)
+    }
+    descr, err = store.reg.GetFile(login, filePath)
+    if err != nil {
+        return has, descr, dserr.Err(err)
+    }
+    return has, descr, dserr.Err(err)
+}
+
 func (store *Store) HasFile(login string, filePath string) (bool, *dsdescr.File, error) {
     var err error
     var has bool
     var descr *dsdescr.File
-    filePath = cleanPath(filePath)
+    login, filePath, err = store.resolvePath(login, filePath, false)
+    if err != nil {
+        return has, descr, dserr.Err(err)
+    }
     has, err = store.reg.HasFile(login, filePath)
     if err != nil {
         return has, descr, dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("file %s not exist", filePath)
+        err = dserr.NewNotFoundError("file %s not exist", filePath)
         return has, descr, dserr.Err(err)
     }
     descr, err = store.reg.GetFile(login, filePath)
@@ -137,18 +334,29 @@ func (store *Store) HasFile(login string, filePath string) (bool, *dsdescr.File,
     return has, descr, dserr.Err(err)
 }
 
-func (store *Store) LoadFile(login string, filePath string, fileWriter io.Writer) error {
+func (store *Store) LoadFile(ctx context.Context, login string, filePath string, fileWriter io.Writer) error {
+    return store.LoadFileRange(ctx, login, filePath, 0, 0, fileWriter)
+}
+
+// LoadFileRange writes length bytes of the file from offset, zero length means up to end of file
+func (store *Store) LoadFileRange(ctx context.Context, login string, filePath string, offset, length int64, fileWriter io.Writer) error {
     var err error
-    filePath = cleanPath(filePath)
-    has, err := store.reg.HasFile(login, filePath)
+    descr, err := store.HoldFile(login, filePath, 0)
     if err != nil {
         return dserr.Err(err)
     }
-    if !has {
-        err = fmt.Errorf("file %s not exist", filePath)
+    defer store.ReleaseFile(descr)
+    err = store.ReadFile(ctx, descr, offset, length, fileWriter)
+    if err != nil {
         return dserr.Err(err)
     }
-    descr, err := store.reg.GetFile(login, filePath)
+    return dserr.Err(err)
+}
+
+// ReadFile writes the range of the file held by HoldFile
+func (store *Store) ReadFile(ctx context.Context, descr *dsdescr.File, offset, length int64, fileWriter io.Writer) error {
+    var err error
+    err = store.restoreBlocks(descr.FileId)
     if err != nil {
         return dserr.Err(err)
     }
@@ -156,18 +364,26 @@ func (store *Store) LoadFile(login string, filePath string, fileWriter io.Writer
     if err != nil {
         return dserr.Err(err)
     }
-    _, err = file.Read(fileWriter)
+    _, err = file.ReadRange(ctx, fileWriter, offset, length)
     if err != nil {
         return dserr.Err(err)
     }
     return dserr.Err(err)
 }
 
+// RangeSize returns size of the file data range
+func (store *Store) RangeSize(descr *dsdescr.File, offset, length int64) (int64, error) {
+    return fsfile.RangeSize(descr.DataSize, offset, length)
+}
+
 
 func (store *Store) DeleteFile(login string, filePath string) (*dsdescr.File, error) {
     var err error
     var fileDescr *dsdescr.File
-    filePath = cleanPath(filePath)
+    login, filePath, err = store.resolvePath(login, filePath, true)
+    if err != nil {
+        return fileDescr, dserr.Err(err)
+    }
     has, err := store.reg.HasFile(login, filePath)
     if err != nil {
         return fileDescr, dserr.Err(err)
@@ -186,55 +402,146 @@ func (store *Store) DeleteFile(login string, filePath string) (*dsdescr.File, er
     return fileDescr, dserr.Err(err)
 }
 
-func (store *Store) FileStats(login, pattern, regular, gPattern string, reader io.Reader) (int64, int64, error) {
+// FileStats returns count and size of matched files, the limit and the start
+// path select one page of files as for listing
+func (store *Store) FileStats(ctx context.Context, login, pattern, regular, gPattern, startAfter string, limit int) (int64, int64, string, error) {
     var err error
     var usage int64
     var count int64
     cb := func(descr *dsdescr.File) error {
         var err error
+        usage += descr.DataSize
+        count++
         return err
     }
-
-    descrs, err := store.loopFiles(login, pattern, regular, gPattern, cb, reader)
+    snap, err := store.reg.Snapshot()
     if err != nil {
-        return count, usage, err
+        return count, usage, "", dserr.Err(err)
     }
-    for _, descr := range descrs {
-        usage += descr.DataSize
-        count++
+    defer snap.Release()
+    next, err := store.walkFiles(ctx, snap, login, pattern, regular, gPattern, startAfter, limit, false, cb)
+    if err != nil {
+        return count, usage, next, err
     }
-    return count, usage, err
+    return count, usage, next, err
 }
 
 type loopFunc = func(descr *dsdescr.File) error
 
-func (store *Store) EraseFiles(login, pattern, regular, gPattern string, erase bool, reader io.Reader) ([]*dsdescr.File, error) {
+func (store *Store) EraseFiles(ctx context.Context, login, pattern, regular, gPattern, startAfter string, limit int, erase bool) ([]*dsdescr.File, string, error) {
+    // Files are only listed without any filter
+    _, ownPattern, _, err := store.resolvePattern(login, pattern, erase)
+    if err != nil {
+        return make([]*dsdescr.File, 0), "", dserr.Err(err)
+    }
+    filtered := len(ownPattern) > 0 || len(regular) > 0 || len(gPattern) > 0
     cb := func(descr *dsdescr.File) error {
         var err error
-        if erase {
+        if erase && filtered {
             store.deleteFile(descr)
             dslog.LogDebugf("delete file %s", descr.FilePath)
         }
         return err
     }
-    return store.loopFiles(login, pattern, regular, gPattern, cb, reader)
+    return store.loopFiles(ctx, login, pattern, regular, gPattern, startAfter, limit, erase, cb)
 }
 
-func (store *Store) ListFiles(login, pattern, regular, gPattern string, reader io.Reader) ([]*dsdescr.File, error) {
+func (store *Store) ListFiles(ctx context.Context, login, pattern, regular, gPattern, startAfter string, limit int) ([]*dsdescr.File, string, error) {
     cb := func(descr *dsdescr.File) error {
         var err error
         return err
     }
-    return store.loopFiles(login, pattern, regular, gPattern, cb, reader)
+    return store.loopFiles(ctx, login, pattern, regular, gPattern, startAfter, limit, false, cb)
 }
 
-func (store *Store) loopFiles(login, pattern, regular, gPattern string, callback loopFunc, reader io.Reader) ([]*dsdescr.File, error) {
+// StreamHead receives the count and the total size of records before
+// the records are written
+type StreamHead = func(count, size int64, next string) error
+
+// StreamFiles writes matched files as newline-delimited json records.
+// Both passes go over one snapshot, so the size sent ahead is exact.
+func (store *Store) StreamFiles(ctx context.Context, login, pattern, regular, gPattern, startAfter string, limit int, headCb StreamHead, writer io.Writer) error {
     var err error
+    var count int64
+    var size int64
+    snap, err := store.reg.Snapshot()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    defer snap.Release()
 
+    sizeCb := func(descr *dsdescr.File) error {
+        var err error
+        record, err := json.Marshal(descr)
+        if err != nil {
+            return err
+        }
+        size += int64(len(record) + 1)
+        count++
+        return err
+    }
+    next, err := store.walkFiles(ctx, snap, login, pattern, regular, gPattern, startAfter, limit, false, sizeCb)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = headCb(count, size, next)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    writeCb := func(descr *dsdescr.File) error {
+        var err error
+        record, err := json.Marshal(descr)
+        if err != nil {
+            return err
+        }
+        record = append(record, '\n')
+        _, err = writer.Write(record)
+        return err
+    }
+    _, err = store.walkFiles(ctx, snap, login, pattern, regular, gPattern, startAfter, limit, false, writeCb)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// loopFiles collects one page of matched files
+func (store *Store) loopFiles(ctx context.Context, login, pattern, regular, gPattern, startAfter string, limit int, write bool, callback loopFunc) ([]*dsdescr.File, string, error) {
+    var err error
+    var next string
     resDescrs := make([]*dsdescr.File, 0)
-    descrs, err := store.reg.ListFiles(login)
+    snap, err := store.reg.Snapshot()
     if err != nil {
-        return resDescrs, dserr.Err(err)
+        return resDescrs, next, dserr.Err(err)
+    }
+    defer snap.Release()
+    cb := func(descr *dsdescr.File) error {
+        var err error
+        err = callback(descr)
+        if err != nil {
+            return err
+        }
+        resDescrs = append(resDescrs, descr)
+        return err
+    }
+    next, err = store.walkFiles(ctx, snap, login, pattern, regular, gPattern, startAfter, limit, write, cb)
+    if err != nil {
+        return resDescrs, next, dserr.Err(err)
+    }
+    return resDescrs, next, dserr.Err(err)
+}
+
+// walkFiles matches files of the user or shared files of other user
+// when the pattern is set as owner:/pattern. Files go in path order
+// after the start path, zero limit means all files. Next path is set
+// when more files are matched after the limit.
+func (store *Store) walkFiles(ctx context.Context, snap dsinter.Snapshot, login, pattern, regular, gPattern, startAfter string, limit int, write bool, callback loopFunc) (string, error) {
+    var err error
+    var next string
+
+    login, pattern, prefixes, err := store.resolvePattern(login, pattern, write)
+    if err != nil {
+        return next, dserr.Err(err)
     }
 
     usePattern  := false
@@ -250,40 +557,29 @@ func (store *Store) loopFiles(login, pattern, regular, gPattern string, callback
         useGPattern = true
     }
 
-    if !usePattern && !useRegular && !useGPattern {
-        resDescrs = descrs
-        return resDescrs, dserr.Err(err)
-    }
-
     pattern = "/" + pattern
     pattern = filepath.Clean(pattern)
 
     re, err := regexp.CompilePOSIX(regular)
     if err != nil {
-        return resDescrs, dserr.Err(err)
+        return next, dserr.Err(err)
     }
     g := glob.NewGlob(gPattern)
 
-    errChan := make(chan error, 16)
-    checker := func() {
-        buf := make([]byte, 1)
-        for {
-            _, err := reader.Read(buf)
-            if err != nil {
-                errChan <- err
-                return
-            }
-        }
-    }
-    go checker()
+    var count int
+    var lastPath string
+    fileCb := func(descr *dsdescr.File) (bool, error) {
+        var err error
+        var stop bool
 
-    for _, descr := range descrs {
+        // Context is canceled when the client is gone
+        err = ctx.Err()
+        if err != nil {
+            return stop, err
+        }
 
-        select {
-            case err := <-errChan:
-                err = fmt.Errorf("connection error: %s", err)
-                return resDescrs, dserr.Err(err)
-            default:
+        if prefixes != nil && !inPrefixes(prefixes, descr.FilePath) {
+            return stop, err
         }
 
         ok1 := false
@@ -299,7 +595,7 @@ func (store *Store) loopFiles(login, pattern, regular, gPattern string, callback
             case true:
                 ok2, err = filepath.Match(pattern, descr.FilePath)
                 if err != nil {
-                    return resDescrs, dserr.Err(err)
+                    return stop, err
                 }
             default:
                 ok2 = true
@@ -308,18 +604,32 @@ func (store *Store) loopFiles(login, pattern, regular, gPattern string, callback
             case true:
                 ok3, err = g.Match(descr.FilePath)
                 if err != nil {
-                    return resDescrs, dserr.Err(err)
+                    return stop, err
                 }
             default:
                 ok3 = true
         }
 
         if ok1 && ok2 && ok3 {
-            callback(descr)
-            resDescrs = append(resDescrs, descr)
+            if limit > 0 && count == limit {
+                next = lastPath
+                stop = true
+                return stop, err
+            }
+            err = callback(descr)
+            if err != nil {
+                return stop, err
+            }
+            lastPath = descr.FilePath
+            count++
         }
+        return stop, err
     }
-    return resDescrs, dserr.Err(err)
+    err = store.reg.ProcFilesFrom(snap, login, startAfter, fileCb)
+    if err != nil {
+        return next, dserr.Err(err)
+    }
+    return next, dserr.Err(err)
 }
 
 
@@ -329,14 +639,96 @@ func (store *Store) deleteFile(fileDescr *dsdescr.File) error {
 
     dslog.LogDebugf("erase #2 file %s", fileDescr.FilePath)
 
+    err = store.dropVersions(fileDescr.Login, fileDescr.FilePath)
+    if err != nil {
+        return dserr.Err(err)
+    }
+
+    switch store.cleanFile(fileDescr) {
+        case true:
+            dslog.LogDebugf("delete file %s", fileDescr.FilePath)
+
+            err = store.reg.DeleteFile(fileDescr.Login, fileDescr.FilePath)
+            if err != nil {
+                err = fmt.Errorf("cannot delete file descr for %s, err: %v", fileDescr.FilePath, err)
+                return dserr.Err(err)
+            }
+            store.fileAlloc.FreeId(fileDescr.FileId)
+        default:
+            err = store.trashFile(fileDescr)
+            if err != nil {
+                return dserr.Err(err)
+            }
+            err = store.reg.DeleteFile(fileDescr.Login, fileDescr.FilePath)
+            if err != nil {
+                return dserr.Err(err)
+            }
+    }
+    return dserr.Err(err)
+}
+
+// dropFile cleans data of the file which path descr is already replaced or deleted
+func (store *Store) dropFile(fileDescr *dsdescr.File) error {
+    var err error
+    switch store.cleanFile(fileDescr) {
+        case true:
+            dslog.LogDebugf("drop file %d", fileDescr.FileId)
+            if strings.HasPrefix(fileDescr.FilePath, "/.tmp/") {
+                err = store.reg.DeleteFile(fileDescr.Login, fileDescr.FilePath)
+                if err != nil {
+                    return dserr.Err(err)
+                }
+            }
+            store.fileAlloc.FreeId(fileDescr.FileId)
+        default:
+            err = store.trashFile(fileDescr)
+            if err != nil {
+                return dserr.Err(err)
+            }
+            if strings.HasPrefix(fileDescr.FilePath, "/.tmp/") {
+                err = store.reg.DeleteFile(fileDescr.Login, fileDescr.FilePath)
+                if err != nil {
+                    return dserr.Err(err)
+                }
+            }
+    }
+    return dserr.Err(err)
+}
 
+// cleanFile deletes blocks and batchs of the file. Local data and records
+// are kept until all remote blocks are dropped, so the file which
+// is not cleaned stays whole and can be restored from trash
+func (store *Store) cleanFile(fileDescr *dsdescr.File) bool {
     blockDescrs, err := store.reg.ListBlocks(fileDescr.FileId)
     if err != nil {
-        return dserr.Err(err)
+        return false
+    }
+    cleanRemote := true
+    for _, descr := range blockDescrs {
+        if !descr.HasRemote {
+            continue
+        }
+        err = store.dropRemoteBlock(descr)
+        if err != nil {
+            dslog.LogDebugf("cannot delete remote block: %v", err)
+            cleanRemote = false
+            continue
+        }
+        descr.HasRemote  = false
+        descr.BStoreAddr = ""
+        descr.BStorePort = ""
+        err = store.reg.PutBlock(descr)
+        if err != nil {
+            cleanRemote = false
+            continue
+        }
+    }
+    if !cleanRemote {
+        return false
     }
     cleanBlocks := true
     for _, descr := range blockDescrs {
-        block, err := fsfile.OpenBlock(store.dataDir, descr)
+        block, err := fsfile.OpenBlock(store.dataDir, store.reg, descr)
         if block == nil && err != nil {
             cleanBlocks = false
             continue
@@ -352,10 +744,13 @@ func (store *Store) deleteFile(fileDescr *dsdescr.File) error {
             continue
         }
     }
+    if !cleanBlocks {
+        return false
+    }
     cleanBatchs := true
     batchDescrs, err := store.reg.ListBatchs(fileDescr.FileId)
     if err != nil {
-        return dserr.Err(err)
+        return false
     }
     for _, descr := range batchDescrs {
         err = store.reg.DeleteBatch(descr.FileId, descr.BatchId)
@@ -363,46 +758,31 @@ func (store *Store) deleteFile(fileDescr *dsdescr.File) error {
             cleanBatchs = false
             continue
         }
-
     }
-    switch {
-        case cleanBatchs && cleanBlocks:
-            dslog.LogDebugf("delete file %s", fileDescr.FilePath)
+    return cleanBatchs
+}
 
-            err = store.reg.DeleteFile(fileDescr.Login, fileDescr.FilePath)
-            if err != nil {
-                err = fmt.Errorf("cannot delete file descr for %s, err: %v", fileDescr.FilePath, err)
-                return dserr.Err(err)
-            }
-            store.fileAlloc.FreeId(fileDescr.FileId)
-            if err != nil {
-                return dserr.Err(err)
-            }
-        default:
-            dslog.LogDebugf("trash file %s", fileDescr.FilePath)
+// trashFile keeps descr of not cleaned file under trash path
+func (store *Store) trashFile(fileDescr *dsdescr.File) error {
+    var err error
+    dslog.LogDebugf("trash file %s", fileDescr.FilePath)
 
-            trashDescr := dsdescr.NewFile()
-            *trashDescr = *fileDescr
+    trashDescr := dsdescr.NewFile()
+    *trashDescr = *fileDescr
 
-            randBin := make([]byte, 16)
-            rand.Read(randBin)
-            randStr := hex.EncodeToString(randBin)
-            trashPath := filepath.Join("/.trash/", randStr, fileDescr.FilePath)
+    randBin := make([]byte, 16)
+    rand.Read(randBin)
+    randStr := hex.EncodeToString(randBin)
+    trashPath := filepath.Join(trashDir, randStr, fileDescr.FilePath)
 
-            trashDescr.FilePath = trashPath
-            err = store.reg.PutFile(trashDescr)
-            if err != nil {
-                return dserr.Err(err)
-            }
-            err = store.reg.DeleteFile(fileDescr.Login, fileDescr.FilePath)
-            if err != nil {
-                return dserr.Err(err)
-            }
+    trashDescr.FilePath = trashPath
+    err = store.reg.PutFile(trashDescr)
+    if err != nil {
+        return dserr.Err(err)
     }
     return dserr.Err(err)
 }
 
-
 func (store *Store) checkLogin(login string) error {
     var err error
     var has bool
@@ -411,7 +791,7 @@ func (store *Store) checkLogin(login string) error {
         return dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("user %s not exist", login)
+        err = dserr.NewNotFoundError("user %s not exist", login)
         return dserr.Err(err)
     }
     return dserr.Err(err)
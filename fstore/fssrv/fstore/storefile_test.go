@@ -5,14 +5,21 @@
 package fstore
 
 import (
+    "context"
     "testing"
     "bytes"
+    "encoding/json"
+    "io"
     "math/rand"
+    "testing/iotest"
 
     "github.com/stretchr/testify/require"
 
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
     "dstore/dscomm/dskvdb"
     "dstore/dscomm/dsalloc"
+    "dstore/fstore/fssrv/fsfile"
     "dstore/fstore/fssrv/fsreg"
 )
 
@@ -50,24 +57,597 @@ func TestFile01(t *testing.T) {
     wrongLogin := "blabla"
 
     fileName := "/qwerty.txt"
-    _, err = store.SaveFile(goodLogin, fileName, reader, dataSize)
+    _, err = store.SaveFile(context.Background(), goodLogin, fileName, reader, dataSize)
     require.NoError(t, err)
 
     writer1 := bytes.NewBuffer(nil)
-    err = store.LoadFile(goodLogin, fileName, writer1)
+    err = store.LoadFile(context.Background(), goodLogin, fileName, writer1)
     require.NoError(t, err)
     require.Equal(t, int64(len(writer1.Bytes())), dataSize)
     require.Equal(t, writer1.Bytes(), buffer)
 
     writer2 := bytes.NewBuffer(nil)
-    err = store.LoadFile(goodLogin, fileName, writer2)
+    err = store.LoadFile(context.Background(), goodLogin, fileName, writer2)
     require.NoError(t, err)
     require.Equal(t, int64(len(writer2.Bytes())), dataSize)
     require.Equal(t, writer2.Bytes(), buffer)
 
     writer3 := bytes.NewBuffer(nil)
-    err = store.LoadFile(wrongLogin, fileName, writer3)
+    err = store.LoadFile(context.Background(), wrongLogin, fileName, writer3)
     require.Error(t, err)
     require.Equal(t, int64(len(writer3.Bytes())), int64(0))
 
 }
+
+func TestFile02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 1000 * 7
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    // Upload is broken after first part
+    var partSize int64 = 1000 * 1000 * 3 + 77
+    login := "admin"
+    fileName := "/resume.bin"
+    reader := bytes.NewReader(buffer[0:partSize])
+    descr, err := store.SaveFile(context.Background(), login, fileName, reader, dataSize)
+    require.NoError(t, err)
+    require.Equal(t, partSize, descr.DataSize)
+
+    _, err = store.SaveFile(context.Background(), login, fileName, reader, dataSize)
+    require.Error(t, err)
+
+    has, descr, err := store.StatFile(login, fileName)
+    require.NoError(t, err)
+    require.True(t, has)
+    offset := descr.DataSize
+
+    _, err = store.AppendFile(context.Background(), login, fileName, offset + 1, reader, dataSize - offset)
+    require.Error(t, err)
+
+    reader = bytes.NewReader(buffer[offset:])
+    descr, err = store.AppendFile(context.Background(), login, fileName, offset, reader, dataSize - offset)
+    require.NoError(t, err)
+    require.Equal(t, dataSize, descr.DataSize)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    // Missing file is created by append from zero offset
+    has, _, err = store.StatFile(login, "/new.bin")
+    require.NoError(t, err)
+    require.False(t, has)
+    reader = bytes.NewReader(buffer)
+    descr, err = store.AppendFile(context.Background(), login, "/new.bin", 0, reader, dataSize)
+    require.NoError(t, err)
+    require.Equal(t, dataSize, descr.DataSize)
+}
+
+func TestFile03(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 1000 * 2
+    buffer1 := make([]byte, dataSize)
+    rand.Read(buffer1)
+    buffer2 := make([]byte, dataSize + 1000)
+    rand.Read(buffer2)
+
+    // Replaced file is not kept as version
+    login := "admin"
+    user := dsdescr.NewUser()
+    user.KeepVers = -1
+    err = store.UpdateUser(login, user)
+    require.NoError(t, err)
+
+    fileName := "/replace.bin"
+    descr1, err := store.SaveFile(context.Background(), login, fileName, bytes.NewReader(buffer1), dataSize)
+    require.NoError(t, err)
+
+    _, err = store.SaveFile(context.Background(), login, fileName, bytes.NewReader(buffer2), int64(len(buffer2)))
+    require.Error(t, err)
+
+    // Reader holds old version while file is replaced
+    held, err := store.HoldFile(login, fileName, 0)
+    require.NoError(t, err)
+
+    descr2, err := store.ReplaceFile(context.Background(), login, fileName, bytes.NewReader(buffer2), int64(len(buffer2)))
+    require.NoError(t, err)
+    require.NotEqual(t, descr1.FileId, descr2.FileId)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.ReadFile(context.Background(), held, 0, 0, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer1, writer.Bytes())
+
+    store.ReleaseFile(held)
+    blockDescrs, err := reg.ListBlocks(descr1.FileId)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(blockDescrs))
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer2, writer.Bytes())
+
+    // Broken upload does not replace the file
+    _, err = store.ReplaceFile(context.Background(), login, fileName, bytes.NewReader(buffer1[0:1000]), dataSize)
+    require.Error(t, err)
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer2, writer.Bytes())
+
+    fileDescrs, err := reg.ListFiles(login)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(fileDescrs))
+}
+
+func TestFile04(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    login := "admin"
+    user := dsdescr.NewUser()
+    user.KeepVers = 2
+    err = store.UpdateUser(login, user)
+    require.NoError(t, err)
+
+    fileName := "/version.bin"
+    var dataSize int64 = 1000 * 100
+    buffers := make([][]byte, 4)
+    fileIds := make([]int64, 4)
+    for i := range buffers {
+        buffers[i] = make([]byte, dataSize + int64(i))
+        rand.Read(buffers[i])
+        reader := bytes.NewReader(buffers[i])
+        descr, err := store.ReplaceFile(context.Background(), login, fileName, reader, int64(len(buffers[i])))
+        require.NoError(t, err)
+        require.Equal(t, int64(i + 1), descr.FileVer)
+        fileIds[i] = descr.FileId
+    }
+
+    // Two previous versions are kept, the oldest one is pruned
+    descrs, err := store.ListVersions(login, fileName)
+    require.NoError(t, err)
+    require.Equal(t, 2, len(descrs))
+    require.Equal(t, int64(2), descrs[0].FileVer)
+    require.Equal(t, int64(3), descrs[1].FileVer)
+    blockDescrs, err := reg.ListBlocks(fileIds[0])
+    require.NoError(t, err)
+    require.Equal(t, 0, len(blockDescrs))
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName + "@2", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffers[1], writer.Bytes())
+
+    held, err := store.HoldFile(login, fileName, 3)
+    require.NoError(t, err)
+    writer = bytes.NewBuffer(nil)
+    err = store.ReadFile(context.Background(), held, 0, 0, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffers[2], writer.Bytes())
+    store.ReleaseFile(held)
+
+    err = store.LoadFile(context.Background(), login, fileName + "@1", bytes.NewBuffer(nil))
+    require.Error(t, err)
+
+    // Restored version becomes current, current one becomes previous
+    descr, err := store.RestoreVersion(login, fileName, 2)
+    require.NoError(t, err)
+    require.Equal(t, int64(5), descr.FileVer)
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffers[1], writer.Bytes())
+
+    descrs, err = store.ListVersions(login, fileName)
+    require.NoError(t, err)
+    require.Equal(t, 2, len(descrs))
+    require.Equal(t, int64(3), descrs[0].FileVer)
+    require.Equal(t, int64(4), descrs[1].FileVer)
+
+    // Versions are deleted with the file
+    _, err = store.DeleteFile(login, fileName)
+    require.NoError(t, err)
+    descrs, err = store.ListVersions(login, fileName)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(descrs))
+    for _, fileId := range fileIds {
+        blockDescrs, err := reg.ListBlocks(fileId)
+        require.NoError(t, err)
+        require.Equal(t, 0, len(blockDescrs))
+    }
+}
+
+func TestFile05(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    filePaths := []string{ "/a/1.bin", "/a/2.bin", "/a/3.txt", "/a/4.bin", "/b/5.bin" }
+    for _, filePath := range filePaths {
+        _, err = store.SaveFile(context.Background(), "user", filePath, bytes.NewReader(buffer), dataSize)
+        require.NoError(t, err)
+    }
+
+    // Pages of matched files
+    paged := make([]string, 0)
+    var next string
+    for {
+        var files []*dsdescr.File
+        files, next, err = store.ListFiles(context.Background(), "user", "/*/*.bin", "", "", next, 2)
+        require.NoError(t, err)
+        require.LessOrEqual(t, len(files), 2)
+        for _, file := range files {
+            paged = append(paged, file.FilePath)
+        }
+        if len(next) == 0 {
+            break
+        }
+    }
+    require.Equal(t, []string{ "/a/1.bin", "/a/2.bin", "/a/4.bin", "/b/5.bin" }, paged)
+
+    count, usage, next, err := store.FileStats(context.Background(), "user", "", "", "", "/a/2.bin", 2)
+    require.NoError(t, err)
+    require.Equal(t, int64(2), count)
+    require.Equal(t, 2 * dataSize, usage)
+    require.Equal(t, "/a/4.bin", next)
+
+    // Stream gets the exact size ahead of records
+    var head int64
+    headCb := func(count, size int64, next string) error {
+        var err error
+        require.Equal(t, int64(5), count)
+        require.Equal(t, "", next)
+        head = size
+        return err
+    }
+    writer := bytes.NewBuffer(nil)
+    err = store.StreamFiles(context.Background(), "user", "", "", "", "", 0, headCb, writer)
+    require.NoError(t, err)
+    require.Equal(t, head, int64(writer.Len()))
+    lines := bytes.Split(bytes.TrimSuffix(writer.Bytes(), []byte("\n")), []byte("\n"))
+    require.Equal(t, 5, len(lines))
+    descr := dsdescr.NewFile()
+    err = json.Unmarshal(lines[4], descr)
+    require.NoError(t, err)
+    require.Equal(t, "/b/5.bin", descr.FilePath)
+
+    // Files are not erased without filter
+    files, _, err := store.EraseFiles(context.Background(), "user", "", "", "", "", 0, true)
+    require.NoError(t, err)
+    require.Equal(t, 5, len(files))
+    files, _, err = store.ListFiles(context.Background(), "user", "", "", "", "", 0)
+    require.NoError(t, err)
+    require.Equal(t, 5, len(files))
+
+    files, next, err = store.EraseFiles(context.Background(), "user", "/a/*", "", "", "", 1, true)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(files))
+    require.Equal(t, "/a/1.bin", next)
+    files, _, err = store.ListFiles(context.Background(), "user", "", "", "", "", 0)
+    require.NoError(t, err)
+    require.Equal(t, 4, len(files))
+}
+
+func TestFile06(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    // Stream of unknown size goes over several batches
+    var dataSize int64 = 1000 * 1000 * 45
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    descr, err := store.SaveFile(context.Background(), "user", "/pipe.bin", bytes.NewReader(buffer), -1)
+    require.NoError(t, err)
+    require.Equal(t, dataSize, descr.DataSize)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "user", "/pipe.bin", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    descr, err = store.ReplaceFile(context.Background(), "user", "/pipe.bin", bytes.NewReader(buffer[:1000]), -1)
+    require.NoError(t, err)
+    require.Equal(t, int64(1000), descr.DataSize)
+
+    // Broken stream of unknown size is not kept
+    broken := io.MultiReader(bytes.NewReader(buffer[:1000]), iotest.ErrReader(io.ErrUnexpectedEOF))
+    _, err = store.SaveFile(context.Background(), "user", "/broken.bin", broken, -1)
+    require.Error(t, err)
+    has, _, err := store.StatFile("user", "/broken.bin")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    broken = io.MultiReader(bytes.NewReader(buffer[:10]), iotest.ErrReader(io.ErrUnexpectedEOF))
+    _, err = store.ReplaceFile(context.Background(), "user", "/pipe.bin", broken, -1)
+    require.Error(t, err)
+    _, descr, err = store.StatFile("user", "/pipe.bin")
+    require.NoError(t, err)
+    require.Equal(t, int64(1000), descr.DataSize)
+}
+
+func TestFile07(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    buffer := make([]byte, 1024 * 100)
+    rand.Read(buffer)
+    _, err = store.SaveFile(context.Background(), "user", "/a.bin", bytes.NewReader(buffer), int64(len(buffer)))
+    require.NoError(t, err)
+
+    // Canceled context stops the calls
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    _, err = store.SaveFile(ctx, "user", "/b.bin", bytes.NewReader(buffer), -1)
+    require.ErrorIs(t, err, context.Canceled)
+    has, _, err := store.StatFile("user", "/b.bin")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    err = store.LoadFile(ctx, "user", "/a.bin", io.Discard)
+    require.ErrorIs(t, err, context.Canceled)
+
+    _, _, err = store.ListFiles(ctx, "user", "", "", "", "", 0)
+    require.ErrorIs(t, err, context.Canceled)
+
+    files, _, err := store.ListFiles(context.Background(), "user", "", "", "", "", 0)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(files))
+    // Kinds of errors are told by types
+    _, err = store.SaveFile(context.Background(), "user", "/a.bin", bytes.NewReader(buffer), int64(len(buffer)))
+    require.True(t, dserr.IsExists(err))
+    err = store.LoadFile(context.Background(), "user", "/c.bin", io.Discard)
+    require.True(t, dserr.IsNotFound(err))
+    _, err = store.ListUsers("user", "")
+    require.True(t, dserr.IsAccess(err))
+}
+
+func TestFile08(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 1000
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    var partSize int64 = 1000 * 300 + 77
+    login := "admin"
+    fileName := "/append.bin"
+    reader := bytes.NewReader(buffer[0:partSize])
+    _, err = store.SaveFile(context.Background(), login, fileName, reader, partSize)
+    require.NoError(t, err)
+
+    // Reader has opened the file before the append
+    held, err := store.HoldFile(login, fileName, 0)
+    require.NoError(t, err)
+    file, err := fsfile.OpenFile(store.dataDir, store.reg, held)
+    require.NoError(t, err)
+
+    pipeReader, pipeWriter := io.Pipe()
+    appended := make(chan error, 1)
+    go func() {
+        _, err := store.AppendFile(context.Background(), login, fileName, partSize, pipeReader, dataSize - partSize)
+        appended <- err
+    }()
+    _, err = pipeWriter.Write(buffer[partSize:partSize + 1000])
+    require.NoError(t, err)
+
+    // Second writer of the file is refused
+    reader = bytes.NewReader(buffer[partSize:])
+    _, err = store.AppendFile(context.Background(), login, fileName, partSize, reader, dataSize - partSize)
+    require.Error(t, err)
+
+    _, err = pipeWriter.Write(buffer[partSize + 1000:])
+    require.NoError(t, err)
+    pipeWriter.Close()
+    require.NoError(t, <-appended)
+
+    // Replaced crates are kept for the reader
+    writer := bytes.NewBuffer(nil)
+    _, err = file.Read(context.Background(), writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer[0:partSize], writer.Bytes())
+    store.ReleaseFile(held)
+    require.Equal(t, 0, len(store.crates))
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+}
+
+func TestFile09(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 100
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    login := "admin"
+    user := dsdescr.NewUser()
+    user.KeepVers = -1
+    err = store.UpdateUser(login, user)
+    require.NoError(t, err)
+
+    fileName := "/replay.bin"
+    descr1, err := store.SaveFile(context.Background(), login, fileName, bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+
+    // Server is stopped while reader holds replaced file
+    _, err = store.HoldFile(login, fileName, 0)
+    require.NoError(t, err)
+    _, err = store.ReplaceFile(context.Background(), login, fileName, bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+
+    drops, err := reg.ListDrops()
+    require.NoError(t, err)
+    require.Equal(t, 1, len(drops))
+
+    // Pending drop is done at start
+    store, err = NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+    err = store.ReplayDrops()
+    require.NoError(t, err)
+
+    blockDescrs, err := reg.ListBlocks(descr1.FileId)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(blockDescrs))
+    drops, err = reg.ListDrops()
+    require.NoError(t, err)
+    require.Equal(t, 0, len(drops))
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "dstore/fstore/fssrv/fsfile"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+)
+
+const gcReportLimit int = 100
+
+// SetGCPause sets pause between collector passes, zero disables collector
+func (store *Store) SetGCPause(pause time.Duration) {
+    store.gcMtx.Lock()
+    defer store.gcMtx.Unlock()
+    store.gcPause = pause
+}
+
+// SetGCGrace sets age of tmp files and unowned crates which are removed
+func (store *Store) SetGCGrace(grace time.Duration) {
+    store.gcMtx.Lock()
+    defer store.gcMtx.Unlock()
+    store.gcGrace = grace
+}
+
+func (store *Store) RunGC(login string, dryRun bool) (*dsdescr.GCReport, error) {
+    var err error
+    report := dsdescr.NewGCReport()
+    role, err := store.getUserRole(login)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    if role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", login)
+        return report, dserr.Err(err)
+    }
+    report, err = store.CollectGarbage(dryRun)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    return report, dserr.Err(err)
+}
+
+func (store *Store) StopCollector() {
+    store.gcCancel()
+    store.gcWg.Wait()
+}
+
+// StartCollector runs the garbage collection loop until StopCollector
+func (store *Store) StartCollector() {
+    store.gcWg.Add(1)
+    go store.collector()
+}
+
+func (store *Store) collector() {
+    defer store.gcWg.Done()
+
+    store.gcMtx.Lock()
+    pause := store.gcPause
+    store.gcMtx.Unlock()
+    if pause < 1 {
+        dslog.LogInfo("garbage collector disabled")
+        return
+    }
+    for {
+        select {
+            case <- store.gcCtx.Done():
+                dslog.LogInfo("gc loop canceled")
+                return
+            case <- time.After(pause):
+        }
+        report, err := store.CollectGarbage(false)
+        if err != nil {
+            dslog.LogErrorf("gc pass error: %v", err)
+            continue
+        }
+        dslog.LogInfof("gc pass: %d tmp files, %d orphan crates, %d bytes", report.TmpFiles,
+                                                report.OrphanCrates, report.OrphanSize)
+    }
+}
+
+// CollectGarbage expires stale tmp files and removes crates without owner block.
+// Dry run only reports the garbage.
+func (store *Store) CollectGarbage(dryRun bool) (*dsdescr.GCReport, error) {
+    var err error
+    store.gcRunMtx.Lock()
+    defer store.gcRunMtx.Unlock()
+
+    report := dsdescr.NewGCReport()
+    report.DryRun = dryRun
+    report.StartedAt = time.Now().Unix()
+    defer func() {
+        report.FinishedAt = time.Now().Unix()
+    }()
+
+    store.gcMtx.Lock()
+    grace := store.gcGrace
+    store.gcMtx.Unlock()
+    deadline := time.Now().Add(-grace)
+
+    err = store.expireTmp(report, deadline)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    err = store.collectCrates(report, deadline)
+    if err != nil {
+        return report, dserr.Err(err)
+    }
+    return report, dserr.Err(err)
+}
+
+func (store *Store) expireTmp(report *dsdescr.GCReport, deadline time.Time) error {
+    var err error
+    users, err := store.reg.ListUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, user := range users {
+        fileDescrs, err := store.reg.ListFiles(user.Login)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        for _, descr := range fileDescrs {
+            if !strings.HasPrefix(descr.FilePath, "/.tmp/") {
+                continue
+            }
+            if descr.UpdatedAt > deadline.Unix() {
+                continue
+            }
+            // Upload in progress
+            store.refMtx.Lock()
+            held := store.fileRefs[descr.FileId] > 0
+            store.refMtx.Unlock()
+            if held {
+                continue
+            }
+            report.TmpFiles++
+            if len(report.TmpPaths) < gcReportLimit {
+                report.TmpPaths = append(report.TmpPaths, descr.FilePath)
+            }
+            if report.DryRun {
+                continue
+            }
+            err = store.dropFile(descr)
+            if err != nil {
+                return dserr.Err(err)
+            }
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) collectCrates(report *dsdescr.GCReport, deadline time.Time) error {
+    var err error
+
+    // Registry is read before the tree, crates written later are younger than deadline
+    used := make(map[string]bool)
+    blockCb := func(descr *dsdescr.Block) (bool, error) {
+        var err error
+        used[filepath.Clean(descr.FilePath)] = true
+        return false, err
+    }
+    err = store.reg.ProcBlocks(blockCb)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    // Crates replaced by the append are read until release
+    store.refMtx.Lock()
+    for _, crates := range store.crates {
+        for _, crate := range crates {
+            used[filepath.Clean(crate)] = true
+        }
+    }
+    store.refMtx.Unlock()
+    crateCb := func(filePath string, info fs.FileInfo) error {
+        var err error
+        report.Crates++
+        if used[filePath] || info.ModTime().After(deadline) {
+            return err
+        }
+        report.OrphanCrates++
+        report.OrphanSize += info.Size()
+        if len(report.OrphanPaths) < gcReportLimit {
+            report.OrphanPaths = append(report.OrphanPaths, filePath)
+        }
+        if report.DryRun {
+            return err
+        }
+        err = os.Remove(filepath.Join(store.dataDir, filePath))
+        if err != nil {
+            return err
+        }
+        return err
+    }
+    err = fsfile.WalkCrates(store.dataDir, crateCb)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "testing"
+    "bytes"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsfile"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestGC01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+    store.SetGCGrace(time.Hour)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 100
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    login := "admin"
+    fileName := "/keep.bin"
+    _, err = store.SaveFile(context.Background(), login, fileName, bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+
+    // Abandoned upload
+    fileId, err := idAlloc.NewId()
+    require.NoError(t, err)
+    tmpPath := "/.tmp/0123/lost.bin"
+    file, err := fsfile.NewFile(dataDir, reg, login, tmpPath, fileId, 2, 1024 * 64, 1)
+    require.NoError(t, err)
+    _, _, err = file.Write(context.Background(), bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+    descr := file.Descr()
+    descr.UpdatedAt = time.Now().Add(-2 * time.Hour).Unix()
+    err = reg.PutFile(descr)
+    require.NoError(t, err)
+
+    // Old and fresh crates without owner block
+    oldTime := time.Now().Add(-2 * time.Hour)
+    oldCrate := filepath.Join("a", "b", strings.Repeat("ab", 32) + ".block")
+    newCrate := filepath.Join("a", "b", strings.Repeat("cd", 32) + ".block")
+    for _, crate := range []string{ oldCrate, newCrate } {
+        fullPath := filepath.Join(dataDir, crate)
+        err = os.MkdirAll(filepath.Dir(fullPath), 0755)
+        require.NoError(t, err)
+        err = os.WriteFile(fullPath, []byte("garbage"), 0644)
+        require.NoError(t, err)
+    }
+    err = os.Chtimes(filepath.Join(dataDir, oldCrate), oldTime, oldTime)
+    require.NoError(t, err)
+
+    _, err = store.RunGC("nobody", true)
+    require.Error(t, err)
+
+    report, err := store.RunGC(login, true)
+    require.NoError(t, err)
+    require.Equal(t, int64(1), report.TmpFiles)
+    require.Equal(t, []string{ tmpPath }, report.TmpPaths)
+    require.Equal(t, int64(1), report.OrphanCrates)
+    require.Equal(t, []string{ oldCrate }, report.OrphanPaths)
+    has, err := reg.HasFile(login, tmpPath)
+    require.NoError(t, err)
+    require.True(t, has)
+    _, err = os.Stat(filepath.Join(dataDir, oldCrate))
+    require.NoError(t, err)
+
+    report, err = store.CollectGarbage(false)
+    require.NoError(t, err)
+    require.Equal(t, int64(1), report.TmpFiles)
+    require.Equal(t, int64(1), report.OrphanCrates)
+    has, err = reg.HasFile(login, tmpPath)
+    require.NoError(t, err)
+    require.False(t, has)
+    _, err = os.Stat(filepath.Join(dataDir, oldCrate))
+    require.True(t, os.IsNotExist(err))
+    _, err = os.Stat(filepath.Join(dataDir, newCrate))
+    require.NoError(t, err)
+
+    // Crates of dropped tmp file are gone with it, live file is untouched
+    report, err = store.CollectGarbage(false)
+    require.NoError(t, err)
+    require.Equal(t, int64(0), report.TmpFiles)
+    require.Equal(t, int64(0), report.OrphanCrates)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+}
+
+func TestGC02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, nil)
+    require.NoError(t, err)
+    store.SetScrubRate(1024 * 1024)
+    store.SetScrubPause(time.Hour)
+    store.SetTrashPause(time.Hour)
+    store.SetGCPause(time.Hour)
+
+    // Stop right after start waits for the loops
+    store.StartScrubber()
+    store.StartTrashCleaner()
+    store.StartCollector()
+    stopped := make(chan bool)
+    go func() {
+        store.StopScrubber()
+        store.StopTrashCleaner()
+        store.StopCollector()
+        stopped <- true
+    }()
+    select {
+        case <-stopped:
+        case <-time.After(5 * time.Second):
+            t.Fatal("loops are not stopped")
+    }
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+)
+
+// Files of other user are addressed as owner:/path
+const ownerSep string = ":"
+
+// GrantAccess gives access to the path prefix of the owner, repeated grant
+// changes the access. The owner or admin can grant the access.
+func (store *Store) GrantAccess(authLogin string, grant *dsdescr.Grant) error {
+    var err error
+    newGrant, err := store.checkGrant(authLogin, grant)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    switch newGrant.Access {
+        case "":
+            newGrant.Access = dsdescr.AccessRead
+        case dsdescr.AccessRead, dsdescr.AccessWrite:
+        default:
+            err = fmt.Errorf("irrelevant access name %s", newGrant.Access)
+            return dserr.Err(err)
+    }
+    if newGrant.GranteeType == dsdescr.GranteeUser {
+        if newGrant.Grantee == newGrant.Owner {
+            err = errors.New("owner cannot be grantee")
+            return dserr.Err(err)
+        }
+        err = store.checkLogin(newGrant.Grantee)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    newGrant.CreatedAt = time.Now().Unix()
+    has, err := store.reg.HasGrant(newGrant.Owner, newGrant.GranteeType, newGrant.Grantee, newGrant.PathPrefix)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if has {
+        oldGrant, err := store.reg.GetGrant(newGrant.Owner, newGrant.GranteeType, newGrant.Grantee, newGrant.PathPrefix)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        newGrant.CreatedAt = oldGrant.CreatedAt
+    }
+    newGrant.UpdatedAt = time.Now().Unix()
+    err = store.reg.PutGrant(newGrant)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) RevokeAccess(authLogin string, grant *dsdescr.Grant) error {
+    var err error
+    oldGrant, err := store.checkGrant(authLogin, grant)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    has, err := store.reg.HasGrant(oldGrant.Owner, oldGrant.GranteeType, oldGrant.Grantee, oldGrant.PathPrefix)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("grant of %s to %s %s not exists", oldGrant.PathPrefix, oldGrant.GranteeType, oldGrant.Grantee)
+        return dserr.Err(err)
+    }
+    err = store.reg.DeleteGrant(oldGrant.Owner, oldGrant.GranteeType, oldGrant.Grantee, oldGrant.PathPrefix)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// ListGrants returns grants of the owner. Empty owner means grants
+// made by the user and grants given to the user or to his groups.
+func (store *Store) ListGrants(authLogin, owner string) ([]*dsdescr.Grant, error) {
+    var err error
+    resDescrs := make([]*dsdescr.Grant, 0)
+    if len(owner) > 0 {
+        err = store.checkKeyRights(authLogin, owner)
+        if err != nil {
+            return resDescrs, dserr.Err(err)
+        }
+        resDescrs, err = store.reg.ListGrants(owner)
+        if err != nil {
+            return resDescrs, dserr.Err(err)
+        }
+        return resDescrs, dserr.Err(err)
+    }
+    user, err := store.reg.GetUser(authLogin)
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    descrs, err := store.reg.ListGrants("")
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        if descr.Owner == authLogin || isGrantee(user, descr) {
+            resDescrs = append(resDescrs, descr)
+        }
+    }
+    return resDescrs, dserr.Err(err)
+}
+
+// checkGrant checks rights of the user and returns normalized grant
+func (store *Store) checkGrant(authLogin string, grant *dsdescr.Grant) (*dsdescr.Grant, error) {
+    var err error
+    newGrant := dsdescr.NewGrant()
+    *newGrant = *grant
+    if len(newGrant.Owner) == 0 {
+        newGrant.Owner = authLogin
+    }
+    err = store.checkKeyRights(authLogin, newGrant.Owner)
+    if err != nil {
+        return newGrant, dserr.Err(err)
+    }
+    switch newGrant.GranteeType {
+        case "":
+            newGrant.GranteeType = dsdescr.GranteeUser
+        case dsdescr.GranteeUser, dsdescr.GranteeGroup:
+        default:
+            err = fmt.Errorf("irrelevant grantee type %s", newGrant.GranteeType)
+            return newGrant, dserr.Err(err)
+    }
+    if len(newGrant.Grantee) == 0 {
+        err = errors.New("empty grantee name")
+        return newGrant, dserr.Err(err)
+    }
+    newGrant.PathPrefix, err = cleanPathPrefix(newGrant.PathPrefix)
+    if err != nil {
+        return newGrant, dserr.Err(err)
+    }
+    if len(newGrant.PathPrefix) == 0 {
+        newGrant.PathPrefix = "/"
+    }
+    return newGrant, dserr.Err(err)
+}
+
+// revokeUserGrants deletes grants made by the deleted user and given to him
+func (store *Store) revokeUserGrants(login string) error {
+    var err error
+    descrs, err := store.reg.ListGrants("")
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        toUser := descr.GranteeType == dsdescr.GranteeUser && descr.Grantee == login
+        if descr.Owner != login && !toUser {
+            continue
+        }
+        err = store.reg.DeleteGrant(descr.Owner, descr.GranteeType, descr.Grantee, descr.PathPrefix)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+// grantedPrefixes returns path prefixes of the owner available to the user
+func (store *Store) grantedPrefixes(login, owner string, write bool) ([]string, error) {
+    var err error
+    prefixes := make([]string, 0)
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return prefixes, dserr.Err(err)
+    }
+    descrs, err := store.reg.ListGrants(owner)
+    if err != nil {
+        return prefixes, dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        if !isGrantee(user, descr) {
+            continue
+        }
+        if write && descr.Access != dsdescr.AccessWrite {
+            continue
+        }
+        prefixes = append(prefixes, descr.PathPrefix)
+    }
+    return prefixes, dserr.Err(err)
+}
+
+// resolvePath returns the owner and clean path of own or shared file
+func (store *Store) resolvePath(login, filePath string, write bool) (string, string, error) {
+    var err error
+    owner, filePath, shared := splitOwner(filePath)
+    filePath = cleanPath(filePath)
+    if !shared || owner == login {
+        return login, filePath, dserr.Err(err)
+    }
+    prefixes, err := store.grantedPrefixes(login, owner, write)
+    if err != nil {
+        return owner, filePath, dserr.Err(err)
+    }
+    if !inPrefixes(prefixes, filePath) {
+        err = dserr.NewAccessError("user %s has no access to %s%s%s", login, owner, ownerSep, filePath)
+        return owner, filePath, dserr.Err(err)
+    }
+    return owner, filePath, dserr.Err(err)
+}
+
+// resolvePattern returns the owner, the pattern and granted prefixes
+// for listing of shared files, the prefixes are nil for own files
+func (store *Store) resolvePattern(login, pattern string, write bool) (string, string, []string, error) {
+    var err error
+    var prefixes []string
+    owner, pattern, shared := splitOwner(pattern)
+    if !shared || owner == login {
+        return login, pattern, prefixes, dserr.Err(err)
+    }
+    prefixes, err = store.grantedPrefixes(login, owner, write)
+    if err != nil {
+        return owner, pattern, prefixes, dserr.Err(err)
+    }
+    if len(prefixes) == 0 {
+        err = dserr.NewAccessError("user %s has no access to files of %s", login, owner)
+        return owner, pattern, prefixes, dserr.Err(err)
+    }
+    if pattern == "/" {
+        pattern = ""
+    }
+    return owner, pattern, prefixes, dserr.Err(err)
+}
+
+func isGrantee(user *dsdescr.User, grant *dsdescr.Grant) bool {
+    switch grant.GranteeType {
+        case dsdescr.GranteeUser:
+            return grant.Grantee == user.Login
+        case dsdescr.GranteeGroup:
+            for _, group := range user.Groups {
+                if group == grant.Grantee {
+                    return true
+                }
+            }
+    }
+    return false
+}
+
+func inPrefixes(prefixes []string, filePath string) bool {
+    for _, prefix := range prefixes {
+        if InPathPrefix(prefix, filePath) {
+            return true
+        }
+    }
+    return false
+}
+
+// splitOwner splits owner:/path, own paths begin with slash or have
+// no owner part
+func splitOwner(filePath string) (string, string, bool) {
+    index := strings.Index(filePath, ownerSep + "/")
+    if index < 1 {
+        return "", filePath, false
+    }
+    owner := filePath[:index]
+    if strings.Contains(owner, "/") {
+        return "", filePath, false
+    }
+    return owner, filePath[index + len(ownerSep):], true
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "bytes"
+    "math/rand"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestGrant01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    user := dsdescr.NewUser()
+    user.Login  = "devel"
+    user.Pass   = "devel"
+    err = store.AddUser("admin", user)
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024 * 64
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    _, err = store.SaveFile(context.Background(), "user", "/builds/app.tgz", bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+    _, err = store.SaveFile(context.Background(), "user", "/private/key.pem", bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+
+    // No access without grant
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "devel", "user:/builds/app.tgz", writer)
+    require.Error(t, err)
+
+    grant := dsdescr.NewGrant()
+    grant.PathPrefix    = "builds"
+    grant.Grantee       = "devel"
+    err = store.GrantAccess("devel", grant)
+    require.Error(t, err)
+    err = store.GrantAccess("user", grant)
+    require.NoError(t, err)
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "devel", "user:/builds/app.tgz", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    has, _, err := store.StatFile("devel", "user:/builds/app.tgz")
+    require.NoError(t, err)
+    require.Equal(t, true, has)
+
+    _, _, err = store.StatFile("devel", "user:/private/key.pem")
+    require.Error(t, err)
+
+    files, _, err := store.ListFiles(context.Background(), "devel", "user:/", "", "", "", 0)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(files))
+    require.Equal(t, "/builds/app.tgz", files[0].FilePath)
+
+    // Read grant does not allow saves
+    _, err = store.SaveFile(context.Background(), "devel", "user:/builds/new.tgz", bytes.NewReader(buffer), dataSize)
+    require.Error(t, err)
+    _, err = store.DeleteFile("devel", "user:/builds/app.tgz")
+    require.Error(t, err)
+
+    // Group grant with write access
+    err = store.UpdateUser("devel", &dsdescr.User{ Login: "devel", Groups: []string{ "ci" } })
+    require.Error(t, err)
+    err = store.UpdateUser("admin", &dsdescr.User{ Login: "devel", Groups: []string{ "ci" } })
+    require.NoError(t, err)
+
+    grant = dsdescr.NewGrant()
+    grant.PathPrefix    = "/builds"
+    grant.GranteeType   = dsdescr.GranteeGroup
+    grant.Grantee       = "ci"
+    grant.Access        = dsdescr.AccessWrite
+    err = store.GrantAccess("user", grant)
+    require.NoError(t, err)
+
+    descr, err := store.SaveFile(context.Background(), "devel", "user:/builds/new.tgz", bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+    require.Equal(t, "user", descr.Login)
+    has, _, err = store.StatFile("user", "/builds/new.tgz")
+    require.NoError(t, err)
+    require.Equal(t, true, has)
+
+    grants, err := store.ListGrants("devel", "")
+    require.NoError(t, err)
+    require.Equal(t, 2, len(grants))
+
+    _, err = store.ListGrants("devel", "user")
+    require.Error(t, err)
+
+    // Revoked grant closes access
+    err = store.RevokeAccess("user", grant)
+    require.NoError(t, err)
+    _, err = store.SaveFile(context.Background(), "devel", "user:/builds/new2.tgz", bytes.NewReader(buffer), dataSize)
+    require.Error(t, err)
+
+    // Grants of deleted user are dropped
+    err = store.DeleteUser("admin", "devel")
+    require.NoError(t, err)
+    grants, err = store.ListGrants("user", "user")
+    require.NoError(t, err)
+    require.Equal(t, 0, len(grants))
+}
+
+func TestSplitOwner01(t *testing.T) {
+    owner, filePath, shared := splitOwner("user:/a/b")
+    require.Equal(t, true, shared)
+    require.Equal(t, "user", owner)
+    require.Equal(t, "/a/b", filePath)
+
+    _, _, shared = splitOwner("/a:/b")
+    require.Equal(t, false, shared)
+    _, _, shared = splitOwner("a:b")
+    require.Equal(t, false, shared)
+    _, _, shared = splitOwner(":/b")
+    require.Equal(t, false, shared)
+}
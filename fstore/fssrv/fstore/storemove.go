@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+)
+
+// MoveFile renames the file, the destination must not exist
+func (store *Store) MoveFile(login, filePath, destPath string) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+    owner, filePath, destPath, err := store.resolveMove(login, filePath, destPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if filePath == destPath {
+        err = fmt.Errorf("file %s is moved to itself", filePath)
+        return descr, dserr.Err(err)
+    }
+    store.refMtx.Lock()
+    defer store.refMtx.Unlock()
+    descr, err = store.reg.MoveFile(owner, filePath, destPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    return descr, dserr.Err(err)
+}
+
+// MoveDir moves each file under the directory path, every file is moved
+// atomically and failed files are reported along with moved ones
+func (store *Store) MoveDir(login, dirPath, destPath string) ([]*dsdescr.File, []*dsdescr.MoveError, error) {
+    var err error
+    moved  := make([]*dsdescr.File, 0)
+    failed := make([]*dsdescr.MoveError, 0)
+    owner, dirPath, destPath, err := store.resolveMove(login, dirPath, destPath)
+    if err != nil {
+        return moved, failed, dserr.Err(err)
+    }
+    if dirPath == "/" {
+        err = errors.New("root directory cannot be moved")
+        return moved, failed, dserr.Err(err)
+    }
+    if InPathPrefix(dirPath, destPath) {
+        err = fmt.Errorf("directory %s is moved into itself", dirPath)
+        return moved, failed, dserr.Err(err)
+    }
+    descrs, err := store.reg.ListFiles(owner)
+    if err != nil {
+        return moved, failed, dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        if !strings.HasPrefix(descr.FilePath, dirPath + "/") {
+            continue
+        }
+        newPath := destPath + strings.TrimPrefix(descr.FilePath, dirPath)
+        store.refMtx.Lock()
+        newDescr, err := store.reg.MoveFile(owner, descr.FilePath, newPath)
+        store.refMtx.Unlock()
+        if err != nil {
+            moveErr := &dsdescr.MoveError{
+                FilePath:   descr.FilePath,
+                DestPath:   newPath,
+                Error:      err.Error(),
+            }
+            failed = append(failed, moveErr)
+            continue
+        }
+        moved = append(moved, newDescr)
+    }
+    if len(failed) > 0 {
+        err = fmt.Errorf("%d of %d files are not moved", len(failed), len(failed) + len(moved))
+        return moved, failed, dserr.Err(err)
+    }
+    return moved, failed, dserr.Err(err)
+}
+
+// resolveMove returns the owner and the clean paths, both paths must
+// belong to one owner and must be out of service directories
+func (store *Store) resolveMove(login, filePath, destPath string) (string, string, string, error) {
+    var err error
+    owner, filePath, err := store.resolvePath(login, filePath, true)
+    if err != nil {
+        return owner, filePath, destPath, dserr.Err(err)
+    }
+    destOwner, destPath, err := store.resolvePath(login, destPath, true)
+    if err != nil {
+        return owner, filePath, destPath, dserr.Err(err)
+    }
+    if owner != destOwner {
+        err = fmt.Errorf("file cannot be moved from %s to %s", owner, destOwner)
+        return owner, filePath, destPath, dserr.Err(err)
+    }
+    for _, somePath := range []string{ filePath, destPath } {
+        if isServicePath(somePath) {
+            err = fmt.Errorf("path %s is in service directory", somePath)
+            return owner, filePath, destPath, dserr.Err(err)
+        }
+    }
+    return owner, filePath, destPath, dserr.Err(err)
+}
+
+func isServicePath(filePath string) bool {
+    return InPathPrefix("/.tmp", filePath) || InPathPrefix("/.trash", filePath)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "bytes"
+    "math/rand"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestMove01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024 * 64
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    for _, filePath := range []string{ "/src/a.bin", "/src/sub/b.bin", "/src/c.bin", "/srcx/d.bin", "/dst/c.bin" } {
+        _, err = store.SaveFile(context.Background(), "user", filePath, bytes.NewReader(buffer), dataSize)
+        require.NoError(t, err)
+    }
+
+    // Single file
+    descr, err := store.MoveFile("user", "src/a.bin", "/a.bin")
+    require.NoError(t, err)
+    require.Equal(t, "/a.bin", descr.FilePath)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "user", "/a.bin", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    _, err = store.MoveFile("user", "/a.bin", "/dst/c.bin")
+    require.Error(t, err)
+    _, err = store.MoveFile("user", "/a.bin", "/.trash/a.bin")
+    require.Error(t, err)
+
+    // Directory with one conflicting file
+    _, _, err = store.MoveDir("user", "/src", "/src/sub")
+    require.Error(t, err)
+
+    moved, failed, err := store.MoveDir("user", "/src", "/dst")
+    require.Error(t, err)
+    require.Equal(t, 1, len(moved))
+    require.Equal(t, "/dst/sub/b.bin", moved[0].FilePath)
+    require.Equal(t, 1, len(failed))
+    require.Equal(t, "/src/c.bin", failed[0].FilePath)
+
+    has, _, err := store.StatFile("user", "/srcx/d.bin")
+    require.NoError(t, err)
+    require.Equal(t, true, has)
+
+    writer = bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), "user", "/dst/sub/b.bin", writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+}
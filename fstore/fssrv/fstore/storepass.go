@@ -0,0 +1,142 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "errors"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+    "dstore/dscomm/dsrpc"
+)
+
+// setUserPass replaces the password with salted verifier
+func setUserPass(user *dsdescr.User, pass string) {
+    verifier := dsrpc.NewVerifier([]byte(pass))
+    user.Pass       = ""
+    user.PassSalt   = verifier.Salt
+    user.PassIter   = verifier.Iter
+    user.PassKey    = verifier.StoredKey
+}
+
+func UserVerifier(user *dsdescr.User) *dsrpc.Verifier {
+    verifier := &dsrpc.Verifier{
+        Salt:       user.PassSalt,
+        Iter:       user.PassIter,
+        StoredKey:  user.PassKey,
+    }
+    return verifier
+}
+
+func checkUserPass(user *dsdescr.User, pass string) bool {
+    return UserVerifier(user).Check([]byte(pass))
+}
+
+// stripUser returns user descr copy without secrets
+func stripUser(user *dsdescr.User) *dsdescr.User {
+    stripped := *user
+    stripped.Pass       = ""
+    stripped.PassSalt   = nil
+    stripped.PassKey    = nil
+    return &stripped
+}
+
+// migrateUsers converts plain passwords of old records
+func (store *Store) migrateUsers() error {
+    var err error
+    users, err := store.reg.ListUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, user := range users {
+        if len(user.Pass) == 0 {
+            continue
+        }
+        setUserPass(user, user.Pass)
+        err = store.reg.PutUser(user)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        dslog.LogInfof("password of user %s is migrated", user.Login)
+    }
+    return dserr.Err(err)
+}
+
+// sealBStorePass moves bstore password to sealed secret, the password
+// must stay recoverable for outbound calls
+func (store *Store) sealBStorePass(bstore *dsdescr.BStore) error {
+    var err error
+    if len(bstore.Pass) == 0 {
+        return dserr.Err(err)
+    }
+    secret, err := store.secretBox.Seal([]byte(bstore.Pass))
+    if err != nil {
+        return dserr.Err(err)
+    }
+    bstore.Secret = secret
+    bstore.Pass = ""
+    return dserr.Err(err)
+}
+
+func (store *Store) openBStorePass(bstore *dsdescr.BStore) (string, error) {
+    var err error
+    var pass string
+    if len(bstore.Secret) == 0 {
+        if len(bstore.Pass) == 0 {
+            err = errors.New("bstore password not set")
+            return pass, dserr.Err(err)
+        }
+        return bstore.Pass, dserr.Err(err)
+    }
+    passBin, err := store.secretBox.Open(bstore.Secret)
+    if err != nil {
+        return pass, dserr.Err(err)
+    }
+    pass = string(passBin)
+    return pass, dserr.Err(err)
+}
+
+func (store *Store) bstoreAuth(bstore *dsdescr.BStore) (*dsrpc.Auth, error) {
+    var err error
+    var auth *dsrpc.Auth
+    pass, err := store.openBStorePass(bstore)
+    if err != nil {
+        return auth, dserr.Err(err)
+    }
+    auth = dsrpc.CreateAuth([]byte(bstore.Login), []byte(pass))
+    return auth, dserr.Err(err)
+}
+
+func stripBStore(bstore *dsdescr.BStore) *dsdescr.BStore {
+    stripped := *bstore
+    stripped.Pass   = ""
+    stripped.Secret = nil
+    return &stripped
+}
+
+// migrateBStores seals plain passwords of old records
+func (store *Store) migrateBStores() error {
+    var err error
+    bstores, err := store.reg.ListBStores()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, bstore := range bstores {
+        if len(bstore.Pass) == 0 {
+            continue
+        }
+        err = store.sealBStorePass(bstore)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        err = store.reg.PutBStore(bstore)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        dslog.LogInfof("password of bstore %s:%s is sealed", bstore.Address, bstore.Port)
+    }
+    return dserr.Err(err)
+}
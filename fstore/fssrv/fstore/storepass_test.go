@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "path/filepath"
+    "testing"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dskvdb"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dssecret"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestPass01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    // Records written by old version keep plain passwords
+    user := dsdescr.NewUser()
+    user.Login  = "admin"
+    user.Pass   = "admin"
+    user.Role   = dsdescr.URoleAdmin
+    user.State  = dsdescr.UStateEnabled
+    err = reg.PutUser(user)
+    require.NoError(t, err)
+
+    bstore := dsdescr.NewBStore()
+    bstore.Address  = "127.0.0.1"
+    bstore.Port     = "5101"
+    bstore.Login    = "admin"
+    bstore.Pass     = "qwerty"
+    bstore.State    = dsdescr.BSStateEnabled
+    err = reg.PutBStore(bstore)
+    require.NoError(t, err)
+
+    keyFile := filepath.Join(dataDir, "secret.key")
+    key, err := dssecret.LoadKey(keyFile)
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, nil)
+    require.NoError(t, err)
+    err = store.SetSecretKey(key)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+    err = store.SeedBStores()
+    require.NoError(t, err)
+
+    user, err = reg.GetUser("admin")
+    require.NoError(t, err)
+    require.Equal(t, "", user.Pass)
+    require.NotEmpty(t, user.PassKey)
+
+    ok, err := store.CheckUser("admin", "admin", "admin")
+    require.NoError(t, err)
+    require.Equal(t, true, ok)
+
+    ok, err = store.CheckUser("admin", "admin", "wrong")
+    require.NoError(t, err)
+    require.Equal(t, false, ok)
+
+    bstore, err = reg.GetBStore("127.0.0.1", "5101")
+    require.NoError(t, err)
+    require.Equal(t, "", bstore.Pass)
+    require.NotEmpty(t, bstore.Secret)
+
+    // Sealed password is opened by the store restarted with the same key
+    key, err = dssecret.LoadKey(keyFile)
+    require.NoError(t, err)
+    store, err = NewStore(dataDir, reg, nil)
+    require.NoError(t, err)
+    err = store.SetSecretKey(key)
+    require.NoError(t, err)
+
+    ok, err = store.CheckBStore("admin", "127.0.0.1", "5101", "admin", "qwerty")
+    require.NoError(t, err)
+    require.Equal(t, true, ok)
+
+    // Foreign key cannot open the secret
+    err = store.SetSecretKey(dssecret.NewKey())
+    require.NoError(t, err)
+    _, err = store.bstoreAuth(bstore)
+    require.Error(t, err)
+}
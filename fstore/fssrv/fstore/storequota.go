@@ -0,0 +1,315 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "errors"
+    "io"
+    "time"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+)
+
+// Quota is rechecked after each portion of the stream, so the lowered
+// quota stops uploads already in progress
+const quotaCheckSize int64 = 1024 * 1024 * 4
+
+// SetQuota sets limits of the user, zero value means no limit
+func (store *Store) SetQuota(authLogin, login string, quotaSize, quotaFiles int64) error {
+    var err error
+    if len(login) == 0 {
+        login = authLogin
+    }
+    role, err := store.getUserRole(authLogin)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", authLogin)
+        return dserr.Err(err)
+    }
+    if quotaSize < 0 || quotaFiles < 0 {
+        err = errors.New("quota cannot be negative")
+        return dserr.Err(err)
+    }
+    has, err := store.reg.HasUser(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("user %s not exists", login)
+        return dserr.Err(err)
+    }
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    user.QuotaSize  = quotaSize
+    user.QuotaFiles = quotaFiles
+    user.UpdatedAt  = time.Now().Unix()
+    err = store.reg.PutUser(user)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// GetUsage returns used space and limits, the user can see own usage only
+func (store *Store) GetUsage(authLogin, login string) (*dsdescr.Usage, error) {
+    var err error
+    usage := dsdescr.NewUsage()
+    if len(login) == 0 {
+        login = authLogin
+    }
+    role, err := store.getUserRole(authLogin)
+    if err != nil {
+        return usage, dserr.Err(err)
+    }
+    if authLogin != login && role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", authLogin)
+        return usage, dserr.Err(err)
+    }
+    has, err := store.reg.HasUser(login)
+    if err != nil {
+        return usage, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("user %s not exists", login)
+        return usage, dserr.Err(err)
+    }
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return usage, dserr.Err(err)
+    }
+    usage, err = store.reg.GetUsage(login)
+    if err != nil {
+        return usage, dserr.Err(err)
+    }
+    usage.QuotaSize  = user.QuotaSize
+    usage.QuotaFiles = user.QuotaFiles
+    return usage, dserr.Err(err)
+}
+
+// recountUsages builds usage records missed after upgrade
+func (store *Store) recountUsages() error {
+    var err error
+    users, err := store.reg.ListUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, user := range users {
+        has, err := store.reg.HasUsage(user.Login)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        if has {
+            continue
+        }
+        _, err = store.reg.RecountUsage(user.Login)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+// reserveQuota checks the limits against usage and running uploads
+// of the user and reserves the size up to the end of upload.
+// Size delta of overwritten file can be negative, new file adds one file.
+func (store *Store) reserveQuota(login string, sizeDelta int64, newFile bool) error {
+    var err error
+    store.quotaMtx.Lock()
+    defer store.quotaMtx.Unlock()
+    err = store.checkQuota(login, sizeDelta, newFile)
+    if err != nil {
+        return err
+    }
+    if sizeDelta > 0 {
+        store.reserved[login] += sizeDelta
+    }
+    return err
+}
+
+// reservePortion reserves the size or the rest of the quota if it is less
+func (store *Store) reservePortion(login string, size int64) (int64, error) {
+    var err error
+    var portion int64
+    store.quotaMtx.Lock()
+    defer store.quotaMtx.Unlock()
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return portion, dserr.Err(err)
+    }
+    portion = size
+    if user.QuotaSize > 0 {
+        usage, err := store.reg.GetUsage(login)
+        if err != nil {
+            return portion, dserr.Err(err)
+        }
+        used := usage.DataSize + store.reserved[login]
+        if used + portion > user.QuotaSize {
+            portion = user.QuotaSize - used
+        }
+        if portion < 1 {
+            err = dserr.NewQuotaError("user %s uses %d of %d bytes", login, used, user.QuotaSize)
+            return 0, dserr.Err(err)
+        }
+    }
+    store.reserved[login] += portion
+    return portion, dserr.Err(err)
+}
+
+func (store *Store) releaseQuota(login string, sizeDelta int64) {
+    if sizeDelta < 1 {
+        return
+    }
+    store.quotaMtx.Lock()
+    defer store.quotaMtx.Unlock()
+    store.reserved[login] -= sizeDelta
+    if store.reserved[login] < 1 {
+        delete(store.reserved, login)
+    }
+}
+
+// checkQuota is called under quota mutex
+func (store *Store) checkQuota(login string, sizeDelta int64, newFile bool) error {
+    var err error
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if user.QuotaSize == 0 && user.QuotaFiles == 0 {
+        return dserr.Err(err)
+    }
+    usage, err := store.reg.GetUsage(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if user.QuotaSize > 0 && sizeDelta > 0 {
+        used := usage.DataSize + store.reserved[login]
+        if used + sizeDelta > user.QuotaSize {
+            err = dserr.NewQuotaError("user %s uses %d of %d bytes, %d requested",
+                                            login, used, user.QuotaSize, sizeDelta)
+            return dserr.Err(err)
+        }
+    }
+    if user.QuotaFiles > 0 && newFile {
+        if usage.FileCount + 1 > user.QuotaFiles {
+            err = dserr.NewQuotaError("user %s has %d of %d files",
+                                            login, usage.FileCount, user.QuotaFiles)
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+// quotaReader cuts off the stream longer than reserved size
+// or the stream of user whose quota was lowered during upload.
+// Stream of unknown size reserves the quota by portions while it is read.
+type quotaReader struct {
+    store       *Store
+    reader      io.Reader
+    login       string
+    limit       int64
+    sizeDelta   int64
+    read        int64
+    checked     int64
+    grown       int64
+}
+
+// newQuotaReader makes the reader of the stream, negative limit
+// means unknown size of the stream
+func newQuotaReader(store *Store, reader io.Reader, login string, limit, sizeDelta int64) *quotaReader {
+    return &quotaReader{
+        store:      store,
+        reader:     reader,
+        login:      login,
+        limit:      limit,
+        sizeDelta:  sizeDelta,
+    }
+}
+
+func (qreader *quotaReader) Read(buffer []byte) (int, error) {
+    var err error
+    if qreader.limit < 0 {
+        return qreader.readGrown(buffer)
+    }
+    size, err := qreader.reader.Read(buffer)
+    qreader.read += int64(size)
+    if qreader.read > qreader.limit {
+        size -= int(qreader.read - qreader.limit)
+        qreader.read = qreader.limit
+        err = dserr.NewQuotaError("user %s sent more than declared %d bytes",
+                                            qreader.login, qreader.limit)
+        return size, err
+    }
+    // Shrinking overwrite is never stopped
+    if qreader.sizeDelta > 0 && qreader.read - qreader.checked >= quotaCheckSize {
+        qreader.checked = qreader.read
+        store := qreader.store
+        store.quotaMtx.Lock()
+        quotaErr := store.checkLowered(qreader.login)
+        store.quotaMtx.Unlock()
+        if quotaErr != nil {
+            return size, quotaErr
+        }
+    }
+    return size, err
+}
+
+// readGrown reserves next portion of quota before the data goes over the reserved size
+func (qreader *quotaReader) readGrown(buffer []byte) (int, error) {
+    var err error
+    if qreader.read == qreader.grown {
+        portion, err := qreader.store.reservePortion(qreader.login, quotaCheckSize)
+        if err != nil {
+            // The stream which fits exactly to the quota is not an error
+            probe := make([]byte, 1)
+            size, probeErr := qreader.reader.Read(probe)
+            if size == 0 && probeErr == io.EOF {
+                return 0, io.EOF
+            }
+            return 0, err
+        }
+        qreader.grown += portion
+    }
+    free := qreader.grown - qreader.read
+    if int64(len(buffer)) > free {
+        buffer = buffer[0:free]
+    }
+    size, err := qreader.reader.Read(buffer)
+    qreader.read += int64(size)
+    return size, err
+}
+
+// release returns the quota reserved by portions
+func (qreader *quotaReader) release() {
+    qreader.store.releaseQuota(qreader.login, qreader.grown)
+    qreader.grown = 0
+}
+
+// checkLowered is called under quota mutex, reserved sizes
+// of running uploads must fit to current quota
+func (store *Store) checkLowered(login string) error {
+    var err error
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if user.QuotaSize == 0 {
+        return dserr.Err(err)
+    }
+    usage, err := store.reg.GetUsage(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    used := usage.DataSize + store.reserved[login]
+    if used > user.QuotaSize {
+        err = dserr.NewQuotaError("user %s uses %d of %d bytes", login, used, user.QuotaSize)
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "bytes"
+    "io"
+    "math/rand"
+    "testing"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+// lowerReader lowers the quota of the user in the middle of upload
+type lowerReader struct {
+    reader      io.Reader
+    store       *Store
+    read        int64
+    lowered     bool
+}
+
+func (lreader *lowerReader) Read(buffer []byte) (int, error) {
+    size, err := lreader.reader.Read(buffer)
+    lreader.read += int64(size)
+    if !lreader.lowered && lreader.read > quotaCheckSize / 2 {
+        lreader.lowered = true
+        lreader.store.SetQuota("admin", "user", 1024, 0)
+    }
+    return size, err
+}
+
+func TestQuota01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024 * 1024
+    buffer := make([]byte, dataSize * 10)
+    rand.Read(buffer)
+
+    err = store.SetQuota("user", "user", dataSize * 3, 3)
+    require.Error(t, err)
+    err = store.SetQuota("admin", "user", dataSize * 3, 3)
+    require.NoError(t, err)
+
+    _, err = store.SaveFile(context.Background(), "user", "/a.bin", bytes.NewReader(buffer[:dataSize]), dataSize)
+    require.NoError(t, err)
+    _, err = store.SaveFile(context.Background(), "user", "/b.bin", bytes.NewReader(buffer[:dataSize]), dataSize)
+    require.NoError(t, err)
+
+    usage, err := store.GetUsage("user", "")
+    require.NoError(t, err)
+    require.Equal(t, dataSize * 2, usage.DataSize)
+    require.Equal(t, int64(2), usage.FileCount)
+    require.Equal(t, dataSize * 3, usage.QuotaSize)
+
+    _, err = store.GetUsage("user", "admin")
+    require.Error(t, err)
+
+    // Upload over the size quota is refused before streaming
+    _, err = store.SaveFile(context.Background(), "user", "/c.bin", bytes.NewReader(buffer[:dataSize * 2]), dataSize * 2)
+    require.Error(t, err)
+    require.True(t, dserr.IsQuota(err))
+    has, _, err := store.StatFile("user", "/c.bin")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    // Overwrite is charged by the size delta only
+    _, err = store.ReplaceFile(context.Background(), "user", "/b.bin", bytes.NewReader(buffer[:dataSize * 2]), dataSize * 2)
+    require.NoError(t, err)
+    _, err = store.AppendFile(context.Background(), "user", "/a.bin", dataSize, bytes.NewReader(buffer[:dataSize]), dataSize)
+    require.Error(t, err)
+    require.True(t, dserr.IsQuota(err))
+
+    // File count quota
+    err = store.SetQuota("admin", "user", 0, 2)
+    require.NoError(t, err)
+    _, err = store.SaveFile(context.Background(), "user", "/c.bin", bytes.NewReader(buffer[:10]), 10)
+    require.Error(t, err)
+    require.True(t, dserr.IsQuota(err))
+
+    // Quota lowered during upload cuts off the stream
+    err = store.SetQuota("admin", "user", dataSize * 20, 0)
+    require.NoError(t, err)
+    reader := &lowerReader{ reader: bytes.NewReader(buffer), store: store }
+    _, err = store.SaveFile(context.Background(), "user", "/d.bin", reader, dataSize * 10)
+    require.Error(t, err)
+    require.True(t, dserr.IsQuota(err))
+    has, _, err = store.StatFile("user", "/d.bin")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    usage, err = store.GetUsage("admin", "user")
+    require.NoError(t, err)
+    require.Equal(t, dataSize * 3, usage.DataSize)
+    require.Equal(t, int64(2), usage.FileCount)
+
+    // Lost counter is rebuilt at start
+    err = reg.DeleteUsage("user")
+    require.NoError(t, err)
+    err = store.SeedUsers()
+    require.NoError(t, err)
+    usage, err = store.GetUsage("admin", "user")
+    require.NoError(t, err)
+    require.Equal(t, dataSize * 3, usage.DataSize)
+    require.Equal(t, int64(2), usage.FileCount)
+}
+
+func TestQuota02(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1024 * 1024
+    buffer := make([]byte, dataSize * 10)
+    rand.Read(buffer)
+
+    err = store.SetQuota("admin", "user", dataSize * 3, 0)
+    require.NoError(t, err)
+
+    // Stream of unknown size reserves the quota while it is read
+    descr, err := store.SaveFile(context.Background(), "user", "/a.bin", bytes.NewReader(buffer[:dataSize * 2]), -1)
+    require.NoError(t, err)
+    require.Equal(t, dataSize * 2, descr.DataSize)
+
+    // Stream which fits exactly to the rest of quota
+    _, err = store.AppendFile(context.Background(), "user", "/a.bin", dataSize * 2, bytes.NewReader(buffer[:dataSize]), -1)
+    require.NoError(t, err)
+
+    _, err = store.SaveFile(context.Background(), "user", "/b.bin", bytes.NewReader(buffer[:10]), -1)
+    require.Error(t, err)
+    require.True(t, dserr.IsQuota(err))
+    has, _, err := store.StatFile("user", "/b.bin")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    err = store.SetQuota("admin", "user", dataSize * 8, 0)
+    require.NoError(t, err)
+    _, err = store.SaveFile(context.Background(), "user", "/b.bin", bytes.NewReader(buffer), -1)
+    require.Error(t, err)
+    require.True(t, dserr.IsQuota(err))
+    has, _, err = store.StatFile("user", "/b.bin")
+    require.NoError(t, err)
+    require.Equal(t, false, has)
+
+    usage, err := store.GetUsage("admin", "user")
+    require.NoError(t, err)
+    require.Equal(t, dataSize * 3, usage.DataSize)
+    require.Equal(t, 0, len(store.reserved))
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "fmt"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+    "dstore/fstore/fssrv/fsfile"
+)
+
+// HoldFile returns file descr and keeps file data until ReleaseFile call.
+// Zero version means current one, the version can be set as path@version also.
+func (store *Store) HoldFile(login string, filePath string, fileVer int64) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+    login, filePath, err = store.resolvePath(login, filePath, false)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+
+    store.refMtx.Lock()
+    defer store.refMtx.Unlock()
+    has, err := store.reg.HasFile(login, filePath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if !has && fileVer == 0 {
+        var isVer bool
+        filePath, fileVer, isVer = splitVersion(filePath)
+        if isVer {
+            has, err = store.reg.HasFile(login, filePath)
+            if err != nil {
+                return descr, dserr.Err(err)
+            }
+        }
+    }
+    if !has {
+        err = dserr.NewNotFoundError("file %s not exist", filePath)
+        return descr, dserr.Err(err)
+    }
+    descr, err = store.reg.GetFile(login, filePath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if fileVer != 0 && fileVer != descr.FileVer {
+        has, err = store.reg.HasVersion(login, filePath, fileVer)
+        if err != nil {
+            return descr, dserr.Err(err)
+        }
+        if !has {
+            err = dserr.NewNotFoundError("file %s version %d not exist", filePath, fileVer)
+            return descr, dserr.Err(err)
+        }
+        descr, err = store.reg.GetVersion(login, filePath, fileVer)
+        if err != nil {
+            return descr, dserr.Err(err)
+        }
+    }
+    store.fileRefs[descr.FileId]++
+    return descr, dserr.Err(err)
+}
+
+func (store *Store) ReleaseFile(descr *dsdescr.File) {
+    store.refMtx.Lock()
+    store.fileRefs[descr.FileId]--
+    if store.fileRefs[descr.FileId] > 0 {
+        store.refMtx.Unlock()
+        return
+    }
+    delete(store.fileRefs, descr.FileId)
+    dropped, isDropped := store.dropped[descr.FileId]
+    delete(store.dropped, descr.FileId)
+    crates := store.crates[descr.FileId]
+    delete(store.crates, descr.FileId)
+    store.refMtx.Unlock()
+
+    for _, crate := range crates {
+        err := fsfile.DropCrate(store.dataDir, store.reg, crate)
+        if err != nil {
+            dslog.LogErrorf("cannot drop replaced crate %s: %v", crate, err)
+        }
+    }
+    if isDropped {
+        err := store.dropPending(dropped)
+        if err != nil {
+            dslog.LogErrorf("cannot drop replaced file %s: %v", dropped.FilePath, err)
+        }
+    }
+}
+
+// replaceFile puts new descr in place of the file path. Replaced file is kept
+// as previous version or dropped after last reader release.
+func (store *Store) replaceFile(descr *dsdescr.File, tmpFilePath string) error {
+    var err error
+    var oldDescr *dsdescr.File
+
+    keepVers, err := store.keepVersions(descr.Login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+
+    store.refMtx.Lock()
+    has, err := store.reg.HasFile(descr.Login, descr.FilePath)
+    if err != nil {
+        store.refMtx.Unlock()
+        return dserr.Err(err)
+    }
+    if has {
+        oldDescr, err = store.reg.GetFile(descr.Login, descr.FilePath)
+        if err != nil {
+            store.refMtx.Unlock()
+            return dserr.Err(err)
+        }
+        descr.FileVer = oldDescr.FileVer + 1
+    }
+    // Single registry record is rewritten, readers see either old or new version
+    err = store.reg.PutFile(descr)
+    if err != nil {
+        store.refMtx.Unlock()
+        return dserr.Err(err)
+    }
+    err = store.reg.DeleteFile(descr.Login, tmpFilePath)
+    if err != nil {
+        store.refMtx.Unlock()
+        return dserr.Err(err)
+    }
+    if oldDescr == nil || oldDescr.FileId == descr.FileId {
+        store.refMtx.Unlock()
+        return dserr.Err(err)
+    }
+    if keepVers > 0 {
+        err = store.reg.PutVersion(oldDescr)
+        store.refMtx.Unlock()
+        if err != nil {
+            return dserr.Err(err)
+        }
+        err = store.pruneVersions(descr.Login, descr.FilePath)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        return dserr.Err(err)
+    }
+    store.refMtx.Unlock()
+    err = store.dropLater(oldDescr)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// dropLater drops file data now or after last reader release,
+// the drop is recorded in the registry until it is done
+func (store *Store) dropLater(descr *dsdescr.File) error {
+    var err error
+    err = store.reg.PutDrop(descr)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    store.refMtx.Lock()
+    if store.fileRefs[descr.FileId] > 0 {
+        store.dropped[descr.FileId] = descr
+        store.refMtx.Unlock()
+        return dserr.Err(err)
+    }
+    store.refMtx.Unlock()
+
+    err = store.dropPending(descr)
+    if err != nil {
+        dslog.LogErrorf("cannot drop file %s: %v", descr.FilePath, err)
+        err = nil
+    }
+    return dserr.Err(err)
+}
+
+// dropPending drops file data and the drop record
+func (store *Store) dropPending(descr *dsdescr.File) error {
+    var err error
+    err = store.dropFile(descr)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.reg.DeleteDrop(descr.FileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// ReplayDrops drops file data left by readers at the stop of the server
+func (store *Store) ReplayDrops() error {
+    var err error
+    descrs, err := store.reg.ListDrops()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        dslog.LogDebugf("replay drop of file %d", descr.FileId)
+        err = store.dropPending(descr)
+        if err != nil {
+            dslog.LogErrorf("cannot drop file %s: %v", descr.FilePath, err)
+            err = nil
+        }
+    }
+    return dserr.Err(err)
+}
+
+// holdWriter marks the file as being written and holds its data,
+// the second writer of the file is refused
+func (store *Store) holdWriter(login, filePath string) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+    store.refMtx.Lock()
+    defer store.refMtx.Unlock()
+    descr, err = store.reg.GetFile(login, filePath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if store.writers[descr.FileId] {
+        err = fmt.Errorf("file %s is being written", filePath)
+        return descr, dserr.Err(err)
+    }
+    store.writers[descr.FileId] = true
+    store.fileRefs[descr.FileId]++
+    return descr, dserr.Err(err)
+}
+
+func (store *Store) releaseWriter(descr *dsdescr.File) {
+    store.refMtx.Lock()
+    delete(store.writers, descr.FileId)
+    store.refMtx.Unlock()
+    store.ReleaseFile(descr)
+}
+
+// keepCrate keeps the crate replaced by the write of the file,
+// the crate is dropped after the last reader release
+func (store *Store) keepCrate(fileId int64, crate string) {
+    store.refMtx.Lock()
+    defer store.refMtx.Unlock()
+    store.crates[fileId] = append(store.crates[fileId], crate)
+}
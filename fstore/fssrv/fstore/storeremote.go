@@ -0,0 +1,218 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "net"
+
+    "dstore/bstore/bsfun"
+    "dstore/fstore/fssrv/fsfile"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+)
+
+func (store *Store) replicateFile(fileId int64) error {
+    var err error
+
+    bstores, err := store.enabledBStores()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if len(bstores) == 0 {
+        return dserr.Err(err)
+    }
+    blockDescrs, err := store.reg.ListBlocks(fileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    // Blocks of one batch go to different bstores as far as possible
+    slots := make(map[int64]int)
+    for _, descr := range blockDescrs {
+        if descr.DataSize < 1 {
+            continue
+        }
+        slot := int(descr.FileId + descr.BatchId) + slots[descr.BatchId]
+        slots[descr.BatchId]++
+        if descr.HasRemote {
+            continue
+        }
+        err := store.pushBlock(bstores, slot, descr)
+        if err != nil {
+            dslog.LogDebugf("cannot replicate block %d,%d,%d,%d: %v", descr.FileId,
+                                    descr.BatchId, descr.BlockType, descr.BlockId, err)
+            continue
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) pushBlock(bstores []*dsdescr.BStore, slot int, descr *dsdescr.Block) error {
+    var err error
+
+    // Previous holder of the block goes first, other bstores in round-robin order
+    order := make([]*dsdescr.BStore, 0, len(bstores))
+    slot = slot % len(bstores)
+    for i := range bstores {
+        bstore := bstores[(slot + i) % len(bstores)]
+        if bstore.Address == descr.BStoreAddr && bstore.Port == descr.BStorePort {
+            order = append([]*dsdescr.BStore{ bstore }, order...)
+            continue
+        }
+        order = append(order, bstore)
+    }
+
+    block, err := fsfile.OpenBlock(store.dataDir, store.reg, descr)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, bstore := range order {
+        crate, err := fsfile.OpenCrate(store.dataDir, descr.FilePath, fsfile.RDONLY)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        uri := bstoreURI(bstore.Address, bstore.Port)
+        auth, err := store.bstoreAuth(bstore)
+        if err != nil {
+            crate.Close()
+            return dserr.Err(err)
+        }
+        err = bsfun.SaveBlock(uri, auth, descr, crate, descr.DataSize)
+        crate.Close()
+        if err != nil {
+            dslog.LogDebugf("cannot save block to bstore %s: %v", uri, err)
+            continue
+        }
+        block.SetRemote(bstore.Address, bstore.Port)
+        err = store.reg.PutBlock(block.Descr())
+        if err != nil {
+            return dserr.Err(err)
+        }
+        return dserr.Err(err)
+    }
+    err = errors.New("no bstore accepted the block")
+    return dserr.Err(err)
+}
+
+func (store *Store) restoreBlocks(fileId int64) error {
+    var err error
+
+    blockDescrs, err := store.reg.ListBlocks(fileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, descr := range blockDescrs {
+        if descr.DataSize < 1 {
+            continue
+        }
+        block, err := fsfile.OpenBlock(store.dataDir, store.reg, descr)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        if block.HasCrate() {
+            continue
+        }
+        // Blocks that cannot be fetched are left to batch recovery
+        if !descr.HasRemote {
+            dslog.LogDebugf("block %d,%d,%d,%d lost", descr.FileId, descr.BatchId,
+                                                        descr.BlockType, descr.BlockId)
+            continue
+        }
+        err = store.fetchBlock(block, descr)
+        if err != nil {
+            dslog.LogDebugf("cannot fetch block %d,%d,%d,%d: %v", descr.FileId, descr.BatchId,
+                                                        descr.BlockType, descr.BlockId, err)
+            continue
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) fetchBlock(block *fsfile.Block, descr *dsdescr.Block) error {
+    var err error
+
+    has, err := store.reg.HasBStore(descr.BStoreAddr, descr.BStorePort)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if !has {
+        err = fmt.Errorf("bstore %s:%s not exist", descr.BStoreAddr, descr.BStorePort)
+        return dserr.Err(err)
+    }
+    bstore, err := store.reg.GetBStore(descr.BStoreAddr, descr.BStorePort)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    uri := bstoreURI(bstore.Address, bstore.Port)
+    auth, err := store.bstoreAuth(bstore)
+    if err != nil {
+        return dserr.Err(err)
+    }
+
+    buffer := bytes.NewBuffer(make([]byte, 0, descr.DataSize))
+    err = bsfun.LoadBlock(uri, auth, descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId, buffer)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = block.Restore(buffer)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.reg.PutBlock(block.Descr())
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) dropRemoteBlock(descr *dsdescr.Block) error {
+    var err error
+    if !descr.HasRemote {
+        return dserr.Err(err)
+    }
+    has, err := store.reg.HasBStore(descr.BStoreAddr, descr.BStorePort)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if !has {
+        return dserr.Err(err)
+    }
+    bstore, err := store.reg.GetBStore(descr.BStoreAddr, descr.BStorePort)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    uri := bstoreURI(bstore.Address, bstore.Port)
+    auth, err := store.bstoreAuth(bstore)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = bsfun.DeleteBlock(uri, auth, descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) enabledBStores() ([]*dsdescr.BStore, error) {
+    var err error
+    resDescrs := make([]*dsdescr.BStore, 0)
+    descrs, err := store.reg.ListBStores()
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        if descr.State == dsdescr.BSStateEnabled {
+            resDescrs = append(resDescrs, descr)
+        }
+    }
+    return resDescrs, dserr.Err(err)
+}
+
+func bstoreURI(address, port string) string {
+    return net.JoinHostPort(address, port)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "testing"
+    "bytes"
+    "math/rand"
+    "net"
+    "time"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/bstore/bsapi"
+    "dstore/bstore/bssrv/bscont"
+    "dstore/bstore/bssrv/bsreg"
+    "dstore/bstore/bssrv/bstore"
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+    "dstore/dscomm/dsrpc"
+    "dstore/fstore/fssrv/fsfile"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestRemote01(t *testing.T) {
+    var err error
+
+    bsAddr, bsReg := startBStore(t)
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    address, port, err := net.SplitHostPort(bsAddr)
+    require.NoError(t, err)
+    bsDescr := dsdescr.NewBStore()
+    bsDescr.Address = address
+    bsDescr.Port    = port
+    bsDescr.Login   = "admin"
+    bsDescr.Pass    = "admin"
+    bsDescr.State   = dsdescr.BSStateEnabled
+    err = reg.PutBStore(bsDescr)
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 1000 * 3
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+    reader := bytes.NewReader(buffer)
+
+    login := "admin"
+    fileName := "/remote.bin"
+    fileDescr, err := store.SaveFile(context.Background(), login, fileName, reader, dataSize)
+    require.NoError(t, err)
+
+    // All blocks with data must be pushed to bstore
+    blockDescrs, err := reg.ListBlocks(fileDescr.FileId)
+    require.NoError(t, err)
+    for _, descr := range blockDescrs {
+        if descr.DataSize < 1 {
+            continue
+        }
+        require.True(t, descr.HasLocal)
+        require.True(t, descr.HasRemote)
+        require.Equal(t, address, descr.BStoreAddr)
+        require.Equal(t, port, descr.BStorePort)
+
+        has, err := bsReg.HasBlock(descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId)
+        require.NoError(t, err)
+        require.True(t, has)
+    }
+
+    // Drop local crates, the file must be restored from bstore
+    for _, descr := range blockDescrs {
+        block, err := fsfile.OpenBlock(dataDir, reg, descr)
+        require.NoError(t, err)
+        err = block.Clean()
+        require.NoError(t, err)
+    }
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    // Remote blocks must be deleted with file
+    _, err = store.DeleteFile(login, fileName)
+    require.NoError(t, err)
+    remoteDescrs, err := bsReg.ListBlocks(fileDescr.FileId)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(remoteDescrs))
+}
+
+func startBStore(t *testing.T) (string, *bsreg.Reg) {
+    var err error
+
+    dataDir := t.TempDir()
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    require.NoError(t, err)
+    t.Cleanup(func() { db.Close() })
+
+    reg, err := bsreg.NewReg(db)
+    require.NoError(t, err)
+    store, err := bstore.NewStore(dataDir, reg)
+    require.NoError(t, err)
+    err = store.SeedUsers()
+    require.NoError(t, err)
+    contr, err := bscont.NewContr(store)
+    require.NoError(t, err)
+
+    serv := dsrpc.NewService()
+    serv.SetVerifierFunc(contr.UserVerifier)
+    serv.PreMiddleware(contr.AuthMidware(false))
+    serv.Handler(bsapi.SaveBlockMethod, contr.SaveBlockHandler)
+    serv.Handler(bsapi.LoadBlockMethod, contr.LoadBlockHandler)
+    serv.Handler(bsapi.ListBlocksMethod, contr.ListBlocksHandler)
+    serv.Handler(bsapi.DeleteBlockMethod, contr.DeleteBlockHandler)
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    require.NoError(t, err)
+    address := listener.Addr().String()
+    listener.Close()
+
+    go serv.Listen(address)
+    for i := 0; i < 50; i++ {
+        conn, err := net.Dial("tcp", address)
+        if err == nil {
+            conn.Close()
+            break
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+    return address, reg
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "strings"
+    "time"
+
+    "dstore/fstore/fssrv/fsfile"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+)
+
+const scrubBadLimit int = 100
+
+// SetScrubRate sets scrub read rate in bytes per second, zero disables scrubber
+func (store *Store) SetScrubRate(rate int64) {
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    store.scrubRate = rate
+    store.scrubStat.Rate = rate
+    store.scrubStat.Enabled = rate > 0
+}
+
+func (store *Store) SetScrubPause(pause time.Duration) {
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    store.scrubPause = pause
+}
+
+func (store *Store) ScrubStatus(login string) (*dsdescr.ScrubStatus, error) {
+    var err error
+    status := dsdescr.NewScrubStatus()
+    role, err := store.getUserRole(login)
+    if err != nil {
+        return status, dserr.Err(err)
+    }
+    if role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", login)
+        return status, dserr.Err(err)
+    }
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    *status = *store.scrubStat
+    if store.scrubStat.Current != nil {
+        current := *store.scrubStat.Current
+        current.BadBlocks = append([]*dsdescr.ScrubBlock{}, current.BadBlocks...)
+        status.Current = &current
+    }
+    return status, dserr.Err(err)
+}
+
+func (store *Store) StopScrubber() {
+    store.scrubCancel()
+    store.scrubWg.Wait()
+}
+
+// StartScrubber runs the scrub loop until StopScrubber
+func (store *Store) StartScrubber() {
+    store.scrubWg.Add(1)
+    go store.scrubber()
+}
+
+func (store *Store) scrubber() {
+    defer store.scrubWg.Done()
+
+    store.scrubMtx.Lock()
+    rate := store.scrubRate
+    pause := store.scrubPause
+    store.scrubMtx.Unlock()
+    if rate < 1 {
+        dslog.LogInfo("scrubber disabled")
+        return
+    }
+    for {
+        err := store.ScrubPass()
+        if err != nil {
+            dslog.LogErrorf("scrub pass error: %v", err)
+        }
+        select {
+            case <- store.scrubCtx.Done():
+                dslog.LogInfo("scrub loop canceled")
+                return
+            case <- time.After(pause):
+        }
+    }
+}
+
+// ScrubPass checks every stored block once
+func (store *Store) ScrubPass() error {
+    var err error
+
+    pass := dsdescr.NewScrubPass()
+    pass.StartedAt = time.Now().Unix()
+    store.scrubMtx.Lock()
+    store.scrubStat.Current = pass
+    store.scrubMtx.Unlock()
+
+    defer func() {
+        store.scrubMtx.Lock()
+        pass.FinishedAt = time.Now().Unix()
+        store.scrubStat.Passes++
+        store.scrubStat.Last = pass
+        store.scrubStat.Current = nil
+        store.scrubMtx.Unlock()
+    }()
+
+    users, err := store.reg.ListUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, user := range users {
+        fileDescrs, err := store.reg.ListFiles(user.Login)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        verDescrs, err := store.reg.ListVersions(user.Login, "")
+        if err != nil {
+            return dserr.Err(err)
+        }
+        fileDescrs = append(fileDescrs, verDescrs...)
+        for _, fileDescr := range fileDescrs {
+            // Files under upload are changing, trashed files are under cleaning
+            if strings.HasPrefix(fileDescr.FilePath, "/.tmp/") {
+                continue
+            }
+            if strings.HasPrefix(fileDescr.FilePath, trashDir) {
+                continue
+            }
+            blockDescrs, err := store.reg.ListBlocks(fileDescr.FileId)
+            if err != nil {
+                return dserr.Err(err)
+            }
+            for _, blockDescr := range blockDescrs {
+                if blockDescr.DataSize < 1 {
+                    continue
+                }
+                select {
+                    case <- store.scrubCtx.Done():
+                        return dserr.Err(err)
+                    default:
+                }
+                store.scrubBlock(pass, blockDescr)
+                store.scrubThrottle(blockDescr.DataSize)
+            }
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) scrubThrottle(size int64) {
+    store.scrubMtx.Lock()
+    rate := store.scrubRate
+    store.scrubMtx.Unlock()
+    if rate < 1 {
+        return
+    }
+    delay := time.Duration(size) * time.Second / time.Duration(rate)
+    select {
+        case <- store.scrubCtx.Done():
+        case <- time.After(delay):
+    }
+}
+
+func (store *Store) scrubBlock(pass *dsdescr.ScrubPass, descr *dsdescr.Block) {
+    state := checkBlock(store.dataDir, descr)
+    if state != dsdescr.ScrubHealthy {
+        // Block can be rewritten or deleted while checked
+        has, err := store.reg.HasBlock(descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId)
+        if err != nil || !has {
+            return
+        }
+        actual, err := store.reg.GetBlock(descr.FileId, descr.BatchId, descr.BlockType, descr.BlockId)
+        if err != nil || actual.FilePath != descr.FilePath {
+            return
+        }
+    }
+    var repaired bool
+    if state != dsdescr.ScrubHealthy {
+        err := store.repairBlock(descr)
+        if err != nil {
+            dslog.LogErrorf("cannot repair %s block %d,%d,%d,%d: %v", state, descr.FileId,
+                                descr.BatchId, descr.BlockType, descr.BlockId, err)
+        } else {
+            repaired = true
+        }
+    }
+
+    store.scrubMtx.Lock()
+    defer store.scrubMtx.Unlock()
+    pass.Checked++
+    pass.CheckedSize += descr.DataSize
+    switch state {
+        case dsdescr.ScrubHealthy:
+            pass.Healthy++
+            return
+        case dsdescr.ScrubCorrupt:
+            pass.Corrupt++
+        default:
+            pass.Missing++
+    }
+    if repaired {
+        pass.Repaired++
+    }
+    if len(pass.BadBlocks) < scrubBadLimit {
+        bad := &dsdescr.ScrubBlock{
+            FileId:     descr.FileId,
+            BatchId:    descr.BatchId,
+            BlockType:  descr.BlockType,
+            BlockId:    descr.BlockId,
+            State:      state,
+            Repaired:   repaired,
+            CheckedAt:  time.Now().Unix(),
+        }
+        pass.BadBlocks = append(pass.BadBlocks, bad)
+    }
+}
+
+func (store *Store) repairBlock(descr *dsdescr.Block) error {
+    var err error
+
+    block, err := fsfile.OpenBlock(store.dataDir, store.reg, descr)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if descr.HasRemote {
+        err = store.fetchBlock(block, descr)
+        if err == nil {
+            return dserr.Err(err)
+        }
+        dslog.LogDebugf("cannot fetch remote copy: %v", err)
+    }
+    batchDescr, err := store.reg.GetBatch(descr.FileId, descr.BatchId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    batch, err := fsfile.OpenBatch(store.dataDir, store.reg, batchDescr)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = batch.Repair(descr.BlockType, descr.BlockId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    // Rebuilt reco blocks have no remote copy
+    err = store.replicateFile(descr.FileId)
+    if err != nil {
+        dslog.LogDebugf("replication error: %v", err)
+        err = nil
+    }
+    return dserr.Err(err)
+}
+
+func checkBlock(dataDir string, descr *dsdescr.Block) string {
+    block, err := fsfile.OpenBlock(dataDir, nil, descr)
+    if err != nil {
+        return dsdescr.ScrubMissing
+    }
+    if !block.HasCrate() {
+        return dsdescr.ScrubMissing
+    }
+    err = block.Verify()
+    if dserr.IsCorrupt(err) {
+        return dsdescr.ScrubCorrupt
+    }
+    if err != nil {
+        return dsdescr.ScrubMissing
+    }
+    return dsdescr.ScrubHealthy
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "testing"
+    "bytes"
+    "math/rand"
+    "os"
+    "path/filepath"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestScrub01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 1000 * 3
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+    reader := bytes.NewReader(buffer)
+
+    login := "admin"
+    fileName := "/scrub.bin"
+    fileDescr, err := store.SaveFile(context.Background(), login, fileName, reader, dataSize)
+    require.NoError(t, err)
+
+    err = store.ScrubPass()
+    require.NoError(t, err)
+    status, err := store.ScrubStatus(login)
+    require.NoError(t, err)
+    require.Equal(t, int64(1), status.Passes)
+    require.True(t, status.Last.Checked > 0)
+    require.Equal(t, status.Last.Checked, status.Last.Healthy)
+
+    // Damage first block and drop second one
+    blockDescrs, err := reg.ListBlocks(fileDescr.FileId)
+    require.NoError(t, err)
+    damaged := 0
+    for _, descr := range blockDescrs {
+        if descr.DataSize < 1 || descr.BatchId != 0 {
+            continue
+        }
+        fullPath := filepath.Join(dataDir, descr.FilePath)
+        switch damaged {
+            case 0:
+                data, err := os.ReadFile(fullPath)
+                require.NoError(t, err)
+                data[0] ^= 0xff
+                err = os.WriteFile(fullPath, data, 0644)
+                require.NoError(t, err)
+            case 1:
+                err = os.Remove(fullPath)
+                require.NoError(t, err)
+        }
+        damaged++
+        if damaged > 1 {
+            break
+        }
+    }
+    require.Equal(t, 2, damaged)
+
+    err = store.ScrubPass()
+    require.NoError(t, err)
+    status, err = store.ScrubStatus(login)
+    require.NoError(t, err)
+    require.Equal(t, int64(2), status.Passes)
+    require.Equal(t, int64(1), status.Last.Corrupt)
+    require.Equal(t, int64(1), status.Last.Missing)
+    require.Equal(t, int64(2), status.Last.Repaired)
+    require.Equal(t, 2, len(status.Last.BadBlocks))
+
+    // Repaired blocks pass next check
+    err = store.ScrubPass()
+    require.NoError(t, err)
+    status, err = store.ScrubStatus(login)
+    require.NoError(t, err)
+    require.Equal(t, status.Last.Checked, status.Last.Healthy)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "path"
+    "strings"
+    "time"
+
+    encoder "github.com/vmihailenco/msgpack/v5"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dssecret"
+)
+
+// Session token is signed claims of the login, the server keeps nothing.
+// API key is random secret, the server keeps only its hash and the scope.
+const sessionPrefix  string = "dss1"
+const apiKeyPrefix   string = "dsk1"
+const tokenSep       string = "."
+
+const apiKeyIdSize      int = 8
+const apiKeySecretSize  int = 32
+
+type sessionClaims struct {
+    Login       string      `msgpack:"login"`
+    IssuedAt    int64       `msgpack:"issuedAt"`
+    ExpiresAt   int64       `msgpack:"expiresAt"`
+}
+
+// SetSessionTTL sets default and maximal lifetime of session token
+func (store *Store) SetSessionTTL(ttl time.Duration) {
+    store.sessionTTL = ttl
+}
+
+// CreateSession issues signed session token for the login
+func (store *Store) CreateSession(login string, ttl time.Duration) (string, int64, error) {
+    var err error
+    var token string
+    var expiresAt int64
+    has, err := store.reg.HasUser(login)
+    if err != nil {
+        return token, expiresAt, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("user %s not exists", login)
+        return token, expiresAt, dserr.Err(err)
+    }
+    if ttl < 1 || ttl > store.sessionTTL {
+        ttl = store.sessionTTL
+    }
+    now := time.Now()
+    claims := &sessionClaims{
+        Login:      login,
+        IssuedAt:   now.Unix(),
+        ExpiresAt:  now.Add(ttl).Unix(),
+    }
+    claimsBin, err := encoder.Marshal(claims)
+    if err != nil {
+        return token, expiresAt, dserr.Err(err)
+    }
+    payload := sessionPrefix + tokenSep + encodeToken(claimsBin)
+    sign := dssecret.Sign(store.tokenKey, []byte(payload))
+    token = payload + tokenSep + encodeToken(sign)
+    expiresAt = claims.ExpiresAt
+    return token, expiresAt, dserr.Err(err)
+}
+
+// CheckToken returns the login of session token or API key,
+// the key descr is returned for API key only
+func (store *Store) CheckToken(token string) (string, *dsdescr.APIKey, error) {
+    var err error
+    var login string
+    var apiKey *dsdescr.APIKey
+    switch {
+        case strings.HasPrefix(token, sessionPrefix + tokenSep):
+            login, err = store.checkSession(token)
+        case strings.HasPrefix(token, apiKeyPrefix + tokenSep):
+            apiKey, err = store.checkAPIKey(token)
+            if err == nil {
+                login = apiKey.Login
+            }
+        default:
+            err = errors.New("unknown token type")
+    }
+    if err != nil {
+        return login, apiKey, dserr.Err(err)
+    }
+    // Deleted user loses his tokens
+    has, err := store.reg.HasUser(login)
+    if err != nil {
+        return login, apiKey, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("user %s not exists", login)
+        return login, apiKey, dserr.Err(err)
+    }
+    return login, apiKey, dserr.Err(err)
+}
+
+func (store *Store) checkSession(token string) (string, error) {
+    var err error
+    var login string
+    parts := strings.Split(token, tokenSep)
+    if len(parts) != 3 {
+        err = errors.New("malformed session token")
+        return login, dserr.Err(err)
+    }
+    sign, err := decodeToken(parts[2])
+    if err != nil {
+        return login, dserr.Err(err)
+    }
+    payload := parts[0] + tokenSep + parts[1]
+    if !dssecret.CheckSign(store.tokenKey, []byte(payload), sign) {
+        err = errors.New("wrong session token sign")
+        return login, dserr.Err(err)
+    }
+    claimsBin, err := decodeToken(parts[1])
+    if err != nil {
+        return login, dserr.Err(err)
+    }
+    claims := &sessionClaims{}
+    err = encoder.Unmarshal(claimsBin, claims)
+    if err != nil {
+        return login, dserr.Err(err)
+    }
+    if time.Now().Unix() >= claims.ExpiresAt {
+        err = errors.New("session token expired")
+        return login, dserr.Err(err)
+    }
+    login = claims.Login
+    return login, dserr.Err(err)
+}
+
+// CreateAPIKey makes new key for the key login, the key is
+// returned only once. Admin can create keys of other users.
+func (store *Store) CreateAPIKey(authLogin string, apiKey *dsdescr.APIKey, ttl time.Duration) (string, *dsdescr.APIKey, error) {
+    var err error
+    var token string
+    newKey := dsdescr.NewAPIKey()
+    login := apiKey.Login
+    if len(login) == 0 {
+        login = authLogin
+    }
+    err = store.checkKeyRights(authLogin, login)
+    if err != nil {
+        return token, newKey, dserr.Err(err)
+    }
+    has, err := store.reg.HasUser(login)
+    if err != nil {
+        return token, newKey, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("user %s not exists", login)
+        return token, newKey, dserr.Err(err)
+    }
+    pathPrefix, err := cleanPathPrefix(apiKey.PathPrefix)
+    if err != nil {
+        return token, newKey, dserr.Err(err)
+    }
+    keyId := make([]byte, apiKeyIdSize)
+    _, err = rand.Read(keyId)
+    if err != nil {
+        return token, newKey, dserr.Err(err)
+    }
+    secret := make([]byte, apiKeySecretSize)
+    _, err = rand.Read(secret)
+    if err != nil {
+        return token, newKey, dserr.Err(err)
+    }
+    secretStr := encodeToken(secret)
+    hash := sha256.Sum256([]byte(secretStr))
+
+    newKey.KeyId        = hex.EncodeToString(keyId)
+    newKey.Login        = login
+    newKey.Name         = apiKey.Name
+    newKey.Hash         = hash[:]
+    newKey.ReadOnly     = apiKey.ReadOnly
+    newKey.PathPrefix   = pathPrefix
+    newKey.CreatedAt    = time.Now().Unix()
+    newKey.UpdatedAt    = newKey.CreatedAt
+    if ttl > 0 {
+        newKey.ExpiresAt = time.Now().Add(ttl).Unix()
+    }
+    err = store.reg.PutAPIKey(newKey)
+    if err != nil {
+        return token, newKey, dserr.Err(err)
+    }
+    token = apiKeyPrefix + tokenSep + newKey.KeyId + tokenSep + secretStr
+    return token, stripAPIKey(newKey), dserr.Err(err)
+}
+
+func (store *Store) checkAPIKey(token string) (*dsdescr.APIKey, error) {
+    var err error
+    var apiKey *dsdescr.APIKey
+    parts := strings.Split(token, tokenSep)
+    if len(parts) != 3 {
+        err = errors.New("malformed api key")
+        return apiKey, dserr.Err(err)
+    }
+    keyId := parts[1]
+    has, err := store.reg.HasAPIKey(keyId)
+    if err != nil {
+        return apiKey, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("api key %s not exists", keyId)
+        return apiKey, dserr.Err(err)
+    }
+    apiKey, err = store.reg.GetAPIKey(keyId)
+    if err != nil {
+        return apiKey, dserr.Err(err)
+    }
+    hash := sha256.Sum256([]byte(parts[2]))
+    if subtle.ConstantTimeCompare(hash[:], apiKey.Hash) != 1 {
+        err = fmt.Errorf("wrong secret of api key %s", keyId)
+        return apiKey, dserr.Err(err)
+    }
+    if apiKey.ExpiresAt > 0 && time.Now().Unix() >= apiKey.ExpiresAt {
+        err = fmt.Errorf("api key %s expired", keyId)
+        return apiKey, dserr.Err(err)
+    }
+    return apiKey, dserr.Err(err)
+}
+
+// ListAPIKeys returns keys without hashes, empty login means own keys
+// of user or all keys for admin
+func (store *Store) ListAPIKeys(authLogin, login string) ([]*dsdescr.APIKey, error) {
+    var err error
+    resDescrs := make([]*dsdescr.APIKey, 0)
+    role, err := store.getUserRole(authLogin)
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    if len(login) == 0 && role != dsdescr.URoleAdmin {
+        login = authLogin
+    }
+    if len(login) > 0 {
+        err = store.checkKeyRights(authLogin, login)
+        if err != nil {
+            return resDescrs, dserr.Err(err)
+        }
+    }
+    descrs, err := store.reg.ListAPIKeys(login)
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        resDescrs = append(resDescrs, stripAPIKey(descr))
+    }
+    return resDescrs, dserr.Err(err)
+}
+
+// RevokeAPIKey deletes the key, the owner or admin can revoke the key
+func (store *Store) RevokeAPIKey(authLogin, keyId string) error {
+    var err error
+    has, err := store.reg.HasAPIKey(keyId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("api key %s not exists", keyId)
+        return dserr.Err(err)
+    }
+    apiKey, err := store.reg.GetAPIKey(keyId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.checkKeyRights(authLogin, apiKey.Login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.reg.DeleteAPIKey(keyId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+// revokeUserKeys deletes all keys of the deleted user
+func (store *Store) revokeUserKeys(login string) error {
+    var err error
+    descrs, err := store.reg.ListAPIKeys(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        err = store.reg.DeleteAPIKey(descr.KeyId)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) checkKeyRights(authLogin, login string) error {
+    var err error
+    role, err := store.getUserRole(authLogin)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if authLogin != login && role != dsdescr.URoleAdmin {
+        err = dserr.NewAccessError("insufficient rights for %s", authLogin)
+        return dserr.Err(err)
+    }
+    return dserr.Err(err)
+}
+
+func stripAPIKey(apiKey *dsdescr.APIKey) *dsdescr.APIKey {
+    stripped := *apiKey
+    stripped.Hash = nil
+    return &stripped
+}
+
+// cleanPathPrefix makes absolute directory path of the prefix
+func cleanPathPrefix(pathPrefix string) (string, error) {
+    var err error
+    if len(pathPrefix) == 0 {
+        return pathPrefix, dserr.Err(err)
+    }
+    pathPrefix = path.Clean("/" + pathPrefix)
+    if strings.ContainsAny(pathPrefix, "*?[]\\") {
+        err = fmt.Errorf("path prefix %s contains pattern chars", pathPrefix)
+        return pathPrefix, dserr.Err(err)
+    }
+    return pathPrefix, dserr.Err(err)
+}
+
+// InPathPrefix checks that the path is the prefix or is placed under it
+func InPathPrefix(pathPrefix, filePath string) bool {
+    if len(pathPrefix) == 0 || pathPrefix == "/" {
+        return true
+    }
+    filePath = path.Clean("/" + filePath)
+    return filePath == pathPrefix || strings.HasPrefix(filePath, pathPrefix + "/")
+}
+
+func encodeToken(data []byte) string {
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeToken(data string) ([]byte, error) {
+    res, err := base64.RawURLEncoding.DecodeString(data)
+    if err != nil {
+        err = errors.New("malformed token")
+    }
+    return res, err
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "strings"
+    "testing"
+    "time"
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dskvdb"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dssecret"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestToken01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, nil)
+    require.NoError(t, err)
+    key := dssecret.NewKey()
+    err = store.SetSecretKey(key)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    // Session token
+    token, expiresAt, err := store.CreateSession("user", 24 * time.Hour)
+    require.NoError(t, err)
+    require.LessOrEqual(t, expiresAt, time.Now().Add(store.sessionTTL).Unix())
+
+    login, apiKey, err := store.CheckToken(token)
+    require.NoError(t, err)
+    require.Equal(t, "user", login)
+    require.Nil(t, apiKey)
+
+    _, _, err = store.CreateSession("wrong", 0)
+    require.Error(t, err)
+
+    parts := strings.Split(token, tokenSep)
+    forged, _, err := store.CreateSession("admin", 0)
+    require.NoError(t, err)
+    forgedParts := strings.Split(forged, tokenSep)
+    _, _, err = store.CheckToken(strings.Join([]string{ parts[0], forgedParts[1], parts[2] }, tokenSep))
+    require.Error(t, err)
+
+    // Token of restarted store with the same key is valid
+    store2, err := NewStore(dataDir, reg, nil)
+    require.NoError(t, err)
+    _, _, err = store2.CheckToken(token)
+    require.Error(t, err)
+    err = store2.SetSecretKey(key)
+    require.NoError(t, err)
+    _, _, err = store2.CheckToken(token)
+    require.NoError(t, err)
+
+    store.SetSessionTTL(time.Second)
+    token, _, err = store.CreateSession("user", 0)
+    require.NoError(t, err)
+    time.Sleep(1100 * time.Millisecond)
+    _, _, err = store.CheckToken(token)
+    require.Error(t, err)
+
+    // API keys
+    descr := dsdescr.NewAPIKey()
+    descr.Name          = "ci"
+    descr.ReadOnly      = true
+    descr.PathPrefix    = "ci/builds/"
+    keyToken, keyDescr, err := store.CreateAPIKey("user", descr, 0)
+    require.NoError(t, err)
+    require.Equal(t, "user", keyDescr.Login)
+    require.Equal(t, "/ci/builds", keyDescr.PathPrefix)
+    require.Empty(t, keyDescr.Hash)
+
+    login, apiKey, err = store.CheckToken(keyToken)
+    require.NoError(t, err)
+    require.Equal(t, "user", login)
+    require.Equal(t, true, apiKey.ReadOnly)
+
+    _, _, err = store.CheckToken(keyToken + "x")
+    require.Error(t, err)
+
+    descr = dsdescr.NewAPIKey()
+    descr.Login = "admin"
+    _, _, err = store.CreateAPIKey("user", descr, 0)
+    require.Error(t, err)
+    adminToken, _, err := store.CreateAPIKey("admin", descr, time.Hour)
+    require.NoError(t, err)
+
+    descr = dsdescr.NewAPIKey()
+    descr.PathPrefix = "/ci/*"
+    _, _, err = store.CreateAPIKey("user", descr, 0)
+    require.Error(t, err)
+
+    keys, err := store.ListAPIKeys("user", "")
+    require.NoError(t, err)
+    require.Equal(t, 1, len(keys))
+    require.Empty(t, keys[0].Hash)
+
+    _, err = store.ListAPIKeys("user", "admin")
+    require.Error(t, err)
+
+    keys, err = store.ListAPIKeys("admin", "")
+    require.NoError(t, err)
+    require.Equal(t, 2, len(keys))
+
+    var adminKeyId string
+    for _, key := range keys {
+        if key.Login == "admin" {
+            adminKeyId = key.KeyId
+        }
+    }
+    err = store.RevokeAPIKey("user", adminKeyId)
+    require.Error(t, err)
+    err = store.RevokeAPIKey("user", keyDescr.KeyId)
+    require.NoError(t, err)
+    _, _, err = store.CheckToken(keyToken)
+    require.Error(t, err)
+
+    _, _, err = store.CheckToken(adminToken)
+    require.NoError(t, err)
+
+    // Keys of deleted user are revoked
+    descr = dsdescr.NewAPIKey()
+    keyToken, _, err = store.CreateAPIKey("user", descr, 0)
+    require.NoError(t, err)
+    err = store.DeleteUser("admin", "user")
+    require.NoError(t, err)
+    _, _, err = store.CheckToken(keyToken)
+    require.Error(t, err)
+    keys, err = store.ListAPIKeys("admin", "user")
+    require.NoError(t, err)
+    require.Equal(t, 0, len(keys))
+}
+
+func TestPathPrefix01(t *testing.T) {
+    require.True(t, InPathPrefix("", "/any"))
+    require.True(t, InPathPrefix("/ci", "/ci"))
+    require.True(t, InPathPrefix("/ci", "/ci/a/b"))
+    require.True(t, InPathPrefix("/ci", "ci/a"))
+    require.True(t, InPathPrefix("/ci", "/ci/*.tgz"))
+    require.False(t, InPathPrefix("/ci", "/cidata"))
+    require.False(t, InPathPrefix("/ci", "/ci/../etc"))
+    require.False(t, InPathPrefix("/ci", "/*"))
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+    "dstore/dscomm/dslog"
+)
+
+const trashDir string = "/.trash/"
+
+func (store *Store) SetTrashPause(pause time.Duration) {
+    store.trashMtx.Lock()
+    defer store.trashMtx.Unlock()
+    store.trashPause = pause
+}
+
+func (store *Store) ListTrash(login string) ([]*dsdescr.File, error) {
+    var err error
+    resDescrs := make([]*dsdescr.File, 0)
+    descrs, err := store.reg.ListFiles(login)
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        if strings.HasPrefix(descr.FilePath, trashDir) {
+            resDescrs = append(resDescrs, descr)
+        }
+    }
+    return resDescrs, dserr.Err(err)
+}
+
+// RestoreTrash moves trashed file back to the origin or to the destination path
+// if the file data are still recoverable
+func (store *Store) RestoreTrash(login, trashPath, destPath string) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+
+    trashPath = cleanPath(trashPath)
+    if !strings.HasPrefix(trashPath, trashDir) {
+        err = fmt.Errorf("file %s not in trash", trashPath)
+        return descr, dserr.Err(err)
+    }
+    has, err := store.reg.HasFile(login, trashPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if !has {
+        err = dserr.NewNotFoundError("file %s not exist", trashPath)
+        return descr, dserr.Err(err)
+    }
+    descr, err = store.reg.GetFile(login, trashPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if len(destPath) == 0 {
+        destPath = trashOrigin(trashPath)
+    }
+    destPath = cleanPath(destPath)
+
+    err = store.checkTrash(descr)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+
+    store.refMtx.Lock()
+    defer store.refMtx.Unlock()
+    has, err = store.reg.HasFile(login, destPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    if has {
+        err = dserr.NewExistsError("file %s already exist", destPath)
+        return descr, dserr.Err(err)
+    }
+    descr.FilePath = destPath
+    err = store.reg.PutFile(descr)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    err = store.reg.DeleteFile(login, trashPath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    return descr, dserr.Err(err)
+}
+
+// PurgeTrash cleans data of the trashed file, empty path means all trashed files
+func (store *Store) PurgeTrash(login, trashPath string) ([]*dsdescr.File, error) {
+    var err error
+    resDescrs := make([]*dsdescr.File, 0)
+
+    descrs, err := store.ListTrash(login)
+    if err != nil {
+        return resDescrs, dserr.Err(err)
+    }
+    if len(trashPath) > 0 {
+        trashPath = cleanPath(trashPath)
+        if !strings.HasPrefix(trashPath, trashDir) {
+            err = fmt.Errorf("file %s not in trash", trashPath)
+            return resDescrs, dserr.Err(err)
+        }
+    }
+    var found bool
+    for _, descr := range descrs {
+        if len(trashPath) > 0 && descr.FilePath != trashPath {
+            continue
+        }
+        found = true
+        if !store.purgeTrash(descr) {
+            err = fmt.Errorf("cannot clean trashed file %s", descr.FilePath)
+            return resDescrs, dserr.Err(err)
+        }
+        resDescrs = append(resDescrs, descr)
+    }
+    if len(trashPath) > 0 && !found {
+        err = dserr.NewNotFoundError("file %s not exist", trashPath)
+        return resDescrs, dserr.Err(err)
+    }
+    return resDescrs, dserr.Err(err)
+}
+
+func (store *Store) StopTrashCleaner() {
+    store.trashCancel()
+    store.trashWg.Wait()
+}
+
+// StartTrashCleaner runs the loop which periodically retries
+// cleaning of trashed files until StopTrashCleaner
+func (store *Store) StartTrashCleaner() {
+    store.trashWg.Add(1)
+    go store.trashCleaner()
+}
+
+func (store *Store) trashCleaner() {
+    defer store.trashWg.Done()
+
+    store.trashMtx.Lock()
+    pause := store.trashPause
+    store.trashMtx.Unlock()
+    if pause < 1 {
+        dslog.LogInfo("trash cleaner disabled")
+        return
+    }
+    for {
+        select {
+            case <- store.trashCtx.Done():
+                dslog.LogInfo("trash loop canceled")
+                return
+            case <- time.After(pause):
+        }
+        err := store.CleanTrash()
+        if err != nil {
+            dslog.LogErrorf("trash clean error: %v", err)
+        }
+    }
+}
+
+// CleanTrash tries to clean all trashed files
+func (store *Store) CleanTrash() error {
+    var err error
+    users, err := store.reg.ListUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, user := range users {
+        descrs, err := store.ListTrash(user.Login)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        for _, descr := range descrs {
+            select {
+                case <- store.trashCtx.Done():
+                    return dserr.Err(err)
+                default:
+            }
+            if !store.purgeTrash(descr) {
+                dslog.LogDebugf("cannot clean trashed file %s", descr.FilePath)
+            }
+        }
+    }
+    return dserr.Err(err)
+}
+
+func (store *Store) purgeTrash(descr *dsdescr.File) bool {
+    if !store.cleanFile(descr) {
+        return false
+    }
+    err := store.reg.DeleteFile(descr.Login, descr.FilePath)
+    if err != nil {
+        return false
+    }
+    store.fileAlloc.FreeId(descr.FileId)
+    dslog.LogDebugf("trashed file %s cleaned", descr.FilePath)
+    return true
+}
+
+// checkTrash checks that no batch of the trashed file lost more blocks than it can recover
+func (store *Store) checkTrash(descr *dsdescr.File) error {
+    var err error
+    batchDescrs, err := store.reg.ListBatchs(descr.FileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    if int64(len(batchDescrs)) != descr.BatchCount {
+        err = fmt.Errorf("file %s batchs are lost", descr.FilePath)
+        return dserr.Err(err)
+    }
+    err = store.restoreBlocks(descr.FileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    blockDescrs, err := store.reg.ListBlocks(descr.FileId)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    blockCount := descr.BatchCount * (descr.BatchSize + descr.RecoCount)
+    if int64(len(blockDescrs)) != blockCount {
+        err = fmt.Errorf("file %s blocks are lost", descr.FilePath)
+        return dserr.Err(err)
+    }
+    lost := make(map[int64]int64)
+    for _, blockDescr := range blockDescrs {
+        if checkBlock(store.dataDir, blockDescr) == dsdescr.ScrubHealthy || blockDescr.DataSize < 1 {
+            continue
+        }
+        lost[blockDescr.BatchId]++
+        if lost[blockDescr.BatchId] > descr.RecoCount {
+            err = fmt.Errorf("file %s batch %d cannot be recovered", descr.FilePath, blockDescr.BatchId)
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+// trashOrigin returns original path of trashed file
+func trashOrigin(trashPath string) string {
+    path := strings.TrimPrefix(trashPath, trashDir)
+    i := strings.Index(path, "/")
+    if i < 0 {
+        return "/" + path
+    }
+    return path[i:]
+}
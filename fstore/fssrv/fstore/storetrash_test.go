@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "context"
+    "testing"
+    "bytes"
+    "math/rand"
+
+    "github.com/stretchr/testify/require"
+
+    "dstore/dscomm/dsalloc"
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dskvdb"
+    "dstore/fstore/fssrv/fsreg"
+)
+
+func TestTrash01(t *testing.T) {
+    var err error
+
+    dataDir := t.TempDir()
+
+    db, err := dskvdb.OpenDB(dataDir, "storedb")
+    defer db.Close()
+    require.NoError(t, err)
+
+    reg, err := fsreg.NewReg(db)
+    require.NoError(t, err)
+
+    idAlloc, err := dsalloc.OpenAlloc(db, []byte("fileIds"))
+    require.NoError(t, err)
+
+    store, err := NewStore(dataDir, reg, idAlloc)
+    require.NoError(t, err)
+
+    err = store.SeedUsers()
+    require.NoError(t, err)
+
+    var dataSize int64 = 1000 * 1000
+    buffer := make([]byte, dataSize)
+    rand.Read(buffer)
+
+    login := "admin"
+    fileName := "/trash.bin"
+    descr, err := store.SaveFile(context.Background(), login, fileName, bytes.NewReader(buffer), dataSize)
+    require.NoError(t, err)
+
+    // Block held by unreachable bstore keeps file in trash
+    bsDescr := dsdescr.NewBStore()
+    bsDescr.Address = "127.0.0.1"
+    bsDescr.Port    = "1"
+    bsDescr.State   = dsdescr.BSStateDisabled
+    err = reg.PutBStore(bsDescr)
+    require.NoError(t, err)
+
+    blockDescr, err := reg.GetBlock(descr.FileId, 0, dsdescr.BTData, 0)
+    require.NoError(t, err)
+    blockDescr.HasRemote  = true
+    blockDescr.BStoreAddr = bsDescr.Address
+    blockDescr.BStorePort = bsDescr.Port
+    err = reg.PutBlock(blockDescr)
+    require.NoError(t, err)
+
+    _, err = store.DeleteFile(login, fileName)
+    require.NoError(t, err)
+
+    // Trashed file is whole and can be restored
+    descrs, err := store.ListTrash(login)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(descrs))
+    trashPath := descrs[0].FilePath
+    require.Equal(t, fileName, trashOrigin(trashPath))
+
+    _, err = store.RestoreTrash(login, fileName, "")
+    require.Error(t, err)
+    _, err = store.RestoreTrash(login, trashPath, "")
+    require.NoError(t, err)
+
+    writer := bytes.NewBuffer(nil)
+    err = store.LoadFile(context.Background(), login, fileName, writer)
+    require.NoError(t, err)
+    require.Equal(t, buffer, writer.Bytes())
+
+    descrs, err = store.ListTrash(login)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(descrs))
+
+    _, err = store.DeleteFile(login, fileName)
+    require.NoError(t, err)
+    descrs, err = store.ListTrash(login)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(descrs))
+
+    err = store.CleanTrash()
+    require.NoError(t, err)
+    descrs, err = store.ListTrash(login)
+    require.NoError(t, err)
+    require.Equal(t, 1, len(descrs))
+
+    _, err = store.PurgeTrash(login, descrs[0].FilePath)
+    require.Error(t, err)
+
+    // Cleaner succeeds when the bstore is gone
+    err = reg.DeleteBStore(bsDescr.Address, bsDescr.Port)
+    require.NoError(t, err)
+    err = store.CleanTrash()
+    require.NoError(t, err)
+
+    descrs, err = store.ListTrash(login)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(descrs))
+    blockDescrs, err := reg.ListBlocks(descr.FileId)
+    require.NoError(t, err)
+    require.Equal(t, 0, len(blockDescrs))
+}
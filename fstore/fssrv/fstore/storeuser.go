@@ -22,6 +22,14 @@ const defaultPass       string  = "user"
 
 func (store *Store) SeedUsers() error {
     var err error
+    err = store.migrateUsers()
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.recountUsages()
+    if err != nil {
+        return dserr.Err(err)
+    }
     users, err := store.reg.ListUsers()
     if err != nil {
         return dserr.Err(err)
@@ -30,7 +38,7 @@ func (store *Store) SeedUsers() error {
         var user *dsdescr.User
         user = dsdescr.NewUser()
         user.Login  = defaultAUser
-        user.Pass   = defaultAPass
+        setUserPass(user, defaultAPass)
         user.State  = dsdescr.UStateEnabled
         user.Role   = dsdescr.URoleAdmin
         user.CreatedAt = time.Now().Unix()
@@ -42,7 +50,7 @@ func (store *Store) SeedUsers() error {
         }
         user = dsdescr.NewUser()
         user.Login  = defaultUser
-        user.Pass   = defaultPass
+        setUserPass(user, defaultPass)
         user.State  = dsdescr.UStateEnabled
         user.Role   = dsdescr.URoleUser
         user.CreatedAt = time.Now().Unix()
@@ -63,7 +71,7 @@ func (store *Store) AddUser(authLogin string, user *dsdescr.User) error {
 
     role, err := store.getUserRole(authLogin)
     if role != dsdescr.URoleAdmin {
-        err = fmt.Errorf("insufficient rights for %s", authLogin)
+        err = dserr.NewAccessError("insufficient rights for %s", authLogin)
         return dserr.Err(err)
     }
     ok, err = validateLogin(user.Login)
@@ -80,15 +88,18 @@ func (store *Store) AddUser(authLogin string, user *dsdescr.User) error {
         return dserr.Err(err)
     }
     if has {
-        err = fmt.Errorf("login %s exist", user.Login)
-
+        err = dserr.NewExistsError("login %s exist", user.Login)
+        return dserr.Err(err)
     }
-    user.State  = dsdescr.UStateEnabled
-    user.Role   = dsdescr.URoleUser
-    user.CreatedAt = time.Now().Unix()
-    user.UpdatedAt = user.CreatedAt
+    newUser := dsdescr.NewUser()
+    *newUser = *user
+    setUserPass(newUser, user.Pass)
+    newUser.State  = dsdescr.UStateEnabled
+    newUser.Role   = dsdescr.URoleUser
+    newUser.CreatedAt = time.Now().Unix()
+    newUser.UpdatedAt = newUser.CreatedAt
 
-    err = store.reg.PutUser(user)
+    err = store.reg.PutUser(newUser)
     if err != nil {
         return dserr.Err(err)
     }
@@ -121,7 +132,7 @@ func (store *Store) CheckUser(authLogin, login, passw string) (bool, error) {
     }
     userRole, err := store.getUserRole(authLogin)
     if authLogin != login && userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return ok, dserr.Err(err)
     }
     has, err := store.reg.HasUser(login)
@@ -129,15 +140,13 @@ func (store *Store) CheckUser(authLogin, login, passw string) (bool, error) {
         return ok, dserr.Err(err)
     }
     if !has {
-        err = fmt.Errorf("user %s not exist", login)
+        err = dserr.NewNotFoundError("user %s not exist", login)
     }
     user, err := store.reg.GetUser(login)
     if err != nil {
         return ok, dserr.Err(err)
     }
-    if passw == user.Pass {
-        ok = true
-    }
+    ok = checkUserPass(user, passw)
     return ok, dserr.Err(err)
 }
 
@@ -154,7 +163,7 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     }
     // Rigth control
     if  authLogin != user.Login && userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return dserr.Err(err)
     }
 
@@ -165,15 +174,21 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     }
     newUser := dsdescr.NewUser()
     newUser.Login       = oldUser.Login
-    newUser.Pass        = oldUser.Pass
+    newUser.PassSalt    = oldUser.PassSalt
+    newUser.PassIter    = oldUser.PassIter
+    newUser.PassKey     = oldUser.PassKey
     newUser.Role        = oldUser.Role
     newUser.State       = oldUser.State
+    newUser.KeepVers    = oldUser.KeepVers
+    newUser.QuotaSize   = oldUser.QuotaSize
+    newUser.QuotaFiles  = oldUser.QuotaFiles
+    newUser.Groups      = oldUser.Groups
     newUser.CreatedAt   = oldUser.CreatedAt
     newUser.UpdatedAt   = time.Now().Unix()
 
     // Update property if exists
     if len(user.Pass) > 0 {
-        newUser.Pass = user.Pass
+        setUserPass(newUser, user.Pass)
     }
     if len(user.Role) > 0 {
         newUser.Role = user.Role
@@ -181,13 +196,23 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     if len(user.State) > 0 {
         newUser.State = user.State
     }
+    if user.KeepVers != 0 {
+        newUser.KeepVers = user.KeepVers
+    }
+    if user.Groups != nil {
+        if userRole != dsdescr.URoleAdmin {
+            err = dserr.NewAccessError("insufficient rights for changing groups")
+            return dserr.Err(err)
+        }
+        newUser.Groups = user.Groups
+    }
     // Rigth control
     if newUser.Role != oldUser.Role && userRole != dsdescr.URoleAdmin {
-        err = errors.New("insufficient rights for changing role")
+        err = dserr.NewAccessError("insufficient rights for changing role")
         return dserr.Err(err)
     }
     if newUser.State != oldUser.State && userRole != dsdescr.URoleAdmin {
-        err = errors.New("insufficient rights for changing state")
+        err = dserr.NewAccessError("insufficient rights for changing state")
         return dserr.Err(err)
     }
 
@@ -201,9 +226,11 @@ func (store *Store) UpdateUser(authLogin string, user *dsdescr.User) error {
     if !ok {
         return dserr.Err(err)
     }
-    ok, err = validatePass(newUser.Pass)
-    if !ok {
-        return dserr.Err(err)
+    if len(user.Pass) > 0 || len(newUser.PassKey) == 0 {
+        ok, err = validatePass(user.Pass)
+        if !ok {
+            return dserr.Err(err)
+        }
     }
     // Delete old user descr
     err = store.reg.DeleteUser(user.Login)
@@ -224,7 +251,7 @@ func (store *Store) ListUsers(authLogin, regular string) ([]*dsdescr.User, error
     resDescrs := make([]*dsdescr.User, 0)
     userRole, err := store.getUserRole(authLogin)
     if userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return resDescrs, dserr.Err(err)
     }
 
@@ -233,7 +260,9 @@ func (store *Store) ListUsers(authLogin, regular string) ([]*dsdescr.User, error
         return resDescrs, dserr.Err(err)
     }
     if len(regular) == 0 {
-        resDescrs = descrs
+        for _, descr := range descrs {
+            resDescrs = append(resDescrs, stripUser(descr))
+        }
         return resDescrs, dserr.Err(err)
     }
     re, err := regexp.CompilePOSIX(regular)
@@ -243,7 +272,7 @@ func (store *Store) ListUsers(authLogin, regular string) ([]*dsdescr.User, error
     for _, descr := range descrs {
         ok := re.Match([]byte(descr.Login))
         if ok {
-            resDescrs = append(resDescrs, descr)
+            resDescrs = append(resDescrs, stripUser(descr))
         }
     }
     return resDescrs, dserr.Err(err)
@@ -254,7 +283,7 @@ func (store *Store) DeleteUser(authLogin string, login string) error {
 
     userRole, err := store.getUserRole(authLogin)
     if authLogin != login && userRole != dsdescr.URoleAdmin {
-        err = fmt.Errorf("user %s have insufficient rights", authLogin)
+        err = dserr.NewAccessError("user %s have insufficient rights", authLogin)
         return dserr.Err(err)
     }
 
@@ -268,6 +297,18 @@ func (store *Store) DeleteUser(authLogin string, login string) error {
     if err != nil {
         return dserr.Err(err)
     }
+    err = store.revokeUserKeys(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.reg.DeleteUsage(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    err = store.revokeUserGrants(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
     return dserr.Err(err)
 }
 
@@ -276,7 +317,7 @@ func (store *Store) getUserRole(authLogin string) (string, error) {
     var userRole string
     has, err := store.reg.HasUser(authLogin)
     if !has {
-        err = fmt.Errorf("user %s not exists", authLogin)
+        err = dserr.NewNotFoundError("user %s not exists", authLogin)
         return userRole, dserr.Err(err)
     }
     user, err := store.reg.GetUser(authLogin)
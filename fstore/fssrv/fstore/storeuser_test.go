@@ -10,6 +10,7 @@ import (
 
     "dstore/dscomm/dskvdb"
     "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
     "dstore/fstore/fssrv/fsreg"
 )
 
@@ -45,10 +46,20 @@ func TestUser01(t *testing.T) {
     err = store.AddUser(adminLogin, descr0)
     require.NoError(t, err)
 
+    // Existing login is not overwritten
+    dupDescr := dsdescr.NewUser()
+    dupDescr.Login  = descr0.Login
+    dupDescr.Pass   = "654321"
+    err = store.AddUser(adminLogin, dupDescr)
+    require.True(t, dserr.IsExists(err))
+
     has, descr1, err := store.GetUser(descr0.Login)
     require.NoError(t, err)
     require.Equal(t, has, true)
-    require.Equal(t, descr0, descr1)
+    require.Equal(t, descr0.Login, descr1.Login)
+    require.Equal(t, dsdescr.URoleUser, descr1.Role)
+    require.Equal(t, "", descr1.Pass)
+    require.NotEmpty(t, descr1.PassKey)
 
     var ok bool
     ok, err = store.CheckUser(adminLogin, descr0.Login, descr0.Pass)
@@ -74,4 +85,7 @@ func TestUser01(t *testing.T) {
     descrs, err := store.ListUsers(adminLogin, "")
     require.NoError(t, err)
     require.Equal(t, len(descrs), 2)
+    for _, descr := range descrs {
+        require.Empty(t, descr.PassKey)
+    }
 }
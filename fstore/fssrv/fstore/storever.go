@@ -0,0 +1,168 @@
+/*
+ * Copyright 2022 Oleg Borodin  <borodin@unix7.org>
+ */
+
+package fstore
+
+import (
+    "strconv"
+    "strings"
+
+    "dstore/dscomm/dsdescr"
+    "dstore/dscomm/dserr"
+)
+
+// SetKeepVersions sets default count of previous file versions
+func (store *Store) SetKeepVersions(keepVers int64) {
+    store.keepVers = keepVers
+}
+
+func (store *Store) ListVersions(login string, filePath string) ([]*dsdescr.File, error) {
+    var err error
+    filePath = cleanPath(filePath)
+    descrs, err := store.reg.ListVersions(login, filePath)
+    if err != nil {
+        return descrs, dserr.Err(err)
+    }
+    return descrs, dserr.Err(err)
+}
+
+// RestoreVersion makes the version current, current file becomes previous version
+func (store *Store) RestoreVersion(login string, filePath string, fileVer int64) (*dsdescr.File, error) {
+    var err error
+    var descr *dsdescr.File
+    filePath = cleanPath(filePath)
+
+    store.refMtx.Lock()
+    has, err := store.reg.HasVersion(login, filePath, fileVer)
+    if err != nil {
+        store.refMtx.Unlock()
+        return descr, dserr.Err(err)
+    }
+    if !has {
+        store.refMtx.Unlock()
+        err = dserr.NewNotFoundError("file %s version %d not exist", filePath, fileVer)
+        return descr, dserr.Err(err)
+    }
+    descr, err = store.reg.GetVersion(login, filePath, fileVer)
+    if err != nil {
+        store.refMtx.Unlock()
+        return descr, dserr.Err(err)
+    }
+    has, err = store.reg.HasFile(login, filePath)
+    if err != nil {
+        store.refMtx.Unlock()
+        return descr, dserr.Err(err)
+    }
+    if has {
+        curDescr, err := store.reg.GetFile(login, filePath)
+        if err != nil {
+            store.refMtx.Unlock()
+            return descr, dserr.Err(err)
+        }
+        err = store.reg.PutVersion(curDescr)
+        if err != nil {
+            store.refMtx.Unlock()
+            return descr, dserr.Err(err)
+        }
+        descr.FileVer = curDescr.FileVer + 1
+    }
+    err = store.reg.PutFile(descr)
+    if err != nil {
+        store.refMtx.Unlock()
+        return descr, dserr.Err(err)
+    }
+    err = store.reg.DeleteVersion(login, filePath, fileVer)
+    store.refMtx.Unlock()
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    err = store.pruneVersions(login, filePath)
+    if err != nil {
+        return descr, dserr.Err(err)
+    }
+    return descr, dserr.Err(err)
+}
+
+// pruneVersions drops the oldest versions over the user retention count
+func (store *Store) pruneVersions(login string, filePath string) error {
+    var err error
+    keepVers, err := store.keepVersions(login)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    descrs, err := store.reg.ListVersions(login, filePath)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for i := 0; int64(len(descrs) - i) > keepVers; i++ {
+        descr := descrs[i]
+        err = store.reg.DeleteVersion(login, filePath, descr.FileVer)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        err = store.dropLater(descr)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+// dropVersions drops all previous versions of the file
+func (store *Store) dropVersions(login string, filePath string) error {
+    var err error
+    descrs, err := store.reg.ListVersions(login, filePath)
+    if err != nil {
+        return dserr.Err(err)
+    }
+    for _, descr := range descrs {
+        err = store.reg.DeleteVersion(login, filePath, descr.FileVer)
+        if err != nil {
+            return dserr.Err(err)
+        }
+        err = store.dropLater(descr)
+        if err != nil {
+            return dserr.Err(err)
+        }
+    }
+    return dserr.Err(err)
+}
+
+// keepVersions returns count of kept versions for the user,
+// zero user value means store default, negative one disables versions
+func (store *Store) keepVersions(login string) (int64, error) {
+    var err error
+    keepVers := store.keepVers
+    has, err := store.reg.HasUser(login)
+    if err != nil {
+        return keepVers, dserr.Err(err)
+    }
+    if !has {
+        return keepVers, dserr.Err(err)
+    }
+    user, err := store.reg.GetUser(login)
+    if err != nil {
+        return keepVers, dserr.Err(err)
+    }
+    switch {
+        case user.KeepVers > 0:
+            keepVers = user.KeepVers
+        case user.KeepVers < 0:
+            keepVers = 0
+    }
+    return keepVers, dserr.Err(err)
+}
+
+// splitVersion splits path@version file name
+func splitVersion(filePath string) (string, int64, bool) {
+    i := strings.LastIndex(filePath, "@")
+    if i < 0 {
+        return filePath, 0, false
+    }
+    fileVer, err := strconv.ParseInt(filePath[i + 1:], 10, 64)
+    if err != nil || fileVer < 1 {
+        return filePath, 0, false
+    }
+    return filePath[0:i], fileVer, true
+}
@@ -1,6 +1,6 @@
 module dstore
 
-go 1.17
+go 1.18
 
 require (
 	github.com/ganbarodigital/go_glob v1.0.0